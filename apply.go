@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/text/language"
+
+	"github.com/biliqiqi/baklab-setup/internal/dirlock"
+	"github.com/biliqiqi/baklab-setup/internal/i18n"
+	"github.com/biliqiqi/baklab-setup/internal/services"
+	"github.com/biliqiqi/baklab-setup/internal/storage"
+	"github.com/biliqiqi/baklab-setup/internal/utils"
+)
+
+var errValidationFailed = errors.New("configuration validation failed")
+
+// runApplyCommand generates a deployment from a config.json and a secrets
+// file without starting the setup server. Validation errors are written to
+// stdout as JSON so provisioning tools can consume them.
+func runApplyCommand(args []string) error {
+	applyFlags := flag.NewFlagSet("apply", flag.ExitOnError)
+	configPath := applyFlags.String("config", "", "Path to config.json (required)")
+	secretsPath := applyFlags.String("secrets", "", "Env-style file with passwords and secrets, using the same variable names as the generated .env")
+	outputPath := applyFlags.String("output", defaultOutputDir, "Directory for generated files")
+	dataPath := applyFlags.String("data", "./data", "Directory to store setup data")
+	devFlag := applyFlags.Bool("dev", false, "Generate a development deployment")
+	storageType := applyFlags.String("storage", storage.BackendJSON, "Setup data storage backend: 'json', 'memory' or 'bolt'")
+	keepBackups := applyFlags.Int("backup-retention", services.DefaultBackupRetention, "Number of output directory backups to keep")
+	keyFile := applyFlags.String("storage-key-file", "", "File holding the passphrase that encrypts setup data at rest (json storage only, or set BAKLAB_STORAGE_KEY)")
+	templatesPath := applyFlags.String("templates-dir", "", "Directory of template overrides layered over the built-in templates")
+	secretsModeFlag := applyFlags.String("secrets-mode", "", "Override how secrets are written: 'env' for the .env file, 'docker' for Docker secrets files or 'age' for an age-encrypted file")
+	recipientsFlag := applyFlags.String("age-recipients", "", "Comma-separated age1... public keys to encrypt secrets to in age mode")
+
+	if err := applyFlags.Parse(args); err != nil {
+		return err
+	}
+
+	if *configPath == "" {
+		return fmt.Errorf("-config flag is required")
+	}
+	if err := validateSecretsMode(*secretsModeFlag); err != nil {
+		return err
+	}
+
+	cfg, err := loadConfigFile(*configPath)
+	if err != nil {
+		return err
+	}
+
+	absOutputDir, err := filepath.Abs(*outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path for output: %w", err)
+	}
+
+	dataLock, err := dirlock.Acquire(*dataPath)
+	if err != nil {
+		return fmt.Errorf("failed to lock data directory: %w", err)
+	}
+	defer utils.Close(dataLock, "data directory lock")
+
+	setupStorage, err := openSetupStorage(*storageType, *dataPath, *keyFile, false)
+	if err != nil {
+		return fmt.Errorf("failed to open setup storage: %w", err)
+	}
+	defer utils.Close(setupStorage, "setup storage")
+
+	setupService := services.NewSetupService(setupStorage)
+	setupService.SetTemplatesFS(templatesFS)
+	setupService.SetDevelopmentMode(resolveDevMode(*devFlag))
+	setupService.SetBackupRetention(*keepBackups)
+	setupService.SetOutputDir(absOutputDir)
+	if *templatesPath != "" {
+		if err := setupService.SetTemplatesDir(*templatesPath); err != nil {
+			return fmt.Errorf("failed to load templates: %w", err)
+		}
+	}
+
+	if *secretsPath != "" {
+		if err := setupService.LoadSecretsFile(cfg, *secretsPath); err != nil {
+			return err
+		}
+	}
+
+	if *secretsModeFlag != "" {
+		cfg.Output.SecretsMode = *secretsModeFlag
+	}
+	if *recipientsFlag != "" {
+		cfg.Output.AgeRecipients = parseList(*recipientsFlag)
+	}
+
+	setupService.PrepareConfiguration(cfg)
+
+	validator := services.NewValidatorService()
+	if validationErrors := validator.ValidateAll(cfg); len(validationErrors) > 0 {
+		localizer := i18n.NewI18nManager(language.English).GetLocalizer(language.English)
+		localizeReport(localizer, validationErrors, nil)
+		if err := writeJSONReport(os.Stdout, errValidationFailed.Error(), validationErrors, nil); err != nil {
+			log.Printf("Warning: failed to write validation report: %v", err)
+		}
+		return fmt.Errorf("%w: %d errors", errValidationFailed, len(validationErrors))
+	}
+
+	log.Printf("Generating configuration files into: %s", absOutputDir)
+	if err := setupService.GenerateConfigFiles(cfg); err != nil {
+		return fmt.Errorf("failed to generate config files: %w", err)
+	}
+
+	log.Printf("Configuration applied successfully: %s", absOutputDir)
+	return nil
+}
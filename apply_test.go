@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const applyTestConfig = `{
+  "database": {"service_type": "docker", "host": "localhost", "port": 5432, "name": "baklab", "super_user": "postgres", "app_user": "baklab"},
+  "redis": {"service_type": "docker", "host": "localhost", "port": 6379, "user": "baklab"},
+  "smtp": {"server": "smtp.example.com", "port": 587, "user": "mailer", "sender": "noreply@example.com"},
+  "app": {"domain_name": "example.com", "brand_name": "BakLab", "default_lang": "en"},
+  "admin_user": {"username": "admin", "email": "admin@example.com"}
+}`
+
+const applyTestSecrets = `PG_PASSWORD=PostgresSuper123!
+APP_DB_PASSWORD=AppDbPass123!
+REDIS_PASSWORD=RedisPass123!
+REDISCLI_AUTH=RedisAdmin123!
+SMTP_PASSWORD=MailPass123!
+SUPER_PASSWORD=AdminPassword123!
+`
+
+func writeApplyInputs(t *testing.T, config, secrets string) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.json")
+	secretsPath := filepath.Join(dir, "secrets.env")
+	if err := os.WriteFile(configPath, []byte(config), 0600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	if err := os.WriteFile(secretsPath, []byte(secrets), 0600); err != nil {
+		t.Fatalf("Failed to write secrets file: %v", err)
+	}
+	return configPath, secretsPath
+}
+
+func TestApplyCommandGeneratesDeployment(t *testing.T) {
+	configPath, secretsPath := writeApplyInputs(t, applyTestConfig, applyTestSecrets)
+	outputDir := filepath.Join(t.TempDir(), "output")
+
+	err := runApplyCommand([]string{
+		"-dev",
+		"-config", configPath,
+		"-secrets", secretsPath,
+		"-output", outputDir,
+		"-data", t.TempDir(),
+	})
+	if err != nil {
+		t.Fatalf("runApplyCommand() failed: %v", err)
+	}
+
+	env, err := os.ReadFile(filepath.Join(outputDir, ".env.development"))
+	if err != nil {
+		t.Fatalf("Failed to read generated .env file: %v", err)
+	}
+	if !strings.Contains(string(env), "AppDbPass123!") {
+		t.Error("generated .env file does not contain the app database password from the secrets file")
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "docker-compose.development.yml")); err != nil {
+		t.Errorf("docker compose file was not generated: %v", err)
+	}
+}
+
+func TestApplyCommandRejectsInvalidConfig(t *testing.T) {
+	config := strings.Replace(applyTestConfig, `"email": "admin@example.com"`, `"email": "not-an-email"`, 1)
+	configPath, secretsPath := writeApplyInputs(t, config, applyTestSecrets)
+	outputDir := filepath.Join(t.TempDir(), "output")
+
+	err := runApplyCommand([]string{
+		"-dev",
+		"-config", configPath,
+		"-secrets", secretsPath,
+		"-output", outputDir,
+		"-data", t.TempDir(),
+	})
+	if !errors.Is(err, errValidationFailed) {
+		t.Fatalf("runApplyCommand() error = %v, want %v", err, errValidationFailed)
+	}
+	if _, err := os.Stat(outputDir); !os.IsNotExist(err) {
+		t.Errorf("output directory exists after a validation failure: %v", err)
+	}
+}
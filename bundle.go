@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/term"
+
+	"github.com/biliqiqi/baklab-setup/internal/dirlock"
+	"github.com/biliqiqi/baklab-setup/internal/services"
+	"github.com/biliqiqi/baklab-setup/internal/storage"
+	"github.com/biliqiqi/baklab-setup/internal/utils"
+)
+
+const bundlePassphraseEnv = "BAKLAB_BUNDLE_PASSPHRASE"
+
+// runExportBundleCommand packs a deployment into an encrypted migration
+// bundle for import-bundle on another host.
+func runExportBundleCommand(args []string) error {
+	exportFlags := flag.NewFlagSet("export-bundle", flag.ExitOnError)
+	outputPath := exportFlags.String("output", defaultOutputDir, "Deployment directory to export")
+	bundlePath := exportFlags.String("bundle", "", "Path of the bundle file to create (required)")
+	passphraseFile := exportFlags.String("passphrase-file", "", "File holding the bundle passphrase (or set BAKLAB_BUNDLE_PASSPHRASE)")
+	identityPath := exportFlags.String("age-identity", "", "age identity file that decrypts the secrets of an age mode deployment")
+
+	if err := exportFlags.Parse(args); err != nil {
+		return err
+	}
+
+	if *bundlePath == "" {
+		return fmt.Errorf("-bundle flag is required")
+	}
+
+	absOutputDir, err := filepath.Abs(*outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path for output: %w", err)
+	}
+
+	setupService := services.NewSetupService(storage.NewMemoryStorage())
+	if *identityPath != "" {
+		identities, err := services.ReadAgeIdentityFile(*identityPath)
+		if err != nil {
+			return err
+		}
+		setupService.SetAgeIdentities(identities)
+	}
+
+	passphrase, err := resolveBundlePassphrase(*passphraseFile, true)
+	if err != nil {
+		return err
+	}
+
+	bundle, manifest, err := setupService.ExportBundle(absOutputDir, passphrase)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(*bundlePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create bundle file: %w", err)
+	}
+	defer utils.Close(file, "bundle file: "+*bundlePath)
+
+	if _, err := file.Write(bundle); err != nil {
+		return fmt.Errorf("failed to write bundle file: %w", err)
+	}
+
+	for _, f := range manifest.Files {
+		log.Printf("  %s (%d bytes)", f.Path, f.Size)
+	}
+	log.Printf("Exported %d files to bundle: %s", len(manifest.Files), *bundlePath)
+	return nil
+}
+
+// runImportBundleCommand verifies a migration bundle and generates the
+// deployment it holds into a new output directory.
+func runImportBundleCommand(args []string) error {
+	importFlags := flag.NewFlagSet("import-bundle", flag.ExitOnError)
+	bundlePath := importFlags.String("bundle", "", "Path of the bundle file to import (required)")
+	outputPath := importFlags.String("output", defaultOutputDir, "New or empty directory for the generated deployment")
+	passphraseFile := importFlags.String("passphrase-file", "", "File holding the bundle passphrase (or set BAKLAB_BUNDLE_PASSPHRASE)")
+	dataPath := importFlags.String("data", "./data", "Directory to store setup data")
+	storageType := importFlags.String("storage", storage.BackendJSON, "Setup data storage backend: 'json', 'memory' or 'bolt'")
+	keyFile := importFlags.String("storage-key-file", "", "File holding the passphrase that encrypts setup data at rest (json storage only, or set BAKLAB_STORAGE_KEY)")
+	templatesPath := importFlags.String("templates-dir", "", "Directory of template overrides layered over the built-in templates")
+
+	if err := importFlags.Parse(args); err != nil {
+		return err
+	}
+
+	if *bundlePath == "" {
+		return fmt.Errorf("-bundle flag is required")
+	}
+
+	bundle, err := os.ReadFile(*bundlePath)
+	if err != nil {
+		return fmt.Errorf("failed to read bundle file: %w", err)
+	}
+
+	absOutputDir, err := filepath.Abs(*outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path for output: %w", err)
+	}
+
+	passphrase, err := resolveBundlePassphrase(*passphraseFile, false)
+	if err != nil {
+		return err
+	}
+
+	dataLock, err := dirlock.Acquire(*dataPath)
+	if err != nil {
+		return fmt.Errorf("failed to lock data directory: %w", err)
+	}
+	defer utils.Close(dataLock, "data directory lock")
+
+	setupStorage, err := openSetupStorage(*storageType, *dataPath, *keyFile, false)
+	if err != nil {
+		return fmt.Errorf("failed to open setup storage: %w", err)
+	}
+	defer utils.Close(setupStorage, "setup storage")
+
+	setupService := services.NewSetupService(setupStorage)
+	setupService.SetTemplatesFS(templatesFS)
+	setupService.SetOutputDir(absOutputDir)
+	if *templatesPath != "" {
+		if err := setupService.SetTemplatesDir(*templatesPath); err != nil {
+			return fmt.Errorf("failed to load templates: %w", err)
+		}
+	}
+
+	cfg, err := setupService.ImportBundle(bundle, passphrase)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Imported bundle for %s into: %s", cfg.App.DomainName, absOutputDir)
+	return nil
+}
+
+// resolveBundlePassphrase reads the bundle passphrase from passphraseFile,
+// BAKLAB_BUNDLE_PASSPHRASE or the terminal, where confirm asks for it twice.
+func resolveBundlePassphrase(passphraseFile string, confirm bool) ([]byte, error) {
+	if passphraseFile != "" {
+		data, err := os.ReadFile(passphraseFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read passphrase file: %w", err)
+		}
+		passphrase := bytes.TrimSpace(data)
+		if len(passphrase) == 0 {
+			return nil, fmt.Errorf("passphrase file is empty: %s", passphraseFile)
+		}
+		return passphrase, nil
+	}
+
+	if envPassphrase := os.Getenv(bundlePassphraseEnv); envPassphrase != "" {
+		return []byte(envPassphrase), nil
+	}
+
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return nil, fmt.Errorf("no bundle passphrase given; use -passphrase-file or %s", bundlePassphraseEnv)
+	}
+
+	fmt.Fprint(os.Stderr, "Bundle passphrase: ")
+	passphrase, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bundle passphrase: %w", err)
+	}
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("bundle passphrase is empty")
+	}
+
+	if confirm {
+		fmt.Fprint(os.Stderr, "Confirm bundle passphrase: ")
+		again, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read bundle passphrase: %w", err)
+		}
+		if !bytes.Equal(passphrase, again) {
+			return nil, fmt.Errorf("bundle passphrases do not match")
+		}
+	}
+
+	return passphrase, nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"path/filepath"
+
+	"github.com/biliqiqi/baklab-setup/internal/services"
+)
+
+// runDecryptEnvCommand writes the complete .env file of an age mode
+// deployment on the host that holds the identity.
+func runDecryptEnvCommand(args []string) error {
+	decryptFlags := flag.NewFlagSet("decrypt-env", flag.ExitOnError)
+	outputPath := decryptFlags.String("output", defaultOutputDir, "Deployment directory holding the age-encrypted .env file")
+	identityPath := decryptFlags.String("identity", "", "age identity file, as written by age-keygen (required)")
+
+	if err := decryptFlags.Parse(args); err != nil {
+		return err
+	}
+
+	if *identityPath == "" {
+		return fmt.Errorf("-identity flag is required")
+	}
+
+	absOutputDir, err := filepath.Abs(*outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path for output: %w", err)
+	}
+
+	identities, err := services.ReadAgeIdentityFile(*identityPath)
+	if err != nil {
+		return err
+	}
+
+	envPath, err := services.DecryptEnvFile(absOutputDir, identities)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Wrote decrypted environment to: %s", envPath)
+	return nil
+}
@@ -0,0 +1,196 @@
+// Package age encrypts and decrypts files in the age format
+// (age-encryption.org/v1) for X25519 recipients and passphrases, using the
+// reference implementation filippo.io/age. Keys are the age1... and
+// AGE-SECRET-KEY-1... strings that age-keygen prints and that SOPS uses for
+// its age backend.
+package age
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	fage "filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// maxScryptWorkFactor is the largest work factor EncryptWithPassphrase
+// accepts, the same limit age applies when decrypting.
+const maxScryptWorkFactor = 22
+
+// ErrNoMatchingIdentity is returned by Decrypt when none of the identities
+// is a recipient of the file.
+var ErrNoMatchingIdentity = errors.New("no identity matched any of the file's recipients")
+
+// ErrIncorrectPassphrase is returned by DecryptWithPassphrase when the
+// passphrase does not decrypt the file.
+var ErrIncorrectPassphrase = errors.New("incorrect passphrase")
+
+// Recipient is an X25519 public key that files are encrypted to.
+type Recipient = fage.X25519Recipient
+
+// Identity is an X25519 secret key that decrypts files encrypted to its
+// Recipient.
+type Identity = fage.X25519Identity
+
+// ParseRecipient parses an age1... recipient.
+func ParseRecipient(s string) (*Recipient, error) {
+	r, err := fage.ParseX25519Recipient(s)
+	if err != nil {
+		return nil, fmt.Errorf("malformed recipient %q: %w", s, err)
+	}
+	return r, nil
+}
+
+// GenerateIdentity creates a random identity.
+func GenerateIdentity() (*Identity, error) {
+	identity, err := fage.GenerateX25519Identity()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate identity: %w", err)
+	}
+	return identity, nil
+}
+
+// ParseIdentity parses an AGE-SECRET-KEY-1... identity.
+func ParseIdentity(s string) (*Identity, error) {
+	identity, err := fage.ParseX25519Identity(s)
+	if err != nil {
+		return nil, fmt.Errorf("malformed identity: %w", err)
+	}
+	return identity, nil
+}
+
+// ParseIdentities reads an identity file as written by age-keygen: one
+// identity per line, with blank lines and # comments ignored.
+func ParseIdentities(r io.Reader) ([]*Identity, error) {
+	var identities []*Identity
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		identity, err := ParseIdentity(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		identities = append(identities, identity)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read identities: %w", err)
+	}
+	if len(identities) == 0 {
+		return nil, fmt.Errorf("no identities found")
+	}
+	return identities, nil
+}
+
+// Encrypt encrypts plaintext to every recipient and returns the file in the
+// ASCII armored form, which keeps it readable in diffs and text editors.
+func Encrypt(plaintext []byte, recipients ...*Recipient) ([]byte, error) {
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("no recipients")
+	}
+
+	ageRecipients := make([]fage.Recipient, 0, len(recipients))
+	for _, r := range recipients {
+		ageRecipients = append(ageRecipients, r)
+	}
+
+	var buf bytes.Buffer
+	armored := armor.NewWriter(&buf)
+	if err := encrypt(armored, plaintext, ageRecipients...); err != nil {
+		return nil, err
+	}
+	if err := armored.Close(); err != nil {
+		return nil, fmt.Errorf("failed to armor encrypted file: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// EncryptWithPassphrase encrypts plaintext with a passphrase, stretched with
+// scrypt at 2^workFactor iterations. It returns the binary file, meant for
+// archives that are not read as text anyway.
+func EncryptWithPassphrase(plaintext, passphrase []byte, workFactor int) ([]byte, error) {
+	if workFactor < 1 || workFactor > maxScryptWorkFactor {
+		return nil, fmt.Errorf("invalid scrypt work factor %d", workFactor)
+	}
+
+	recipient, err := fage.NewScryptRecipient(string(passphrase))
+	if err != nil {
+		return nil, err
+	}
+	recipient.SetWorkFactor(workFactor)
+
+	var buf bytes.Buffer
+	if err := encrypt(&buf, plaintext, recipient); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func encrypt(dst io.Writer, plaintext []byte, recipients ...fage.Recipient) error {
+	w, err := fage.Encrypt(dst, recipients...)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt: %w", err)
+	}
+	if _, err := w.Write(plaintext); err != nil {
+		return fmt.Errorf("failed to encrypt: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to encrypt: %w", err)
+	}
+	return nil
+}
+
+// Decrypt decrypts an armored or binary age file with the first identity
+// that is one of its recipients.
+func Decrypt(data []byte, identities ...*Identity) ([]byte, error) {
+	ageIdentities := make([]fage.Identity, 0, len(identities))
+	for _, identity := range identities {
+		ageIdentities = append(ageIdentities, identity)
+	}
+
+	plaintext, err := decrypt(data, ageIdentities...)
+	var noMatch *fage.NoIdentityMatchError
+	if errors.As(err, &noMatch) {
+		return nil, ErrNoMatchingIdentity
+	}
+	return plaintext, err
+}
+
+// DecryptWithPassphrase decrypts an armored or binary age file that was
+// encrypted with a passphrase.
+func DecryptWithPassphrase(data, passphrase []byte) ([]byte, error) {
+	identity, err := fage.NewScryptIdentity(string(passphrase))
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := decrypt(data, identity)
+	var noMatch *fage.NoIdentityMatchError
+	if errors.As(err, &noMatch) {
+		return nil, ErrIncorrectPassphrase
+	}
+	return plaintext, err
+}
+
+func decrypt(data []byte, identities ...fage.Identity) ([]byte, error) {
+	var src io.Reader = bytes.NewReader(data)
+	if bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), []byte(armor.Header)) {
+		src = armor.NewReader(src)
+	}
+
+	r, err := fage.Decrypt(src, identities...)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt payload: %w", err)
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,198 @@
+package age
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age/armor"
+)
+
+func TestParseRecipient(t *testing.T) {
+	// The example recipient from the age documentation.
+	const s = "age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p"
+	r, err := ParseRecipient(s)
+	if err != nil {
+		t.Fatalf("ParseRecipient() failed: %v", err)
+	}
+	if r.String() != s {
+		t.Errorf("String() = %q, want %q", r.String(), s)
+	}
+
+	for _, invalid := range []string{"", "age1", s[:len(s)-1] + "q", strings.ToUpper(s[:10]) + s[10:]} {
+		if _, err := ParseRecipient(invalid); err == nil {
+			t.Errorf("ParseRecipient(%q) succeeded, want error", invalid)
+		}
+	}
+}
+
+func TestParseIdentities(t *testing.T) {
+	identity, err := GenerateIdentity()
+	if err != nil {
+		t.Fatalf("GenerateIdentity() failed: %v", err)
+	}
+
+	file := "# created: 2024-01-01T00:00:00Z\n# public key: " + identity.Recipient().String() + "\n" + identity.String() + "\n\n"
+	identities, err := ParseIdentities(strings.NewReader(file))
+	if err != nil {
+		t.Fatalf("ParseIdentities() failed: %v", err)
+	}
+	if len(identities) != 1 || identities[0].Recipient().String() != identity.Recipient().String() {
+		t.Fatalf("ParseIdentities() = %v, want the generated identity", identities)
+	}
+
+	if _, err := ParseIdentities(strings.NewReader("# nothing here\n")); err == nil {
+		t.Error("ParseIdentities() accepted a file without identities")
+	}
+}
+
+// TestDecryptAgeFile decrypts the example file of the age project, which was
+// written by the age tool.
+func TestDecryptAgeFile(t *testing.T) {
+	keys, err := os.Open(filepath.Join("testdata", "example_keys.txt"))
+	if err != nil {
+		t.Fatalf("Failed to open identity file: %v", err)
+	}
+	defer keys.Close()
+
+	identities, err := ParseIdentities(keys)
+	if err != nil {
+		t.Fatalf("ParseIdentities() failed: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join("testdata", "example.age"))
+	if err != nil {
+		t.Fatalf("Failed to read age file: %v", err)
+	}
+
+	plaintext, err := Decrypt(data, identities...)
+	if err != nil {
+		t.Fatalf("Decrypt() failed: %v", err)
+	}
+	if string(plaintext) != "Black lives matter." {
+		t.Errorf("Decrypt() = %q", plaintext)
+	}
+}
+
+// TestVectors runs the age test vectors from c2sp.org/CCTV/age, kept in
+// testdata/testkit. Each vector is a header of "key: value" lines, a blank
+// line and an age file.
+func TestVectors(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "testkit", "*"))
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no test vectors found: %v", err)
+	}
+
+	for _, path := range paths {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			contents, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Failed to read vector: %v", err)
+			}
+			header, file, ok := bytes.Cut(contents, []byte("\n\n"))
+			if !ok {
+				t.Fatal("vector has no header")
+			}
+
+			var expect, payload, passphrase string
+			var identities []*Identity
+			scanner := bufio.NewScanner(bytes.NewReader(header))
+			for scanner.Scan() {
+				key, value, _ := strings.Cut(scanner.Text(), ": ")
+				switch key {
+				case "expect":
+					expect = value
+				case "payload":
+					payload = value
+				case "passphrase":
+					passphrase = value
+				case "identity":
+					identity, err := ParseIdentity(value)
+					if err != nil {
+						t.Fatalf("ParseIdentity() failed: %v", err)
+					}
+					identities = append(identities, identity)
+				}
+			}
+
+			var plaintext []byte
+			if passphrase != "" {
+				plaintext, err = DecryptWithPassphrase(file, []byte(passphrase))
+			} else {
+				plaintext, err = Decrypt(file, identities...)
+			}
+
+			if expect != "success" {
+				if err == nil {
+					t.Fatalf("decryption succeeded, want %s", expect)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decryption failed: %v", err)
+			}
+			if sum := sha256.Sum256(plaintext); hex.EncodeToString(sum[:]) != payload {
+				t.Errorf("payload hash = %x, want %s", sum, payload)
+			}
+		})
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	alice, _ := GenerateIdentity()
+	bob, _ := GenerateIdentity()
+	eve, _ := GenerateIdentity()
+
+	plaintext := bytes.Repeat([]byte("PG_PASSWORD=secret\n"), 5000)
+	encrypted, err := Encrypt(plaintext, alice.Recipient(), bob.Recipient())
+	if err != nil {
+		t.Fatalf("Encrypt() failed: %v", err)
+	}
+	if !bytes.HasPrefix(encrypted, []byte(armor.Header+"\n")) {
+		t.Errorf("Encrypt() output is not armored")
+	}
+
+	for _, identity := range []*Identity{alice, bob} {
+		decrypted, err := Decrypt(encrypted, eve, identity)
+		if err != nil {
+			t.Fatalf("Decrypt() failed: %v", err)
+		}
+		if !bytes.Equal(decrypted, plaintext) {
+			t.Errorf("Decrypt() returned %d bytes, want %d", len(decrypted), len(plaintext))
+		}
+	}
+
+	if _, err := Decrypt(encrypted, eve); !errors.Is(err, ErrNoMatchingIdentity) {
+		t.Errorf("Decrypt() with a foreign identity error = %v, want ErrNoMatchingIdentity", err)
+	}
+}
+
+func TestEncryptDecryptWithPassphrase(t *testing.T) {
+	plaintext := []byte("bundle contents")
+	encrypted, err := EncryptWithPassphrase(plaintext, []byte("correct horse"), 10)
+	if err != nil {
+		t.Fatalf("EncryptWithPassphrase() failed: %v", err)
+	}
+
+	decrypted, err := DecryptWithPassphrase(encrypted, []byte("correct horse"))
+	if err != nil {
+		t.Fatalf("DecryptWithPassphrase() failed: %v", err)
+	}
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Errorf("DecryptWithPassphrase() = %q, want %q", decrypted, plaintext)
+	}
+
+	if _, err := DecryptWithPassphrase(encrypted, []byte("wrong horse")); !errors.Is(err, ErrIncorrectPassphrase) {
+		t.Errorf("DecryptWithPassphrase() with a wrong passphrase error = %v, want ErrIncorrectPassphrase", err)
+	}
+
+	identity, _ := GenerateIdentity()
+	if _, err := Decrypt(encrypted, identity); err == nil {
+		t.Error("Decrypt() of a passphrase file with an identity succeeded")
+	}
+}
@@ -0,0 +1,106 @@
+// Package dirlock provides advisory inter-process locks on directories so
+// that two baklab-setup processes never work on the same data or output
+// directory at once.
+package dirlock
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FileName is the lock file created inside every locked directory.
+const FileName = ".baklab-setup.lock"
+
+// lockRetryInterval is how often AcquireNamed retries a held lock.
+const lockRetryInterval = 50 * time.Millisecond
+
+var ErrLocked = errors.New("directory locked")
+
+// Lock is an exclusive lock on a directory, held until Close is called.
+type Lock struct {
+	dir  string
+	file *os.File
+}
+
+// Acquire takes an exclusive lock on dir, creating the directory if needed.
+// It fails immediately with an error wrapping ErrLocked, and naming the PID
+// recorded by the holder, when another process already holds the lock.
+func Acquire(dir string) (*Lock, error) {
+	return acquire(dir, FileName)
+}
+
+// AcquireNamed takes an exclusive lock on the lock file name in dir rather
+// than FileName, for locks that are only held around a single change. It
+// waits up to timeout while another process holds the lock.
+func AcquireNamed(dir, name string, timeout time.Duration) (*Lock, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		lock, err := acquire(dir, name)
+		if !errors.Is(err, ErrLocked) || time.Now().After(deadline) {
+			return lock, err
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+func acquire(dir, name string) (*Lock, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory %s: %w", dir, err)
+	}
+
+	lockPath := filepath.Join(dir, name)
+	file, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	if err := lockFile(file); err != nil {
+		_ = file.Close()
+		if errors.Is(err, ErrLocked) {
+			return nil, fmt.Errorf("%s is in use by another baklab-setup process (%s): %w", dir, holderPID(lockPath), ErrLocked)
+		}
+		return nil, fmt.Errorf("failed to lock %s: %w", dir, err)
+	}
+
+	if err := file.Truncate(0); err == nil {
+		_, _ = file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+
+	return &Lock{dir: dir, file: file}, nil
+}
+
+// Close releases the lock. The lock file is left in place, since removing it
+// would race with a process that is just opening it.
+func (l *Lock) Close() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+
+	unlockErr := unlockFile(l.file)
+	closeErr := l.file.Close()
+	l.file = nil
+
+	if unlockErr != nil {
+		return fmt.Errorf("failed to unlock %s: %w", l.dir, unlockErr)
+	}
+	return closeErr
+}
+
+func holderPID(lockPath string) string {
+	data, err := os.ReadFile(lockPath)
+	if err != nil {
+		return "PID unknown"
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return "PID unknown"
+	}
+
+	return fmt.Sprintf("PID %d", pid)
+}
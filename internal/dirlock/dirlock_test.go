@@ -0,0 +1,68 @@
+package dirlock
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAcquireIsExclusive(t *testing.T) {
+	dir := t.TempDir()
+
+	lock, err := Acquire(dir)
+	if err != nil {
+		t.Fatalf("Acquire() failed: %v", err)
+	}
+
+	_, err = Acquire(dir)
+	if !errors.Is(err, ErrLocked) {
+		t.Fatalf("second Acquire() error = %v, want ErrLocked", err)
+	}
+	if want := fmt.Sprintf("PID %d", os.Getpid()); !strings.Contains(err.Error(), want) {
+		t.Errorf("second Acquire() error = %q, want it to name %q", err, want)
+	}
+
+	if err := lock.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+
+	relocked, err := Acquire(dir)
+	if err != nil {
+		t.Fatalf("Acquire() after Close() failed: %v", err)
+	}
+	if err := relocked.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+}
+
+func TestAcquireNamedWaitsForTheHolder(t *testing.T) {
+	dir := t.TempDir()
+	const name = ".tokens.lock"
+
+	dirLock, err := Acquire(dir)
+	if err != nil {
+		t.Fatalf("Acquire() failed: %v", err)
+	}
+	defer dirLock.Close()
+
+	lock, err := AcquireNamed(dir, name, time.Second)
+	if err != nil {
+		t.Fatalf("AcquireNamed() while the directory is locked failed: %v", err)
+	}
+
+	if _, err := AcquireNamed(dir, name, 100*time.Millisecond); !errors.Is(err, ErrLocked) {
+		t.Fatalf("AcquireNamed() of a held lock error = %v, want ErrLocked", err)
+	}
+
+	time.AfterFunc(100*time.Millisecond, func() { lock.Close() })
+	relocked, err := AcquireNamed(dir, name, 5*time.Second)
+	if err != nil {
+		t.Fatalf("AcquireNamed() after the holder released it failed: %v", err)
+	}
+	if err := relocked.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"strconv"
+	"strings"
 	"sync"
 	"text/template"
 
@@ -152,6 +153,16 @@ func (ic *I18nCustom) MustLocalize(id string, templateData any, pluralcount any)
 	return result
 }
 
+// LocalizeKeyed translates a message of the form "key:<message id>" as
+// produced by the services package. Other messages are returned unchanged.
+func (ic *I18nCustom) LocalizeKeyed(message string) string {
+	messageKey, ok := strings.CutPrefix(message, "key:")
+	if !ok {
+		return message
+	}
+	return ic.LocalTpl(messageKey)
+}
+
 func (ic *I18nCustom) SwitchLang(lang language.Tag) {
 	switch lang {
 	case language.Chinese:
@@ -27,9 +27,9 @@ type DatabaseConfig struct {
 	Port          int    `json:"port" validate:"required,min=1,max=65535"`
 	Name          string `json:"name" validate:"required"`
 	SuperUser     string `json:"super_user"`
-	SuperPassword string `json:"super_password"`
+	SuperPassword string `json:"super_password" secret:"true" target:"host,port,super_user"`
 	AppUser       string `json:"app_user" validate:"required"`
-	AppPassword   string `json:"app_password" validate:"required"`
+	AppPassword   string `json:"app_password" validate:"required" secret:"true" target:"host,port,app_user"`
 }
 
 type RedisConfig struct {
@@ -37,15 +37,15 @@ type RedisConfig struct {
 	Host          string `json:"host" validate:"required"`
 	Port          int    `json:"port" validate:"required,min=1,max=65535"`
 	User          string `json:"user"`
-	Password      string `json:"password" validate:"required"`
-	AdminPassword string `json:"admin_password"`
+	Password      string `json:"password" validate:"required" secret:"true" target:"host,port,user"`
+	AdminPassword string `json:"admin_password" secret:"true" target:"host,port"`
 }
 
 type SMTPConfig struct {
 	Server   string `json:"server" validate:"required"`
 	Port     int    `json:"port" validate:"required,min=1,max=65535"`
 	User     string `json:"user" validate:"required"`
-	Password string `json:"password" validate:"required"`
+	Password string `json:"password" validate:"required" secret:"true" target:"server,port,user"`
 	Sender   string `json:"sender" validate:"required,email"`
 }
 
@@ -53,7 +53,7 @@ type SMSConfig struct {
 	Provider         string `json:"provider"`
 	Endpoint         string `json:"endpoint"`
 	APIKey           string `json:"api_key"`
-	APISecret        string `json:"api_secret"`
+	APISecret        string `json:"api_secret" secret:"true" target:"endpoint,api_key"`
 	SignName         string `json:"sign_name"`
 	TemplateRegister string `json:"template_register"`
 	TemplateReset    string `json:"template_reset"`
@@ -83,81 +83,184 @@ type ReverseProxyConfig struct {
 type OAuthConfig struct {
 	GoogleEnabled  bool   `json:"google_enabled"`
 	GoogleClientID string `json:"google_client_id" validate:"required_if=GoogleEnabled true"`
-	GoogleSecret   string `json:"google_client_secret" validate:"required_if=GoogleEnabled true"`
+	GoogleSecret   string `json:"google_client_secret" validate:"required_if=GoogleEnabled true" secret:"true"`
 	GithubEnabled  bool   `json:"github_enabled"`
 	GithubClientID string `json:"github_client_id" validate:"required_if=GithubEnabled true"`
-	GithubSecret   string `json:"github_client_secret" validate:"required_if=GithubEnabled true"`
+	GithubSecret   string `json:"github_client_secret" validate:"required_if=GithubEnabled true" secret:"true"`
 	FrontendOrigin string `json:"frontend_origin"`
 }
 
 type AppConfig struct {
-	DomainName          string      `json:"domain_name" validate:"required"`
-	StaticHostName      string      `json:"static_host_name" validate:"required"`
-	RankingHostName     string      `json:"ranking_host_name"`
-	UserGuideHostName   string      `json:"user_guide_host_name"`
-	DizkazDomainName    string      `json:"dizkaz_domain_name"`
-	DizkazSitePath      string      `json:"dizkaz_site_path"`
-	HandleWWW           bool        `json:"handle_www"`
-	BrandName           string      `json:"brand_name" validate:"required"`
-	DefaultLang         string      `json:"default_lang" validate:"required"`
-	Version             string      `json:"version"`
-	Debug               bool        `json:"debug"`
-	FrontendDecoupled   bool        `json:"frontend_decoupled"`
-	CORSAllowOrigins    []string    `json:"cors_allow_origins"`
-	JWTKeyFilePath      string      `json:"jwt_key_file_path"`
-	JWTKeyFromFile      bool        `json:"jwt_key_from_file"`
-	HasJWTKeyFile       bool        `json:"has_jwt_key_file"`
-	JWTKeyTempPath      string      `json:"jwt_key_temp_path"`
-	RobotsTxtPath       string      `json:"robots_txt_path"`
-	HasCustomRobotsTxt  bool        `json:"has_custom_robots_txt"`
-	OAuth               OAuthConfig `json:"oauth"`
-	CloudflareSiteKey   string      `json:"cloudflare_site_key"`
-	CloudflareSecret    string      `json:"cloudflare_secret"`
-	SSREnabled          bool        `json:"ssr_enabled"`
-	FrontendScripts     []string    `json:"frontend_scripts"`
-	FrontendStyles      []string    `json:"frontend_styles"`
-	FrontendContainerId string      `json:"frontend_container_id" validate:"required_if=SSREnabled true"`
-	RateLimitReqPerMin  int         `json:"rate_limit_req_per_min"`
+	DomainName          string   `json:"domain_name" validate:"required"`
+	StaticHostName      string   `json:"static_host_name" validate:"required"`
+	RankingHostName     string   `json:"ranking_host_name"`
+	UserGuideHostName   string   `json:"user_guide_host_name"`
+	DizkazDomainName    string   `json:"dizkaz_domain_name"`
+	DizkazSitePath      string   `json:"dizkaz_site_path"`
+	HandleWWW           bool     `json:"handle_www"`
+	BrandName           string   `json:"brand_name" validate:"required"`
+	DefaultLang         string   `json:"default_lang" validate:"required"`
+	Version             string   `json:"version"`
+	Debug               bool     `json:"debug"`
+	FrontendDecoupled   bool     `json:"frontend_decoupled"`
+	CORSAllowOrigins    []string `json:"cors_allow_origins"`
+	JWTKeyFilePath      string   `json:"jwt_key_file_path"`
+	JWTKeyFromFile      bool     `json:"jwt_key_from_file"`
+	HasJWTKeyFile       bool     `json:"has_jwt_key_file"`
+	JWTKeyTempPath      string   `json:"jwt_key_temp_path"`
+	RobotsTxtPath       string   `json:"robots_txt_path"`
+	HasCustomRobotsTxt  bool     `json:"has_custom_robots_txt"`
+	CloudflareSiteKey   string   `json:"cloudflare_site_key"`
+	CloudflareSecret    string   `json:"cloudflare_secret" secret:"true"`
+	SSREnabled          bool     `json:"ssr_enabled"`
+	FrontendScripts     []string `json:"frontend_scripts"`
+	FrontendStyles      []string `json:"frontend_styles"`
+	FrontendContainerId string   `json:"frontend_container_id" validate:"required_if=SSREnabled true"`
+	RateLimitReqPerMin  int      `json:"rate_limit_req_per_min"`
 }
 
 type AdminUserConfig struct {
 	Username string `json:"username" validate:"required,min=3,max=50"`
 	Email    string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required,min=8"`
+	Password string `json:"password" validate:"required,min=8" secret:"true"`
+}
+
+// Secrets modes of OutputConfig.
+const (
+	// SecretsModeEnv writes secrets into the .env file, the default.
+	SecretsModeEnv = "env"
+	// SecretsModeDocker writes each secret to secrets/<name> and mounts it
+	// into the services as a Docker secret.
+	SecretsModeDocker = "docker"
+	// SecretsModeAge writes secrets into an age-encrypted file next to the
+	// .env file, which then only holds the other variables.
+	SecretsModeAge = "age"
+)
+
+// OutputConfig controls how the generated deployment stores its files.
+type OutputConfig struct {
+	SecretsMode string `json:"secrets_mode,omitempty" validate:"omitempty,oneof=env docker age"`
+	// AgeRecipients are the age1... public keys the secrets are encrypted to
+	// in age mode.
+	AgeRecipients []string `json:"age_recipients,omitempty"`
 }
 
 type RevisionMode struct {
-	Enabled       bool      `json:"enabled"`
-	ImportedAt    time.Time `json:"imported_at,omitempty"`
-	ModifiedSteps []string  `json:"modified_steps,omitempty"`
+	Enabled             bool      `json:"enabled"`
+	ImportedAt          time.Time `json:"imported_at,omitempty"`
+	ModifiedSteps       []string  `json:"modified_steps,omitempty"`
+	SourceSchemaVersion int       `json:"source_schema_version"`
+	AppliedMigrations   []string  `json:"applied_migrations,omitempty"`
 }
 
+// ConfigSchemaVersion is the SetupConfig schema version written by this
+// binary. Documents with an older version are migrated on import.
+const ConfigSchemaVersion = 1
+
 type SetupConfig struct {
-	Development  bool               `json:"development"`
-	Database     DatabaseConfig     `json:"database"`
-	Redis        RedisConfig        `json:"redis"`
-	SMTP         SMTPConfig         `json:"smtp"`
-	SMS          SMSConfig          `json:"sms"`
-	App          AppConfig          `json:"app"`
-	OAuth        OAuthConfig        `json:"oauth"`
-	AdminUser    AdminUserConfig    `json:"admin_user"`
-	GoAccess     GoAccessConfig     `json:"goaccess"`
-	SSL          SSLConfig          `json:"ssl"`
-	ReverseProxy ReverseProxyConfig `json:"reverse_proxy"`
-	CurrentStep  string             `json:"current_step,omitempty"`
-	RevisionMode RevisionMode       `json:"revision_mode,omitempty"`
+	SchemaVersion int                `json:"schema_version"`
+	Development   bool               `json:"development"`
+	Database      DatabaseConfig     `json:"database"`
+	Redis         RedisConfig        `json:"redis"`
+	SMTP          SMTPConfig         `json:"smtp"`
+	SMS           SMSConfig          `json:"sms"`
+	App           AppConfig          `json:"app"`
+	OAuth         OAuthConfig        `json:"oauth"`
+	AdminUser     AdminUserConfig    `json:"admin_user"`
+	GoAccess      GoAccessConfig     `json:"goaccess"`
+	SSL           SSLConfig          `json:"ssl"`
+	ReverseProxy  ReverseProxyConfig `json:"reverse_proxy"`
+	Output        OutputConfig       `json:"output"`
+	CurrentStep   string             `json:"current_step,omitempty"`
+	RevisionMode  RevisionMode       `json:"revision_mode,omitempty"`
 }
 
 func (sc *SetupConfig) HasGeoFile() bool {
 	return sc.GoAccess.HasGeoFile
 }
 
+// ConfigSnapshot is a saved generation of the configuration draft.
+type ConfigSnapshot struct {
+	ID              int          `json:"id"`
+	CreatedAt       time.Time    `json:"created_at"`
+	ChangedSections []string     `json:"changed_sections"`
+	RestoredFrom    int          `json:"restored_from,omitempty"`
+	Config          *SetupConfig `json:"config,omitempty"`
+}
+
+// ConfigFieldChange is one field that differs between two configurations.
+// Secret values are masked.
+type ConfigFieldChange struct {
+	Path    string `json:"path"`
+	Section string `json:"section"`
+	Before  any    `json:"before"`
+	After   any    `json:"after"`
+}
+
+// PreviewFile is one file of a dry-run generation. Content has secrets masked
+// and is omitted for binary or large files.
+type PreviewFile struct {
+	Path           string `json:"path"`
+	Size           int64  `json:"size"`
+	Mode           string `json:"mode"`
+	Status         string `json:"status"`
+	Content        string `json:"content,omitempty"`
+	ContentOmitted bool   `json:"content_omitted,omitempty"`
+	Diff           string `json:"diff,omitempty"`
+}
+
+const (
+	PreviewAdded     = "added"
+	PreviewModified  = "modified"
+	PreviewUnchanged = "unchanged"
+	PreviewRemoved   = "removed"
+)
+
+// GenerationPreview lists what a generation would write to OutputDir.
+type GenerationPreview struct {
+	OutputDir string        `json:"output_dir"`
+	Files     []PreviewFile `json:"files"`
+}
+
+// TokenRole is what the holder of a setup token may do in the wizard.
+type TokenRole string
+
+const (
+	// TokenRoleViewer can read the configuration but not change it.
+	TokenRoleViewer TokenRole = "viewer"
+	// TokenRoleSectionEditor can also save changes to the configuration
+	// sections listed in SetupToken.Sections and test connections.
+	TokenRoleSectionEditor TokenRole = "section-editor"
+	// TokenRoleAdmin has full control.
+	TokenRoleAdmin TokenRole = "admin"
+)
+
+// SetupToken is a token of an access URL. Token holds the plaintext only
+// on a newly generated token; storage keeps the salted TokenHash and the
+// TokenPrefix used in logs. IPAddress is empty for a token usable from any
+// address and "0.0.0.0" for one bound to the address that first uses it.
 type SetupToken struct {
-	Token     string    `json:"token"`
-	ExpiresAt time.Time `json:"expires_at"`
-	IPAddress string    `json:"ip_address"`
-	Used      bool      `json:"used"`
-	CreatedAt time.Time `json:"created_at"`
+	ID          string    `json:"id,omitempty"`
+	Label       string    `json:"label,omitempty"`
+	Role        TokenRole `json:"role,omitempty"`
+	Sections    []string  `json:"sections,omitempty"`
+	Token       string    `json:"token,omitempty"`
+	TokenHash   string    `json:"token_hash,omitempty"`
+	TokenSalt   string    `json:"token_salt,omitempty"`
+	TokenPrefix string    `json:"token_prefix,omitempty"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	IPAddress   string    `json:"ip_address"`
+	Used        bool      `json:"used"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// EffectiveRole returns the role of the token. Tokens saved before roles
+// existed are admin tokens.
+func (t *SetupToken) EffectiveRole() TokenRole {
+	if t.Role == "" {
+		return TokenRoleAdmin
+	}
+	return t.Role
 }
 
 type ConnectionTestResult struct {
@@ -0,0 +1,242 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// SecretField is a SetupConfig field tagged secret:"true". Secrets are never
+// written to config.json, returned by the API or shown in previews.
+//
+// A secret that is sent to a server lists, in its target tag, the JSON names
+// of the fields in the same struct that say where it is sent and for which
+// account, e.g. target:"host,port,user".
+type SecretField struct {
+	// Path is the Go field path, e.g. Database.SuperPassword.
+	Path string
+	// JSONPath is the path in the JSON form, e.g. database.super_password.
+	JSONPath string
+
+	index   []int
+	targets [][]int
+}
+
+var secretFields = sync.OnceValue(func() []SecretField {
+	var fields []SecretField
+	collectSecretFields(reflect.TypeOf(SetupConfig{}), nil, nil, nil, &fields)
+	return fields
+})
+
+func collectSecretFields(t reflect.Type, index []int, path, jsonPath []string, fields *[]SecretField) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		jsonName, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if jsonName == "" {
+			jsonName = field.Name
+		}
+
+		fieldIndex := append(append([]int{}, index...), i)
+		fieldPath := append(append([]string{}, path...), field.Name)
+		fieldJSONPath := append(append([]string{}, jsonPath...), jsonName)
+
+		if field.Type.Kind() == reflect.Struct && field.Type.PkgPath() == t.PkgPath() {
+			collectSecretFields(field.Type, fieldIndex, fieldPath, fieldJSONPath, fields)
+			continue
+		}
+
+		if field.Tag.Get("secret") == "true" {
+			*fields = append(*fields, SecretField{
+				Path:     strings.Join(fieldPath, "."),
+				JSONPath: strings.Join(fieldJSONPath, "."),
+				index:    fieldIndex,
+				targets:  targetFields(t, index, field),
+			})
+		}
+	}
+}
+
+// targetFields resolves the target tag of a secret field of t, whose index
+// within SetupConfig is index.
+func targetFields(t reflect.Type, index []int, secret reflect.StructField) [][]int {
+	tag := secret.Tag.Get("target")
+	if tag == "" {
+		return nil
+	}
+
+	var targets [][]int
+	for _, name := range strings.Split(tag, ",") {
+		found := false
+		for i := 0; i < t.NumField(); i++ {
+			jsonName, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+			if jsonName == name {
+				targets = append(targets, append(append([]int{}, index...), i))
+				found = true
+				break
+			}
+		}
+		if !found {
+			panic(fmt.Sprintf("secret field %s has unknown target %q", secret.Name, name))
+		}
+	}
+	return targets
+}
+
+// SecretFields lists the secret fields of SetupConfig in declaration order.
+func SecretFields() []SecretField {
+	return secretFields()
+}
+
+// IsSecretPath reports whether path, in either Go or JSON form, names a
+// secret field.
+func IsSecretPath(path string) bool {
+	for _, field := range secretFields() {
+		if field.Path == path || field.JSONPath == path {
+			return true
+		}
+	}
+	return false
+}
+
+// Value returns the field of cfg described by f.
+func (f SecretField) Value(cfg *SetupConfig) reflect.Value {
+	return reflect.ValueOf(cfg).Elem().FieldByIndex(f.index)
+}
+
+// ClearSecrets empties every secret field of cfg.
+func ClearSecrets(cfg *SetupConfig) {
+	for _, field := range secretFields() {
+		field.Value(cfg).SetString("")
+	}
+}
+
+// SecretValues returns the non-empty secret values of cfg.
+func SecretValues(cfg *SetupConfig) []string {
+	var values []string
+	for _, field := range secretFields() {
+		if value := field.Value(cfg).String(); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// ErrInvalidSecretValue is returned when a secret field holds an object
+// other than the unchanged sentinel.
+var ErrInvalidSecretValue = errors.New("invalid secret value")
+
+// ErrSecretTargetChanged is returned when a secret is sent as unchanged but
+// the server or account it belongs to has changed, so the stored secret is
+// not sent somewhere it was not meant for.
+var ErrSecretTargetChanged = errors.New("secret must be entered again for a changed server or account")
+
+// SecretPlaceholder stands in for a secret in API responses.
+type SecretPlaceholder struct {
+	Set bool `json:"set"`
+}
+
+// RedactSecrets returns the JSON form of cfg with every secret replaced by a
+// SecretPlaceholder, so clients learn whether a secret is set but never its
+// value.
+func RedactSecrets(cfg *SetupConfig) (map[string]any, error) {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+
+	var redacted map[string]any
+	if err := json.Unmarshal(data, &redacted); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
+	}
+
+	for _, field := range secretFields() {
+		parent, key := jsonParent(redacted, field.JSONPath)
+		if parent != nil {
+			parent[key] = SecretPlaceholder{Set: field.Value(cfg).String() != ""}
+		}
+	}
+	return redacted, nil
+}
+
+// DecodeConfig decodes a SetupConfig sent by a client. A secret sent as
+// {"unchanged": true} keeps its value from stored, which may be nil when
+// nothing has been saved yet, as long as its target fields are unchanged.
+func DecodeConfig(r io.Reader, stored *SetupConfig) (*SetupConfig, error) {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+
+	var raw map[string]any
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	var unchanged []SecretField
+	for _, field := range secretFields() {
+		parent, key := jsonParent(raw, field.JSONPath)
+		if parent == nil {
+			continue
+		}
+		object, ok := parent[key].(map[string]any)
+		if !ok {
+			continue
+		}
+		if len(object) != 1 || object["unchanged"] != true {
+			return nil, fmt.Errorf("%w for %s", ErrInvalidSecretValue, field.JSONPath)
+		}
+		delete(parent, key)
+		unchanged = append(unchanged, field)
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	var cfg SetupConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+
+	if stored != nil {
+		for _, field := range unchanged {
+			if field.Value(stored).String() != "" && field.targetChanged(&cfg, stored) {
+				return nil, fmt.Errorf("%w for %s", ErrSecretTargetChanged, field.JSONPath)
+			}
+			field.Value(&cfg).Set(field.Value(stored))
+		}
+	}
+	return &cfg, nil
+}
+
+// targetChanged reports whether a target field of f differs between cfg and
+// stored.
+func (f SecretField) targetChanged(cfg, stored *SetupConfig) bool {
+	for _, target := range f.targets {
+		if !reflect.DeepEqual(reflect.ValueOf(cfg).Elem().FieldByIndex(target).Interface(),
+			reflect.ValueOf(stored).Elem().FieldByIndex(target).Interface()) {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonParent returns the object holding the last element of a dotted path
+// and that element's key, or nil if the path does not exist in m.
+func jsonParent(m map[string]any, path string) (map[string]any, string) {
+	keys := strings.Split(path, ".")
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := m[key].(map[string]any)
+		if !ok {
+			return nil, ""
+		}
+		m = next
+	}
+	return m, keys[len(keys)-1]
+}
@@ -0,0 +1,228 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/biliqiqi/baklab-setup/internal/age"
+	"github.com/biliqiqi/baklab-setup/internal/dirlock"
+	"github.com/biliqiqi/baklab-setup/internal/model"
+	"github.com/biliqiqi/baklab-setup/internal/utils"
+)
+
+func usesAgeSecrets(cfg *model.SetupConfig) bool {
+	return cfg.Output.SecretsMode == model.SecretsModeAge
+}
+
+// separatesSecrets reports whether the secrets are kept out of the .env file.
+func separatesSecrets(cfg *model.SetupConfig) bool {
+	return usesDockerSecrets(cfg) || usesAgeSecrets(cfg)
+}
+
+// ageEnvFileName is the age-encrypted file holding the secret variables of
+// the .env file in age mode, e.g. .env.production.age.
+func ageEnvFileName(cfg *model.SetupConfig) string {
+	return envFileName(cfg) + ".age"
+}
+
+// generateSecrets writes the secrets that the .env file leaves out.
+func (g *GeneratorService) generateSecrets(cfg *model.SetupConfig) error {
+	if usesAgeSecrets(cfg) {
+		return g.generateAgeSecrets(cfg)
+	}
+	return g.generateDockerSecrets(cfg)
+}
+
+// generateAgeSecrets encrypts the secret variables, in .env syntax, to the
+// configured age recipients. The file is safe to commit; decrypt-env turns
+// it back into a complete .env file on the target host.
+func (g *GeneratorService) generateAgeSecrets(cfg *model.SetupConfig) error {
+	recipients, err := parseAgeRecipients(cfg.Output.AgeRecipients)
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Secret variables of %s\n", envFileName(cfg))
+	for _, v := range secretEnvVars() {
+		fmt.Fprintf(&b, "%s=%s\n", v.Name, encodeEnvValue(v.value(cfg, envContext{})))
+	}
+
+	encrypted, err := age.Encrypt([]byte(b.String()), recipients...)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt secrets: %w", err)
+	}
+
+	if err := g.out.WriteFile(filepath.Join(g.outputDir, ageEnvFileName(cfg)), encrypted, 0644); err != nil {
+		return fmt.Errorf("failed to write encrypted secrets: %w", err)
+	}
+	return nil
+}
+
+func parseAgeRecipients(values []string) ([]*age.Recipient, error) {
+	if len(values) == 0 {
+		return nil, fmt.Errorf("no age recipients configured")
+	}
+
+	recipients := make([]*age.Recipient, 0, len(values))
+	for _, value := range values {
+		recipient, err := age.ParseRecipient(value)
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, recipient)
+	}
+	return recipients, nil
+}
+
+// ReadAgeIdentityFile reads an age identity file, as written by age-keygen.
+func ReadAgeIdentityFile(path string) ([]*age.Identity, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open identity file: %w", err)
+	}
+	defer utils.Close(file, "identity file: "+path)
+
+	identities, err := age.ParseIdentities(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse identity file %s: %w", path, err)
+	}
+	return identities, nil
+}
+
+// readAgeSecrets decrypts an age-encrypted secrets file into its variables.
+func readAgeSecrets(path string, identities []*age.Identity) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read encrypted secrets: %w", err)
+	}
+
+	plaintext, err := age.Decrypt(data, identities...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s: %w", filepath.Base(path), err)
+	}
+
+	envVars, err := parseEnv(string(plaintext))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse decrypted %s: %w", filepath.Base(path), err)
+	}
+	return envVars, nil
+}
+
+// hasSecretEnvVars reports whether envVars holds any catalog secret, as a
+// .env file does once decrypt-env has run.
+func hasSecretEnvVars(envVars map[string]string) bool {
+	for _, v := range secretEnvVars() {
+		if _, ok := envVars[v.Name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// DecryptEnvFile decrypts the age-encrypted secrets in outputDir and writes
+// them, together with the plain variables, to the .env file the compose file
+// reads. It returns the path of the written file.
+func DecryptEnvFile(outputDir string, identities []*age.Identity) (string, error) {
+	outputLock, err := dirlock.Acquire(outputDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to lock output directory: %w", err)
+	}
+	defer utils.Close(outputLock, "output directory lock")
+
+	var envName string
+	for _, name := range []string{".env.production", ".env.development"} {
+		if fileExists(filepath.Join(outputDir, name+".age")) {
+			envName = name
+			break
+		}
+	}
+	if envName == "" {
+		return "", fmt.Errorf("no age-encrypted .env file found in %s", outputDir)
+	}
+
+	envPath := filepath.Join(outputDir, envName)
+	plainVars, err := parseEnvFile(envPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse %s: %w", envName, err)
+	}
+
+	secretVars, err := readAgeSecrets(envPath+".age", identities)
+	if err != nil {
+		return "", err
+	}
+
+	// WriteFile keeps the mode of an existing file, so restrict it before
+	// the secrets go in.
+	if err := os.Chmod(envPath, 0600); err != nil {
+		return "", fmt.Errorf("failed to restrict permissions of %s: %w", envName, err)
+	}
+	note := "Secrets decrypted at: " + time.Now().Format(time.RFC3339)
+	if err := os.WriteFile(envPath, mergedEnvFile(note, plainVars, secretVars), 0600); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", envName, err)
+	}
+
+	return envPath, nil
+}
+
+// mergedEnvFile lays the variables out in catalog order, as the generator
+// does, with secrets taking precedence. Variables the catalog does not know
+// come last. The note goes into the header comment.
+func mergedEnvFile(note string, plainVars, secretVars map[string]string) []byte {
+	var b strings.Builder
+	b.WriteString("# Generated by baklab setup service\n")
+	b.WriteString("# " + note + "\n")
+
+	written := make(map[string]bool)
+	lookup := func(name string) (string, bool) {
+		if value, ok := secretVars[name]; ok {
+			return value, true
+		}
+		value, ok := plainVars[name]
+		return value, ok
+	}
+
+	for _, section := range envCatalog {
+		var lines []string
+		for _, v := range section.Vars {
+			if value, ok := lookup(v.Name); ok {
+				lines = append(lines, v.Name+"="+encodeEnvValue(value))
+				written[v.Name] = true
+			}
+		}
+		if len(lines) == 0 {
+			continue
+		}
+
+		b.WriteString("\n")
+		for _, comment := range section.Comments {
+			b.WriteString("# " + comment + "\n")
+		}
+		for _, line := range lines {
+			b.WriteString(line + "\n")
+		}
+	}
+
+	var extra []string
+	for _, vars := range []map[string]string{plainVars, secretVars} {
+		for name := range vars {
+			if !written[name] && !slices.Contains(extra, name) {
+				extra = append(extra, name)
+			}
+		}
+	}
+	if len(extra) > 0 {
+		slices.Sort(extra)
+		b.WriteString("\n# Additional variables\n")
+		for _, name := range extra {
+			value, _ := lookup(name)
+			b.WriteString(name + "=" + encodeEnvValue(value) + "\n")
+		}
+	}
+
+	return []byte(b.String())
+}
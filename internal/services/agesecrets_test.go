@@ -0,0 +1,124 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/biliqiqi/baklab-setup/internal/age"
+	"github.com/biliqiqi/baklab-setup/internal/model"
+	"github.com/biliqiqi/baklab-setup/internal/storage"
+)
+
+func ageSecretsConfig(t *testing.T) (*model.SetupConfig, *age.Identity) {
+	t.Helper()
+
+	identity, err := age.GenerateIdentity()
+	if err != nil {
+		t.Fatalf("GenerateIdentity() failed: %v", err)
+	}
+
+	cfg := dockerSecretsConfig()
+	cfg.Output = model.OutputConfig{
+		SecretsMode:   model.SecretsModeAge,
+		AgeRecipients: []string{identity.Recipient().String()},
+	}
+	return cfg, identity
+}
+
+func writeAgeDeployment(t *testing.T, cfg *model.SetupConfig) string {
+	t.Helper()
+
+	outputDir := t.TempDir()
+	templatesDir, err := filepath.Abs("../../templates")
+	if err != nil {
+		t.Fatalf("Failed to get templates directory path: %v", err)
+	}
+
+	g := NewGeneratorService()
+	g.SetOutputDir(outputDir)
+	g.SetTemplatesFS(os.DirFS(templatesDir))
+	if err := g.WriteArtifacts(cfg, []string{"env", "secrets", "setup-config"}); err != nil {
+		t.Fatalf("WriteArtifacts() failed: %v", err)
+	}
+	return outputDir
+}
+
+func TestDecryptEnvFile(t *testing.T) {
+	cfg, identity := ageSecretsConfig(t)
+	outputDir := writeAgeDeployment(t, cfg)
+	envPath := filepath.Join(outputDir, ".env.production")
+
+	plainVars, err := parseEnvFile(envPath)
+	if err != nil {
+		t.Fatalf("parseEnvFile() failed: %v", err)
+	}
+	if hasSecretEnvVars(plainVars) {
+		t.Error(".env should not hold secrets in age mode")
+	}
+
+	encrypted, err := os.ReadFile(envPath + ".age")
+	if err != nil {
+		t.Fatalf("Failed to read encrypted secrets: %v", err)
+	}
+	if strings.Contains(string(encrypted), cfg.Database.SuperPassword) {
+		t.Error("encrypted secrets file holds a plaintext password")
+	}
+
+	other, _ := age.GenerateIdentity()
+	if _, err := DecryptEnvFile(outputDir, []*age.Identity{other}); err == nil {
+		t.Error("DecryptEnvFile() succeeded with an identity that is not a recipient")
+	}
+
+	written, err := DecryptEnvFile(outputDir, []*age.Identity{identity})
+	if err != nil {
+		t.Fatalf("DecryptEnvFile() failed: %v", err)
+	}
+	if written != envPath {
+		t.Errorf("DecryptEnvFile() wrote %s, want %s", written, envPath)
+	}
+
+	info, err := os.Stat(envPath)
+	if err != nil {
+		t.Fatalf("Failed to stat env file: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("decrypted env file mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	envVars, err := parseEnvFile(envPath)
+	if err != nil {
+		t.Fatalf("parseEnvFile() failed: %v", err)
+	}
+	if envVars["APP_DB_PASSWORD"] != cfg.Database.AppPassword {
+		t.Errorf("APP_DB_PASSWORD = %q, want %q", envVars["APP_DB_PASSWORD"], cfg.Database.AppPassword)
+	}
+	for name, value := range plainVars {
+		if envVars[name] != value {
+			t.Errorf("%s = %q, want %q", name, envVars[name], value)
+		}
+	}
+}
+
+func TestImportFromOutputDirDecryptsAgeSecrets(t *testing.T) {
+	want, identity := ageSecretsConfig(t)
+	outputDir := writeAgeDeployment(t, want)
+
+	if _, err := NewSetupService(storage.NewMemoryStorage()).ImportFromOutputDir(outputDir); err == nil {
+		t.Error("ImportFromOutputDir() without an identity succeeded, want error")
+	}
+
+	s := NewSetupService(storage.NewMemoryStorage())
+	s.SetAgeIdentities([]*age.Identity{identity})
+	got, err := s.ImportFromOutputDir(outputDir)
+	if err != nil {
+		t.Fatalf("ImportFromOutputDir() failed: %v", err)
+	}
+
+	for _, field := range model.SecretFields() {
+		if gotValue, wantValue := field.Value(got).String(), field.Value(want).String(); gotValue != wantValue {
+			t.Errorf("%s = %q, want %q", field.Path, gotValue, wantValue)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/biliqiqi/baklab-setup/internal/model"
+)
+
+// ErrInvalidArtifactSelection is returned when a generation is restricted to
+// artifacts that do not exist or that the configuration does not use.
+var ErrInvalidArtifactSelection = errors.New("invalid artifact selection")
+
+// Artifact is one independently renderable part of the deployment, such as
+// the .env file or the Caddy configuration.
+type Artifact interface {
+	Name() string
+	// Dependencies lists the artifacts that must be rendered first because
+	// they settle configuration this artifact reads.
+	Dependencies() []string
+	// Enabled reports whether cfg uses this artifact at all.
+	Enabled(cfg *model.SetupConfig) bool
+	// Render generates the artifact's files in memory.
+	Render(g *GeneratorService, cfg *model.SetupConfig) (*RenderedArtifact, error)
+	// Write stores rendered files in the output directory.
+	Write(g *GeneratorService, rendered *RenderedArtifact) error
+}
+
+// RenderedArtifact holds the files of a rendered artifact until it is written.
+type RenderedArtifact struct {
+	files *memFS
+}
+
+// generatorArtifact renders an artifact by running one of the generator's
+// functions against an in-memory filesystem.
+type generatorArtifact struct {
+	name         string
+	dependencies []string
+	enabled      func(cfg *model.SetupConfig) bool
+	render       func(g *GeneratorService, cfg *model.SetupConfig) error
+}
+
+func (a *generatorArtifact) Name() string {
+	return a.name
+}
+
+func (a *generatorArtifact) Dependencies() []string {
+	return a.dependencies
+}
+
+func (a *generatorArtifact) Enabled(cfg *model.SetupConfig) bool {
+	return a.enabled == nil || a.enabled(cfg)
+}
+
+func (a *generatorArtifact) Render(g *GeneratorService, cfg *model.SetupConfig) (*RenderedArtifact, error) {
+	mem := newMemFS()
+	renderer := *g
+	renderer.out = mem
+
+	if err := a.render(&renderer, cfg); err != nil {
+		return nil, err
+	}
+
+	return &RenderedArtifact{files: mem}, nil
+}
+
+func (a *generatorArtifact) Write(g *GeneratorService, rendered *RenderedArtifact) error {
+	return rendered.files.writeTo(g.out)
+}
+
+func usesDockerDatabase(cfg *model.SetupConfig) bool {
+	return cfg.Database.ServiceType == "docker"
+}
+
+func usesDockerRedis(cfg *model.SetupConfig) bool {
+	return cfg.Redis.ServiceType == "docker"
+}
+
+func reverseProxyType(cfg *model.SetupConfig) string {
+	if cfg.ReverseProxy.Type == "" {
+		return "caddy"
+	}
+	return cfg.ReverseProxy.Type
+}
+
+// artifactRegistry lists every artifact in the order a full generation
+// renders them.
+var artifactRegistry = []Artifact{
+	&generatorArtifact{
+		name:   "env",
+		render: (*GeneratorService).GenerateEnvFile,
+	},
+	&generatorArtifact{
+		name:    "secrets",
+		enabled: separatesSecrets,
+		render:  (*GeneratorService).generateSecrets,
+	},
+	&generatorArtifact{
+		name:   "jwt-key",
+		render: (*GeneratorService).generateJWTKeyArtifact,
+	},
+	&generatorArtifact{
+		name:    "ssl",
+		enabled: func(cfg *model.SetupConfig) bool { return cfg.SSL.Enabled },
+		render:  (*GeneratorService).handleSSLCertificates,
+	},
+	&generatorArtifact{
+		name:    "db-init",
+		enabled: usesDockerDatabase,
+		render:  (*GeneratorService).copyTemplateFiles,
+	},
+	&generatorArtifact{
+		name:         "compose",
+		dependencies: []string{"jwt-key"},
+		render:       (*GeneratorService).generateComposeFile,
+	},
+	&generatorArtifact{
+		name:    "redis",
+		enabled: usesDockerRedis,
+		render:  (*GeneratorService).generateRedisConfig,
+	},
+	&generatorArtifact{
+		name:    "caddy",
+		enabled: func(cfg *model.SetupConfig) bool { return reverseProxyType(cfg) == "caddy" },
+		render:  (*GeneratorService).GenerateCaddyConfig,
+	},
+	&generatorArtifact{
+		name:    "nginx",
+		enabled: func(cfg *model.SetupConfig) bool { return reverseProxyType(cfg) == "nginx" },
+		render:  (*GeneratorService).GenerateNginxConfig,
+	},
+	&generatorArtifact{
+		name:    "goaccess",
+		enabled: func(cfg *model.SetupConfig) bool { return cfg.GoAccess.Enabled },
+		render:  (*GeneratorService).generateGoAccessConfig,
+	},
+	&generatorArtifact{
+		name:   "robots",
+		render: (*GeneratorService).generateRobotsTxt,
+	},
+	&generatorArtifact{
+		name:   "geoip",
+		render: (*GeneratorService).copyGeoIPFiles,
+	},
+	&generatorArtifact{
+		name:   "directories",
+		render: (*GeneratorService).createRequiredDirectories,
+	},
+	&generatorArtifact{
+		name:   "gitignore",
+		render: (*GeneratorService).generateGitignore,
+	},
+	&generatorArtifact{
+		name:         "setup-config",
+		dependencies: []string{"jwt-key"},
+		render:       (*GeneratorService).SaveSetupConfiguration,
+	},
+}
+
+// ArtifactNames returns the names of all known artifacts.
+func ArtifactNames() []string {
+	names := make([]string, 0, len(artifactRegistry))
+	for _, artifact := range artifactRegistry {
+		names = append(names, artifact.Name())
+	}
+	return names
+}
+
+// ParseArtifactList splits a comma separated list of artifact names, as
+// accepted by -only and the generate API.
+func ParseArtifactList(list string) []string {
+	var names []string
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func findArtifact(name string) Artifact {
+	for _, artifact := range artifactRegistry {
+		if artifact.Name() == name {
+			return artifact
+		}
+	}
+	return nil
+}
+
+// artifactPlan is the ordered list of artifacts to render, and which of them
+// are written. Dependencies that were not selected are rendered only for the
+// configuration they settle.
+type artifactPlan struct {
+	render []Artifact
+	write  map[string]bool
+}
+
+// planArtifacts resolves the artifacts to generate for cfg. An empty only
+// selects every artifact the configuration uses.
+func planArtifacts(cfg *model.SetupConfig, only []string) (*artifactPlan, error) {
+	if proxyType := reverseProxyType(cfg); proxyType != "caddy" && proxyType != "nginx" {
+		return nil, fmt.Errorf("unsupported reverse proxy type: %s", proxyType)
+	}
+
+	plan := &artifactPlan{write: map[string]bool{}}
+	if len(only) == 0 {
+		for _, artifact := range artifactRegistry {
+			if artifact.Enabled(cfg) {
+				plan.write[artifact.Name()] = true
+			}
+		}
+	} else {
+		for _, name := range only {
+			artifact := findArtifact(name)
+			if artifact == nil {
+				return nil, fmt.Errorf("%w: unknown artifact %q (available: %s)",
+					ErrInvalidArtifactSelection, name, strings.Join(ArtifactNames(), ", "))
+			}
+			if !artifact.Enabled(cfg) {
+				return nil, fmt.Errorf("%w: artifact %q is not used by this configuration",
+					ErrInvalidArtifactSelection, name)
+			}
+			plan.write[name] = true
+		}
+	}
+
+	visited := map[string]bool{}
+	visiting := map[string]bool{}
+	var visit func(artifact Artifact) error
+	visit = func(artifact Artifact) error {
+		name := artifact.Name()
+		if visited[name] {
+			return nil
+		}
+		if visiting[name] {
+			return fmt.Errorf("artifact dependency cycle at %s", name)
+		}
+		visiting[name] = true
+
+		for _, dependency := range artifact.Dependencies() {
+			dep := findArtifact(dependency)
+			if dep == nil {
+				return fmt.Errorf("artifact %s depends on unknown artifact %s", name, dependency)
+			}
+			if !dep.Enabled(cfg) {
+				continue
+			}
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+
+		visiting[name] = false
+		visited[name] = true
+		plan.render = append(plan.render, artifact)
+		return nil
+	}
+
+	for _, artifact := range artifactRegistry {
+		if plan.write[artifact.Name()] {
+			if err := visit(artifact); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return plan, nil
+}
+
+// ValidateArtifactSelection checks that only names artifacts cfg uses.
+func ValidateArtifactSelection(cfg *model.SetupConfig, only []string) error {
+	_, err := planArtifacts(cfg, only)
+	return err
+}
+
+// WriteArtifacts renders the selected artifacts, or all of them when only is
+// empty, and writes them into the output filesystem.
+func (g *GeneratorService) WriteArtifacts(cfg *model.SetupConfig, only []string) error {
+	plan, err := planArtifacts(cfg, only)
+	if err != nil {
+		return err
+	}
+
+	for _, artifact := range plan.render {
+		rendered, err := artifact.Render(g, cfg)
+		if err != nil {
+			return fmt.Errorf("failed to render %s: %w", artifact.Name(), err)
+		}
+
+		if !plan.write[artifact.Name()] {
+			continue
+		}
+		if err := artifact.Write(g, rendered); err != nil {
+			return fmt.Errorf("failed to write %s: %w", artifact.Name(), err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/biliqiqi/baklab-setup/internal/model"
+	"github.com/biliqiqi/baklab-setup/internal/storage"
+)
+
+func TestPlanArtifactsOrdersDependencies(t *testing.T) {
+	cfg := &model.SetupConfig{ReverseProxy: model.ReverseProxyConfig{Type: "nginx"}}
+
+	plan, err := planArtifacts(cfg, []string{"compose"})
+	if err != nil {
+		t.Fatalf("planArtifacts() failed: %v", err)
+	}
+
+	var rendered []string
+	for _, artifact := range plan.render {
+		rendered = append(rendered, artifact.Name())
+	}
+	if len(rendered) != 2 || rendered[0] != "jwt-key" || rendered[1] != "compose" {
+		t.Errorf("rendered = %v, want [jwt-key compose]", rendered)
+	}
+	if plan.write["jwt-key"] || !plan.write["compose"] {
+		t.Errorf("write = %v, want only compose written", plan.write)
+	}
+
+	plan, err = planArtifacts(cfg, nil)
+	if err != nil {
+		t.Fatalf("planArtifacts() failed: %v", err)
+	}
+	if plan.write["caddy"] || !plan.write["nginx"] || plan.write["redis"] {
+		t.Errorf("write = %v, want the artifacts an external-redis nginx deployment uses", plan.write)
+	}
+
+	for _, only := range [][]string{{"unknown"}, {"caddy"}} {
+		if _, err := planArtifacts(cfg, only); !errors.Is(err, ErrInvalidArtifactSelection) {
+			t.Errorf("planArtifacts(%v) error = %v, want ErrInvalidArtifactSelection", only, err)
+		}
+	}
+}
+
+func TestGenerateArtifactsOnlyRewritesSelected(t *testing.T) {
+	outputDir := t.TempDir()
+	writeTestFile(t, filepath.Join(outputDir, ".env.production"), "APP_DB_PASSWORD='keep'\n")
+	writeTestFile(t, filepath.Join(outputDir, "keys", "jwt-private.pem"), "existing key")
+	writeTestFile(t, filepath.Join(outputDir, "caddy", "Caddyfile"), "old caddyfile")
+
+	templatesDir, err := filepath.Abs("../../templates")
+	if err != nil {
+		t.Fatalf("Failed to get templates directory path: %v", err)
+	}
+
+	service := NewSetupService(storage.NewMemoryStorage())
+	service.SetOutputDir(outputDir)
+	service.generator.SetTemplatesFS(os.DirFS(templatesDir))
+
+	cfg := &model.SetupConfig{
+		App:          model.AppConfig{DomainName: "example.com", StaticHostName: "static.example.com", BrandName: "Example", DefaultLang: "en"},
+		ReverseProxy: model.ReverseProxyConfig{Type: "caddy"},
+	}
+
+	if err := service.GenerateArtifacts(cfg, []string{"caddy", "compose"}); err != nil {
+		t.Fatalf("GenerateArtifacts() failed: %v", err)
+	}
+
+	if got := readTestFile(t, filepath.Join(outputDir, "caddy", "Caddyfile")); got == "old caddyfile" {
+		t.Errorf("Caddyfile should be regenerated")
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "docker-compose.production.yml")); err != nil {
+		t.Errorf("docker-compose.production.yml should be generated: %v", err)
+	}
+	if got := readTestFile(t, filepath.Join(outputDir, ".env.production")); got != "APP_DB_PASSWORD='keep'\n" {
+		t.Errorf(".env.production = %q, should be left alone", got)
+	}
+	if got := readTestFile(t, filepath.Join(outputDir, "keys", "jwt-private.pem")); got != "existing key" {
+		t.Errorf("jwt-private.pem = %q, a dependency must not be rewritten", got)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "static", "robots.txt")); !os.IsNotExist(err) {
+		t.Errorf("robots.txt was not selected and should not be written")
+	}
+}
@@ -0,0 +1,278 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/biliqiqi/baklab-setup/internal/utils"
+)
+
+const (
+	setupDirName   = ".baklab-setup"
+	backupsDirName = "backups"
+
+	// DefaultBackupRetention is the number of output backups kept when no
+	// other limit is configured.
+	DefaultBackupRetention = 5
+
+	backupNameFormat = "20060102-150405.000"
+	partialPrefix    = ".partial-"
+)
+
+// secretOutputPaths are the files and directories of the output dir that can
+// hold secrets in the clear. Backups store them readable by the owner only
+// and the generated .gitignore keeps them out of version control.
+var secretOutputPaths = []string{
+	".env.development",
+	".env.production",
+	secretsDirName + "/",
+	"keys/jwt-private.pem",
+	"ssl/privkey.pem",
+}
+
+// isSecretOutputPath reports whether relPath, relative to the output dir, is
+// or lies in one of the secretOutputPaths.
+func isSecretOutputPath(relPath string) bool {
+	relPath = filepath.ToSlash(relPath)
+	for _, secretPath := range secretOutputPaths {
+		if dir, ok := strings.CutSuffix(secretPath, "/"); ok {
+			if relPath == dir || strings.HasPrefix(relPath, secretPath) {
+				return true
+			}
+		} else if relPath == secretPath {
+			return true
+		}
+	}
+	return false
+}
+
+// OutputBackup is a snapshot of the managed files of the output directory.
+type OutputBackup struct {
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	Path      string    `json:"path"`
+}
+
+func (g *GeneratorService) SetBackupRetention(keep int) {
+	g.backupRetention = keep
+}
+
+func (g *GeneratorService) backupsDir() string {
+	return filepath.Join(g.outputDir, setupDirName, backupsDirName)
+}
+
+// BackupOutputDir copies every file ClearOutputDir would remove into
+// .baklab-setup/backups/<timestamp> and returns the backup name. Files that
+// hold secrets are copied with mode 0600. It returns an empty name when
+// there is nothing to back up.
+func (g *GeneratorService) BackupOutputDir() (string, error) {
+	paths, err := g.managedOutputPaths()
+	if err != nil {
+		return "", err
+	}
+	if len(paths) == 0 {
+		return "", nil
+	}
+
+	backupsDir := g.backupsDir()
+	if err := os.MkdirAll(backupsDir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create backups directory: %w", err)
+	}
+
+	name := time.Now().Format(backupNameFormat)
+	// Copy into a hidden directory first so an interrupted backup is never
+	// mistaken for a complete one.
+	partialDir := filepath.Join(backupsDir, partialPrefix+name)
+	if err := os.RemoveAll(partialDir); err != nil {
+		return "", fmt.Errorf("failed to remove stale partial backup: %w", err)
+	}
+
+	for _, relPath := range paths {
+		secretMode := func(treePath string, perm os.FileMode) os.FileMode {
+			if isSecretOutputPath(filepath.Join(relPath, treePath)) {
+				return 0600
+			}
+			return perm
+		}
+		if err := copyTree(filepath.Join(g.outputDir, relPath), filepath.Join(partialDir, relPath), secretMode); err != nil {
+			_ = os.RemoveAll(partialDir)
+			return "", fmt.Errorf("failed to back up %s: %w", relPath, err)
+		}
+	}
+
+	if err := os.Rename(partialDir, filepath.Join(backupsDir, name)); err != nil {
+		_ = os.RemoveAll(partialDir)
+		return "", fmt.Errorf("failed to finalize backup: %w", err)
+	}
+
+	log.Printf("Backed up output directory to %s", filepath.Join(backupsDir, name))
+	return name, nil
+}
+
+// RestoreOutputBackup replaces the managed files of the output directory with
+// the contents of the named backup.
+func (g *GeneratorService) RestoreOutputBackup(name string) error {
+	backupDir, err := g.backupPath(name)
+	if err != nil {
+		return err
+	}
+
+	if err := g.ClearOutputDir(); err != nil {
+		return fmt.Errorf("failed to clear output directory: %w", err)
+	}
+
+	entries, err := os.ReadDir(backupDir)
+	if err != nil {
+		return fmt.Errorf("failed to read backup %s: %w", name, err)
+	}
+
+	for _, entry := range entries {
+		if err := copyTree(filepath.Join(backupDir, entry.Name()), filepath.Join(g.outputDir, entry.Name()), nil); err != nil {
+			return fmt.Errorf("failed to restore %s from backup %s: %w", entry.Name(), name, err)
+		}
+	}
+
+	return nil
+}
+
+// ListOutputBackups returns the complete backups, newest first.
+func (g *GeneratorService) ListOutputBackups() ([]OutputBackup, error) {
+	entries, err := os.ReadDir(g.backupsDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []OutputBackup{}, nil
+		}
+		return nil, fmt.Errorf("failed to read backups directory: %w", err)
+	}
+
+	backups := []OutputBackup{}
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		createdAt, err := time.ParseInLocation(backupNameFormat, entry.Name(), time.Local)
+		if err != nil {
+			continue
+		}
+
+		backups = append(backups, OutputBackup{
+			Name:      entry.Name(),
+			CreatedAt: createdAt,
+			Path:      filepath.Join(g.backupsDir(), entry.Name()),
+		})
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Name > backups[j].Name
+	})
+
+	return backups, nil
+}
+
+// PruneOutputBackups deletes the oldest backups beyond the retention limit.
+func (g *GeneratorService) PruneOutputBackups() error {
+	keep := g.backupRetention
+	if keep <= 0 {
+		keep = DefaultBackupRetention
+	}
+
+	backups, err := g.ListOutputBackups()
+	if err != nil {
+		return err
+	}
+
+	for _, backup := range backups[min(keep, len(backups)):] {
+		if err := os.RemoveAll(backup.Path); err != nil {
+			return fmt.Errorf("failed to remove old backup %s: %w", backup.Name, err)
+		}
+		log.Printf("Removed old output backup %s", backup.Name)
+	}
+
+	return nil
+}
+
+func (g *GeneratorService) backupPath(name string) (string, error) {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("invalid backup name: %q", name)
+	}
+
+	backupDir := filepath.Join(g.backupsDir(), name)
+	if info, err := os.Stat(backupDir); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("backup not found: %s", name)
+	}
+
+	return backupDir, nil
+}
+
+// copyTree copies src to dest recursively, keeping symlinks and file modes.
+// If fileMode is not nil, it maps the path of each regular file relative to
+// src and its mode to the mode of the copy.
+func copyTree(src, dest string, fileMode func(relPath string, perm os.FileMode) os.FileMode) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, relPath)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case d.Type().IsRegular():
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			perm := info.Mode().Perm()
+			if fileMode != nil {
+				perm = fileMode(relPath, perm)
+			}
+			return copyFileWithMode(path, target, perm)
+		default:
+			log.Printf("Warning: skipping special file %s", path)
+			return nil
+		}
+	})
+}
+
+func copyFileWithMode(src, dest string, perm os.FileMode) error {
+	sourceFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer utils.Close(sourceFile, "source file: "+src)
+
+	destFile, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(destFile, sourceFile); err != nil {
+		_ = destFile.Close()
+		return err
+	}
+
+	return destFile.Close()
+}
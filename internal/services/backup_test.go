@@ -0,0 +1,206 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/biliqiqi/baklab-setup/internal/dirlock"
+	"github.com/biliqiqi/baklab-setup/internal/model"
+	"github.com/biliqiqi/baklab-setup/internal/storage"
+)
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Failed to create directory for %s: %v", path, err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+}
+
+func readTestFile(t *testing.T, path string) string {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", path, err)
+	}
+	return string(data)
+}
+
+func TestBackupAndRestoreOutputDir(t *testing.T) {
+	outputDir := t.TempDir()
+
+	writeTestFile(t, filepath.Join(outputDir, ".env.production"), "APP_DB_PASSWORD=old")
+	writeTestFile(t, filepath.Join(outputDir, "caddy", "Caddyfile"), "old caddyfile")
+	writeTestFile(t, filepath.Join(outputDir, "caddy", "data", "certificate"), "runtime data")
+	writeTestFile(t, filepath.Join(outputDir, "ssl", "cert.pem"), "certificate")
+	writeTestFile(t, filepath.Join(outputDir, dirlock.FileName), "1")
+
+	g := NewGeneratorService()
+	g.SetOutputDir(outputDir)
+
+	name, err := g.BackupOutputDir()
+	if err != nil {
+		t.Fatalf("BackupOutputDir() failed: %v", err)
+	}
+
+	backupDir := filepath.Join(outputDir, setupDirName, backupsDirName, name)
+	if got := readTestFile(t, filepath.Join(backupDir, "caddy", "Caddyfile")); got != "old caddyfile" {
+		t.Errorf("backed up Caddyfile = %q", got)
+	}
+	for _, preserved := range []string{"ssl", filepath.Join("caddy", "data"), dirlock.FileName} {
+		if _, err := os.Stat(filepath.Join(backupDir, preserved)); !os.IsNotExist(err) {
+			t.Errorf("%s is preserved by ClearOutputDir and should not be backed up", preserved)
+		}
+	}
+
+	if err := g.ClearOutputDir(); err != nil {
+		t.Fatalf("ClearOutputDir() failed: %v", err)
+	}
+	writeTestFile(t, filepath.Join(outputDir, ".env.production"), "APP_DB_PASSWORD=half-written")
+
+	backups, err := g.ListOutputBackups()
+	if err != nil {
+		t.Fatalf("ListOutputBackups() failed: %v", err)
+	}
+	if len(backups) != 1 || backups[0].Name != name {
+		t.Fatalf("ListOutputBackups() = %+v, want the backup to survive ClearOutputDir", backups)
+	}
+
+	if err := g.RestoreOutputBackup(name); err != nil {
+		t.Fatalf("RestoreOutputBackup() failed: %v", err)
+	}
+
+	if got := readTestFile(t, filepath.Join(outputDir, ".env.production")); got != "APP_DB_PASSWORD=old" {
+		t.Errorf("restored .env.production = %q", got)
+	}
+	if got := readTestFile(t, filepath.Join(outputDir, "caddy", "Caddyfile")); got != "old caddyfile" {
+		t.Errorf("restored Caddyfile = %q", got)
+	}
+	if got := readTestFile(t, filepath.Join(outputDir, "ssl", "cert.pem")); got != "certificate" {
+		t.Errorf("ssl/cert.pem = %q, should be untouched", got)
+	}
+
+	if err := g.RestoreOutputBackup("../.."); err == nil {
+		t.Errorf("RestoreOutputBackup() should reject names outside the backups directory")
+	}
+}
+
+func TestPruneOutputBackups(t *testing.T) {
+	outputDir := t.TempDir()
+	g := NewGeneratorService()
+	g.SetOutputDir(outputDir)
+	g.SetBackupRetention(2)
+
+	backupsDir := filepath.Join(outputDir, setupDirName, backupsDirName)
+	for _, name := range []string{"20250101-120000.000", "20250102-120000.000", "20250103-120000.000"} {
+		writeTestFile(t, filepath.Join(backupsDir, name, ".env.production"), name)
+	}
+
+	if err := g.PruneOutputBackups(); err != nil {
+		t.Fatalf("PruneOutputBackups() failed: %v", err)
+	}
+
+	backups, err := g.ListOutputBackups()
+	if err != nil {
+		t.Fatalf("ListOutputBackups() failed: %v", err)
+	}
+	if len(backups) != 2 || backups[0].Name != "20250103-120000.000" || backups[1].Name != "20250102-120000.000" {
+		t.Errorf("ListOutputBackups() = %+v, want the two newest backups", backups)
+	}
+}
+
+func TestGenerateConfigFilesRestoresBackupOnFailure(t *testing.T) {
+	outputDir := t.TempDir()
+	writeTestFile(t, filepath.Join(outputDir, ".env.production"), "working deployment")
+
+	templatesDir, err := filepath.Abs("../../templates")
+	if err != nil {
+		t.Fatalf("Failed to get templates directory path: %v", err)
+	}
+
+	service := NewSetupService(storage.NewMemoryStorage())
+	service.SetOutputDir(outputDir)
+	service.generator.SetTemplatesFS(os.DirFS(templatesDir))
+
+	cfg := &model.SetupConfig{
+		App:          model.AppConfig{DomainName: "example.com", BrandName: "Example", DefaultLang: "en"},
+		ReverseProxy: model.ReverseProxyConfig{Type: "caddy"},
+		GoAccess: model.GoAccessConfig{
+			Enabled:     true,
+			HasGeoFile:  true,
+			GeoTempPath: filepath.Join(t.TempDir(), "missing.mmdb"),
+		},
+	}
+
+	if err := service.GenerateConfigFiles(cfg); err == nil {
+		t.Fatalf("GenerateConfigFiles() should fail when the GeoIP temp file is gone")
+	}
+
+	if got := readTestFile(t, filepath.Join(outputDir, ".env.production")); got != "working deployment" {
+		t.Errorf(".env.production = %q, want the previous deployment restored", got)
+	}
+
+	backups, err := service.ListOutputBackups()
+	if err != nil {
+		t.Fatalf("ListOutputBackups() failed: %v", err)
+	}
+	if len(backups) != 1 {
+		t.Errorf("ListOutputBackups() = %+v, want the pre-generation backup kept", backups)
+	}
+}
+
+func TestBackupOutputDirRestrictsSecretFiles(t *testing.T) {
+	outputDir := t.TempDir()
+	writeTestFile(t, filepath.Join(outputDir, ".env.production"), "APP_DB_PASSWORD=secret")
+	writeTestFile(t, filepath.Join(outputDir, secretsDirName, "app_db_password"), "secret")
+	writeTestFile(t, filepath.Join(outputDir, "keys", "jwt-private.pem"), "private key")
+	writeTestFile(t, filepath.Join(outputDir, "caddy", "Caddyfile"), "caddyfile")
+
+	g := NewGeneratorService()
+	g.SetOutputDir(outputDir)
+
+	name, err := g.BackupOutputDir()
+	if err != nil {
+		t.Fatalf("BackupOutputDir() failed: %v", err)
+	}
+
+	backupDir := filepath.Join(outputDir, setupDirName, backupsDirName, name)
+	wantModes := map[string]os.FileMode{
+		".env.production": 0600,
+		filepath.Join(secretsDirName, "app_db_password"): 0600,
+		filepath.Join("keys", "jwt-private.pem"):         0600,
+		filepath.Join("caddy", "Caddyfile"):              0644,
+	}
+	for path, want := range wantModes {
+		info, err := os.Stat(filepath.Join(backupDir, path))
+		if err != nil {
+			t.Fatalf("Failed to stat backed up %s: %v", path, err)
+		}
+		if got := info.Mode().Perm(); got != want {
+			t.Errorf("backed up %s mode = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestGenerateGitignoreExcludesSecretsAndBackups(t *testing.T) {
+	outputDir := t.TempDir()
+	g := NewGeneratorService()
+	g.SetOutputDir(outputDir)
+
+	if err := g.WriteArtifacts(&model.SetupConfig{}, []string{"gitignore"}); err != nil {
+		t.Fatalf("WriteArtifacts() failed: %v", err)
+	}
+
+	gitignore := readTestFile(t, filepath.Join(outputDir, ".gitignore"))
+	for _, want := range []string{"/.env.production\n", "/" + secretsDirName + "/\n", "/keys/jwt-private.pem\n", "/" + setupDirName + "/" + backupsDirName + "/\n"} {
+		if !strings.Contains(gitignore, want) {
+			t.Errorf(".gitignore = %q, want it to contain %q", gitignore, want)
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package services
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/biliqiqi/baklab-setup/internal/age"
+	"github.com/biliqiqi/baklab-setup/internal/dirlock"
+	"github.com/biliqiqi/baklab-setup/internal/model"
+	"github.com/biliqiqi/baklab-setup/internal/utils"
+)
+
+// A migration bundle carries a deployment to another host: the saved
+// configuration, a complete .env file with every secret, and the files that
+// regeneration cannot recreate, as a tar.gz encrypted with a passphrase in
+// the age format. A manifest inside the archive lists every file with its
+// size and SHA-256.
+
+const (
+	bundleFormatVersion = 1
+	bundleManifestName  = "manifest.json"
+	maxManifestSize     = 1 << 20
+)
+
+// bundleScryptWorkFactor is the scrypt work factor of bundle passphrases,
+// age's default.
+var bundleScryptWorkFactor = 18
+
+// ErrBundleIntegrity is returned when the files of a bundle do not match its
+// manifest.
+var ErrBundleIntegrity = errors.New("bundle does not match its manifest")
+
+// BundleManifest describes the files of a migration bundle.
+type BundleManifest struct {
+	Version   int          `json:"baklab_bundle"`
+	CreatedAt time.Time    `json:"created_at"`
+	Files     []BundleFile `json:"files"`
+}
+
+// BundleFile is a file of a migration bundle, with its path relative to the
+// output directory.
+type BundleFile struct {
+	Path   string      `json:"path"`
+	Size   int64       `json:"size"`
+	Mode   fs.FileMode `json:"mode"`
+	SHA256 string      `json:"sha256"`
+}
+
+type bundleEntry struct {
+	path string
+	mode fs.FileMode
+	data []byte
+}
+
+// bundledOutputFiles lists the files of the output directory a bundle
+// carries when they exist, besides the configuration and the .env file.
+func bundledOutputFiles(cfg *model.SetupConfig) []bundleEntry {
+	certbotDir := path.Join("caddy/certbot/conf/live", rootDomain(cfg.App.DomainName))
+	return []bundleEntry{
+		{path: "keys/jwt-private.pem", mode: 0600},
+		{path: "ssl/fullchain.pem", mode: 0644},
+		{path: "ssl/privkey.pem", mode: 0600},
+		{path: path.Join(certbotDir, "fullchain.pem"), mode: 0644},
+		{path: path.Join(certbotDir, "privkey.pem"), mode: 0600},
+		{path: "static/robots.txt", mode: 0644},
+		{path: "geoip/GeoLite2-City.mmdb", mode: 0644},
+	}
+}
+
+// ExportBundle packs the deployment in outputDir into a migration bundle
+// encrypted with passphrase. Secrets kept out of the .env file are merged
+// back into it; an age mode deployment needs the identities set with
+// SetAgeIdentities unless decrypt-env has already run.
+func (s *SetupService) ExportBundle(outputDir string, passphrase []byte) ([]byte, *BundleManifest, error) {
+	outputLock, err := dirlock.Acquire(outputDir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to lock output directory: %w", err)
+	}
+	defer utils.Close(outputLock, "output directory lock")
+
+	configPath := filepath.Join(outputDir, setupDirName, "config.json")
+	configData, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read config.json: %w", err)
+	}
+	cfg, err := MigrateConfig(configData)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse config.json: %w", err)
+	}
+
+	envVars, err := parseEnvFile(filepath.Join(outputDir, envFileName(cfg)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse .env file: %w", err)
+	}
+	secretVars, err := s.readSeparatedSecrets(outputDir, cfg, envVars)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	createdAt := time.Now().UTC().Truncate(time.Second)
+	note := "Exported to a migration bundle at: " + createdAt.Format(time.RFC3339)
+	entries := []bundleEntry{
+		{path: path.Join(setupDirName, "config.json"), mode: 0600, data: configData},
+		{path: envFileName(cfg), mode: 0600, data: mergedEnvFile(note, envVars, secretVars)},
+	}
+
+	for _, entry := range bundledOutputFiles(cfg) {
+		data, err := os.ReadFile(filepath.Join(outputDir, filepath.FromSlash(entry.path)))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read %s: %w", entry.path, err)
+		}
+		entry.data = data
+		entries = append(entries, entry)
+	}
+
+	archive, manifest, err := writeBundleArchive(entries, createdAt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	bundle, err := age.EncryptWithPassphrase(archive, passphrase, bundleScryptWorkFactor)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encrypt bundle: %w", err)
+	}
+
+	return bundle, manifest, nil
+}
+
+// ImportBundle decrypts a migration bundle, imports it with
+// ImportFromOutputDir and generates the deployment into the output
+// directory, which must be new or empty.
+func (s *SetupService) ImportBundle(bundle, passphrase []byte) (*model.SetupConfig, error) {
+	outputDir := s.generator.outputDir
+	if entries, err := os.ReadDir(outputDir); err == nil && len(entries) > 0 {
+		return nil, fmt.Errorf("output directory is not empty: %s", outputDir)
+	}
+
+	archive, err := age.DecryptWithPassphrase(bundle, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt bundle: %w", err)
+	}
+
+	stagingDir, err := os.MkdirTemp("", "baklab-bundle-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(stagingDir); err != nil {
+			log.Printf("Warning: failed to remove staging directory %s: %v", stagingDir, err)
+		}
+	}()
+
+	manifest, err := extractBundleArchive(archive, stagingDir)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Verified %d files of bundle created at %s", len(manifest.Files), manifest.CreatedAt.Format(time.RFC3339))
+
+	cfg, err := s.ImportFromOutputDir(stagingDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to import bundle: %w", err)
+	}
+
+	if err := s.GenerateConfigFiles(cfg); err != nil {
+		return nil, fmt.Errorf("failed to generate config files: %w", err)
+	}
+
+	return cfg, nil
+}
+
+func writeBundleArchive(entries []bundleEntry, createdAt time.Time) ([]byte, *BundleManifest, error) {
+	manifest := &BundleManifest{Version: bundleFormatVersion, CreatedAt: createdAt}
+	for _, entry := range entries {
+		sum := sha256.Sum256(entry.data)
+		manifest.Files = append(manifest.Files, BundleFile{
+			Path:   entry.path,
+			Size:   int64(len(entry.data)),
+			Mode:   entry.mode,
+			SHA256: hex.EncodeToString(sum[:]),
+		})
+	}
+
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal bundle manifest: %w", err)
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+
+	files := append([]bundleEntry{{path: bundleManifestName, mode: 0600, data: manifestData}}, entries...)
+	for _, file := range files {
+		header := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     file.path,
+			Mode:     int64(file.mode),
+			Size:     int64(len(file.data)),
+			ModTime:  createdAt,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return nil, nil, fmt.Errorf("failed to write %s to bundle: %w", file.path, err)
+		}
+		if _, err := tw.Write(file.data); err != nil {
+			return nil, nil, fmt.Errorf("failed to write %s to bundle: %w", file.path, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, nil, fmt.Errorf("failed to finish bundle archive: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, nil, fmt.Errorf("failed to compress bundle: %w", err)
+	}
+
+	return buf.Bytes(), manifest, nil
+}
+
+// extractBundleArchive writes the files of a bundle archive to dir after
+// checking each against the manifest, which must come first.
+func extractBundleArchive(archive []byte, dir string) (*BundleManifest, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bundle archive: %w", err)
+	}
+	tr := tar.NewReader(gz)
+
+	header, err := tr.Next()
+	if err != nil || header.Name != bundleManifestName {
+		return nil, fmt.Errorf("%w: manifest is missing", ErrBundleIntegrity)
+	}
+	manifestData, err := io.ReadAll(io.LimitReader(tr, maxManifestSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bundle manifest: %w", err)
+	}
+
+	var manifest BundleManifest
+	if err := json.Unmarshal(manifestData, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse bundle manifest: %w", err)
+	}
+	if manifest.Version != bundleFormatVersion {
+		return nil, fmt.Errorf("unsupported bundle format version %d", manifest.Version)
+	}
+
+	expected := make(map[string]BundleFile, len(manifest.Files))
+	for _, file := range manifest.Files {
+		if !filepath.IsLocal(filepath.FromSlash(file.Path)) || path.Clean(file.Path) != file.Path {
+			return nil, fmt.Errorf("%w: invalid path %q", ErrBundleIntegrity, file.Path)
+		}
+		expected[file.Path] = file
+	}
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read bundle archive: %w", err)
+		}
+
+		file, ok := expected[header.Name]
+		if !ok || header.Typeflag != tar.TypeReg {
+			return nil, fmt.Errorf("%w: unexpected entry %q", ErrBundleIntegrity, header.Name)
+		}
+		delete(expected, header.Name)
+
+		data, err := io.ReadAll(io.LimitReader(tr, file.Size+1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s from bundle: %w", file.Path, err)
+		}
+		sum := sha256.Sum256(data)
+		if int64(len(data)) != file.Size || hex.EncodeToString(sum[:]) != file.SHA256 {
+			return nil, fmt.Errorf("%w: %s is corrupted", ErrBundleIntegrity, file.Path)
+		}
+
+		target := filepath.Join(dir, filepath.FromSlash(file.Path))
+		if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+			return nil, fmt.Errorf("failed to create directory for %s: %w", file.Path, err)
+		}
+		if err := os.WriteFile(target, data, file.Mode.Perm()); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", file.Path, err)
+		}
+	}
+
+	if len(expected) > 0 {
+		missing := slices.Sorted(maps.Keys(expected))
+		return nil, fmt.Errorf("%w: missing %s", ErrBundleIntegrity, strings.Join(missing, ", "))
+	}
+
+	return &manifest, nil
+}
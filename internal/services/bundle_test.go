@@ -0,0 +1,172 @@
+package services
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/biliqiqi/baklab-setup/internal/age"
+	"github.com/biliqiqi/baklab-setup/internal/model"
+	"github.com/biliqiqi/baklab-setup/internal/storage"
+)
+
+func lowerBundleWorkFactor(t *testing.T) {
+	t.Helper()
+	previous := bundleScryptWorkFactor
+	bundleScryptWorkFactor = 10
+	t.Cleanup(func() { bundleScryptWorkFactor = previous })
+}
+
+func TestBundleRoundTrip(t *testing.T) {
+	lowerBundleWorkFactor(t)
+
+	templatesDir, err := filepath.Abs("../../templates")
+	if err != nil {
+		t.Fatalf("Failed to get templates directory path: %v", err)
+	}
+
+	sourceDir := t.TempDir()
+	g := NewGeneratorService()
+	g.SetOutputDir(sourceDir)
+	g.SetTemplatesFS(os.DirFS(templatesDir))
+
+	want := dockerSecretsConfig()
+	want.ReverseProxy.Type = "caddy"
+	if err := g.WriteArtifacts(want, []string{"env", "secrets", "jwt-key", "setup-config"}); err != nil {
+		t.Fatalf("WriteArtifacts() failed: %v", err)
+	}
+	writeTestFile(t, filepath.Join(sourceDir, "static", "robots.txt"), "User-agent: *\nDisallow: /private\n")
+
+	passphrase := []byte("move to the new host")
+	bundle, manifest, err := NewSetupService(storage.NewMemoryStorage()).ExportBundle(sourceDir, passphrase)
+	if err != nil {
+		t.Fatalf("ExportBundle() failed: %v", err)
+	}
+	if bytes.Contains(bundle, []byte(want.Database.SuperPassword)) {
+		t.Error("bundle holds a plaintext password")
+	}
+
+	var paths []string
+	for _, file := range manifest.Files {
+		paths = append(paths, file.Path)
+	}
+	for _, path := range []string{".baklab-setup/config.json", ".env.production", "keys/jwt-private.pem", "static/robots.txt"} {
+		if !slices.Contains(paths, path) {
+			t.Errorf("manifest lacks %s, has %v", path, paths)
+		}
+	}
+
+	targetDir := filepath.Join(t.TempDir(), "output")
+	s := NewSetupService(storage.NewMemoryStorage())
+	s.SetOutputDir(targetDir)
+	s.generator.SetTemplatesFS(os.DirFS(templatesDir))
+
+	if _, err := s.ImportBundle(bundle, []byte("wrong passphrase")); !errors.Is(err, age.ErrIncorrectPassphrase) {
+		t.Errorf("ImportBundle() with a wrong passphrase error = %v, want ErrIncorrectPassphrase", err)
+	}
+
+	if _, err := s.ImportBundle(bundle, passphrase); err != nil {
+		t.Fatalf("ImportBundle() failed: %v", err)
+	}
+
+	for _, path := range []string{"keys/jwt-private.pem", "static/robots.txt"} {
+		if got, want := readTestFile(t, filepath.Join(targetDir, path)), readTestFile(t, filepath.Join(sourceDir, path)); got != want {
+			t.Errorf("%s differs after import", path)
+		}
+	}
+
+	got, err := NewSetupService(storage.NewMemoryStorage()).ImportFromOutputDir(targetDir)
+	if err != nil {
+		t.Fatalf("ImportFromOutputDir() of the imported deployment failed: %v", err)
+	}
+	if got.Output.SecretsMode != model.SecretsModeDocker {
+		t.Errorf("secrets mode = %q, want %q", got.Output.SecretsMode, model.SecretsModeDocker)
+	}
+	for _, field := range model.SecretFields() {
+		if gotValue, wantValue := field.Value(got).String(), field.Value(want).String(); gotValue != wantValue {
+			t.Errorf("%s = %q, want %q", field.Path, gotValue, wantValue)
+		}
+	}
+
+	if _, err := s.ImportBundle(bundle, passphrase); err == nil {
+		t.Error("ImportBundle() into a non-empty output directory succeeded, want error")
+	}
+}
+
+func TestExtractBundleArchiveChecksManifest(t *testing.T) {
+	sum := sha256.Sum256([]byte("original"))
+	manifestFor := func(path string) []byte {
+		data, err := json.Marshal(BundleManifest{
+			Version: bundleFormatVersion,
+			Files:   []BundleFile{{Path: path, Size: 8, Mode: 0644, SHA256: hex.EncodeToString(sum[:])}},
+		})
+		if err != nil {
+			t.Fatalf("Failed to marshal manifest: %v", err)
+		}
+		return data
+	}
+
+	tests := []struct {
+		name    string
+		entries []bundleEntry
+	}{
+		{"modified file", []bundleEntry{
+			{path: bundleManifestName, data: manifestFor("static/robots.txt")},
+			{path: "static/robots.txt", data: []byte("tampered")},
+		}},
+		{"missing file", []bundleEntry{
+			{path: bundleManifestName, data: manifestFor("static/robots.txt")},
+		}},
+		{"unlisted file", []bundleEntry{
+			{path: bundleManifestName, data: manifestFor("static/robots.txt")},
+			{path: "static/robots.txt", data: []byte("original")},
+			{path: "keys/extra.pem", data: []byte("extra")},
+		}},
+		{"path outside the output directory", []bundleEntry{
+			{path: bundleManifestName, data: manifestFor("../robots.txt")},
+			{path: "../robots.txt", data: []byte("original")},
+		}},
+		{"manifest not first", []bundleEntry{
+			{path: "static/robots.txt", data: []byte("original")},
+			{path: bundleManifestName, data: manifestFor("static/robots.txt")},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			gz := gzip.NewWriter(&buf)
+			tw := tar.NewWriter(gz)
+			for _, entry := range tt.entries {
+				if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: entry.path, Mode: 0644, Size: int64(len(entry.data))}); err != nil {
+					t.Fatalf("Failed to write tar header: %v", err)
+				}
+				if _, err := tw.Write(entry.data); err != nil {
+					t.Fatalf("Failed to write tar entry: %v", err)
+				}
+			}
+			if err := tw.Close(); err != nil {
+				t.Fatalf("Failed to close tar writer: %v", err)
+			}
+			if err := gz.Close(); err != nil {
+				t.Fatalf("Failed to close gzip writer: %v", err)
+			}
+
+			dir := t.TempDir()
+			if _, err := extractBundleArchive(buf.Bytes(), dir); !errors.Is(err, ErrBundleIntegrity) {
+				t.Errorf("extractBundleArchive() error = %v, want ErrBundleIntegrity", err)
+			}
+			if _, err := os.Stat(filepath.Join(filepath.Dir(dir), "robots.txt")); !os.IsNotExist(err) {
+				t.Errorf("extractBundleArchive() wrote outside its directory")
+			}
+		})
+	}
+}
@@ -0,0 +1,787 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/biliqiqi/baklab-setup/internal/model"
+)
+
+const (
+	baklabImage = "ghcr.io/biliqiqi/baklab:$APP_VERSION"
+
+	conditionHealthy   = "service_healthy"
+	conditionCompleted = "service_completed_successfully"
+)
+
+// composeFile is the subset of the Compose specification the generated
+// docker-compose file uses. Services and volumes keep the order they are
+// added in, so the output reads top to bottom in startup order.
+type composeFile struct {
+	Services []composeService
+	Volumes  []string
+	// Secrets are the names of the file-based secrets, each read from
+	// secrets/<name>.
+	Secrets []string
+}
+
+type composeService struct {
+	Name string `yaml:"-"`
+
+	Image         string              `yaml:"image,omitempty"`
+	Build         *composeBuild       `yaml:"build,omitempty"`
+	ContainerName string              `yaml:"container_name,omitempty"`
+	User          string              `yaml:"user,omitempty"`
+	Restart       string              `yaml:"restart,omitempty"`
+	DNS           []string            `yaml:"dns,omitempty"`
+	Environment   composeEnvironment  `yaml:"environment,omitempty"`
+	Secrets       []string            `yaml:"secrets,omitempty"`
+	Volumes       []string            `yaml:"volumes,omitempty"`
+	Ports         composePorts        `yaml:"ports,omitempty"`
+	Command       composeCommand      `yaml:"command,omitempty"`
+	Entrypoint    composeCommand      `yaml:"entrypoint,omitempty"`
+	DependsOn     composeDependsOn    `yaml:"depends_on,omitempty"`
+	Links         []string            `yaml:"links,omitempty"`
+	Healthcheck   *composeHealthcheck `yaml:"healthcheck,omitempty"`
+}
+
+type composeBuild struct {
+	Context    string `yaml:"context"`
+	Dockerfile string `yaml:"dockerfile"`
+}
+
+type composeHealthcheck struct {
+	Test        composeTest `yaml:"test"`
+	Interval    string      `yaml:"interval"`
+	Timeout     string      `yaml:"timeout"`
+	Retries     int         `yaml:"retries"`
+	StartPeriod string      `yaml:"start_period,omitempty"`
+}
+
+// composeEnvVar is a single environment entry. Value is a string or an int,
+// which stays unquoted in the mapping form.
+type composeEnvVar struct {
+	Name  string
+	Value any
+}
+
+// composeEnvironment renders either as a mapping or, when List is set, as a
+// list of NAME=value strings.
+type composeEnvironment struct {
+	Vars []composeEnvVar
+	List bool
+}
+
+// composeCommand is either a shell string or, when Exec is set, an argument
+// list.
+type composeCommand struct {
+	Shell string
+	Exec  []string
+}
+
+type composeDependency struct {
+	Service   string
+	Condition string
+}
+
+type composeDependsOn []composeDependency
+
+// composeTest is a healthcheck command, written as a quoted flow list.
+type composeTest []string
+
+// composePorts are always quoted, since YAML 1.1 parsers read unquoted
+// values such as 22:22 as base-60 numbers.
+type composePorts []string
+
+func (f composeFile) MarshalYAML() (any, error) {
+	services := &yaml.Node{Kind: yaml.MappingNode}
+	for _, service := range f.Services {
+		value := &yaml.Node{}
+		if err := value.Encode(service); err != nil {
+			return nil, fmt.Errorf("failed to encode service %s: %w", service.Name, err)
+		}
+		services.Content = append(services.Content, scalarNode(service.Name), value)
+	}
+
+	volumes := &yaml.Node{Kind: yaml.MappingNode}
+	for _, volume := range f.Volumes {
+		volumes.Content = append(volumes.Content, scalarNode(volume), &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null"})
+	}
+
+	root := &yaml.Node{
+		Kind: yaml.MappingNode,
+		Content: []*yaml.Node{
+			scalarNode("services"), services,
+			scalarNode("volumes"), volumes,
+		},
+	}
+
+	if len(f.Secrets) > 0 {
+		secrets := &yaml.Node{Kind: yaml.MappingNode}
+		for _, name := range f.Secrets {
+			secrets.Content = append(secrets.Content, scalarNode(name), &yaml.Node{
+				Kind:    yaml.MappingNode,
+				Content: []*yaml.Node{scalarNode("file"), scalarNode("./" + secretsDirName + "/" + name)},
+			})
+		}
+		root.Content = append(root.Content, scalarNode("secrets"), secrets)
+	}
+
+	return root, nil
+}
+
+func (e composeEnvironment) IsZero() bool {
+	return len(e.Vars) == 0
+}
+
+func (e composeEnvironment) MarshalYAML() (any, error) {
+	if e.List {
+		entries := make([]string, 0, len(e.Vars))
+		for _, v := range e.Vars {
+			entries = append(entries, fmt.Sprintf("%s=%v", v.Name, v.Value))
+		}
+		return entries, nil
+	}
+
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	for _, v := range e.Vars {
+		value := &yaml.Node{}
+		if err := value.Encode(v.Value); err != nil {
+			return nil, fmt.Errorf("failed to encode environment variable %s: %w", v.Name, err)
+		}
+		node.Content = append(node.Content, scalarNode(v.Name), value)
+	}
+	return node, nil
+}
+
+func (c composeCommand) IsZero() bool {
+	return c.Shell == "" && len(c.Exec) == 0
+}
+
+func (c composeCommand) MarshalYAML() (any, error) {
+	if len(c.Exec) > 0 {
+		return c.Exec, nil
+	}
+
+	node := scalarNode(c.Shell)
+	if strings.Contains(c.Shell, "\n") {
+		node.Style = yaml.LiteralStyle
+	}
+	return node, nil
+}
+
+func (d composeDependsOn) MarshalYAML() (any, error) {
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	for _, dep := range d {
+		condition := &yaml.Node{
+			Kind:    yaml.MappingNode,
+			Content: []*yaml.Node{scalarNode("condition"), scalarNode(dep.Condition)},
+		}
+		node.Content = append(node.Content, scalarNode(dep.Service), condition)
+	}
+	return node, nil
+}
+
+func (p composePorts) MarshalYAML() (any, error) {
+	node := &yaml.Node{Kind: yaml.SequenceNode}
+	for _, port := range p {
+		quoted := scalarNode(port)
+		quoted.Style = yaml.DoubleQuotedStyle
+		node.Content = append(node.Content, quoted)
+	}
+	return node, nil
+}
+
+func (t composeTest) MarshalYAML() (any, error) {
+	node := &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+	for _, arg := range t {
+		quoted := scalarNode(arg)
+		quoted.Style = yaml.DoubleQuotedStyle
+		node.Content = append(node.Content, quoted)
+	}
+	return node, nil
+}
+
+func scalarNode(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+}
+
+func envVars(pairs ...string) []composeEnvVar {
+	vars := make([]composeEnvVar, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		vars = append(vars, composeEnvVar{Name: pairs[i], Value: pairs[i+1]})
+	}
+	return vars
+}
+
+// passthroughEnv maps each name to the variable of the same name in the env
+// file, e.g. APP_PORT: $APP_PORT.
+func passthroughEnv(names ...string) []composeEnvVar {
+	vars := make([]composeEnvVar, 0, len(names))
+	for _, name := range names {
+		vars = append(vars, composeEnvVar{Name: name, Value: "$" + name})
+	}
+	return vars
+}
+
+// marshalComposeFile renders the compose file for cfg, including the header
+// comment.
+func (g *GeneratorService) marshalComposeFile(cfg *model.SetupConfig) ([]byte, error) {
+	mode := "Production"
+	if cfg.Development {
+		mode = "Development"
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# Generated by baklab setup service\n# %s Docker Compose Configuration\n\n", mode)
+
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(g.buildComposeFile(cfg)); err != nil {
+		return nil, fmt.Errorf("failed to encode docker compose file: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode docker compose file: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (g *GeneratorService) buildComposeFile(cfg *model.SetupConfig) composeFile {
+	dockerDB := usesDockerDatabase(cfg)
+	dockerRedis := usesDockerRedis(cfg)
+	proxyType := reverseProxyType(cfg)
+
+	file := composeFile{
+		Services: []composeService{
+			staticInitializerService(),
+			dbMigratorService(cfg),
+			appService(cfg),
+		},
+		Volumes: []string{"static-data"},
+	}
+
+	if dockerDB {
+		file.Services = append(file.Services, dbService(cfg))
+		file.Volumes = append(file.Volumes, "db-data")
+	}
+	if dockerRedis {
+		file.Services = append(file.Services, redisACLGeneratorService(cfg), redisService(cfg))
+		file.Volumes = append(file.Volumes, "redis-data", "redis-config")
+	}
+
+	file.Services = append(file.Services, g.frontendBuilderService(cfg))
+
+	if proxyType == "nginx" {
+		file.Services = append(file.Services, nginxService(cfg))
+	} else {
+		file.Services = append(file.Services, caddyService(cfg))
+		file.Volumes = append(file.Volumes, "caddy-data", "caddy-config")
+	}
+
+	if cfg.GoAccess.Enabled {
+		file.Services = append(file.Services, goAccessService(cfg, proxyType))
+	}
+
+	file.Services = append(file.Services, daliService(cfg))
+
+	if cfg.App.UserGuideHostName != "" {
+		file.Services = append(file.Services, userGuideService())
+	}
+
+	file.Secrets = mountedSecrets(file.Services)
+
+	return file
+}
+
+// mountedSecrets lists the secrets any of services mounts, in catalog order.
+func mountedSecrets(services []composeService) []string {
+	mounted := map[string]bool{}
+	for _, service := range services {
+		for _, name := range service.Secrets {
+			mounted[name] = true
+		}
+	}
+
+	var names []string
+	for _, v := range secretEnvVars() {
+		if name := dockerSecretName(v.Name); mounted[name] {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func webScheme(cfg *model.SetupConfig) string {
+	if cfg.SSL.Enabled {
+		return "https"
+	}
+	return "http"
+}
+
+func staticInitializerService() composeService {
+	return composeService{
+		Name:          "static-initializer",
+		Image:         baklabImage,
+		ContainerName: "baklab-static-init",
+		Volumes: []string{
+			"./frontend_dist:/frontend:ro",
+			"static-data:/static-output",
+		},
+		Command: composeCommand{Shell: `sh -c "
+  echo 'Initializing static files from app image...' &&
+  cp -r /app/static/* /static-output/ &&
+  if [ -f /frontend/manifest.webmanifest ]; then
+    echo 'Copying PWA manifest to static directory...' &&
+    cp /frontend/manifest.webmanifest /static-output/site.webmanifest &&
+    chmod 644 /static-output/site.webmanifest &&
+    echo 'PWA manifest copied successfully'
+  fi &&
+  echo 'Static files initialization completed'
+"
+`},
+		DependsOn: composeDependsOn{{Service: "frontend-builder", Condition: conditionCompleted}},
+		Restart:   "no",
+	}
+}
+
+func dbMigratorService(cfg *model.SetupConfig) composeService {
+	dockerDB := usesDockerDatabase(cfg)
+
+	env := composeEnvVars(cfg, "db-migrator")
+
+	service := composeService{
+		Name:          "db-migrator",
+		Image:         baklabImage,
+		ContainerName: "baklab-db-migrator",
+		Environment:   composeEnvironment{Vars: env},
+		Secrets:       composeSecrets(cfg, "db-migrator"),
+		Command:       composeCommand{Exec: []string{"./baklab", "migrate"}},
+		Restart:       "no",
+	}
+	if exports := secretExports(cfg, "db-migrator"); exports != "" {
+		service.Command = composeCommand{Shell: "sh -c \"\n" + exports + "  exec ./baklab migrate\n\"\n"}
+	}
+	if dockerDB {
+		service.DependsOn = composeDependsOn{{Service: "db", Condition: conditionHealthy}}
+	}
+
+	return service
+}
+
+func appService(cfg *model.SetupConfig) composeService {
+	dockerDB := usesDockerDatabase(cfg)
+	dockerRedis := usesDockerRedis(cfg)
+
+	var env []composeEnvVar
+	if dockerDB {
+		env = append(env, composeEnvVar{Name: "DB_CONTAINER_NAME", Value: "baklab-db"})
+	}
+	env = append(env, composeEnvVars(cfg, "app")...)
+
+	keysVolume := "./keys:/app/keys"
+	if cfg.App.JWTKeyFromFile {
+		keysVolume = cfg.App.JWTKeyFilePath + ":/app/keys/jwt-private.pem"
+	}
+	volumes := []string{keysVolume, "./frontend_dist:/frontend:ro", "./manage_static:/app/manage_static:ro"}
+	if cfg.HasGeoFile() {
+		volumes = append(volumes, "./geoip:/app/geoip:ro")
+	}
+
+	dependsOn := composeDependsOn{
+		{Service: "static-initializer", Condition: conditionCompleted},
+		{Service: "db-migrator", Condition: conditionCompleted},
+	}
+	var links []string
+	if dockerDB {
+		dependsOn = append(dependsOn, composeDependency{Service: "db", Condition: conditionHealthy})
+		links = append(links, "db")
+	}
+	if dockerRedis {
+		dependsOn = append(dependsOn, composeDependency{Service: "redis", Condition: conditionHealthy})
+		links = append(links, "redis")
+	}
+
+	service := composeService{
+		Name:          "app",
+		Image:         baklabImage,
+		ContainerName: "baklab-app",
+		Restart:       "unless-stopped",
+		Environment:   composeEnvironment{Vars: env},
+		Secrets:       composeSecrets(cfg, "app"),
+		Volumes:       volumes,
+		Command: composeCommand{Shell: "sh -c \"\n" + secretExports(cfg, "app") + `  if [ -f /frontend/.frontend-manifest.json ]; then
+    echo 'Loading frontend configuration from manifest...' &&
+    FRONTEND_SCRIPTS=$$(cat /frontend/.frontend-manifest.json | grep -o '\"scripts\":[[:space:]]*\"[^\"]*\"' | cut -d'\"' -f4) &&
+    FRONTEND_STYLES=$$(cat /frontend/.frontend-manifest.json | grep -o '\"styles\":[[:space:]]*\"[^\"]*\"' | cut -d'\"' -f4) &&
+    export FRONTEND_SCRIPTS &&
+    export FRONTEND_STYLES &&
+    echo \"Loaded: FRONTEND_SCRIPTS=$$FRONTEND_SCRIPTS\" &&
+    echo \"Loaded: FRONTEND_STYLES=$$FRONTEND_STYLES\"
+  else
+    echo 'Frontend manifest not found, using defaults' &&
+    export FRONTEND_SCRIPTS='' &&
+    export FRONTEND_STYLES=''
+  fi &&
+  echo 'Starting baklab with entrypoint script...' &&
+  ./docker-entrypoint.sh
+"
+`},
+		DependsOn: dependsOn,
+		Links:     links,
+		Healthcheck: &composeHealthcheck{
+			Test:        composeTest{"CMD", "curl", "-f", "http://localhost:$APP_PORT/health"},
+			Interval:    "30s",
+			Timeout:     "10s",
+			Retries:     3,
+			StartPeriod: "30s",
+		},
+	}
+	if cfg.Development {
+		service.Ports = composePorts{"${APP_OUTER_PORT:-3000}:${APP_PORT:-3000}"}
+	}
+
+	return service
+}
+
+func dbService(cfg *model.SetupConfig) composeService {
+	var secrets []string
+	if usesDockerSecrets(cfg) {
+		secrets = []string{dockerSecretName("PG_PASSWORD"), dockerSecretName("APP_DB_PASSWORD")}
+	}
+
+	env := envVars(
+		"POSTGRES_USER", "${PG_USER}",
+		"POSTGRES_DB", "postgres",
+	)
+	env = append(env, secretEnv(cfg, "POSTGRES_PASSWORD", "PG_PASSWORD"))
+	env = append(env, envVars(
+		"APP_DB_NAME", "${APP_DB_NAME}",
+		"APP_DB_USER", "${APP_DB_USER}",
+	)...)
+	env = append(env, secretEnv(cfg, "APP_DB_PASSWORD", "APP_DB_PASSWORD"))
+	env = append(env, envVars(
+		"PGTZ", "UTC",
+		"DEBUG", "${DEBUG:-false}",
+	)...)
+
+	return composeService{
+		Name:          "db",
+		Build:         &composeBuild{Context: ".", Dockerfile: "./Dockerfile.pg"},
+		ContainerName: "baklab-db",
+		Restart:       "unless-stopped",
+		Volumes: []string{
+			"db-data:/var/lib/postgresql/data",
+			"./db/initdb:/docker-entrypoint-initdb.d/",
+			"./db/postgresql.conf:/etc/postgresql/custom/postgresql.conf",
+		},
+		Command:     composeCommand{Exec: []string{"postgres", "-c", "config_file=/etc/postgresql/custom/postgresql.conf"}},
+		Environment: composeEnvironment{List: true, Vars: env},
+		Secrets:     secrets,
+		Ports:       composePorts{"${DB_PORT}:5432"},
+		Healthcheck: &composeHealthcheck{
+			Test:     composeTest{"CMD-SHELL", "pg_isready -U ${PG_USER} -d postgres"},
+			Interval: "10s",
+			Timeout:  "5s",
+			Retries:  5,
+		},
+	}
+}
+
+func redisEnvironment(cfg *model.SetupConfig) composeEnvironment {
+	return composeEnvironment{List: true, Vars: []composeEnvVar{
+		{Name: "REDIS_USER", Value: "${REDIS_USER}"},
+		secretEnv(cfg, "REDIS_PASSWORD", "REDIS_PASSWORD"),
+		secretEnv(cfg, "REDISCLI_AUTH", "REDISCLI_AUTH"),
+	}}
+}
+
+func redisSecrets(cfg *model.SetupConfig) []string {
+	if !usesDockerSecrets(cfg) {
+		return nil
+	}
+	return []string{dockerSecretName("REDIS_PASSWORD"), dockerSecretName("REDISCLI_AUTH")}
+}
+
+func redisACLGeneratorService(cfg *model.SetupConfig) composeService {
+	return composeService{
+		Name:          "redis-acl-generator",
+		Image:         "alpine:latest",
+		ContainerName: "baklab-redis-acl-gen",
+		Environment:   redisEnvironment(cfg),
+		Secrets:       redisSecrets(cfg),
+		Volumes: []string{
+			"./redis:/src:ro",
+			"redis-config:/config",
+		},
+		Command: composeCommand{Shell: `sh -c '
+  cp /src/redis.conf /config/
+  echo "user default on >` + secretShellRef(cfg, "REDISCLI_AUTH") + ` ~* +@all" > /config/users.acl
+  echo "user $$REDIS_USER on >` + secretShellRef(cfg, "REDIS_PASSWORD") + ` ~* resetchannels -@all +@read +@write +@list +@hash +@set +@string +@connection +@scripting +scan +del +exists +type +ttl +expire" >> /config/users.acl
+  echo "ACL file generated successfully"
+  echo "Users configured: default (admin access), $$REDIS_USER (app access)"
+  echo "ACL file location: /config/users.acl"
+'
+`},
+	}
+}
+
+func redisService(cfg *model.SetupConfig) composeService {
+	healthcheck := composeTest{"CMD", "valkey-cli", "ping"}
+	if usesDockerSecrets(cfg) {
+		// valkey-cli only reads the password from REDISCLI_AUTH.
+		healthcheck = composeTest{"CMD-SHELL", "REDISCLI_AUTH=\"" + secretShellRef(cfg, "REDISCLI_AUTH") + "\" valkey-cli ping"}
+	}
+
+	return composeService{
+		Name:          "redis",
+		Image:         "valkey/valkey:7.2-alpine",
+		ContainerName: "baklab-redis",
+		DependsOn:     composeDependsOn{{Service: "redis-acl-generator", Condition: conditionCompleted}},
+		Environment:   redisEnvironment(cfg),
+		Secrets:       redisSecrets(cfg),
+		Volumes: []string{
+			"redis-data:/data",
+			"./redis/redis.conf:/usr/local/etc/redis/redis.conf:ro",
+			"redis-config:/usr/local/etc/redis",
+		},
+		Command: composeCommand{Shell: "valkey-server /usr/local/etc/redis/redis.conf"},
+		Ports:   composePorts{"${REDIS_PORT}:6379"},
+		Healthcheck: &composeHealthcheck{
+			Test:     healthcheck,
+			Interval: "10s",
+			Timeout:  "5s",
+			Retries:  5,
+		},
+	}
+}
+
+func (g *GeneratorService) frontendBuilderService(cfg *model.SetupConfig) composeService {
+	scheme := webScheme(cfg)
+
+	apiHost := ""
+	if cfg.App.FrontendDecoupled {
+		apiHost = scheme + "://$SERVER_DOMAIN_NAME"
+	}
+
+	return composeService{
+		Name:          "frontend-builder",
+		Image:         "ghcr.io/biliqiqi/baklab-web:latest",
+		ContainerName: "baklab-frontend-builder",
+		User:          "${UID:-1000}:${GID:-1000}",
+		Environment: composeEnvironment{List: true, Vars: envVars(
+			"STATIC_HOST", scheme+"://$STATIC_HOST_NAME",
+			"FRONTEND_HOST", scheme+"://$SERVER_DOMAIN_NAME",
+			"API_HOST", apiHost,
+			"BASE_URL", "/static/frontend/",
+			"API_PATH_PREFIX", "/api/",
+			"OAUTH_PROVIDERS", g.buildOAuthProviders(cfg.OAuth),
+			"BRAND_NAME", "$BRAND_NAME",
+		)},
+		Volumes: []string{"./frontend_dist:/output"},
+		Restart: "no",
+	}
+}
+
+func sslCertificateVolumes() []string {
+	return []string{
+		"./ssl/fullchain.pem:/etc/ssl/certs/server.crt:ro",
+		"./ssl/privkey.pem:/etc/ssl/private/server.key:ro",
+	}
+}
+
+func nginxService(cfg *model.SetupConfig) composeService {
+	volumes := []string{
+		"static-data:/data/static",
+		"./frontend_dist:/data/static/frontend:ro",
+		"./static:/data/custom_static:ro",
+		"./nginx/nginx.conf:/etc/nginx/nginx.conf:ro",
+		"./nginx/templates/baklab.conf.template:/etc/nginx/templates/baklab.conf.template:ro",
+		"./nginx/logs:/etc/nginx/logs",
+	}
+	var ports composePorts
+	if cfg.SSL.Enabled {
+		volumes = append(volumes, sslCertificateVolumes()...)
+		ports = append(ports, "$NGINX_SSL_PORT:443")
+	}
+	ports = append(ports, "$NGINX_PORT:80")
+
+	return composeService{
+		Name:          "nginx",
+		Image:         "nginx:1.25.2-alpine",
+		ContainerName: "baklab-nginx",
+		Restart:       "unless-stopped",
+		Environment:   composeEnvironment{List: true, Vars: composeEnvVars(cfg, "nginx")},
+		Volumes:       volumes,
+		Ports:         ports,
+		DependsOn:     composeDependsOn{{Service: "app", Condition: conditionHealthy}},
+		Healthcheck: &composeHealthcheck{
+			Test:        composeTest{"CMD-SHELL", "curl -H 'Host: $SERVER_DOMAIN_NAME' -f http://localhost:80/health"},
+			Interval:    "30s",
+			Timeout:     "10s",
+			Retries:     3,
+			StartPeriod: "10s",
+		},
+	}
+}
+
+func caddyService(cfg *model.SetupConfig) composeService {
+	volumes := []string{
+		"static-data:/data/static",
+		"./frontend_dist:/data/static/frontend:ro",
+		"./static:/data/custom_static:ro",
+		"./caddy/Caddyfile:/etc/caddy/Caddyfile:ro",
+		"./caddy/optional:/etc/caddy/optional:rw",
+		"caddy-data:/data",
+		"caddy-config:/config",
+		"./caddy/logs:/var/log/caddy",
+	}
+	ports := composePorts{"$NGINX_PORT:80"}
+	if cfg.SSL.Enabled {
+		volumes = append(volumes, sslCertificateVolumes()...)
+		ports = append(ports, "$NGINX_SSL_PORT:443", "$NGINX_SSL_PORT:443/udp")
+	}
+
+	return composeService{
+		Name:          "caddy",
+		Image:         "caddy:2.8-alpine",
+		ContainerName: "baklab-caddy",
+		Restart:       "unless-stopped",
+		DNS:           []string{"8.8.8.8", "1.1.1.1", "223.5.5.5"},
+		Environment:   composeEnvironment{List: true, Vars: composeEnvVars(cfg, "caddy")},
+		Volumes:       volumes,
+		Ports:         ports,
+		Entrypoint: composeCommand{Shell: `sh -c '
+  mkdir -p /var/log/caddy &&
+  touch /var/log/caddy/access.log &&
+  if [ -n "$$DIZKAZ_DOMAIN_NAME" ] && [ "$$DIZKAZ_DOMAIN_NAME" != "" ]; then
+    echo "Enabling DIZKAZ domain configuration for: $$DIZKAZ_DOMAIN_NAME"
+    cp /etc/caddy/optional/dizkaz.caddy.template /etc/caddy/optional/dizkaz.caddy
+  else
+    echo "DIZKAZ domain not configured, skipping"
+    rm -f /etc/caddy/optional/dizkaz.caddy
+  fi &&
+  caddy run --config /etc/caddy/Caddyfile --adapter caddyfile
+'
+`},
+		DependsOn: composeDependsOn{{Service: "app", Condition: conditionHealthy}},
+		Healthcheck: &composeHealthcheck{
+			Test:        composeTest{"CMD-SHELL", "wget --no-verbose --tries=1 --spider --header='Host: $$SERVER_DOMAIN_NAME' http://localhost:80/health"},
+			Interval:    "30s",
+			Timeout:     "10s",
+			Retries:     3,
+			StartPeriod: "10s",
+		},
+	}
+}
+
+func goAccessService(cfg *model.SetupConfig, proxyType string) composeService {
+	logFormat := "CADDY"
+	if proxyType == "nginx" {
+		logFormat = "COMMON"
+	}
+
+	var entrypoint composeCommand
+	env := envVars("LOG_FORMAT", logFormat, "TZ", `"China/Shanghai"`)
+	switch {
+	case !cfg.SSL.Enabled:
+		entrypoint.Shell = `sh -c "/bin/goaccess /data/logs/access.log -o /data/static/report.html --real-time-html --port=9880 --log-format=$$LOG_FORMAT"`
+	case proxyType == "nginx":
+		entrypoint.Shell = `sh -c "/bin/goaccess /data/logs/access.log -o /data/static/report.html --real-time-html --port=9880 --ssl-cert=$$SSL_CERT --ssl-key=$$SSL_KEY --log-format=$$LOG_FORMAT"`
+		env = append(env, envVars("SSL_CERT", "/etc/ssl/certs/server.crt", "SSL_KEY", "/etc/ssl/private/server.key")...)
+	default:
+		// Caddy manages the certificate itself, so look it up in its data volume.
+		entrypoint.Shell = `sh -c '
+  SSL_CERT=$$(find /data/caddy/certificates -type f -path "*/$$SERVER_DOMAIN_NAME/$$SERVER_DOMAIN_NAME.crt" | head -n1) &&
+  SSL_KEY=$$(find /data/caddy/certificates -type f -path "*/$$SERVER_DOMAIN_NAME/$$SERVER_DOMAIN_NAME.key" | head -n1) &&
+  if [ -z "$$SSL_CERT" ] || [ -z "$$SSL_KEY" ]; then
+    echo "Failed to locate Caddy-managed certificate for $$SERVER_DOMAIN_NAME in /data/caddy/certificates" &&
+    exit 1
+  fi &&
+  /bin/goaccess /data/logs/access.log -o /data/static/report.html --real-time-html --port=9880 --ssl-cert=$$SSL_CERT --ssl-key=$$SSL_KEY --log-format=$$LOG_FORMAT
+'
+`
+		env = append(env, passthroughEnv("SERVER_DOMAIN_NAME")...)
+	}
+
+	volumes := []string{"/var/www/goaccess:/var/www/goaccess:rw"}
+	if cfg.GoAccess.HasGeoFile {
+		volumes = append(volumes, "./geoip:/data/geoip:ro")
+	}
+	if cfg.SSL.Enabled {
+		if proxyType == "nginx" {
+			volumes = append(volumes, sslCertificateVolumes()...)
+		} else {
+			volumes = append(volumes, "caddy-data:/data/caddy:ro")
+		}
+	}
+	volumes = append(volumes, "./goaccess.conf:/etc/goaccess/goaccess.conf")
+	if proxyType == "nginx" {
+		volumes = append(volumes, "./nginx/logs:/data/logs")
+	} else {
+		volumes = append(volumes, "./caddy/logs:/data/logs")
+	}
+	volumes = append(volumes, "./manage_static:/data/static")
+
+	return composeService{
+		Name:          "goaccess",
+		Image:         "allinurl/goaccess:1.7.2",
+		ContainerName: "baklab-goaccess",
+		Restart:       "unless-stopped",
+		Entrypoint:    entrypoint,
+		Environment:   composeEnvironment{List: true, Vars: env},
+		Volumes:       volumes,
+		Ports:         composePorts{"9880:9880"},
+		DependsOn:     composeDependsOn{{Service: proxyType, Condition: conditionHealthy}},
+		Healthcheck: &composeHealthcheck{
+			Test:        composeTest{"CMD", "sh", "-c", "pgrep -f goaccess && test -s /data/static/report.html"},
+			Interval:    "30s",
+			Timeout:     "10s",
+			Retries:     3,
+			StartPeriod: "30s",
+		},
+	}
+}
+
+func daliService(cfg *model.SetupConfig) composeService {
+	scheme := webScheme(cfg)
+
+	return composeService{
+		Name:          "dali",
+		Image:         "ghcr.io/biliqiqi/dali-web:latest",
+		ContainerName: "baklab-dali",
+		Restart:       "unless-stopped",
+		Environment: composeEnvironment{List: true, Vars: envVars(
+			"STATIC_HOST", scheme+"://$STATIC_HOST_NAME",
+			"API_HOST", scheme+"://$SERVER_DOMAIN_NAME",
+			"API_PATH_PREFIX", "",
+			"BAKLAB_WEB_HOST", scheme+"://$SERVER_DOMAIN_NAME",
+		)},
+		Healthcheck: &composeHealthcheck{
+			Test:        composeTest{"CMD", "curl", "-f", "http://localhost:80"},
+			Interval:    "30s",
+			Timeout:     "10s",
+			Retries:     3,
+			StartPeriod: "10s",
+		},
+	}
+}
+
+func userGuideService() composeService {
+	return composeService{
+		Name:          "user-guide",
+		Image:         "ghcr.io/biliqiqi/baklab-user-guide:latest",
+		ContainerName: "baklab-user-guide",
+		Restart:       "unless-stopped",
+		Healthcheck: &composeHealthcheck{
+			Test:        composeTest{"CMD", "wget", "--no-verbose", "--tries=1", "--spider", "http://localhost/health"},
+			Interval:    "30s",
+			Timeout:     "10s",
+			Retries:     3,
+			StartPeriod: "10s",
+		},
+	}
+}
@@ -0,0 +1,179 @@
+package services
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/biliqiqi/baklab-setup/internal/model"
+)
+
+// renderLegacyCompose renders the text template the compose file used to be
+// generated from, kept in testdata as the reference for the typed builder. It
+// has since been updated only where the generated file was meant to change.
+func renderLegacyCompose(t *testing.T, g *GeneratorService, cfg *model.SetupConfig) []byte {
+	t.Helper()
+
+	content, err := os.ReadFile(filepath.Join("testdata", "docker-compose.yml.template"))
+	if err != nil {
+		t.Fatalf("Failed to read legacy compose template: %v", err)
+	}
+
+	tmpl, err := template.New("docker").Funcs(template.FuncMap{
+		"oauthProviders": g.buildOAuthProviders,
+		"hasGeoFile": func(cfg *model.SetupConfig) bool {
+			return cfg.HasGeoFile()
+		},
+	}).Parse(string(content))
+	if err != nil {
+		t.Fatalf("Failed to parse legacy compose template: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, cfg); err != nil {
+		t.Fatalf("Failed to execute legacy compose template: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func parseCompose(t *testing.T, content []byte) map[string]any {
+	t.Helper()
+
+	var parsed map[string]any
+	if err := yaml.Unmarshal(content, &parsed); err != nil {
+		t.Fatalf("Failed to parse compose file: %v\n%s", err, content)
+	}
+
+	services, _ := parsed["services"].(map[string]any)
+	for _, service := range services {
+		fields, ok := service.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		// The template wrote an empty depends_on for the migrator when the
+		// database is external, which Compose treats the same as leaving it out.
+		if deps, exists := fields["depends_on"]; exists && deps == nil {
+			delete(fields, "depends_on")
+		}
+
+		// The order of a list-form environment does not matter to Compose.
+		if list, ok := fields["environment"].([]any); ok {
+			env := map[string]any{}
+			for _, entry := range list {
+				name, value, _ := strings.Cut(entry.(string), "=")
+				env[name] = value
+			}
+			fields["environment"] = env
+		}
+	}
+
+	return parsed
+}
+
+func TestComposeFileMatchesLegacyTemplate(t *testing.T) {
+	jwtKeyPath := filepath.Join(t.TempDir(), "jwt-private.pem")
+	writeTestFile(t, jwtKeyPath, "key")
+
+	base := func() *model.SetupConfig {
+		return &model.SetupConfig{
+			Database: model.DatabaseConfig{ServiceType: "docker", Host: "db", Port: 5432},
+			Redis:    model.RedisConfig{ServiceType: "docker", Host: "redis", Port: 6379},
+			App:      model.AppConfig{DomainName: "example.com", StaticHostName: "static.example.com"},
+		}
+	}
+
+	cases := map[string]func(cfg *model.SetupConfig){
+		"defaults": func(cfg *model.SetupConfig) {},
+		"external services": func(cfg *model.SetupConfig) {
+			cfg.Database = model.DatabaseConfig{ServiceType: "external", Host: "pg.internal", Port: 15432}
+			cfg.Redis = model.RedisConfig{ServiceType: "external", Host: "cache.internal", Port: 16379}
+		},
+		"external database only": func(cfg *model.SetupConfig) {
+			cfg.Database = model.DatabaseConfig{ServiceType: "external", Host: "pg.internal", Port: 5432}
+		},
+		"caddy with ssl and goaccess": func(cfg *model.SetupConfig) {
+			cfg.ReverseProxy.Type = "caddy"
+			cfg.SSL.Enabled = true
+			cfg.GoAccess = model.GoAccessConfig{Enabled: true, HasGeoFile: true}
+		},
+		"nginx with ssl and goaccess": func(cfg *model.SetupConfig) {
+			cfg.ReverseProxy.Type = "nginx"
+			cfg.SSL.Enabled = true
+			cfg.GoAccess = model.GoAccessConfig{Enabled: true}
+		},
+		"nginx without ssl": func(cfg *model.SetupConfig) {
+			cfg.ReverseProxy.Type = "nginx"
+			cfg.GoAccess = model.GoAccessConfig{Enabled: true, HasGeoFile: true}
+		},
+		"caddy goaccess without ssl": func(cfg *model.SetupConfig) {
+			cfg.GoAccess = model.GoAccessConfig{Enabled: true}
+		},
+		"development": func(cfg *model.SetupConfig) {
+			cfg.Development = true
+		},
+		"user guide and decoupled frontend": func(cfg *model.SetupConfig) {
+			cfg.App.UserGuideHostName = "docs.example.com"
+			cfg.App.FrontendDecoupled = true
+			cfg.SSL.Enabled = true
+		},
+		"jwt key from file": func(cfg *model.SetupConfig) {
+			cfg.App.JWTKeyFromFile = true
+			cfg.App.JWTKeyFilePath = jwtKeyPath
+		},
+		"oauth": func(cfg *model.SetupConfig) {
+			cfg.OAuth = model.OAuthConfig{
+				GoogleEnabled: true, GoogleClientID: "google-id", GoogleSecret: "google-secret",
+				GithubEnabled: true, GithubClientID: "github-id", GithubSecret: "github-secret",
+			}
+		},
+	}
+
+	g := NewGeneratorService()
+	for name, apply := range cases {
+		t.Run(name, func(t *testing.T) {
+			cfg := base()
+			apply(cfg)
+
+			got, err := g.marshalComposeFile(cfg)
+			if err != nil {
+				t.Fatalf("marshalComposeFile() failed: %v", err)
+			}
+
+			want := parseCompose(t, renderLegacyCompose(t, g, cfg))
+			if parsed := parseCompose(t, got); !reflect.DeepEqual(parsed, want) {
+				t.Errorf("compose file differs from the legacy template\ngot:\n%s", got)
+			}
+		})
+	}
+}
+
+func TestComposeFileQuotesPorts(t *testing.T) {
+	cfg := &model.SetupConfig{
+		Database: model.DatabaseConfig{ServiceType: "docker"},
+		Redis:    model.RedisConfig{ServiceType: "docker"},
+		SSL:      model.SSLConfig{Enabled: true},
+	}
+
+	content, err := NewGeneratorService().marshalComposeFile(cfg)
+	if err != nil {
+		t.Fatalf("marshalComposeFile() failed: %v", err)
+	}
+
+	for _, want := range []string{
+		"# Production Docker Compose Configuration\n",
+		`- "${DB_PORT}:5432"`,
+		`- "$NGINX_SSL_PORT:443/udp"`,
+		`restart: "no"`,
+	} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("compose file should contain %s", want)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/biliqiqi/baklab-setup/internal/model"
+)
+
+// secretsDirName is the output directory holding one file per secret in
+// Docker secrets mode.
+const secretsDirName = "secrets"
+
+func usesDockerSecrets(cfg *model.SetupConfig) bool {
+	return cfg.Output.SecretsMode == model.SecretsModeDocker
+}
+
+// dockerSecretName is the name of the Docker secret, and of its file under
+// secrets/, that holds the env variable name, e.g. app_db_password for
+// APP_DB_PASSWORD.
+func dockerSecretName(name string) string {
+	return strings.ToLower(name)
+}
+
+// dockerSecretTarget is where compose mounts the secret inside a container.
+func dockerSecretTarget(name string) string {
+	return "/run/secrets/" + dockerSecretName(name)
+}
+
+// secretEnvVars returns the secret variables of the env catalog.
+func secretEnvVars() []envVar {
+	var vars []envVar
+	for _, section := range envCatalog {
+		for _, v := range section.Vars {
+			if v.secret() {
+				vars = append(vars, v)
+			}
+		}
+	}
+	return vars
+}
+
+// generateDockerSecrets writes every catalog secret to secrets/<name>.
+// Unset secrets get an empty file, since compose refuses to start when the
+// file of a declared secret is missing.
+func (g *GeneratorService) generateDockerSecrets(cfg *model.SetupConfig) error {
+	secretsDir := filepath.Join(g.outputDir, secretsDirName)
+	if err := g.out.MkdirAll(secretsDir, 0700); err != nil {
+		return fmt.Errorf("failed to create secrets directory: %w", err)
+	}
+
+	for _, v := range secretEnvVars() {
+		path := filepath.Join(secretsDir, dockerSecretName(v.Name))
+		if err := g.out.WriteFile(path, []byte(v.value(cfg, envContext{})), 0600); err != nil {
+			return fmt.Errorf("failed to write secret %s: %w", dockerSecretName(v.Name), err)
+		}
+	}
+
+	return nil
+}
+
+// readDockerSecrets reads the secrets/ directory of a deployment, keyed by
+// env variable name like the .env file. A deployment without the directory
+// yields no variables.
+func readDockerSecrets(outputDir string) (map[string]string, error) {
+	secretsDir := filepath.Join(outputDir, secretsDirName)
+	if _, err := os.Stat(secretsDir); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	envVars := make(map[string]string)
+	for _, v := range secretEnvVars() {
+		data, err := os.ReadFile(filepath.Join(secretsDir, dockerSecretName(v.Name)))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read secret %s: %w", dockerSecretName(v.Name), err)
+		}
+		envVars[v.Name] = string(data)
+	}
+
+	return envVars, nil
+}
+
+// secretEnv passes the secret env variable source to a service as name, or in
+// Docker secrets mode as name_FILE holding the path of the mounted secret.
+func secretEnv(cfg *model.SetupConfig, name, source string) composeEnvVar {
+	if usesDockerSecrets(cfg) {
+		return composeEnvVar{Name: name + "_FILE", Value: dockerSecretTarget(source)}
+	}
+	return composeEnvVar{Name: name, Value: "${" + source + "}"}
+}
+
+// secretShellRef is how a shell command inside a container reads the secret
+// env variable name.
+func secretShellRef(cfg *model.SetupConfig, name string) string {
+	if usesDockerSecrets(cfg) {
+		return "$$(cat " + dockerSecretTarget(name) + ")"
+	}
+	return "$$" + name
+}
+
+// composeSecrets returns the Docker secrets a service mounts: those of the
+// catalog secrets it receives, in Docker secrets mode only.
+func composeSecrets(cfg *model.SetupConfig, service string) []string {
+	if !usesDockerSecrets(cfg) {
+		return nil
+	}
+
+	var names []string
+	for _, v := range secretEnvVars() {
+		if v.targets(service) {
+			names = append(names, dockerSecretName(v.Name))
+		}
+	}
+	return names
+}
+
+// secretExports returns the lines of a double-quoted sh -c script that load
+// the secrets a service mounts back into its environment, for programs that
+// only read the plain variables. Exported inside the container, the values
+// stay out of docker inspect.
+func secretExports(cfg *model.SetupConfig, service string) string {
+	if !usesDockerSecrets(cfg) {
+		return ""
+	}
+
+	var b strings.Builder
+	for _, v := range secretEnvVars() {
+		if v.targets(service) {
+			fmt.Fprintf(&b, "  export %s=\\\"%s\\\" &&\n", v.Name, secretShellRef(cfg, v.Name))
+		}
+	}
+	return b.String()
+}
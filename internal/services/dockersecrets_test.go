@@ -0,0 +1,127 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/biliqiqi/baklab-setup/internal/model"
+	"github.com/biliqiqi/baklab-setup/internal/storage"
+)
+
+func dockerSecretsConfig() *model.SetupConfig {
+	return &model.SetupConfig{
+		Database: model.DatabaseConfig{
+			ServiceType: "docker", Host: "localhost", Port: 5432, Name: "baklab",
+			SuperUser: "postgres", SuperPassword: "PostgresSuper123!", AppUser: "baklab", AppPassword: "it's #1 $HOME",
+		},
+		Redis:     model.RedisConfig{ServiceType: "docker", Host: "localhost", Port: 6379, User: "baklab", Password: "RedisPass1!", AdminPassword: "RedisAdmin1!"},
+		SMTP:      model.SMTPConfig{Server: "smtp.example.com", Port: 587, User: "mailer", Password: "MailPass1!"},
+		App:       model.AppConfig{DomainName: "example.com", BrandName: "BakLab", DefaultLang: "en"},
+		AdminUser: model.AdminUserConfig{Username: "admin", Email: "admin@example.com", Password: "AdminPassword123!"},
+		Output:    model.OutputConfig{SecretsMode: model.SecretsModeDocker},
+	}
+}
+
+func TestDockerSecretsMode(t *testing.T) {
+	outputDir := t.TempDir()
+	templatesDir, err := filepath.Abs("../../templates")
+	if err != nil {
+		t.Fatalf("Failed to get templates directory path: %v", err)
+	}
+
+	g := NewGeneratorService()
+	g.SetOutputDir(outputDir)
+	g.SetTemplatesFS(os.DirFS(templatesDir))
+
+	cfg := dockerSecretsConfig()
+	if err := g.WriteArtifacts(cfg, []string{"env", "secrets", "compose"}); err != nil {
+		t.Fatalf("WriteArtifacts() failed: %v", err)
+	}
+
+	secretPath := filepath.Join(outputDir, "secrets", "app_db_password")
+	info, err := os.Stat(secretPath)
+	if err != nil {
+		t.Fatalf("Failed to stat secret file: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("secret file mode = %v, want 0600", info.Mode().Perm())
+	}
+	if data, _ := os.ReadFile(secretPath); string(data) != cfg.Database.AppPassword {
+		t.Errorf("secret file = %q, want %q", data, cfg.Database.AppPassword)
+	}
+
+	envVars, err := parseEnvFile(filepath.Join(outputDir, ".env.production"))
+	if err != nil {
+		t.Fatalf("parseEnvFile() failed: %v", err)
+	}
+	for _, v := range secretEnvVars() {
+		if _, ok := envVars[v.Name]; ok {
+			t.Errorf(".env should not hold %s in Docker secrets mode", v.Name)
+		}
+	}
+
+	content, err := os.ReadFile(filepath.Join(outputDir, "docker-compose.production.yml"))
+	if err != nil {
+		t.Fatalf("Failed to read compose file: %v", err)
+	}
+	for _, match := range composeEnvReference.FindAllStringSubmatch(strings.ReplaceAll(string(content), "$$", ""), -1) {
+		if _, ok := envVars[match[1]]; !ok {
+			t.Errorf("compose file references %s, which the .env file does not define", match[1])
+		}
+	}
+
+	compose := parseCompose(t, content)
+	secrets, _ := compose["secrets"].(map[string]any)
+	if len(secrets) != len(secretEnvVars()) {
+		t.Errorf("compose declares %d secrets, want %d", len(secrets), len(secretEnvVars()))
+	}
+	if pg, _ := secrets["pg_password"].(map[string]any); pg["file"] != "./secrets/pg_password" {
+		t.Errorf("pg_password secret = %v, want file ./secrets/pg_password", secrets["pg_password"])
+	}
+
+	services := compose["services"].(map[string]any)
+	db := services["db"].(map[string]any)
+	if env := db["environment"].(map[string]any); env["POSTGRES_PASSWORD_FILE"] != "/run/secrets/pg_password" {
+		t.Errorf("db environment = %v, want POSTGRES_PASSWORD_FILE", env)
+	}
+	app := services["app"].(map[string]any)
+	if env := app["environment"].(map[string]any); env["APP_DB_PASSWORD_FILE"] != "/run/secrets/app_db_password" {
+		t.Errorf("app environment = %v, want APP_DB_PASSWORD_FILE", env)
+	}
+	if secrets, _ := app["secrets"].([]any); len(secrets) == 0 || secrets[0] != "app_db_password" {
+		t.Errorf("app secrets = %v, want app_db_password first", app["secrets"])
+	}
+}
+
+func TestImportFromOutputDirReadsDockerSecrets(t *testing.T) {
+	outputDir := t.TempDir()
+	templatesDir, err := filepath.Abs("../../templates")
+	if err != nil {
+		t.Fatalf("Failed to get templates directory path: %v", err)
+	}
+
+	g := NewGeneratorService()
+	g.SetOutputDir(outputDir)
+	g.SetTemplatesFS(os.DirFS(templatesDir))
+
+	want := dockerSecretsConfig()
+	if err := g.WriteArtifacts(want, []string{"env", "secrets", "setup-config"}); err != nil {
+		t.Fatalf("WriteArtifacts() failed: %v", err)
+	}
+
+	got, err := NewSetupService(storage.NewMemoryStorage()).ImportFromOutputDir(outputDir)
+	if err != nil {
+		t.Fatalf("ImportFromOutputDir() failed: %v", err)
+	}
+
+	if got.Output.SecretsMode != model.SecretsModeDocker {
+		t.Errorf("secrets mode = %q, want %q", got.Output.SecretsMode, model.SecretsModeDocker)
+	}
+	for _, field := range model.SecretFields() {
+		if gotValue, wantValue := field.Value(got).String(), field.Value(want).String(); gotValue != wantValue {
+			t.Errorf("%s = %q, want %q", field.Path, gotValue, wantValue)
+		}
+	}
+}
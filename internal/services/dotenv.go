@@ -0,0 +1,173 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// plainEnvValuePattern matches values docker compose reads back unchanged
+// without quotes.
+var plainEnvValuePattern = regexp.MustCompile(`^[A-Za-z0-9_./:,@+-]+$`)
+
+var envKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// encodeEnvValue quotes a value for a .env file so that docker compose and
+// parseEnv both read back exactly the original string. Single quotes are
+// literal in compose, so they are used unless the value contains a single
+// quote or a line break; those values are double quoted with compose's
+// escapes, and $ is doubled to stop interpolation.
+func encodeEnvValue(value any) string {
+	s := fmt.Sprint(value)
+
+	if s == "" || plainEnvValuePattern.MatchString(s) {
+		return s
+	}
+
+	if !strings.ContainsAny(s, "'\n\r") {
+		return "'" + s + "'"
+	}
+
+	replacer := strings.NewReplacer(
+		`\`, `\\`,
+		`"`, `\"`,
+		"$", "$$",
+		"\n", `\n`,
+		"\r", `\r`,
+	)
+	return `"` + replacer.Replace(s) + `"`
+}
+
+// parseEnv decodes .env content the way docker compose does, except that
+// variable references are kept as written instead of being interpolated.
+func parseEnv(content string) (map[string]string, error) {
+	envVars := make(map[string]string)
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+
+	lineNo := 0
+	for len(content) > 0 {
+		lineNo++
+
+		var line string
+		line, content = cutLine(content)
+
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		trimmed = strings.TrimPrefix(trimmed, "export ")
+
+		key, rest, ok := strings.Cut(trimmed, "=")
+		if !ok {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		if !envKeyPattern.MatchString(key) {
+			return nil, fmt.Errorf("line %d: invalid variable name %q", lineNo, key)
+		}
+		rest = strings.TrimLeft(rest, " \t")
+
+		var value string
+		switch {
+		case strings.HasPrefix(rest, "'"):
+			end := strings.Index(rest[1:], "'")
+			for end < 0 && len(content) > 0 {
+				// A quoted value may continue on the following lines.
+				var next string
+				next, content = cutLine(content)
+				lineNo++
+				rest += "\n" + next
+				end = strings.Index(rest[1:], "'")
+			}
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated single-quoted value for %s", lineNo, key)
+			}
+			value = rest[1 : end+1]
+		case strings.HasPrefix(rest, `"`):
+			end := closingDoubleQuote(rest)
+			for end < 0 && len(content) > 0 {
+				var next string
+				next, content = cutLine(content)
+				lineNo++
+				rest += "\n" + next
+				end = closingDoubleQuote(rest)
+			}
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated double-quoted value for %s", lineNo, key)
+			}
+			value = unescapeDoubleQuoted(rest[1:end])
+		default:
+			// An unquoted value ends at a comment that follows whitespace.
+			if idx := strings.Index(rest, " #"); idx >= 0 {
+				rest = rest[:idx]
+			}
+			if idx := strings.Index(rest, "\t#"); idx >= 0 {
+				rest = rest[:idx]
+			}
+			value = strings.ReplaceAll(strings.TrimSpace(rest), "$$", "$")
+		}
+
+		envVars[key] = value
+	}
+
+	return envVars, nil
+}
+
+func cutLine(content string) (string, string) {
+	line, rest, _ := strings.Cut(content, "\n")
+	return line, rest
+}
+
+// closingDoubleQuote returns the index of the quote that closes the value
+// opened at s[0], or -1 if it is not closed yet.
+func closingDoubleQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+func unescapeDoubleQuoted(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s):
+			i++
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case '\\', '"', '$':
+				b.WriteByte(s[i])
+			default:
+				b.WriteByte('\\')
+				b.WriteByte(s[i])
+			}
+		case c == '$' && i+1 < len(s) && s[i+1] == '$':
+			i++
+			b.WriteByte('$')
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func parseEnvFile(envPath string) (map[string]string, error) {
+	content, err := os.ReadFile(envPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseEnv(string(content))
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/quick"
+
+	"github.com/biliqiqi/baklab-setup/internal/model"
+)
+
+func TestEncodeEnvValue(t *testing.T) {
+	tests := []struct {
+		value any
+		want  string
+	}{
+		{"", ""},
+		{5432, "5432"},
+		{true, "true"},
+		{"https://example.com", "https://example.com"},
+		{"Pass word#1", "'Pass word#1'"},
+		{"pa$$word", "'pa$$word'"},
+		{`it's`, `"it's"`},
+		{"it's $HOME \"x\" \\", `"it's $$HOME \"x\" \\"`},
+		{"line1\nline2", `"line1\nline2"`},
+	}
+
+	for _, tt := range tests {
+		if got := encodeEnvValue(tt.value); got != tt.want {
+			t.Errorf("encodeEnvValue(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestParseEnv(t *testing.T) {
+	content := strings.Join([]string{
+		"# comment",
+		"PLAIN=value # trailing comment",
+		"export EXPORTED=yes",
+		"SINGLE='literal $HOME \\n # kept'",
+		`DOUBLE="a\"b\\c\n$$d"`,
+		`MULTI="first`,
+		`second"`,
+		"EMPTY=",
+		"EMPTY_QUOTED=''",
+		"HASH=a#b",
+	}, "\n")
+
+	got, err := parseEnv(content)
+	if err != nil {
+		t.Fatalf("parseEnv() failed: %v", err)
+	}
+
+	want := map[string]string{
+		"PLAIN":        "value",
+		"EXPORTED":     "yes",
+		"SINGLE":       `literal $HOME \n # kept`,
+		"DOUBLE":       "a\"b\\c\n$d",
+		"MULTI":        "first\nsecond",
+		"EMPTY":        "",
+		"EMPTY_QUOTED": "",
+		"HASH":         "a#b",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseEnv() = %#v, want %#v", got, want)
+	}
+
+	for _, invalid := range []string{"KEY='open", `KEY="open`, "1KEY=value"} {
+		if _, err := parseEnv(invalid); err == nil {
+			t.Errorf("parseEnv(%q) should fail", invalid)
+		}
+	}
+}
+
+// passwordAlphabet is weighted towards characters with a meaning in .env
+// files and shell interpolation.
+var passwordAlphabet = []rune("aZ9 '\"$#\\`=!{}()~;&|<>*?%^@,.:/-_\t" + "密码é😀")
+
+type externalPassword string
+
+func (externalPassword) Generate(r *rand.Rand, size int) reflect.Value {
+	n := 1 + r.Intn(128)
+	runes := make([]rune, 0, n)
+	for len(runes) < n {
+		if r.Intn(4) == 0 {
+			runes = append(runes, rune(32+r.Intn(95)))
+		} else {
+			runes = append(runes, passwordAlphabet[r.Intn(len(passwordAlphabet))])
+		}
+	}
+	return reflect.ValueOf(externalPassword(runes))
+}
+
+func TestEnvValueRoundTripsExternalPasswords(t *testing.T) {
+	roundTrips := func(p externalPassword) bool {
+		pwd := string(p)
+		if !validateExternalServicePassword(pwd) {
+			return true
+		}
+
+		parsed, err := parseEnv("REDIS_PASSWORD=" + encodeEnvValue(pwd) + "\nNEXT=1\n")
+		if err != nil {
+			t.Logf("parseEnv() failed for %q: %v", pwd, err)
+			return false
+		}
+		return parsed["REDIS_PASSWORD"] == pwd && parsed["NEXT"] == "1"
+	}
+
+	if err := quick.Check(roundTrips, &quick.Config{MaxCount: 5000}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGenerateEnvFileRoundTripsPasswords(t *testing.T) {
+	outputDir := t.TempDir()
+	templatesDir, err := filepath.Abs("../../templates")
+	if err != nil {
+		t.Fatalf("Failed to get templates directory path: %v", err)
+	}
+
+	g := NewGeneratorService()
+	g.SetOutputDir(outputDir)
+	g.SetTemplatesFS(os.DirFS(templatesDir))
+
+	cfg := &model.SetupConfig{
+		Database: model.DatabaseConfig{Host: "db", Port: 5432, AppPassword: `it's #1 $HOME "quoted" \ end`},
+		Redis:    model.RedisConfig{Host: "redis", Port: 6379, Password: "p@ss word$$"},
+		SMTP:     model.SMTPConfig{Password: "'"},
+		App:      model.AppConfig{DomainName: "example.com", BrandName: "Bob's Forum"},
+	}
+	if err := g.GenerateEnvFile(cfg); err != nil {
+		t.Fatalf("GenerateEnvFile() failed: %v", err)
+	}
+
+	envVars, err := parseEnvFile(filepath.Join(outputDir, ".env.production"))
+	if err != nil {
+		t.Fatalf("parseEnvFile() failed: %v", err)
+	}
+
+	for key, want := range map[string]string{
+		"APP_DB_PASSWORD": cfg.Database.AppPassword,
+		"REDIS_PASSWORD":  cfg.Redis.Password,
+		"SMTP_PASSWORD":   cfg.SMTP.Password,
+		"BRAND_NAME":      cfg.App.BrandName,
+		"DB_PORT":         "5432",
+		"SMTP_SENDER":     "noreply@example.com",
+	} {
+		if got := envVars[key]; got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+}
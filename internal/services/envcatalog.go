@@ -0,0 +1,469 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/biliqiqi/baklab-setup/internal/model"
+)
+
+// envVar describes one variable of the generated .env file. The catalog below
+// is the single source for the .env file, the compose environment blocks and
+// ImportFromOutputDir.
+type envVar struct {
+	Name string
+	// Field is the dotted path of the SetupConfig field the variable holds.
+	// The importer writes the value back to it.
+	// The field's secret tag marks the variable as a secret.
+	Field string
+	// Default is written when Field is empty. The importer leaves the field
+	// alone when it reads the default back.
+	Default func(cfg *model.SetupConfig) string
+	// Value computes variables that are not a plain copy of Field.
+	Value func(cfg *model.SetupConfig, ctx envContext) string
+	// Services are the compose services that receive the variable.
+	Services []string
+	// Compose overrides the $NAME reference the services receive, for values
+	// that differ inside the compose network.
+	Compose func(cfg *model.SetupConfig) any
+}
+
+// envSection groups variables under a comment in the .env file.
+type envSection struct {
+	Comments []string
+	Vars     []envVar
+}
+
+// envContext carries the values that come from the generation run rather
+// than from the configuration.
+type envContext struct {
+	Timestamp string
+	UserID    string
+	GroupID   string
+}
+
+func staticEnv(value string) func(*model.SetupConfig, envContext) string {
+	return func(*model.SetupConfig, envContext) string { return value }
+}
+
+func staticDefault(value string) func(*model.SetupConfig) string {
+	return func(*model.SetupConfig) string { return value }
+}
+
+var envCatalog = []envSection{
+	{
+		Comments: []string{"Language Configuration"},
+		Vars: []envVar{
+			{Name: "DEFAULT_LANG", Field: "App.DefaultLang", Services: []string{"app"}},
+		},
+	},
+	{
+		Comments: []string{"Database Configuration"},
+		Vars: []envVar{
+			{Name: "DB_HOST", Field: "Database.Host", Services: []string{"db-migrator", "app"}, Compose: func(cfg *model.SetupConfig) any {
+				if usesDockerDatabase(cfg) {
+					return "db"
+				}
+				return cfg.Database.Host
+			}},
+			{Name: "DB_PORT", Field: "Database.Port", Services: []string{"db-migrator", "app"}, Compose: func(cfg *model.SetupConfig) any {
+				if usesDockerDatabase(cfg) {
+					return 5432
+				}
+				return cfg.Database.Port
+			}},
+			{Name: "PG_USER", Field: "Database.SuperUser", Services: []string{"db-migrator"}},
+			{Name: "PG_PASSWORD", Field: "Database.SuperPassword", Services: []string{"db-migrator"}},
+			{Name: "APP_DB_NAME", Field: "Database.Name", Services: []string{"db-migrator", "app"}},
+			{Name: "APP_DB_USER", Field: "Database.AppUser", Services: []string{"app"}},
+			{Name: "APP_DB_PASSWORD", Field: "Database.AppPassword", Services: []string{"app"}},
+		},
+	},
+	{
+		Comments: []string{"Redis Configuration"},
+		Vars: []envVar{
+			{Name: "REDIS_HOST", Field: "Redis.Host", Services: []string{"app"}, Compose: func(cfg *model.SetupConfig) any {
+				if usesDockerRedis(cfg) {
+					return "redis"
+				}
+				return cfg.Redis.Host
+			}},
+			{Name: "REDIS_PORT", Field: "Redis.Port", Services: []string{"app"}, Compose: func(cfg *model.SetupConfig) any {
+				if usesDockerRedis(cfg) {
+					return 6379
+				}
+				return cfg.Redis.Port
+			}},
+			{Name: "REDIS_USER", Field: "Redis.User", Services: []string{"app"}},
+			{Name: "REDIS_PASSWORD", Field: "Redis.Password", Services: []string{"app"}},
+			{Name: "REDISCLI_AUTH", Field: "Redis.AdminPassword", Services: []string{"app"}},
+		},
+	},
+	{
+		Comments: []string{"Application Configuration"},
+		Vars: []envVar{
+			{Name: "SERVER_DOMAIN_NAME", Field: "App.DomainName", Services: []string{"app", "nginx", "caddy"}},
+			{Name: "ROOT_DOMAIN_NAME", Services: []string{"nginx", "caddy"}, Value: func(cfg *model.SetupConfig, _ envContext) string {
+				return rootDomain(cfg.App.DomainName)
+			}},
+			{Name: "BRAND_NAME", Field: "App.BrandName", Services: []string{"app"}},
+			{Name: "DEBUG", Services: []string{"app"}, Value: func(cfg *model.SetupConfig, _ envContext) string {
+				return strconv.FormatBool(cfg.Development || cfg.App.Debug)
+			}},
+			{Name: "DEV", Services: []string{"app"}, Value: func(cfg *model.SetupConfig, _ envContext) string {
+				return strconv.FormatBool(cfg.Development)
+			}},
+			{Name: "TEST", Services: []string{"app"}, Value: staticEnv("false")},
+			{Name: "APP_VERSION", Field: "App.Version", Default: staticDefault("latest"), Services: []string{"app"}},
+		},
+	},
+	{
+		Comments: []string{"Go Runtime Configuration"},
+		Vars: []envVar{
+			{Name: "GOMAXPROCS", Services: []string{"app"}, Value: staticEnv("1")},
+		},
+	},
+	{
+		Comments: []string{"HTTPS Configuration", "Set to true when using HTTPS (nginx SSL configuration)"},
+		Vars: []envVar{
+			{Name: "USE_HTTPS", Services: []string{"app"}, Value: func(cfg *model.SetupConfig, _ envContext) string {
+				return strconv.FormatBool(!cfg.Development && cfg.SSL.Enabled)
+			}},
+		},
+	},
+	{
+		Vars: []envVar{
+			{Name: "JWT_KEY_FILE", Services: []string{"app"}, Value: staticEnv("./keys/jwt-private.pem")},
+		},
+	},
+	{
+		Comments: []string{"Application Ports"},
+		Vars: []envVar{
+			{Name: "APP_PORT", Services: []string{"app", "nginx", "caddy"}, Value: staticEnv("3000")},
+			{Name: "APP_OUTER_PORT", Services: []string{"app"}, Value: staticEnv("3000")},
+			{Name: "FRONTEND_ORIGIN", Field: "OAuth.FrontendOrigin", Services: []string{"app"}, Default: func(cfg *model.SetupConfig) string {
+				if !cfg.Development && cfg.SSL.Enabled {
+					return "https://" + cfg.App.DomainName
+				}
+				return "http://" + cfg.App.DomainName
+			}},
+			{Name: "NGINX_PORT", Services: []string{"app"}, Value: staticEnv("80")},
+			{Name: "NGINX_SSL_PORT", Services: []string{"app"}, Value: staticEnv("443")},
+		},
+	},
+	{
+		Comments: []string{"Network Configuration"},
+		Vars: []envVar{
+			{Name: "CORS_ALLOW_ORIGINS", Field: "App.CORSAllowOrigins", Default: defaultCORSOrigins, Services: []string{"app"}, Value: func(cfg *model.SetupConfig, _ envContext) string {
+				if cfg.Development {
+					return ""
+				}
+				if len(cfg.App.CORSAllowOrigins) > 0 {
+					return strings.Join(cfg.App.CORSAllowOrigins, ",")
+				}
+				return defaultCORSOrigins(cfg)
+			}},
+		},
+	},
+	{
+		Comments: []string{"Frontend Configuration"},
+		Vars: []envVar{
+			{Name: "FRONTEND_CONTAINER_ID", Field: "App.FrontendContainerId", Default: staticDefault("root"), Services: []string{"app"}, Value: ssrOnly("App.FrontendContainerId", "root")},
+			{Name: "FRONTEND_SCRIPTS", Field: "App.FrontendScripts", Value: ssrOnly("App.FrontendScripts", "")},
+			{Name: "FRONTEND_STYLES", Field: "App.FrontendStyles", Value: ssrOnly("App.FrontendStyles", "")},
+		},
+	},
+	{
+		Comments: []string{"Service Configuration"},
+		Vars: []envVar{
+			{Name: "STATIC_HOST_NAME", Field: "App.StaticHostName", Services: []string{"app"}},
+			{Name: "RANKING_HOST_NAME", Field: "App.RankingHostName", Services: []string{"app", "nginx", "caddy"}},
+			{Name: "USER_GUIDE_HOST_NAME", Field: "App.UserGuideHostName", Services: []string{"app", "nginx", "caddy"}},
+			{Name: "DIZKAZ_DOMAIN_NAME", Field: "App.DizkazDomainName", Services: []string{"caddy"}},
+			{Name: "DIZKAZ_SITE_PATH", Field: "App.DizkazSitePath", Services: []string{"caddy"}},
+		},
+	},
+	{
+		Comments: []string{"OAuth Configuration (optional)"},
+		Vars: []envVar{
+			{Name: "GOOGLE_CLIENT_ID", Field: "OAuth.GoogleClientID", Services: []string{"app"}},
+			{Name: "GOOGLE_CLIENT_SECRET", Field: "OAuth.GoogleSecret", Services: []string{"app"}},
+			{Name: "GITHUB_CLIENT_ID", Field: "OAuth.GithubClientID", Services: []string{"app"}},
+			{Name: "GITHUB_CLIENT_SECRET", Field: "OAuth.GithubSecret", Services: []string{"app"}},
+		},
+	},
+	{
+		Comments: []string{"Cloudflare Configuration (optional)"},
+		Vars: []envVar{
+			{Name: "CLOUDFLARE_SITE_KEY", Field: "App.CloudflareSiteKey", Services: []string{"app"}},
+			{Name: "CLOUDFLARE_SECRET", Field: "App.CloudflareSecret", Services: []string{"app"}},
+		},
+	},
+	{
+		Comments: []string{
+			"Global Rate Limiting (requests per minute per IP)",
+			"Protects against crawler/bot abuse and DDoS attacks",
+			"Default: 100 requests per minute per IP",
+		},
+		Vars: []envVar{
+			{Name: "RATE_LIMIT_REQ_PER_MIN", Field: "App.RateLimitReqPerMin", Default: staticDefault("100"), Services: []string{"app"}},
+		},
+	},
+	{
+		Comments: []string{"SMTP Configuration (optional)"},
+		Vars: []envVar{
+			{Name: "SMTP_SERVER", Field: "SMTP.Server", Services: []string{"app"}},
+			{Name: "SMTP_SERVER_PORT", Field: "SMTP.Port", Default: staticDefault("587"), Services: []string{"app"}},
+			{Name: "SMTP_USER", Field: "SMTP.User", Services: []string{"app"}},
+			{Name: "SMTP_PASSWORD", Field: "SMTP.Password", Services: []string{"app"}},
+			{Name: "SMTP_SENDER", Field: "SMTP.Sender", Services: []string{"app"}, Default: func(cfg *model.SetupConfig) string {
+				return "noreply@" + cfg.App.DomainName
+			}},
+		},
+	},
+	{
+		Comments: []string{"Super User Configuration (Initial Admin User)"},
+		Vars: []envVar{
+			{Name: "SUPER_USER", Field: "AdminUser.Username", Services: []string{"app"}},
+			{Name: "SUPER_PASSWORD", Field: "AdminUser.Password", Services: []string{"app"}},
+			{Name: "SUPER_USER_EMAIL", Field: "AdminUser.Email", Services: []string{"app"}},
+		},
+	},
+	{
+		Comments: []string{"SMS Configuration (optional)"},
+		Vars: []envVar{
+			{Name: "SMS_PROVIDER", Field: "SMS.Provider", Services: []string{"app"}},
+			{Name: "SMS_ENDPOINT", Field: "SMS.Endpoint", Services: []string{"app"}},
+			{Name: "SMS_API_KEY", Field: "SMS.APIKey", Services: []string{"app"}},
+			{Name: "SMS_API_SECRET", Field: "SMS.APISecret", Services: []string{"app"}},
+			{Name: "SMS_SIGN_NAME", Field: "SMS.SignName", Services: []string{"app"}},
+			{Name: "SMS_TEMPLATE_REGISTER", Field: "SMS.TemplateRegister", Services: []string{"app"}},
+			{Name: "SMS_TEMPLATE_RESET", Field: "SMS.TemplateReset", Services: []string{"app"}},
+			{Name: "SMS_FROM", Field: "SMS.From", Services: []string{"app"}},
+		},
+	},
+	{
+		Comments: []string{"File Paths"},
+		Vars: []envVar{
+			{Name: "GEOIP_ENABLED", Services: []string{"app"}, Value: func(cfg *model.SetupConfig, _ envContext) string {
+				return strconv.FormatBool(cfg.HasGeoFile())
+			}},
+			{Name: "GEOIP_FILE", Services: []string{"app"}, Value: func(cfg *model.SetupConfig, _ envContext) string {
+				if cfg.HasGeoFile() {
+					return "./geoip/GeoLite2-City.mmdb"
+				}
+				return "./geoip/Country.mmdb"
+			}},
+			{Name: "I18N_FILE_DIR", Services: []string{"app"}, Value: staticEnv("./i18n")},
+			{Name: "MIGRATION_FILE_DIR", Services: []string{"db-migrator", "app"}, Value: staticEnv("./config/db/migrations")},
+			{Name: "DEFAULT_DATA_DIR", Services: []string{"app"}, Value: staticEnv("./config/defaults")},
+		},
+	},
+	{
+		Comments: []string{"Development Configuration"},
+		Vars: []envVar{
+			{Name: "HOST_PROXY", Value: staticEnv("")},
+			{Name: "APP_LOCAL_HOST", Value: staticEnv("172.17.0.1"), Services: []string{"nginx"}, Compose: func(*model.SetupConfig) any {
+				return "app"
+			}},
+		},
+	},
+	{
+		Comments: []string{"Setup Status"},
+		Vars: []envVar{
+			{Name: "SETUP_COMPLETED", Value: staticEnv("true")},
+			{Name: "SETUP_COMPLETED_AT", Value: func(_ *model.SetupConfig, ctx envContext) string { return ctx.Timestamp }},
+		},
+	},
+	{
+		Comments: []string{"User Configuration (for Docker permissions)"},
+		Vars: []envVar{
+			{Name: "UID", Value: func(_ *model.SetupConfig, ctx envContext) string { return ctx.UserID }},
+			{Name: "GID", Value: func(_ *model.SetupConfig, ctx envContext) string { return ctx.GroupID }},
+		},
+	},
+}
+
+func defaultCORSOrigins(cfg *model.SetupConfig) string {
+	if cfg.App.DomainName == "localhost" {
+		return "http://" + cfg.App.DomainName
+	}
+	return "https://" + cfg.App.DomainName
+}
+
+// ssrOnly writes field only when server-side rendering is enabled.
+func ssrOnly(field, fallback string) func(*model.SetupConfig, envContext) string {
+	return func(cfg *model.SetupConfig, _ envContext) string {
+		if !cfg.App.SSREnabled {
+			return fallback
+		}
+		return formatConfigField(configField(cfg, field))
+	}
+}
+
+// configField returns the SetupConfig field at a dotted path such as
+// Database.Host. The catalog paths are checked by tests, so an unknown path
+// is a programming error.
+func configField(cfg *model.SetupConfig, path string) reflect.Value {
+	value := reflect.ValueOf(cfg).Elem()
+	for _, name := range strings.Split(path, ".") {
+		value = value.FieldByName(name)
+		if !value.IsValid() {
+			panic(fmt.Sprintf("unknown config field %s", path))
+		}
+	}
+	return value
+}
+
+func formatConfigField(value reflect.Value) string {
+	switch value.Kind() {
+	case reflect.String:
+		return value.String()
+	case reflect.Int:
+		if value.Int() == 0 {
+			return ""
+		}
+		return strconv.FormatInt(value.Int(), 10)
+	case reflect.Bool:
+		return strconv.FormatBool(value.Bool())
+	case reflect.Slice:
+		return strings.Join(value.Interface().([]string), ",")
+	default:
+		panic(fmt.Sprintf("unsupported config field kind %s", value.Kind()))
+	}
+}
+
+func setConfigField(value reflect.Value, s string) error {
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(s)
+	case reflect.Int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return err
+		}
+		value.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		value.SetBool(b)
+	case reflect.Slice:
+		value.Set(reflect.ValueOf(strings.Split(s, ",")))
+	default:
+		return fmt.Errorf("unsupported config field kind %s", value.Kind())
+	}
+	return nil
+}
+
+// value returns what the .env file holds for v.
+func (v envVar) value(cfg *model.SetupConfig, ctx envContext) string {
+	if v.Value != nil {
+		return v.Value(cfg, ctx)
+	}
+
+	s := formatConfigField(configField(cfg, v.Field))
+	if s == "" && v.Default != nil {
+		s = v.Default(cfg)
+	}
+	return s
+}
+
+func (v envVar) secret() bool {
+	return v.Field != "" && model.IsSecretPath(v.Field)
+}
+
+func (v envVar) targets(service string) bool {
+	for _, s := range v.Services {
+		if s == service {
+			return true
+		}
+	}
+	return false
+}
+
+// renderedEnvSection is an envSection with its values resolved, as passed to
+// env.template.
+type renderedEnvSection struct {
+	Comments []string
+	Vars     []renderedEnvVar
+}
+
+type renderedEnvVar struct {
+	Name  string
+	Value string
+}
+
+// renderEnvCatalog resolves the catalog for env.template. In Docker secrets
+// and age mode the secrets are left out; they live in the secrets/ directory
+// or the encrypted .env file.
+func renderEnvCatalog(cfg *model.SetupConfig, ctx envContext) []renderedEnvSection {
+	sections := make([]renderedEnvSection, 0, len(envCatalog))
+	for _, section := range envCatalog {
+		rendered := renderedEnvSection{Comments: section.Comments}
+		for _, v := range section.Vars {
+			if v.secret() && separatesSecrets(cfg) {
+				continue
+			}
+			rendered.Vars = append(rendered.Vars, renderedEnvVar{Name: v.Name, Value: v.value(cfg, ctx)})
+		}
+		sections = append(sections, rendered)
+	}
+	return sections
+}
+
+// composeEnvVars returns the environment a compose service receives from the
+// .env file, in catalog order. In Docker secrets mode a secret is passed as
+// its _FILE variant instead.
+func composeEnvVars(cfg *model.SetupConfig, service string) []composeEnvVar {
+	var vars []composeEnvVar
+	for _, section := range envCatalog {
+		for _, v := range section.Vars {
+			if !v.targets(service) {
+				continue
+			}
+			if v.secret() && usesDockerSecrets(cfg) {
+				vars = append(vars, secretEnv(cfg, v.Name, v.Name))
+				continue
+			}
+			var value any = "$" + v.Name
+			if v.Compose != nil {
+				value = v.Compose(cfg)
+			}
+			vars = append(vars, composeEnvVar{Name: v.Name, Value: value})
+		}
+	}
+	return vars
+}
+
+// applyEnvVars copies the variables of an existing .env file back into the
+// config fields they were generated from. Secrets are always taken from the
+// file; other fields only when the file holds a value other than the default.
+// With secretsOnly set, only secret fields are touched.
+func applyEnvVars(cfg *model.SetupConfig, envVars map[string]string, secretsOnly bool) {
+	for _, section := range envCatalog {
+		for _, v := range section.Vars {
+			if v.Field == "" || (secretsOnly && !v.secret()) {
+				continue
+			}
+
+			value, ok := envVars[v.Name]
+			if !ok {
+				continue
+			}
+			if !v.secret() {
+				if value == "" || (v.Default != nil && value == v.Default(cfg)) {
+					continue
+				}
+			}
+
+			if err := setConfigField(configField(cfg, v.Field), value); err != nil {
+				log.Printf("Warning: ignoring invalid value for %s: %v", v.Name, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/biliqiqi/baklab-setup/internal/model"
+)
+
+func TestEnvCatalogFieldsResolve(t *testing.T) {
+	cfg := &model.SetupConfig{}
+	seen := map[string]bool{}
+
+	for _, section := range envCatalog {
+		for _, v := range section.Vars {
+			if seen[v.Name] {
+				t.Errorf("%s is listed twice", v.Name)
+			}
+			seen[v.Name] = true
+
+			if v.Field == "" {
+				if v.Value == nil {
+					t.Errorf("%s has neither a field nor a value", v.Name)
+				}
+				continue
+			}
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						t.Errorf("%s: %v", v.Name, r)
+					}
+				}()
+				formatConfigField(configField(cfg, v.Field))
+			}()
+		}
+	}
+}
+
+var composeEnvReference = regexp.MustCompile(`\$\{?([A-Z_][A-Z0-9_]*)`)
+
+// TestComposeEnvironmentUsesCatalog checks that every variable the compose
+// file reads from the environment is written to the .env file.
+func TestComposeEnvironmentUsesCatalog(t *testing.T) {
+	written := map[string]bool{"UID": true, "GID": true}
+	for _, section := range renderEnvCatalog(&model.SetupConfig{}, envContext{}) {
+		for _, v := range section.Vars {
+			written[v.Name] = true
+		}
+	}
+
+	cfg := &model.SetupConfig{
+		Database: model.DatabaseConfig{ServiceType: "docker"},
+		Redis:    model.RedisConfig{ServiceType: "docker"},
+		SSL:      model.SSLConfig{Enabled: true},
+		GoAccess: model.GoAccessConfig{Enabled: true},
+		App:      model.AppConfig{UserGuideHostName: "docs.example.com"},
+	}
+	content, err := NewGeneratorService().marshalComposeFile(cfg)
+	if err != nil {
+		t.Fatalf("marshalComposeFile() failed: %v", err)
+	}
+
+	for _, match := range composeEnvReference.FindAllStringSubmatch(strings.ReplaceAll(string(content), "$$", ""), -1) {
+		if !written[match[1]] {
+			t.Errorf("compose file references %s, which the .env file does not define", match[1])
+		}
+	}
+
+	app := map[string]bool{}
+	for _, v := range composeEnvVars(cfg, "app") {
+		app[v.Name] = true
+	}
+	if !app["USER_GUIDE_HOST_NAME"] {
+		t.Errorf("the app service should receive USER_GUIDE_HOST_NAME")
+	}
+}
+
+func TestApplyEnvVarsRoundTrip(t *testing.T) {
+	want := &model.SetupConfig{
+		Database:  model.DatabaseConfig{Host: "pg.internal", Port: 15432, Name: "forum", SuperUser: "postgres", SuperPassword: "Super'Pass1", AppUser: "forum", AppPassword: "App#Pass1"},
+		Redis:     model.RedisConfig{Host: "cache.internal", Port: 16379, User: "forum", Password: "Redis$Pass1", AdminPassword: "Admin Pass1"},
+		SMTP:      model.SMTPConfig{Server: "smtp.example.com", Port: 2525, User: "mailer", Password: "Mail\"Pass1", Sender: "forum@example.com"},
+		SMS:       model.SMSConfig{Provider: "aliyun", APIKey: "key", APISecret: "sms-secret"},
+		AdminUser: model.AdminUserConfig{Username: "admin", Password: "Admin!Pass1", Email: "admin@example.com"},
+		OAuth:     model.OAuthConfig{GoogleClientID: "google-id", GoogleSecret: "google-secret", FrontendOrigin: "https://app.example.com"},
+		App: model.AppConfig{
+			DomainName:         "example.com",
+			StaticHostName:     "static.example.com",
+			UserGuideHostName:  "docs.example.com",
+			BrandName:          "Bob's Forum",
+			DefaultLang:        "en",
+			Version:            "v1.2.3",
+			CORSAllowOrigins:   []string{"https://a.example.com", "https://b.example.com"},
+			RateLimitReqPerMin: 250,
+			CloudflareSecret:   "cf-secret",
+		},
+	}
+
+	envVars := map[string]string{}
+	for _, section := range renderEnvCatalog(want, envContext{}) {
+		for _, v := range section.Vars {
+			content := v.Name + "=" + encodeEnvValue(v.Value)
+			parsed, err := parseEnv(content)
+			if err != nil {
+				t.Fatalf("parseEnv(%q) failed: %v", content, err)
+			}
+			envVars[v.Name] = parsed[v.Name]
+		}
+	}
+
+	got := &model.SetupConfig{App: model.AppConfig{DomainName: "example.com"}}
+	applyEnvVars(got, envVars, false)
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("applyEnvVars() = %+v, want %+v", got, want)
+	}
+
+	secretsOnly := &model.SetupConfig{}
+	applyEnvVars(secretsOnly, envVars, true)
+	if secretsOnly.SMS.APISecret != "sms-secret" || secretsOnly.Database.Host != "" {
+		t.Errorf("applyEnvVars(secretsOnly) should only set secrets, got %+v", secretsOnly)
+	}
+}
@@ -11,17 +11,20 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"text/template"
 	"time"
 
+	"github.com/biliqiqi/baklab-setup/internal/dirlock"
 	"github.com/biliqiqi/baklab-setup/internal/model"
-	"github.com/biliqiqi/baklab-setup/internal/utils"
 )
 
 type GeneratorService struct {
-	outputDir   string
-	templatesFS fs.FS
+	outputDir       string
+	templatesFS     fs.FS
+	backupRetention int
+	out             outputFS
 }
 
 func rootDomain(domain string) string {
@@ -67,6 +70,7 @@ func composeFileName(cfg *model.SetupConfig) string {
 func NewGeneratorService() *GeneratorService {
 	return &GeneratorService{
 		outputDir: "./output",
+		out:       diskFS{},
 	}
 }
 
@@ -87,38 +91,15 @@ func (g *GeneratorService) GetAbsoluteOutputDir() (string, error) {
 }
 
 func (g *GeneratorService) ClearOutputDir() error {
-	if _, err := os.Stat(g.outputDir); os.IsNotExist(err) {
-		return nil
-	}
-
-	entries, err := os.ReadDir(g.outputDir)
+	paths, err := g.managedOutputPaths()
 	if err != nil {
-		return fmt.Errorf("failed to read output directory: %w", err)
+		return err
 	}
 
-	for _, entry := range entries {
-		entryPath := filepath.Join(g.outputDir, entry.Name())
-
-		if entry.Name() == "nginx" {
-			if err := g.clearNginxDir(entryPath); err != nil {
-				return fmt.Errorf("failed to clear nginx directory: %w", err)
-			}
-			continue
-		}
+	for _, relPath := range paths {
+		entryPath := filepath.Join(g.outputDir, relPath)
 
-		if entry.Name() == "caddy" {
-			if err := g.clearCaddyDir(entryPath); err != nil {
-				return fmt.Errorf("failed to clear caddy directory: %w", err)
-			}
-			continue
-		}
-
-		if entry.Name() == "ssl" {
-			log.Printf("Preserving existing SSL directory: %s", entryPath)
-			continue
-		}
-
-		if entry.Name() == "frontend_dist" {
+		if relPath == "frontend_dist" {
 			if err := g.clearFrontendDistDir(entryPath); err != nil {
 				return fmt.Errorf("failed to clear frontend_dist directory: %w", err)
 			}
@@ -133,54 +114,53 @@ func (g *GeneratorService) ClearOutputDir() error {
 	return nil
 }
 
-func (g *GeneratorService) clearNginxDir(nginxPath string) error {
-	entries, err := os.ReadDir(nginxPath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil
-		}
-		return err
-	}
-
-	for _, entry := range entries {
-		entryPath := filepath.Join(nginxPath, entry.Name())
-
-		if entry.Name() == "logs" {
-			log.Printf("Skipping nginx/logs directory to avoid permission issues")
-			continue
-		}
-
-		if err := os.RemoveAll(entryPath); err != nil {
-			return fmt.Errorf("failed to remove %s: %w", entryPath, err)
-		}
-	}
-
-	return nil
+// preservedOutputEntries lists, per directory of the output dir, the entries
+// that survive regeneration: certificates, runtime data written by the
+// containers (which may not be removable by this user), the lock file and
+// the output backups.
+var preservedOutputEntries = map[string][]string{
+	".":          {"ssl", dirlock.FileName},
+	"nginx":      {"logs"},
+	"caddy":      {"data", "config", "logs", "certbot"},
+	setupDirName: {backupsDirName},
 }
 
-func (g *GeneratorService) clearCaddyDir(caddyPath string) error {
-	entries, err := os.ReadDir(caddyPath)
+// managedOutputPaths returns the paths, relative to the output dir, that
+// ClearOutputDir removes and output backups capture.
+func (g *GeneratorService) managedOutputPaths() ([]string, error) {
+	entries, err := os.ReadDir(g.outputDir)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil
+			return nil, nil
 		}
-		return err
+		return nil, fmt.Errorf("failed to read output directory: %w", err)
 	}
 
+	var paths []string
 	for _, entry := range entries {
-		entryPath := filepath.Join(caddyPath, entry.Name())
+		name := entry.Name()
+		if slices.Contains(preservedOutputEntries["."], name) {
+			continue
+		}
 
-		if entry.Name() == "data" || entry.Name() == "config" || entry.Name() == "logs" || entry.Name() == "certbot" {
-			log.Printf("Skipping caddy/%s directory to avoid permission issues", entry.Name())
+		preserved, partial := preservedOutputEntries[name]
+		if !partial || !entry.IsDir() {
+			paths = append(paths, name)
 			continue
 		}
 
-		if err := os.RemoveAll(entryPath); err != nil {
-			return fmt.Errorf("failed to remove %s: %w", entryPath, err)
+		subEntries, err := os.ReadDir(filepath.Join(g.outputDir, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s directory: %w", name, err)
+		}
+		for _, subEntry := range subEntries {
+			if !slices.Contains(preserved, subEntry.Name()) {
+				paths = append(paths, filepath.Join(name, subEntry.Name()))
+			}
 		}
 	}
 
-	return nil
+	return paths, nil
 }
 
 func (g *GeneratorService) clearFrontendDistDir(frontendDistPath string) error {
@@ -232,142 +212,22 @@ func (g *GeneratorService) clearFrontendDistDir(frontendDistPath string) error {
 }
 
 func (g *GeneratorService) GenerateEnvFile(cfg *model.SetupConfig) error {
-	if err := os.MkdirAll(g.outputDir, 0755); err != nil {
+	if err := g.out.MkdirAll(g.outputDir, 0755); err != nil {
 		return fmt.Errorf("failed to create output directory: %w", err)
 	}
 
 	dataDir := filepath.Join("./data")
-	if err := os.MkdirAll(dataDir, 0755); err != nil {
+	if err := g.out.MkdirAll(dataDir, 0755); err != nil {
 		return fmt.Errorf("failed to create data directory: %w", err)
 	}
 
 	logsDir := filepath.Join("./data/logs")
-	if err := os.MkdirAll(logsDir, 0755); err != nil {
+	if err := g.out.MkdirAll(logsDir, 0755); err != nil {
 		return fmt.Errorf("failed to create logs directory: %w", err)
 	}
 
-	envTemplate := `# Generated by baklab setup service
-# Generated at: {{ .Timestamp }}
-
-# Language Configuration
-DEFAULT_LANG={{ .App.DefaultLang }}
-
-# Database Configuration
-DB_HOST='{{ .Database.Host }}'
-DB_PORT={{ .Database.Port }}
-PG_USER='{{ .Database.SuperUser }}'
-PG_PASSWORD='{{ .Database.SuperPassword }}'
-APP_DB_NAME='{{ .Database.Name }}'
-APP_DB_USER='{{ .Database.AppUser }}'
-APP_DB_PASSWORD='{{ .Database.AppPassword }}'
-
-# Redis Configuration
-REDIS_HOST='{{ .Redis.Host }}'
-REDIS_PORT={{ .Redis.Port }}
-REDIS_USER='{{ .Redis.User }}'
-REDIS_PASSWORD='{{ .Redis.Password }}'
-REDISCLI_AUTH='{{ .Redis.AdminPassword }}'
-
-# Application Configuration
-SERVER_DOMAIN_NAME='{{ .App.DomainName }}'
-ROOT_DOMAIN_NAME='{{ rootDomain .App.DomainName }}'
-BRAND_NAME='{{ .App.BrandName }}'
-DEBUG={{ if .Development }}true{{ else }}{{ .App.Debug }}{{ end }}
-DEV={{ .Development }}
-TEST=false
-APP_VERSION={{ if .App.Version }}{{ .App.Version }}{{ else }}latest{{ end }}
-
-# Go Runtime Configuration
-GOMAXPROCS=1
-
-# HTTPS Configuration
-# Set to true when using HTTPS (nginx SSL configuration)
-USE_HTTPS={{ if .Development }}false{{ else }}{{ .SSL.Enabled }}{{ end }}
-
-JWT_KEY_FILE=./keys/jwt-private.pem
-
-# Application Ports
-APP_PORT=3000
-APP_OUTER_PORT=3000
-{{ if .OAuth.FrontendOrigin }}FRONTEND_ORIGIN='{{ .OAuth.FrontendOrigin }}'{{ else }}FRONTEND_ORIGIN='http{{ if and (not .Development) .SSL.Enabled }}s{{ end }}://{{ .App.DomainName }}'{{ end }}
-NGINX_PORT=80
-NGINX_SSL_PORT=443
-
-# Network Configuration
-{{ if .Development }}CORS_ALLOW_ORIGINS=
-{{ else if .CORSOrigins }}CORS_ALLOW_ORIGINS='{{ .CORSOrigins }}'{{ else }}CORS_ALLOW_ORIGINS='http{{ if ne .App.DomainName "localhost" }}s{{ end }}://{{ .App.DomainName }}'{{ end }}
-
-# Frontend Configuration
-{{ if .App.SSREnabled }}FRONTEND_CONTAINER_ID='{{ .App.FrontendContainerId }}'{{ else }}FRONTEND_CONTAINER_ID=root{{ end }}
-{{ if .App.SSREnabled }}FRONTEND_SCRIPTS='{{ join .App.FrontendScripts "," }}'{{ else }}FRONTEND_SCRIPTS={{ end }}
-{{ if .App.SSREnabled }}FRONTEND_STYLES='{{ join .App.FrontendStyles "," }}'{{ else }}FRONTEND_STYLES={{ end }}
-
-# Service Configuration
-STATIC_HOST_NAME='{{ .App.StaticHostName }}'
-{{ if .App.RankingHostName }}RANKING_HOST_NAME='{{ .App.RankingHostName }}'{{ else }}RANKING_HOST_NAME=''{{ end }}
-{{ if .App.UserGuideHostName }}USER_GUIDE_HOST_NAME='{{ .App.UserGuideHostName }}'{{ else }}USER_GUIDE_HOST_NAME=''{{ end }}
-{{ if .App.DizkazDomainName }}DIZKAZ_DOMAIN_NAME='{{ .App.DizkazDomainName }}'{{ else }}DIZKAZ_DOMAIN_NAME=''{{ end }}
-{{ if .App.DizkazSitePath }}DIZKAZ_SITE_PATH='{{ .App.DizkazSitePath }}'{{ else }}DIZKAZ_SITE_PATH=''{{ end }}
-
-# OAuth Configuration (optional)
-{{ if .OAuth.GoogleClientID }}GOOGLE_CLIENT_ID='{{ .OAuth.GoogleClientID }}'{{ else }}GOOGLE_CLIENT_ID={{ end }}
-{{ if .OAuth.GoogleSecret }}GOOGLE_CLIENT_SECRET='{{ .OAuth.GoogleSecret }}'{{ else }}GOOGLE_CLIENT_SECRET={{ end }}
-{{ if .OAuth.GithubClientID }}GITHUB_CLIENT_ID='{{ .OAuth.GithubClientID }}'{{ else }}GITHUB_CLIENT_ID={{ end }}
-{{ if .OAuth.GithubSecret }}GITHUB_CLIENT_SECRET='{{ .OAuth.GithubSecret }}'{{ else }}GITHUB_CLIENT_SECRET={{ end }}
-
-# Cloudflare Configuration (optional)
-{{ if .App.CloudflareSiteKey }}CLOUDFLARE_SITE_KEY='{{ .App.CloudflareSiteKey }}'{{ else }}CLOUDFLARE_SITE_KEY={{ end }}
-{{ if .App.CloudflareSecret }}CLOUDFLARE_SECRET='{{ .App.CloudflareSecret }}'{{ else }}CLOUDFLARE_SECRET={{ end }}
-
-# Global Rate Limiting (requests per minute per IP)
-# Protects against crawler/bot abuse and DDoS attacks
-# Default: 100 requests per minute per IP
-RATE_LIMIT_REQ_PER_MIN={{ if .App.RateLimitReqPerMin }}{{ .App.RateLimitReqPerMin }}{{ else }}100{{ end }}
-
-# SMTP Configuration (optional)
-{{ if .SMTP.Server }}SMTP_SERVER='{{ .SMTP.Server }}'{{ else }}SMTP_SERVER={{ end }}
-SMTP_SERVER_PORT={{ if .SMTP.Port }}{{ .SMTP.Port }}{{ else }}587{{ end }}
-{{ if .SMTP.User }}SMTP_USER='{{ .SMTP.User }}'{{ else }}SMTP_USER={{ end }}
-{{ if .SMTP.Password }}SMTP_PASSWORD='{{ .SMTP.Password }}'{{ else }}SMTP_PASSWORD={{ end }}
-{{ if .SMTP.Sender }}SMTP_SENDER='{{ .SMTP.Sender }}'{{ else }}SMTP_SENDER='noreply@{{ .App.DomainName }}'{{ end }}
-
-# Super User Configuration (Initial Admin User)
-SUPER_USER='{{ .AdminUser.Username }}'
-SUPER_PASSWORD='{{ .AdminUser.Password }}'
-SUPER_USER_EMAIL='{{ .AdminUser.Email }}'
-
-# SMS Configuration (optional)
-{{ if .SMS.Provider }}SMS_PROVIDER='{{ .SMS.Provider }}'{{ else }}SMS_PROVIDER={{ end }}
-{{ if .SMS.Endpoint }}SMS_ENDPOINT='{{ .SMS.Endpoint }}'{{ else }}SMS_ENDPOINT={{ end }}
-{{ if .SMS.APIKey }}SMS_API_KEY='{{ .SMS.APIKey }}'{{ else }}SMS_API_KEY={{ end }}
-{{ if .SMS.APISecret }}SMS_API_SECRET='{{ .SMS.APISecret }}'{{ else }}SMS_API_SECRET={{ end }}
-{{ if .SMS.SignName }}SMS_SIGN_NAME='{{ .SMS.SignName }}'{{ else }}SMS_SIGN_NAME={{ end }}
-{{ if .SMS.TemplateRegister }}SMS_TEMPLATE_REGISTER='{{ .SMS.TemplateRegister }}'{{ else }}SMS_TEMPLATE_REGISTER={{ end }}
-{{ if .SMS.TemplateReset }}SMS_TEMPLATE_RESET='{{ .SMS.TemplateReset }}'{{ else }}SMS_TEMPLATE_RESET={{ end }}
-{{ if .SMS.From }}SMS_FROM='{{ .SMS.From }}'{{ else }}SMS_FROM={{ end }}
-
-# File Paths
-{{ if hasGeoFile .SetupConfig }}GEOIP_ENABLED=true
-GEOIP_FILE=./geoip/GeoLite2-City.mmdb{{ else }}GEOIP_ENABLED=false
-GEOIP_FILE=./geoip/Country.mmdb{{ end }}
-I18N_FILE_DIR=./i18n
-MIGRATION_FILE_DIR=./config/db/migrations
-DEFAULT_DATA_DIR=./config/defaults
-
-# Development Configuration
-HOST_PROXY=
-APP_LOCAL_HOST=172.17.0.1
-
-# Setup Status
-SETUP_COMPLETED=true
-SETUP_COMPLETED_AT={{ .Timestamp }}
-
-# User Configuration (for Docker permissions)
-UID={{ .UserID }}
-GID={{ .GroupID }}
-`
-
 	funcMap := template.FuncMap{
+		"env":        encodeEnvValue,
 		"rootDomain": rootDomain,
 		"join": func(slice []string, sep string) string {
 			return strings.Join(slice, sep)
@@ -378,32 +238,40 @@ GID={{ .GroupID }}
 		},
 	}
 
-	tmpl, err := template.New("env").Funcs(funcMap).Parse(envTemplate)
+	envTemplateContent, err := fs.ReadFile(g.templatesFS, "env.template")
+	if err != nil {
+		return fmt.Errorf("failed to read env.template: %w", err)
+	}
+
+	tmpl, err := template.New("env").Funcs(funcMap).Parse(string(envTemplateContent))
 	if err != nil {
 		return fmt.Errorf("failed to parse env template: %w", err)
 	}
 
-	corsOrigins := ""
-	if len(cfg.App.CORSAllowOrigins) > 0 {
-		corsOrigins = strings.Join(cfg.App.CORSAllowOrigins, ",")
+	ctx := envContext{
+		Timestamp: time.Now().Format(time.RFC3339),
+		UserID:    fmt.Sprintf("%d", os.Getuid()),
+		GroupID:   fmt.Sprintf("%d", os.Getgid()),
 	}
 
+	// The config and the individual values stay available to customized
+	// templates; the built-in one writes the catalog sections.
 	data := struct {
 		*model.SetupConfig
-		Timestamp   string
-		CORSOrigins string
-		UserID      string
-		GroupID     string
+		Timestamp string
+		UserID    string
+		GroupID   string
+		Sections  []renderedEnvSection
 	}{
 		SetupConfig: cfg,
-		Timestamp:   time.Now().Format(time.RFC3339),
-		CORSOrigins: corsOrigins,
-		UserID:      fmt.Sprintf("%d", os.Getuid()),
-		GroupID:     fmt.Sprintf("%d", os.Getgid()),
+		Timestamp:   ctx.Timestamp,
+		UserID:      ctx.UserID,
+		GroupID:     ctx.GroupID,
+		Sections:    renderEnvCatalog(cfg, ctx),
 	}
 
 	filePath := filepath.Join(g.outputDir, envFileName(cfg))
-	file, err := os.Create(filePath)
+	file, err := g.out.Create(filePath)
 	if err != nil {
 		return fmt.Errorf("failed to create env file: %w", err)
 	}
@@ -427,7 +295,7 @@ func (g *GeneratorService) handleSSLCertificates(cfg *model.SetupConfig) error {
 
 	// Create ssl directory in output
 	sslDir := filepath.Join(g.outputDir, "ssl")
-	if err := os.MkdirAll(sslDir, 0755); err != nil {
+	if err := g.out.MkdirAll(sslDir, 0755); err != nil {
 		return fmt.Errorf("failed to create ssl directory: %w", err)
 	}
 
@@ -460,7 +328,7 @@ func (g *GeneratorService) handleSSLCertificates(cfg *model.SetupConfig) error {
 	}
 
 	// Verify copied files are not empty
-	certDestInfo, err := os.Stat(certDest)
+	certDestInfo, err := g.out.Stat(certDest)
 	if err != nil {
 		return fmt.Errorf("failed to verify copied certificate: %w", err)
 	}
@@ -468,7 +336,7 @@ func (g *GeneratorService) handleSSLCertificates(cfg *model.SetupConfig) error {
 		return fmt.Errorf("copied certificate file is empty: %s", certDest)
 	}
 
-	keyDestInfo, err := os.Stat(keyDest)
+	keyDestInfo, err := g.out.Stat(keyDest)
 	if err != nil {
 		return fmt.Errorf("failed to verify copied key: %w", err)
 	}
@@ -483,555 +351,35 @@ func (g *GeneratorService) handleSSLCertificates(cfg *model.SetupConfig) error {
 	return nil
 }
 
-func (g *GeneratorService) GenerateDockerConfig(cfg *model.SetupConfig) error {
-	g.normalizeJWTKeyConfig(cfg)
+// dockerArtifacts are the artifacts GenerateDockerConfig writes: everything
+// but the .env file, the secrets kept out of it, the JWT key and the saved
+// setup configuration.
+var dockerArtifacts = []string{"ssl", "db-init", "compose", "redis", "caddy", "nginx", "goaccess", "robots", "geoip", "directories", "gitignore"}
 
-	// Handle SSL certificates - copy to output/ssl directory
-	if cfg.SSL.Enabled {
-		if err := g.handleSSLCertificates(cfg); err != nil {
-			return fmt.Errorf("failed to handle SSL certificates: %w", err)
+// GenerateDockerConfig writes the compose file and the service configuration
+// the configuration uses.
+func (g *GeneratorService) GenerateDockerConfig(cfg *model.SetupConfig) error {
+	var names []string
+	for _, name := range dockerArtifacts {
+		if findArtifact(name).Enabled(cfg) {
+			names = append(names, name)
 		}
 	}
 
-	if err := g.copyTemplateFiles(cfg); err != nil {
-		return fmt.Errorf("failed to copy template files: %w", err)
-	}
-	dockerComposeTemplate := `# Generated by baklab setup service
-# {{ if .Development }}Development{{ else }}Production{{ end }} Docker Compose Configuration
-
-services:
-  static-initializer:
-    image: ghcr.io/biliqiqi/baklab:$APP_VERSION
-    container_name: "baklab-static-init"
-    volumes:
-      - ./frontend_dist:/frontend:ro
-      - static-data:/static-output
-    command: >
-      sh -c "
-        echo 'Initializing static files from app image...' &&
-        cp -r /app/static/* /static-output/ &&
-        if [ -f /frontend/manifest.webmanifest ]; then
-          echo 'Copying PWA manifest to static directory...' &&
-          cp /frontend/manifest.webmanifest /static-output/site.webmanifest &&
-          chmod 644 /static-output/site.webmanifest &&
-          echo 'PWA manifest copied successfully'
-        fi &&
-        echo 'Static files initialization completed'
-      "
-    depends_on:
-      frontend-builder:
-        condition: service_completed_successfully
-    restart: "no"
-
-  db-migrator:
-    image: ghcr.io/biliqiqi/baklab:$APP_VERSION
-    container_name: "baklab-db-migrator"
-    environment:
-      {{- if eq .Database.ServiceType "docker" }}
-      DB_HOST: "db"
-      DB_PORT: 5432
-      {{- else }}
-      DB_HOST: "{{.Database.Host}}"
-      DB_PORT: {{.Database.Port}}
-      {{- end }}
-      PG_USER: $PG_USER
-      PG_PASSWORD: $PG_PASSWORD
-      APP_DB_NAME: $APP_DB_NAME
-      MIGRATION_FILE_DIR: $MIGRATION_FILE_DIR
-    command: ["./baklab", "migrate"]
-    depends_on:
-      {{- if eq .Database.ServiceType "docker" }}
-      db:
-        condition: service_healthy
-      {{- end }}
-    restart: "no"
-
-  app:
-    image: ghcr.io/biliqiqi/baklab:$APP_VERSION
-    container_name: "baklab-app"
-    restart: unless-stopped
-    environment:
-      {{- if eq .Database.ServiceType "docker" }}
-      DB_CONTAINER_NAME: "baklab-db"
-      DB_HOST: "db"
-      DB_PORT: 5432
-      {{- else }}
-      DB_HOST: "{{.Database.Host}}"
-      DB_PORT: {{.Database.Port}}
-      {{- end }}
-      SERVER_DOMAIN_NAME: $SERVER_DOMAIN_NAME
-      APP_DB_NAME: $APP_DB_NAME
-      APP_DB_USER: $APP_DB_USER
-      APP_DB_PASSWORD: $APP_DB_PASSWORD
-      APP_PORT: $APP_PORT
-      APP_OUTER_PORT: $APP_OUTER_PORT
-      NGINX_PORT: $NGINX_PORT
-      NGINX_SSL_PORT: $NGINX_SSL_PORT
-      {{- if eq .Redis.ServiceType "docker" }}
-      REDIS_HOST: "redis"
-      REDIS_PORT: 6379
-      {{- else }}
-      REDIS_HOST: "{{.Redis.Host}}"
-      REDIS_PORT: {{.Redis.Port}}
-      {{- end }}
-      REDIS_USER: $REDIS_USER
-      REDIS_PASSWORD: $REDIS_PASSWORD
-      REDISCLI_AUTH: $REDISCLI_AUTH
-      SMTP_SERVER: $SMTP_SERVER
-      SMTP_SERVER_PORT: $SMTP_SERVER_PORT
-      SMTP_USER: $SMTP_USER
-      SMTP_PASSWORD: $SMTP_PASSWORD
-      SMTP_SENDER: $SMTP_SENDER
-      SMS_PROVIDER: $SMS_PROVIDER
-      SMS_ENDPOINT: $SMS_ENDPOINT
-      SMS_API_KEY: $SMS_API_KEY
-      SMS_API_SECRET: $SMS_API_SECRET
-      SMS_SIGN_NAME: $SMS_SIGN_NAME
-      SMS_TEMPLATE_REGISTER: $SMS_TEMPLATE_REGISTER
-      SMS_TEMPLATE_RESET: $SMS_TEMPLATE_RESET
-      SMS_FROM: $SMS_FROM
-      GOOGLE_CLIENT_ID: $GOOGLE_CLIENT_ID
-      GOOGLE_CLIENT_SECRET: $GOOGLE_CLIENT_SECRET
-      GITHUB_CLIENT_ID: $GITHUB_CLIENT_ID
-      GITHUB_CLIENT_SECRET: $GITHUB_CLIENT_SECRET
-      APP_VERSION: $APP_VERSION
-      CLOUDFLARE_SITE_KEY: $CLOUDFLARE_SITE_KEY
-      CLOUDFLARE_SECRET: $CLOUDFLARE_SECRET
-      JWT_KEY_FILE: $JWT_KEY_FILE
-      STATIC_HOST_NAME: $STATIC_HOST_NAME
-      RANKING_HOST_NAME: $RANKING_HOST_NAME
-      CORS_ALLOW_ORIGINS: $CORS_ALLOW_ORIGINS
-      FRONTEND_CONTAINER_ID: $FRONTEND_CONTAINER_ID
-      GEOIP_ENABLED: $GEOIP_ENABLED
-      GEOIP_FILE: $GEOIP_FILE
-      I18N_FILE_DIR: $I18N_FILE_DIR
-      MIGRATION_FILE_DIR: $MIGRATION_FILE_DIR
-      DEFAULT_DATA_DIR: $DEFAULT_DATA_DIR
-      DEFAULT_LANG: $DEFAULT_LANG
-      BRAND_NAME: $BRAND_NAME
-      DEBUG: $DEBUG
-      DEV: $DEV
-      TEST: $TEST
-      SUPER_USER: $SUPER_USER
-      SUPER_PASSWORD: $SUPER_PASSWORD
-      SUPER_USER_EMAIL: $SUPER_USER_EMAIL
-      USE_HTTPS: $USE_HTTPS
-      FRONTEND_ORIGIN: $FRONTEND_ORIGIN
-      GOMAXPROCS: $GOMAXPROCS
-      RATE_LIMIT_REQ_PER_MIN: $RATE_LIMIT_REQ_PER_MIN
-    {{- if .Development }}
-    ports:
-      - "${APP_OUTER_PORT:-3000}:${APP_PORT:-3000}"
-    {{- end }}
-    volumes:
-      {{ if .App.JWTKeyFromFile -}}
-      - {{ .App.JWTKeyFilePath }}:/app/keys/jwt-private.pem
-      {{- else -}}
-      - ./keys:/app/keys
-      {{- end }}
-      - ./frontend_dist:/frontend:ro
-      - ./manage_static:/app/manage_static:ro{{ if hasGeoFile . }}
-      - ./geoip:/app/geoip:ro{{ end }}
-    command: >
-      sh -c "
-        if [ -f /frontend/.frontend-manifest.json ]; then
-          echo 'Loading frontend configuration from manifest...' &&
-          FRONTEND_SCRIPTS=$$(cat /frontend/.frontend-manifest.json | grep -o '\"scripts\":[[:space:]]*\"[^\"]*\"' | cut -d'\"' -f4) &&
-          FRONTEND_STYLES=$$(cat /frontend/.frontend-manifest.json | grep -o '\"styles\":[[:space:]]*\"[^\"]*\"' | cut -d'\"' -f4) &&
-          export FRONTEND_SCRIPTS &&
-          export FRONTEND_STYLES &&
-          echo \"Loaded: FRONTEND_SCRIPTS=$$FRONTEND_SCRIPTS\" &&
-          echo \"Loaded: FRONTEND_STYLES=$$FRONTEND_STYLES\"
-        else
-          echo 'Frontend manifest not found, using defaults' &&
-          export FRONTEND_SCRIPTS='' &&
-          export FRONTEND_STYLES=''
-        fi &&
-        echo 'Starting baklab with entrypoint script...' &&
-        ./docker-entrypoint.sh
-      "
-    depends_on:
-      static-initializer:
-        condition: service_completed_successfully
-      db-migrator:
-        condition: service_completed_successfully
-      {{- if eq .Database.ServiceType "docker" }}
-      db:
-        condition: service_healthy
-      {{- end }}
-      {{- if eq .Redis.ServiceType "docker" }}
-      redis:
-        condition: service_healthy
-      {{- end }}
-    {{- if or (eq .Database.ServiceType "docker") (eq .Redis.ServiceType "docker") }}
-    links:
-      {{- if eq .Database.ServiceType "docker" }}
-      - db
-      {{- end }}
-      {{- if eq .Redis.ServiceType "docker" }}
-      - redis
-      {{- end }}
-    {{- end }}
-    healthcheck:
-      test: ["CMD", "curl", "-f", "http://localhost:$APP_PORT/health"]
-      interval: 30s
-      timeout: 10s
-      retries: 3
-      start_period: 30s
-{{ if eq .Database.ServiceType "docker" }}
-
-  db:
-    build:
-      context: .
-      dockerfile: ./Dockerfile.pg
-    container_name: "baklab-db"
-    restart: unless-stopped
-    volumes:
-      - db-data:/var/lib/postgresql/data
-      - ./db/initdb:/docker-entrypoint-initdb.d/
-      - ./db/postgresql.conf:/etc/postgresql/custom/postgresql.conf
-    command:
-      - postgres
-      - -c
-      - config_file=/etc/postgresql/custom/postgresql.conf
-    environment:
-      - POSTGRES_USER=${PG_USER}
-      - POSTGRES_DB=postgres
-      - POSTGRES_PASSWORD=${PG_PASSWORD}
-      - APP_DB_NAME=${APP_DB_NAME}
-      - APP_DB_USER=${APP_DB_USER}
-      - APP_DB_PASSWORD=${APP_DB_PASSWORD}
-      - PGTZ=UTC
-      - DEBUG=${DEBUG:-false}
-    ports:
-      - ${DB_PORT}:5432
-    healthcheck:
-      test: ["CMD-SHELL", "pg_isready -U ${PG_USER} -d postgres"]
-      interval: 10s
-      timeout: 5s
-      retries: 5
-{{ end }}
-{{ if eq .Redis.ServiceType "docker" }}
-  redis-acl-generator:
-    image: alpine:latest
-    container_name: "baklab-redis-acl-gen"
-    environment:
-      - REDIS_USER=${REDIS_USER}
-      - REDIS_PASSWORD=${REDIS_PASSWORD}
-      - REDISCLI_AUTH=${REDISCLI_AUTH}
-    volumes:
-      - ./redis:/src:ro
-      - redis-config:/config
-    command: |
-      sh -c '
-        cp /src/redis.conf /config/
-        echo "user default on >$$REDISCLI_AUTH ~* +@all" > /config/users.acl
-        echo "user $$REDIS_USER on >$$REDIS_PASSWORD ~* resetchannels -@all +@read +@write +@list +@hash +@set +@string +@connection +@scripting +scan +del +exists +type +ttl +expire" >> /config/users.acl
-        echo "ACL file generated successfully"
-        echo "Users configured: default (admin access), $$REDIS_USER (app access)"
-        echo "ACL file location: /config/users.acl"
-      '
-
-  redis:
-    image: valkey/valkey:7.2-alpine
-    container_name: "baklab-redis"
-    depends_on:
-      redis-acl-generator:
-        condition: service_completed_successfully
-    environment:
-      - REDIS_USER=${REDIS_USER}
-      - REDIS_PASSWORD=${REDIS_PASSWORD}
-      - REDISCLI_AUTH=${REDISCLI_AUTH}
-    volumes:
-      - redis-data:/data
-      - ./redis/redis.conf:/usr/local/etc/redis/redis.conf:ro
-      - redis-config:/usr/local/etc/redis
-    command: valkey-server /usr/local/etc/redis/redis.conf
-    ports:
-      - ${REDIS_PORT}:6379
-    healthcheck:
-      test: ["CMD", "valkey-cli", "ping"]
-      interval: 10s
-      timeout: 5s
-      retries: 5
-{{ end }}
-  frontend-builder:
-    image: ghcr.io/biliqiqi/baklab-web:latest
-    container_name: "baklab-frontend-builder"
-    user: "${UID:-1000}:${GID:-1000}"
-    environment:
-      {{- if .SSL.Enabled }}
-      - STATIC_HOST=https://$STATIC_HOST_NAME
-      - FRONTEND_HOST=https://$SERVER_DOMAIN_NAME
-      {{- else }}
-      - STATIC_HOST=http://$STATIC_HOST_NAME
-      - FRONTEND_HOST=http://$SERVER_DOMAIN_NAME
-      {{- end }}
-      {{- if .App.FrontendDecoupled }}
-      {{- if .SSL.Enabled }}
-      - API_HOST=https://$SERVER_DOMAIN_NAME
-      {{- else }}
-      - API_HOST=http://$SERVER_DOMAIN_NAME
-      {{- end }}
-      {{- else }}
-      - API_HOST=
-      {{- end }}
-      - BASE_URL=/static/frontend/
-      - API_PATH_PREFIX=/api/
-      - OAUTH_PROVIDERS={{ oauthProviders .OAuth }}
-      - BRAND_NAME=$BRAND_NAME
-    volumes:
-      - ./frontend_dist:/output
-    restart: "no"
-{{- $proxyType := .ReverseProxy.Type }}
-{{- if eq $proxyType "" }}
-{{- $proxyType = "caddy" }}
-{{- end }}
-{{- if eq $proxyType "nginx" }}
-  nginx:
-    image: nginx:1.25.2-alpine
-    container_name: "baklab-nginx"
-    restart: unless-stopped
-    environment:
-      - APP_LOCAL_HOST=app
-      - APP_PORT=$APP_PORT
-      - SERVER_DOMAIN_NAME=$SERVER_DOMAIN_NAME
-      - ROOT_DOMAIN_NAME=$ROOT_DOMAIN_NAME
-      - RANKING_HOST_NAME=$RANKING_HOST_NAME
-      - USER_GUIDE_HOST_NAME=$USER_GUIDE_HOST_NAME
-    volumes:
-      - static-data:/data/static
-      - ./frontend_dist:/data/static/frontend:ro
-      - ./static:/data/custom_static:ro
-      - ./nginx/nginx.conf:/etc/nginx/nginx.conf:ro
-      - ./nginx/templates/baklab.conf.template:/etc/nginx/templates/baklab.conf.template:ro
-      - ./nginx/logs:/etc/nginx/logs{{if .SSL.Enabled}}
-      - ./ssl/fullchain.pem:/etc/ssl/certs/server.crt:ro
-      - ./ssl/privkey.pem:/etc/ssl/private/server.key:ro{{end}}
-    ports:{{if .SSL.Enabled}}
-      - $NGINX_SSL_PORT:443{{end}}
-      - $NGINX_PORT:80
-    depends_on:
-      app:
-        condition: service_healthy
-    healthcheck:
-      test: ["CMD-SHELL", "curl -H 'Host: $SERVER_DOMAIN_NAME' -f http://localhost:80/health"]
-      interval: 30s
-      timeout: 10s
-      retries: 3
-      start_period: 10s
-{{- else }}
-  caddy:
-    image: caddy:2.8-alpine
-    container_name: "baklab-caddy"
-    restart: unless-stopped
-    dns:
-      - 8.8.8.8
-      - 1.1.1.1
-      - 223.5.5.5
-    environment:
-      - APP_PORT=$APP_PORT
-      - SERVER_DOMAIN_NAME=$SERVER_DOMAIN_NAME
-      - ROOT_DOMAIN_NAME=$ROOT_DOMAIN_NAME
-      - RANKING_HOST_NAME=$RANKING_HOST_NAME
-      - USER_GUIDE_HOST_NAME=$USER_GUIDE_HOST_NAME
-      - DIZKAZ_DOMAIN_NAME=$DIZKAZ_DOMAIN_NAME
-      - DIZKAZ_SITE_PATH=$DIZKAZ_SITE_PATH
-    volumes:
-      - static-data:/data/static
-      - ./frontend_dist:/data/static/frontend:ro
-      - ./static:/data/custom_static:ro
-      - ./caddy/Caddyfile:/etc/caddy/Caddyfile:ro
-      - ./caddy/optional:/etc/caddy/optional:rw
-      - caddy-data:/data
-      - caddy-config:/config
-      - ./caddy/logs:/var/log/caddy{{if .SSL.Enabled}}
-      - ./ssl/fullchain.pem:/etc/ssl/certs/server.crt:ro
-      - ./ssl/privkey.pem:/etc/ssl/private/server.key:ro{{end}}
-    ports:
-      - $NGINX_PORT:80{{if .SSL.Enabled}}
-      - $NGINX_SSL_PORT:443
-      - $NGINX_SSL_PORT:443/udp{{end}}
-    entrypoint: >
-      sh -c '
-        mkdir -p /var/log/caddy &&
-        touch /var/log/caddy/access.log &&
-        if [ -n "$$DIZKAZ_DOMAIN_NAME" ] && [ "$$DIZKAZ_DOMAIN_NAME" != "" ]; then
-          echo "Enabling DIZKAZ domain configuration for: $$DIZKAZ_DOMAIN_NAME"
-          cp /etc/caddy/optional/dizkaz.caddy.template /etc/caddy/optional/dizkaz.caddy
-        else
-          echo "DIZKAZ domain not configured, skipping"
-          rm -f /etc/caddy/optional/dizkaz.caddy
-        fi &&
-        caddy run --config /etc/caddy/Caddyfile --adapter caddyfile
-      '
-    depends_on:
-      app:
-        condition: service_healthy
-    healthcheck:
-      test: ["CMD-SHELL", "wget --no-verbose --tries=1 --spider --header='Host: $$SERVER_DOMAIN_NAME' http://localhost:80/health"]
-      interval: 30s
-      timeout: 10s
-      retries: 3
-      start_period: 10s
-{{- end }}
-{{ if .GoAccess.Enabled }}
-  goaccess:
-    image: allinurl/goaccess:1.7.2
-    container_name: "baklab-goaccess"
-    restart: unless-stopped{{if .SSL.Enabled}}
-    {{- if eq $proxyType "nginx" }}
-    entrypoint: 'sh -c "/bin/goaccess /data/logs/access.log -o /data/static/report.html --real-time-html --port=9880 --ssl-cert=$$SSL_CERT --ssl-key=$$SSL_KEY --log-format=$$LOG_FORMAT"'
-    environment:
-      - LOG_FORMAT={{- if eq $proxyType "nginx" }}COMMON{{- else }}CADDY{{- end }}
-      - TZ="China/Shanghai"
-      - SSL_CERT=/etc/ssl/certs/server.crt
-      - SSL_KEY=/etc/ssl/private/server.key
-    {{- else }}
-    entrypoint: >
-      sh -c '
-        SSL_CERT=$$(find /data/caddy/certificates -type f -path "*/$$SERVER_DOMAIN_NAME/$$SERVER_DOMAIN_NAME.crt" | head -n1) &&
-        SSL_KEY=$$(find /data/caddy/certificates -type f -path "*/$$SERVER_DOMAIN_NAME/$$SERVER_DOMAIN_NAME.key" | head -n1) &&
-        if [ -z "$$SSL_CERT" ] || [ -z "$$SSL_KEY" ]; then
-          echo "Failed to locate Caddy-managed certificate for $$SERVER_DOMAIN_NAME in /data/caddy/certificates" &&
-          exit 1
-        fi &&
-        /bin/goaccess /data/logs/access.log -o /data/static/report.html --real-time-html --port=9880 --ssl-cert=$$SSL_CERT --ssl-key=$$SSL_KEY --log-format=$$LOG_FORMAT
-      '
-    environment:
-      - LOG_FORMAT=CADDY
-      - TZ="China/Shanghai"
-      - SERVER_DOMAIN_NAME=$SERVER_DOMAIN_NAME
-    {{- end }}
-      {{- else}}
-    entrypoint: 'sh -c "/bin/goaccess /data/logs/access.log -o /data/static/report.html --real-time-html --port=9880 --log-format=$$LOG_FORMAT"'
-    environment:
-      - LOG_FORMAT={{- if eq $proxyType "nginx" }}COMMON{{- else }}CADDY{{- end }}
-      - TZ="China/Shanghai"{{end}}
-    volumes:
-      - /var/www/goaccess:/var/www/goaccess:rw{{ if .GoAccess.HasGeoFile }}
-      - ./geoip:/data/geoip:ro{{ end }}{{if .SSL.Enabled}}
-{{- if eq $proxyType "nginx" }}
-      - ./ssl/fullchain.pem:/etc/ssl/certs/server.crt:ro
-      - ./ssl/privkey.pem:/etc/ssl/private/server.key:ro
-{{- else }}
-      - caddy-data:/data/caddy:ro
-{{- end }}{{end}}
-      - ./goaccess.conf:/etc/goaccess/goaccess.conf
-{{- if eq $proxyType "nginx" }}
-      - ./nginx/logs:/data/logs
-{{- else }}
-      - ./caddy/logs:/data/logs
-{{- end }}
-      - ./manage_static:/data/static
-    ports:
-      - "9880:9880"
-    depends_on:
-{{- if eq $proxyType "nginx" }}
-      nginx:
-        condition: service_healthy
-{{- else }}
-      caddy:
-        condition: service_healthy
-{{- end }}
-    healthcheck:
-      test: ["CMD", "sh", "-c", "pgrep -f goaccess && test -s /data/static/report.html"]
-      interval: 30s
-      timeout: 10s
-      retries: 3
-      start_period: 30s{{ end }}
-  dali:
-    image: ghcr.io/biliqiqi/dali-web:latest
-    container_name: "baklab-dali"
-    restart: unless-stopped
-    environment:
-      - STATIC_HOST={{ if .SSL.Enabled }}https{{ else }}http{{ end }}://$STATIC_HOST_NAME
-      - API_HOST={{ if .SSL.Enabled }}https{{ else }}http{{ end }}://$SERVER_DOMAIN_NAME
-      - API_PATH_PREFIX=
-      - BAKLAB_WEB_HOST={{ if .SSL.Enabled }}https{{ else }}http{{ end }}://$SERVER_DOMAIN_NAME
-    healthcheck:
-      test: ["CMD", "curl", "-f", "http://localhost:80"]
-      interval: 30s
-      timeout: 10s
-      retries: 3
-      start_period: 10s
-{{ if .App.UserGuideHostName }}
-  user-guide:
-    image: ghcr.io/biliqiqi/baklab-user-guide:latest
-    container_name: "baklab-user-guide"
-    restart: unless-stopped
-    healthcheck:
-      test: ["CMD", "wget", "--no-verbose", "--tries=1", "--spider", "http://localhost/health"]
-      interval: 30s
-      timeout: 10s
-      retries: 3
-      start_period: 10s
-{{ end }}
-
-volumes:
-  static-data:{{ if eq .Database.ServiceType "docker" }}
-  db-data:{{ end }}{{ if eq .Redis.ServiceType "docker" }}
-  redis-data:
-  redis-config:{{ end }}
-{{- if ne $proxyType "nginx" }}
-  caddy-data:
-  caddy-config:
-{{- end }}
-`
-
-	dockerFuncMap := template.FuncMap{
-		"oauthProviders": g.buildOAuthProviders,
-		"hasGeoFile": func(cfg *model.SetupConfig) bool {
-			return cfg.HasGeoFile()
-		},
-	}
+	return g.WriteArtifacts(cfg, names)
+}
 
-	tmpl, err := template.New("docker").Funcs(dockerFuncMap).Parse(dockerComposeTemplate)
-	if err != nil {
-		return fmt.Errorf("failed to parse docker template: %w", err)
-	}
+func (g *GeneratorService) generateComposeFile(cfg *model.SetupConfig) error {
+	g.normalizeJWTKeyConfig(cfg)
 
-	filePath := filepath.Join(g.outputDir, composeFileName(cfg))
-	file, err := os.Create(filePath)
+	content, err := g.marshalComposeFile(cfg)
 	if err != nil {
-		return fmt.Errorf("failed to create docker compose file: %w", err)
-	}
-	defer func() {
-		if err := file.Close(); err != nil {
-			log.Printf("Warning: failed to close docker compose file: %v", err)
-		}
-	}()
-
-	if err := tmpl.Execute(file, cfg); err != nil {
-		return fmt.Errorf("failed to execute docker template: %w", err)
-	}
-
-	if cfg.Redis.ServiceType == "docker" {
-		if err := g.generateRedisConfig(cfg); err != nil {
-			return fmt.Errorf("failed to generate redis config: %w", err)
-		}
-	}
-
-	proxyType := cfg.ReverseProxy.Type
-	if proxyType == "" {
-		proxyType = "caddy"
-	}
-
-	switch proxyType {
-	case "nginx":
-		if err := g.GenerateNginxConfig(cfg); err != nil {
-			return fmt.Errorf("failed to generate nginx config: %w", err)
-		}
-	case "caddy":
-		if err := g.GenerateCaddyConfig(cfg); err != nil {
-			return fmt.Errorf("failed to generate caddy config: %w", err)
-		}
-	default:
-		return fmt.Errorf("unsupported reverse proxy type: %s", proxyType)
+		return err
 	}
 
-	if err := g.generateAdditionalConfigs(cfg); err != nil {
-		return fmt.Errorf("failed to generate additional configs: %w", err)
+	filePath := filepath.Join(g.outputDir, composeFileName(cfg))
+	if err := g.out.WriteFile(filePath, content, 0644); err != nil {
+		return fmt.Errorf("failed to write docker compose file: %w", err)
 	}
 
 	return nil
@@ -1063,46 +411,31 @@ func (g *GeneratorService) normalizeJWTKeyConfig(cfg *model.SetupConfig) {
 }
 
 func (g *GeneratorService) copyTemplateFiles(cfg *model.SetupConfig) error {
-	if cfg.Database.ServiceType == "docker" {
-		dbDir := filepath.Join(g.outputDir, "db")
-		if err := os.MkdirAll(dbDir, 0755); err != nil {
-			return fmt.Errorf("failed to create db directory: %w", err)
-		}
+	dbDir := filepath.Join(g.outputDir, "db")
+	if err := g.out.MkdirAll(dbDir, 0755); err != nil {
+		return fmt.Errorf("failed to create db directory: %w", err)
+	}
 
-		destInitdbDir := filepath.Join(dbDir, "initdb")
-		if err := g.copyDirFromFS("db/initdb", destInitdbDir); err != nil {
-			return fmt.Errorf("failed to copy initdb directory: %w", err)
-		}
+	destInitdbDir := filepath.Join(dbDir, "initdb")
+	if err := g.copyDirFromFS("db/initdb", destInitdbDir); err != nil {
+		return fmt.Errorf("failed to copy initdb directory: %w", err)
+	}
 
-		destPostgresqlConf := filepath.Join(dbDir, "postgresql.conf")
-		if err := g.copyFileFromFS("db/postgresql.conf", destPostgresqlConf); err != nil {
-			return fmt.Errorf("failed to copy postgresql.conf: %w", err)
-		}
+	destPostgresqlConf := filepath.Join(dbDir, "postgresql.conf")
+	if err := g.copyFileFromFS("db/postgresql.conf", destPostgresqlConf); err != nil {
+		return fmt.Errorf("failed to copy postgresql.conf: %w", err)
+	}
 
-		destDockerfile := filepath.Join(g.outputDir, "Dockerfile.pg")
-		if err := g.copyFileFromFS("db/Dockerfile.pg", destDockerfile); err != nil {
-			return fmt.Errorf("failed to copy Dockerfile.pg: %w", err)
-		}
+	destDockerfile := filepath.Join(g.outputDir, "Dockerfile.pg")
+	if err := g.copyFileFromFS("db/Dockerfile.pg", destDockerfile); err != nil {
+		return fmt.Errorf("failed to copy Dockerfile.pg: %w", err)
 	}
 
 	return nil
 }
 
 func (g *GeneratorService) copyFile(src, dest string) error {
-	sourceFile, err := os.Open(src)
-	if err != nil {
-		return err
-	}
-	defer utils.Close(sourceFile, "source file: "+src)
-
-	destFile, err := os.Create(dest)
-	if err != nil {
-		return err
-	}
-	defer utils.Close(destFile, "dest file: "+dest)
-
-	_, err = destFile.ReadFrom(sourceFile)
-	return err
+	return g.out.CopyFile(src, dest)
 }
 
 func (g *GeneratorService) copyFileFromFS(src, dest string) error {
@@ -1111,7 +444,7 @@ func (g *GeneratorService) copyFileFromFS(src, dest string) error {
 		return fmt.Errorf("failed to read from embedded FS: %w", err)
 	}
 
-	if err := os.WriteFile(dest, content, 0644); err != nil {
+	if err := g.out.WriteFile(dest, content, 0644); err != nil {
 		return fmt.Errorf("failed to write file: %w", err)
 	}
 
@@ -1119,7 +452,7 @@ func (g *GeneratorService) copyFileFromFS(src, dest string) error {
 }
 
 func (g *GeneratorService) copyDirFromFS(src, dest string) error {
-	if err := os.MkdirAll(dest, 0755); err != nil {
+	if err := g.out.MkdirAll(dest, 0755); err != nil {
 		return fmt.Errorf("failed to create directory: %w", err)
 	}
 
@@ -1148,7 +481,7 @@ func (g *GeneratorService) copyDirFromFS(src, dest string) error {
 
 func (g *GeneratorService) generateRedisConfig(cfg *model.SetupConfig) error {
 	redisDir := filepath.Join(g.outputDir, "redis")
-	if err := os.MkdirAll(redisDir, 0755); err != nil {
+	if err := g.out.MkdirAll(redisDir, 0755); err != nil {
 		return fmt.Errorf("failed to create redis directory: %w", err)
 	}
 
@@ -1158,7 +491,7 @@ func (g *GeneratorService) generateRedisConfig(cfg *model.SetupConfig) error {
 	}
 
 	redisConfPath := filepath.Join(redisDir, "redis.conf")
-	if err := os.WriteFile(redisConfPath, redisConfContent, 0644); err != nil {
+	if err := g.out.WriteFile(redisConfPath, redisConfContent, 0644); err != nil {
 		return fmt.Errorf("failed to write redis.conf: %w", err)
 	}
 
@@ -1168,7 +501,7 @@ func (g *GeneratorService) generateRedisConfig(cfg *model.SetupConfig) error {
 func (g *GeneratorService) GenerateNginxConfig(cfg *model.SetupConfig) error {
 	nginxDir := filepath.Join(g.outputDir, "nginx")
 	templatesDir := filepath.Join(nginxDir, "templates")
-	if err := os.MkdirAll(templatesDir, 0755); err != nil {
+	if err := g.out.MkdirAll(templatesDir, 0755); err != nil {
 		return fmt.Errorf("failed to create nginx directories: %w", err)
 	}
 
@@ -1178,7 +511,7 @@ func (g *GeneratorService) GenerateNginxConfig(cfg *model.SetupConfig) error {
 	}
 
 	nginxConfPath := filepath.Join(nginxDir, "nginx.conf")
-	if err := os.WriteFile(nginxConfPath, nginxConfContent, 0644); err != nil {
+	if err := g.out.WriteFile(nginxConfPath, nginxConfContent, 0644); err != nil {
 		return fmt.Errorf("failed to write nginx.conf: %w", err)
 	}
 
@@ -1193,7 +526,7 @@ func (g *GeneratorService) GenerateNginxConfig(cfg *model.SetupConfig) error {
 	}
 
 	baklabTemplatePath := filepath.Join(templatesDir, "baklab.conf.template")
-	file, err := os.Create(baklabTemplatePath)
+	file, err := g.out.Create(baklabTemplatePath)
 	if err != nil {
 		return fmt.Errorf("failed to create baklab.conf.template file: %w", err)
 	}
@@ -1212,17 +545,17 @@ func (g *GeneratorService) GenerateNginxConfig(cfg *model.SetupConfig) error {
 
 func (g *GeneratorService) GenerateCaddyConfig(cfg *model.SetupConfig) error {
 	caddyDir := filepath.Join(g.outputDir, "caddy")
-	if err := os.MkdirAll(caddyDir, 0755); err != nil {
+	if err := g.out.MkdirAll(caddyDir, 0755); err != nil {
 		return fmt.Errorf("failed to create caddy directory: %w", err)
 	}
 
 	logsDir := filepath.Join(caddyDir, "logs")
-	if err := os.MkdirAll(logsDir, 0755); err != nil {
+	if err := g.out.MkdirAll(logsDir, 0755); err != nil {
 		return fmt.Errorf("failed to create caddy logs directory: %w", err)
 	}
 
 	optionalDir := filepath.Join(caddyDir, "optional")
-	if err := os.MkdirAll(optionalDir, 0755); err != nil {
+	if err := g.out.MkdirAll(optionalDir, 0755); err != nil {
 		return fmt.Errorf("failed to create caddy optional directory: %w", err)
 	}
 
@@ -1232,6 +565,7 @@ func (g *GeneratorService) GenerateCaddyConfig(cfg *model.SetupConfig) error {
 	}
 
 	funcMap := template.FuncMap{
+		"env":        encodeEnvValue,
 		"rootDomain": rootDomain,
 	}
 
@@ -1241,7 +575,7 @@ func (g *GeneratorService) GenerateCaddyConfig(cfg *model.SetupConfig) error {
 	}
 
 	caddyfilePath := filepath.Join(caddyDir, "Caddyfile")
-	file, err := os.Create(caddyfilePath)
+	file, err := g.out.Create(caddyfilePath)
 	if err != nil {
 		return fmt.Errorf("failed to create Caddyfile: %w", err)
 	}
@@ -1268,7 +602,7 @@ func (g *GeneratorService) GenerateCaddyConfig(cfg *model.SetupConfig) error {
 	}
 
 	dizkazPath := filepath.Join(optionalDir, "dizkaz.caddy.template")
-	dizkazFile, err := os.Create(dizkazPath)
+	dizkazFile, err := g.out.Create(dizkazPath)
 	if err != nil {
 		return fmt.Errorf("failed to create dizkaz.caddy.template: %w", err)
 	}
@@ -1306,45 +640,15 @@ func (g *GeneratorService) GenerateJWTKey() ([]byte, error) {
 	return privateKeyPEM, nil
 }
 
-func (g *GeneratorService) generateAdditionalConfigs(cfg *model.SetupConfig) error {
-	if cfg.GoAccess.Enabled {
-		if err := g.generateGoAccessConfig(cfg); err != nil {
-			return fmt.Errorf("failed to generate goaccess config: %w", err)
-		}
-	}
-
-	if err := g.createKeysDirectory(); err != nil {
-		return fmt.Errorf("failed to create keys directory: %w", err)
-	}
-
-	if err := g.createRequiredDirectories(cfg); err != nil {
-		return fmt.Errorf("failed to create required directories: %w", err)
-	}
-
-	return nil
-}
-
 func (g *GeneratorService) generateGoAccessConfig(cfg *model.SetupConfig) error {
-	proxyType := cfg.ReverseProxy.Type
-	if proxyType == "" {
-		proxyType = "caddy"
-	}
-
-	var goAccessConfig string
-	if proxyType == "caddy" {
-		goAccessConfig = `time-format %H:%M:%S
-date-format %d/%b/%Y
-log-format %h %^ %^ [%d:%t %^] "%r" %s %b
-geoip-database /data/geoip/GeoLite2-City.mmdb`
-	} else {
-		goAccessConfig = `time-format %T
-date-format %d/%b/%Y
-log_format %h - %^ [%d:%t %^]  %s "%r" %b "%R" "%u" "%^"
-geoip-database /data/geoip/GeoLite2-City.mmdb`
+	templatePath := "goaccess/" + reverseProxyType(cfg) + ".conf"
+	goAccessConfig, err := fs.ReadFile(g.templatesFS, templatePath)
+	if err != nil {
+		return fmt.Errorf("failed to read %s template: %w", templatePath, err)
 	}
 
 	filePath := filepath.Join(g.outputDir, "goaccess.conf")
-	if err := os.WriteFile(filePath, []byte(goAccessConfig), 0644); err != nil {
+	if err := g.out.WriteFile(filePath, goAccessConfig, 0644); err != nil {
 		return fmt.Errorf("failed to write goaccess.conf: %w", err)
 	}
 
@@ -1353,7 +657,7 @@ geoip-database /data/geoip/GeoLite2-City.mmdb`
 
 func (g *GeneratorService) createKeysDirectory() error {
 	keysDir := filepath.Join(g.outputDir, "keys")
-	if err := os.MkdirAll(keysDir, 0755); err != nil {
+	if err := g.out.MkdirAll(keysDir, 0755); err != nil {
 		return fmt.Errorf("failed to create keys directory: %w", err)
 	}
 
@@ -1364,32 +668,8 @@ func (g *GeneratorService) createKeysDirectory() error {
 			return fmt.Errorf("failed to copy keys README.md: %w", err)
 		}
 	} else {
-		keysReadmeContent := `# JWT Key Management
-
-This directory contains JWT signing keys for the application.
-
-## Setup Instructions
-
-1. Generate Ed25519 key for JWT signing:
-   ` + "```bash" + `
-   openssl genpkey -algorithm Ed25519 -out jwt-ed25519.pem
-   chmod 600 jwt-ed25519.pem
-   ` + "```" + `
-
-2. Or generate RSA key (alternative):
-   ` + "```bash" + `
-   openssl genrsa -out jwt-rsa.pem 3072
-   chmod 600 jwt-rsa.pem
-   ` + "```" + `
-
-## Security Notes
-
-- Never commit private keys to version control
-- Set proper file permissions (600) for private keys
-- Use different keys for different environments`
-
 		readmePath := filepath.Join(keysDir, "README.md")
-		if err := os.WriteFile(readmePath, []byte(keysReadmeContent), 0644); err != nil {
+		if err := g.copyFileFromFS("keys/README.md", readmePath); err != nil {
 			return fmt.Errorf("failed to create keys README.md: %w", err)
 		}
 	}
@@ -1399,22 +679,47 @@ This directory contains JWT signing keys for the application.
 
 func (g *GeneratorService) createRequiredDirectories(cfg *model.SetupConfig) error {
 	manageStaticDir := filepath.Join(g.outputDir, "manage_static")
-	if err := os.MkdirAll(manageStaticDir, 0755); err != nil {
+	if err := g.out.MkdirAll(manageStaticDir, 0755); err != nil {
 		return fmt.Errorf("failed to create manage_static directory: %w", err)
 	}
 
 	frontendDistDir := filepath.Join(g.outputDir, "frontend_dist")
-	if err := os.MkdirAll(frontendDistDir, 0755); err != nil {
+	if err := g.out.MkdirAll(frontendDistDir, 0755); err != nil {
 		return fmt.Errorf("failed to create frontend_dist directory: %w", err)
 	}
 
+	gitkeepPath := filepath.Join(manageStaticDir, ".gitkeep")
+	if err := g.out.WriteFile(gitkeepPath, []byte{}, 0644); err != nil {
+		return fmt.Errorf("failed to create .gitkeep: %w", err)
+	}
+
+	return nil
+}
+
+// generateGitignore writes a .gitignore that keeps the files holding secrets
+// and the output backups out of version control.
+func (g *GeneratorService) generateGitignore(cfg *model.SetupConfig) error {
+	var b strings.Builder
+	b.WriteString("# Generated by baklab-setup: files holding secrets and output backups\n")
+	for _, secretPath := range secretOutputPaths {
+		b.WriteString("/" + secretPath + "\n")
+	}
+	b.WriteString("/" + setupDirName + "/" + backupsDirName + "/\n")
+
+	if err := g.out.WriteFile(filepath.Join(g.outputDir, ".gitignore"), []byte(b.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write .gitignore: %w", err)
+	}
+	return nil
+}
+
+func (g *GeneratorService) generateRobotsTxt(cfg *model.SetupConfig) error {
 	staticDir := filepath.Join(g.outputDir, "static")
-	if err := os.MkdirAll(staticDir, 0755); err != nil {
+	if err := g.out.MkdirAll(staticDir, 0755); err != nil {
 		return fmt.Errorf("failed to create static directory: %w", err)
 	}
 
 	robotsTxtPath := filepath.Join(staticDir, "robots.txt")
-	if _, err := os.Stat(robotsTxtPath); os.IsNotExist(err) {
+	if _, err := g.out.Stat(robotsTxtPath); os.IsNotExist(err) {
 		if cfg.App.HasCustomRobotsTxt && cfg.App.RobotsTxtPath != "" {
 			if err := g.copyFile(cfg.App.RobotsTxtPath, robotsTxtPath); err != nil {
 				return fmt.Errorf("failed to copy custom robots.txt: %w", err)
@@ -1428,13 +733,12 @@ func (g *GeneratorService) createRequiredDirectories(cfg *model.SetupConfig) err
 		}
 	}
 
-	gitkeepPath := filepath.Join(manageStaticDir, ".gitkeep")
-	if err := os.WriteFile(gitkeepPath, []byte{}, 0644); err != nil {
-		return fmt.Errorf("failed to create .gitkeep: %w", err)
-	}
+	return nil
+}
 
+func (g *GeneratorService) copyGeoIPFiles(cfg *model.SetupConfig) error {
 	geoipDir := filepath.Join(g.outputDir, "geoip")
-	if err := os.MkdirAll(geoipDir, 0755); err != nil {
+	if err := g.out.MkdirAll(geoipDir, 0755); err != nil {
 		return fmt.Errorf("failed to create geoip directory: %w", err)
 	}
 
@@ -1447,7 +751,7 @@ func (g *GeneratorService) createRequiredDirectories(cfg *model.SetupConfig) err
 				return fmt.Errorf("failed to copy GeoIP database from temp: %w", err)
 			}
 
-			if err := os.Remove(tempGeoipFile); err != nil {
+			if err := g.out.Remove(tempGeoipFile); err != nil {
 				log.Printf("Warning: failed to remove temporary GeoIP file %s: %v", tempGeoipFile, err)
 			} else {
 				log.Printf("Temporary GeoIP file %s removed successfully", tempGeoipFile)
@@ -1471,16 +775,16 @@ func (g *GeneratorService) createRequiredDirectories(cfg *model.SetupConfig) err
 	cityFile := filepath.Join(geoipDir, "GeoLite2-City.mmdb")
 	countryFile := filepath.Join(geoipDir, "Country.mmdb")
 
-	if _, err := os.Stat(cityFile); err == nil {
+	if _, err := g.out.Stat(cityFile); err == nil {
 		hasAnyGeoFile = true
 	}
-	if _, err := os.Stat(countryFile); err == nil {
+	if _, err := g.out.Stat(countryFile); err == nil {
 		hasAnyGeoFile = true
 	}
 
 	if !hasAnyGeoFile {
 		gitkeepGeoipPath := filepath.Join(geoipDir, ".gitkeep")
-		if err := os.WriteFile(gitkeepGeoipPath, []byte{}, 0644); err != nil {
+		if err := g.out.WriteFile(gitkeepGeoipPath, []byte{}, 0644); err != nil {
 			return fmt.Errorf("failed to create geoip .gitkeep: %w", err)
 		}
 	}
@@ -1488,9 +792,17 @@ func (g *GeneratorService) createRequiredDirectories(cfg *model.SetupConfig) err
 	return nil
 }
 
+func (g *GeneratorService) generateJWTKeyArtifact(cfg *model.SetupConfig) error {
+	if err := g.HandleJWTKeyFile(cfg); err != nil {
+		return err
+	}
+
+	return g.createKeysDirectory()
+}
+
 func (g *GeneratorService) HandleJWTKeyFile(cfg *model.SetupConfig) error {
 	keysDir := filepath.Join(g.outputDir, "keys")
-	if err := os.MkdirAll(keysDir, 0755); err != nil {
+	if err := g.out.MkdirAll(keysDir, 0755); err != nil {
 		return fmt.Errorf("failed to create keys directory: %w", err)
 	}
 
@@ -1522,7 +834,7 @@ func (g *GeneratorService) HandleJWTKeyFile(cfg *model.SetupConfig) error {
 		return fmt.Errorf("failed to generate JWT key: %w", err)
 	}
 
-	if err := os.WriteFile(destPath, jwtKeyPEM, 0600); err != nil {
+	if err := g.out.WriteFile(destPath, jwtKeyPEM, 0600); err != nil {
 		return fmt.Errorf("failed to write JWT key file: %w", err)
 	}
 
@@ -1538,8 +850,8 @@ func (g *GeneratorService) HandleJWTKeyFile(cfg *model.SetupConfig) error {
 // SaveSetupConfiguration saves the complete setup configuration to .baklab-setup directory
 func (g *GeneratorService) SaveSetupConfiguration(cfg *model.SetupConfig) error {
 	// Create .baklab-setup directory
-	setupDir := filepath.Join(g.outputDir, ".baklab-setup")
-	if err := os.MkdirAll(setupDir, 0755); err != nil {
+	setupDir := filepath.Join(g.outputDir, setupDirName)
+	if err := g.out.MkdirAll(setupDir, 0755); err != nil {
 		return fmt.Errorf("failed to create .baklab-setup directory: %w", err)
 	}
 
@@ -1553,7 +865,7 @@ func (g *GeneratorService) SaveSetupConfiguration(cfg *model.SetupConfig) error
 		return fmt.Errorf("failed to marshal configuration: %w", err)
 	}
 
-	if err := os.WriteFile(configPath, configData, 0644); err != nil {
+	if err := g.out.WriteFile(configPath, configData, 0644); err != nil {
 		return fmt.Errorf("failed to write config.json: %w", err)
 	}
 
@@ -1570,7 +882,7 @@ Domain: %s
 	)
 
 	readmePath := filepath.Join(setupDir, "readme.txt")
-	if err := os.WriteFile(readmePath, []byte(readmeContent), 0644); err != nil {
+	if err := g.out.WriteFile(readmePath, []byte(readmeContent), 0644); err != nil {
 		return fmt.Errorf("failed to write readme.txt: %w", err)
 	}
 
@@ -1582,29 +894,9 @@ Domain: %s
 func (g *GeneratorService) sanitizeConfigForSaving(cfg model.SetupConfig) model.SetupConfig {
 	// Create a deep copy
 	sanitized := cfg
+	sanitized.SchemaVersion = model.ConfigSchemaVersion
 
-	// Clear sensitive database passwords
-	sanitized.Database.SuperPassword = ""
-	sanitized.Database.AppPassword = ""
-
-	// Clear sensitive Redis passwords
-	sanitized.Redis.Password = ""
-	sanitized.Redis.AdminPassword = ""
-
-	// Clear SMTP password
-	sanitized.SMTP.Password = ""
-
-	// Clear admin user password
-	sanitized.AdminUser.Password = ""
-
-	// Clear OAuth client secrets
-	sanitized.OAuth.GoogleSecret = ""
-	sanitized.OAuth.GithubSecret = ""
-	sanitized.App.OAuth.GoogleSecret = ""
-	sanitized.App.OAuth.GithubSecret = ""
-
-	// Clear Cloudflare secret
-	sanitized.App.CloudflareSecret = ""
+	model.ClearSecrets(&sanitized)
 
 	// Clear temporary file paths that may contain sensitive data
 	sanitized.GoAccess.GeoTempPath = ""
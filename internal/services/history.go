@@ -0,0 +1,239 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/biliqiqi/baklab-setup/internal/model"
+)
+
+// maxConfigHistory bounds the number of configuration snapshots kept.
+const maxConfigHistory = 20
+
+const maskedConfigValue = "******"
+
+var ErrConfigSnapshotNotFound = errors.New("config snapshot not found")
+
+// historyIgnoredKeys are top-level config keys that describe the editing
+// session rather than the deployment and are left out of diffs.
+var historyIgnoredKeys = map[string]bool{
+	"schema_version": true,
+	"current_step":   true,
+	"revision_mode":  true,
+}
+
+// GetConfigHistory returns the configuration snapshots, oldest first.
+func (s *SetupService) GetConfigHistory() ([]model.ConfigSnapshot, error) {
+	return s.storage.GetConfigHistory()
+}
+
+// DiffConfigSnapshot lists the fields that differ between snapshot id
+// (Before) and the current configuration draft (After).
+func (s *SetupService) DiffConfigSnapshot(id int) ([]model.ConfigFieldChange, error) {
+	snapshot, err := s.findConfigSnapshot(id)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := s.storage.GetSetupConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current configuration: %w", err)
+	}
+
+	return diffConfigs(snapshot.Config, current)
+}
+
+// RestoreConfigSnapshot makes snapshot id the current configuration draft.
+// The restore itself is recorded as a new snapshot so it can be undone.
+func (s *SetupService) RestoreConfigSnapshot(id int) (*model.SetupConfig, error) {
+	snapshot, err := s.findConfigSnapshot(id)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := *snapshot.Config
+	if err := s.storage.SaveSetupConfig(&cfg); err != nil {
+		return nil, fmt.Errorf("failed to save restored configuration: %w", err)
+	}
+
+	if err := s.recordConfigSnapshot(&cfg, id); err != nil {
+		return nil, err
+	}
+
+	if err := s.updateSetupProgress("configuration", 25, fmt.Sprintf("Configuration restored from snapshot %d", id)); err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+func (s *SetupService) findConfigSnapshot(id int) (*model.ConfigSnapshot, error) {
+	history, err := s.storage.GetConfigHistory()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config history: %w", err)
+	}
+
+	for i := range history {
+		if history[i].ID == id && history[i].Config != nil {
+			return &history[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %d", ErrConfigSnapshotNotFound, id)
+}
+
+// recordConfigSnapshot appends cfg to the history unless it is identical to
+// the latest snapshot, dropping the oldest entries beyond maxConfigHistory.
+func (s *SetupService) recordConfigSnapshot(cfg *model.SetupConfig, restoredFrom int) error {
+	history, err := s.storage.GetConfigHistory()
+	if err != nil {
+		return fmt.Errorf("failed to get config history: %w", err)
+	}
+
+	previous := &model.SetupConfig{}
+	nextID := 1
+	if len(history) > 0 {
+		latest := history[len(history)-1]
+		if latest.Config != nil {
+			previous = latest.Config
+		}
+		nextID = latest.ID + 1
+	}
+
+	changes, err := diffConfigs(previous, cfg)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 && restoredFrom == 0 {
+		return nil
+	}
+
+	snapshotCfg := *cfg
+	history = append(history, model.ConfigSnapshot{
+		ID:              nextID,
+		CreatedAt:       time.Now(),
+		ChangedSections: changedSections(changes),
+		RestoredFrom:    restoredFrom,
+		Config:          &snapshotCfg,
+	})
+	if len(history) > maxConfigHistory {
+		history = history[len(history)-maxConfigHistory:]
+	}
+
+	if err := s.storage.SaveConfigHistory(history); err != nil {
+		return fmt.Errorf("failed to save config history: %w", err)
+	}
+
+	return nil
+}
+
+func diffConfigs(before, after *model.SetupConfig) ([]model.ConfigFieldChange, error) {
+	beforeFields, err := flattenConfig(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := flattenConfig(after)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make(map[string]bool, len(beforeFields))
+	for path := range beforeFields {
+		paths[path] = true
+	}
+	for path := range afterFields {
+		paths[path] = true
+	}
+
+	sortedPaths := make([]string, 0, len(paths))
+	for path := range paths {
+		sortedPaths = append(sortedPaths, path)
+	}
+	sort.Strings(sortedPaths)
+
+	var changes []model.ConfigFieldChange
+	for _, path := range sortedPaths {
+		oldValue, newValue := beforeFields[path], afterFields[path]
+		if reflect.DeepEqual(oldValue, newValue) {
+			continue
+		}
+
+		section, _, _ := strings.Cut(path, ".")
+		if model.IsSecretPath(path) {
+			oldValue, newValue = maskConfigValue(oldValue), maskConfigValue(newValue)
+		}
+
+		changes = append(changes, model.ConfigFieldChange{
+			Path:    path,
+			Section: section,
+			Before:  oldValue,
+			After:   newValue,
+		})
+	}
+
+	return changes, nil
+}
+
+// flattenConfig maps every leaf of the JSON form of cfg to its dotted path,
+// e.g. "database.app_password". Arrays are kept as single values.
+func flattenConfig(cfg *model.SetupConfig) (map[string]any, error) {
+	fields := map[string]any{}
+	if cfg == nil {
+		return fields, nil
+	}
+
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal configuration: %w", err)
+	}
+
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal configuration: %w", err)
+	}
+
+	for key, value := range doc {
+		if historyIgnoredKeys[key] {
+			continue
+		}
+		flattenValue(fields, key, value)
+	}
+
+	return fields, nil
+}
+
+func flattenValue(fields map[string]any, path string, value any) {
+	nested, ok := value.(map[string]any)
+	if !ok {
+		fields[path] = value
+		return
+	}
+
+	for key, child := range nested {
+		flattenValue(fields, path+"."+key, child)
+	}
+}
+
+func maskConfigValue(value any) any {
+	if value == nil || value == "" {
+		return value
+	}
+	return maskedConfigValue
+}
+
+func changedSections(changes []model.ConfigFieldChange) []string {
+	sections := []string{}
+	seen := map[string]bool{}
+	for _, change := range changes {
+		if !seen[change.Section] {
+			seen[change.Section] = true
+			sections = append(sections, change.Section)
+		}
+	}
+	return sections
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/biliqiqi/baklab-setup/internal/model"
+	"github.com/biliqiqi/baklab-setup/internal/storage"
+)
+
+func TestConfigHistoryRecordsChangedSections(t *testing.T) {
+	service := NewSetupService(storage.NewMemoryStorage())
+
+	first := &model.SetupConfig{App: model.AppConfig{DomainName: "example.com"}}
+	second := &model.SetupConfig{
+		App:   model.AppConfig{DomainName: "example.com"},
+		Redis: model.RedisConfig{Host: "redis"},
+	}
+
+	for _, cfg := range []*model.SetupConfig{first, first, second} {
+		if err := service.recordConfigSnapshot(cfg, 0); err != nil {
+			t.Fatalf("recordConfigSnapshot() failed: %v", err)
+		}
+	}
+
+	history, err := service.GetConfigHistory()
+	if err != nil {
+		t.Fatalf("GetConfigHistory() failed: %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("history length = %d, want 2 (unchanged saves are skipped)", len(history))
+	}
+	if history[1].ID != 2 || len(history[1].ChangedSections) != 1 || history[1].ChangedSections[0] != "redis" {
+		t.Errorf("second snapshot = %+v, want id 2 with changed section redis", history[1])
+	}
+}
+
+func TestConfigHistoryIsBounded(t *testing.T) {
+	service := NewSetupService(storage.NewMemoryStorage())
+
+	for i := 0; i < maxConfigHistory+5; i++ {
+		cfg := &model.SetupConfig{App: model.AppConfig{RateLimitReqPerMin: i + 1}}
+		if err := service.recordConfigSnapshot(cfg, 0); err != nil {
+			t.Fatalf("recordConfigSnapshot() failed: %v", err)
+		}
+	}
+
+	history, err := service.GetConfigHistory()
+	if err != nil {
+		t.Fatalf("GetConfigHistory() failed: %v", err)
+	}
+	if len(history) != maxConfigHistory {
+		t.Fatalf("history length = %d, want %d", len(history), maxConfigHistory)
+	}
+	if history[0].ID != 6 {
+		t.Errorf("oldest snapshot id = %d, want 6", history[0].ID)
+	}
+}
+
+func TestConfigHistoryDiffAndRestore(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	service := NewSetupService(store)
+
+	good := &model.SetupConfig{
+		App:      model.AppConfig{DomainName: "good.example.com"},
+		Database: model.DatabaseConfig{AppPassword: "GoodPassword1!"},
+	}
+	broken := &model.SetupConfig{
+		App:      model.AppConfig{DomainName: "broken.example.com"},
+		Database: model.DatabaseConfig{AppPassword: "BrokenPassword1!"},
+	}
+
+	for _, cfg := range []*model.SetupConfig{good, broken} {
+		if err := store.SaveSetupConfig(cfg); err != nil {
+			t.Fatalf("SaveSetupConfig() failed: %v", err)
+		}
+		if err := service.recordConfigSnapshot(cfg, 0); err != nil {
+			t.Fatalf("recordConfigSnapshot() failed: %v", err)
+		}
+	}
+
+	changes, err := service.DiffConfigSnapshot(1)
+	if err != nil {
+		t.Fatalf("DiffConfigSnapshot() failed: %v", err)
+	}
+
+	found := map[string]model.ConfigFieldChange{}
+	for _, change := range changes {
+		found[change.Path] = change
+	}
+	if change := found["app.domain_name"]; change.Before != "good.example.com" || change.After != "broken.example.com" {
+		t.Errorf("app.domain_name change = %+v", change)
+	}
+	if change, ok := found["database.app_password"]; !ok || change.Before != maskedConfigValue || change.After != maskedConfigValue {
+		t.Errorf("database.app_password change = %+v, want masked values", change)
+	}
+
+	restored, err := service.RestoreConfigSnapshot(1)
+	if err != nil {
+		t.Fatalf("RestoreConfigSnapshot() failed: %v", err)
+	}
+	if restored.App.DomainName != "good.example.com" {
+		t.Errorf("restored domain = %q, want %q", restored.App.DomainName, "good.example.com")
+	}
+
+	current, err := store.GetSetupConfig()
+	if err != nil {
+		t.Fatalf("GetSetupConfig() failed: %v", err)
+	}
+	if current.Database.AppPassword != "GoodPassword1!" {
+		t.Errorf("restored draft password = %q, want %q", current.Database.AppPassword, "GoodPassword1!")
+	}
+
+	history, err := service.GetConfigHistory()
+	if err != nil {
+		t.Fatalf("GetConfigHistory() failed: %v", err)
+	}
+	if latest := history[len(history)-1]; latest.RestoredFrom != 1 {
+		t.Errorf("latest snapshot = %+v, want a record of the restore", latest)
+	}
+
+	if _, err := service.RestoreConfigSnapshot(42); !errors.Is(err, ErrConfigSnapshotNotFound) {
+		t.Errorf("RestoreConfigSnapshot(42) error = %v, want ErrConfigSnapshotNotFound", err)
+	}
+}
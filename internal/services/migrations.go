@@ -0,0 +1,130 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/biliqiqi/baklab-setup/internal/model"
+)
+
+// configMigration upgrades a raw config.json document by one schema version.
+type configMigration struct {
+	description string
+	migrate     func(doc map[string]any) error
+}
+
+// configMigrations[i] upgrades a document from schema version i to i+1, so
+// the registry length must always equal model.ConfigSchemaVersion.
+var configMigrations = []configMigration{
+	{description: "move app.oauth to oauth", migrate: migrateAppOAuth},
+}
+
+// MigrateConfig decodes a config.json document, upgrading it step by step to
+// model.ConfigSchemaVersion, and records the source version and applied
+// migrations in RevisionMode. Documents written by a newer binary are refused.
+func MigrateConfig(configData []byte) (*model.SetupConfig, error) {
+	decoder := json.NewDecoder(bytes.NewReader(configData))
+	decoder.UseNumber()
+
+	var doc map[string]any
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to parse configuration: %w", err)
+	}
+	if doc == nil {
+		return nil, fmt.Errorf("failed to parse configuration: document is empty")
+	}
+
+	sourceVersion, err := schemaVersionOf(doc)
+	if err != nil {
+		return nil, err
+	}
+	if sourceVersion > model.ConfigSchemaVersion {
+		return nil, fmt.Errorf("configuration schema version %d is newer than the supported version %d, please upgrade baklab-setup", sourceVersion, model.ConfigSchemaVersion)
+	}
+
+	var applied []string
+	for version := sourceVersion; version < model.ConfigSchemaVersion; version++ {
+		migration := configMigrations[version]
+		if err := migration.migrate(doc); err != nil {
+			return nil, fmt.Errorf("failed to migrate configuration from schema version %d: %w", version, err)
+		}
+		applied = append(applied, fmt.Sprintf("v%d->v%d: %s", version, version+1, migration.description))
+	}
+
+	migratedData, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode migrated configuration: %w", err)
+	}
+
+	var cfg model.SetupConfig
+	if err := json.Unmarshal(migratedData, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse configuration: %w", err)
+	}
+
+	cfg.SchemaVersion = model.ConfigSchemaVersion
+	cfg.RevisionMode.SourceSchemaVersion = sourceVersion
+	cfg.RevisionMode.AppliedMigrations = applied
+
+	return &cfg, nil
+}
+
+func schemaVersionOf(doc map[string]any) (int, error) {
+	raw, ok := doc["schema_version"]
+	if !ok || raw == nil {
+		return 0, nil
+	}
+
+	number, ok := raw.(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("invalid schema_version: %v", raw)
+	}
+	version, err := number.Int64()
+	if err != nil || version < 0 {
+		return 0, fmt.Errorf("invalid schema_version: %s", number)
+	}
+
+	return int(version), nil
+}
+
+// migrateAppOAuth folds the legacy app.oauth block into the top-level oauth
+// block, which is the only one the generator and validator read. Values
+// already present at the top level win.
+func migrateAppOAuth(doc map[string]any) error {
+	app, ok := doc["app"].(map[string]any)
+	if !ok {
+		return nil
+	}
+	legacy, ok := app["oauth"].(map[string]any)
+	delete(app, "oauth")
+	if !ok {
+		return nil
+	}
+
+	current, ok := doc["oauth"].(map[string]any)
+	if !ok {
+		current = map[string]any{}
+		doc["oauth"] = current
+	}
+
+	for key, value := range legacy {
+		if isEmptyJSONValue(current[key]) {
+			current[key] = value
+		}
+	}
+
+	return nil
+}
+
+func isEmptyJSONValue(value any) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case bool:
+		return !v
+	case string:
+		return v == ""
+	default:
+		return false
+	}
+}
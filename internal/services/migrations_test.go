@@ -0,0 +1,114 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/biliqiqi/baklab-setup/internal/model"
+	"github.com/biliqiqi/baklab-setup/internal/storage"
+)
+
+func TestConfigMigrationsCoverSchemaVersion(t *testing.T) {
+	if len(configMigrations) != model.ConfigSchemaVersion {
+		t.Fatalf("configMigrations has %d entries, want one per schema version (%d)", len(configMigrations), model.ConfigSchemaVersion)
+	}
+}
+
+func TestMigrateConfigMovesLegacyAppOAuth(t *testing.T) {
+	legacy := `{
+		"app": {
+			"domain_name": "example.com",
+			"oauth": {"github_enabled": true, "github_client_id": "legacy-id", "google_client_id": "legacy-google"}
+		},
+		"oauth": {"google_client_id": "current-google"}
+	}`
+
+	cfg, err := MigrateConfig([]byte(legacy))
+	if err != nil {
+		t.Fatalf("MigrateConfig() failed: %v", err)
+	}
+
+	if cfg.SchemaVersion != model.ConfigSchemaVersion {
+		t.Errorf("SchemaVersion = %d, want %d", cfg.SchemaVersion, model.ConfigSchemaVersion)
+	}
+	if !cfg.OAuth.GithubEnabled || cfg.OAuth.GithubClientID != "legacy-id" {
+		t.Errorf("legacy app.oauth was not moved to oauth: %+v", cfg.OAuth)
+	}
+	if cfg.OAuth.GoogleClientID != "current-google" {
+		t.Errorf("GoogleClientID = %q, existing top-level value should win", cfg.OAuth.GoogleClientID)
+	}
+	if cfg.App.DomainName != "example.com" {
+		t.Errorf("DomainName = %q, unrelated fields should be preserved", cfg.App.DomainName)
+	}
+	if cfg.RevisionMode.SourceSchemaVersion != 0 || len(cfg.RevisionMode.AppliedMigrations) != model.ConfigSchemaVersion {
+		t.Errorf("RevisionMode = %+v, want source version 0 and all migrations recorded", cfg.RevisionMode)
+	}
+}
+
+func TestMigrateConfigCurrentVersion(t *testing.T) {
+	current := fmt.Sprintf(`{"schema_version": %d, "oauth": {"github_client_id": "id"}}`, model.ConfigSchemaVersion)
+
+	cfg, err := MigrateConfig([]byte(current))
+	if err != nil {
+		t.Fatalf("MigrateConfig() failed: %v", err)
+	}
+	if len(cfg.RevisionMode.AppliedMigrations) != 0 {
+		t.Errorf("AppliedMigrations = %v, want none", cfg.RevisionMode.AppliedMigrations)
+	}
+	if cfg.OAuth.GithubClientID != "id" {
+		t.Errorf("GithubClientID = %q, want %q", cfg.OAuth.GithubClientID, "id")
+	}
+}
+
+func TestMigrateConfigRejectsInvalidDocuments(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{"newer version", fmt.Sprintf(`{"schema_version": %d}`, model.ConfigSchemaVersion+1), "newer than the supported version"},
+		{"negative version", `{"schema_version": -1}`, "invalid schema_version"},
+		{"non numeric version", `{"schema_version": "1"}`, "invalid schema_version"},
+		{"not an object", `[]`, "failed to parse configuration"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := MigrateConfig([]byte(tt.data))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("MigrateConfig() error = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestImportConfigurationRecordsMigration(t *testing.T) {
+	service := NewSetupService(storage.NewMemoryStorage())
+
+	cfg, err := service.ImportConfiguration([]byte(`{"app": {"oauth": {"github_client_id": "legacy-id"}}}`))
+	if err != nil {
+		t.Fatalf("ImportConfiguration() failed: %v", err)
+	}
+
+	if !cfg.RevisionMode.Enabled {
+		t.Errorf("RevisionMode.Enabled should be true after import")
+	}
+	if cfg.OAuth.GithubClientID != "legacy-id" {
+		t.Errorf("GithubClientID = %q, want %q", cfg.OAuth.GithubClientID, "legacy-id")
+	}
+
+	found := false
+	for _, step := range cfg.RevisionMode.ModifiedSteps {
+		if strings.HasPrefix(step, "SCHEMA_MIGRATED") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("ModifiedSteps = %v, want a SCHEMA_MIGRATED notice", cfg.RevisionMode.ModifiedSteps)
+	}
+
+	if _, err := service.ImportConfiguration([]byte(`{"schema_version": 999}`)); err == nil {
+		t.Errorf("ImportConfiguration() should refuse newer schema versions")
+	}
+}
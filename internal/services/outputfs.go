@@ -0,0 +1,261 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/biliqiqi/baklab-setup/internal/utils"
+)
+
+// outputFS is where the generator writes the deployment files. diskFS writes
+// to the real output directory; memFS keeps everything in memory so a
+// generation can be previewed without touching the disk.
+type outputFS interface {
+	MkdirAll(path string, perm os.FileMode) error
+	WriteFile(path string, data []byte, perm os.FileMode) error
+	Create(path string) (io.WriteCloser, error)
+	// CopyFile copies a file from the real filesystem into the output.
+	CopyFile(src, dest string) error
+	Stat(path string) (os.FileInfo, error)
+	// Remove deletes a file from the real filesystem once its content has
+	// been consumed, e.g. an uploaded temp file. memFS only records it.
+	Remove(path string) error
+}
+
+type diskFS struct{}
+
+func (diskFS) MkdirAll(path string, perm os.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+func (diskFS) WriteFile(path string, data []byte, perm os.FileMode) error {
+	return os.WriteFile(path, data, perm)
+}
+
+func (diskFS) Create(path string) (io.WriteCloser, error) {
+	return os.Create(path)
+}
+
+func (diskFS) CopyFile(src, dest string) error {
+	sourceFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer utils.Close(sourceFile, "source file: "+src)
+
+	destFile, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer utils.Close(destFile, "dest file: "+dest)
+
+	_, err = destFile.ReadFrom(sourceFile)
+	return err
+}
+
+func (diskFS) Stat(path string) (os.FileInfo, error) {
+	return os.Stat(path)
+}
+
+func (diskFS) Remove(path string) error {
+	return os.Remove(path)
+}
+
+// createdFileMode is the mode os.Create gives new files under the usual 022
+// umask, used for files memFS creates without an explicit mode.
+const createdFileMode os.FileMode = 0644
+
+// memPreviewLimit is the largest copied file whose content memFS loads;
+// bigger files (GeoIP databases) are only recorded with their size.
+const memPreviewLimit = 1 << 20
+
+type memFile struct {
+	data    []byte
+	size    int64
+	mode    os.FileMode
+	source  string
+	modTime time.Time
+}
+
+type memFS struct {
+	mu      sync.Mutex
+	files   map[string]*memFile
+	dirs    map[string]os.FileMode
+	removed []string
+}
+
+func newMemFS() *memFS {
+	return &memFS{
+		files: map[string]*memFile{},
+		dirs:  map[string]os.FileMode{},
+	}
+}
+
+func (m *memFS) MkdirAll(path string, perm os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.dirs[filepath.Clean(path)] = perm
+	return nil
+}
+
+func (m *memFS) WriteFile(path string, data []byte, perm os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.files[filepath.Clean(path)] = &memFile{
+		data:    bytes.Clone(data),
+		size:    int64(len(data)),
+		mode:    perm,
+		modTime: time.Now(),
+	}
+	return nil
+}
+
+func (m *memFS) Create(path string) (io.WriteCloser, error) {
+	return &memWriter{fs: m, path: path}, nil
+}
+
+func (m *memFS) CopyFile(src, dest string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	file := &memFile{
+		size:    info.Size(),
+		mode:    createdFileMode,
+		source:  src,
+		modTime: time.Now(),
+	}
+	if info.Size() <= memPreviewLimit {
+		if file.data, err = os.ReadFile(src); err != nil {
+			return err
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files[filepath.Clean(dest)] = file
+	return nil
+}
+
+func (m *memFS) Stat(path string) (os.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	file, ok := m.files[filepath.Clean(path)]
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: path, Err: fs.ErrNotExist}
+	}
+	return memFileInfo{name: filepath.Base(path), file: file}, nil
+}
+
+func (m *memFS) Remove(path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.removed = append(m.removed, path)
+	return nil
+}
+
+// writeTo replays everything written to m onto dst: directories first, then
+// files, then the removals of consumed source files.
+func (m *memFS) writeTo(dst outputFS) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dirs := make([]string, 0, len(m.dirs))
+	for dir := range m.dirs {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		if err := dst.MkdirAll(dir, m.dirs[dir]); err != nil {
+			return fmt.Errorf("failed to create directory %s: %w", dir, err)
+		}
+	}
+
+	paths := make([]string, 0, len(m.files))
+	for path := range m.files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if err := dst.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %w", path, err)
+		}
+
+		file := m.files[path]
+		var err error
+		if file.source != "" {
+			err = dst.CopyFile(file.source, path)
+		} else {
+			err = dst.WriteFile(path, file.data, file.mode)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+	}
+
+	for _, path := range m.removed {
+		if err := dst.Remove(path); err != nil {
+			log.Printf("Warning: failed to remove %s: %v", path, err)
+		}
+	}
+
+	return nil
+}
+
+// paths returns the paths of all files written, sorted.
+func (m *memFS) paths() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	paths := make([]string, 0, len(m.files))
+	for path := range m.files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func (m *memFS) file(path string) *memFile {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.files[path]
+}
+
+type memWriter struct {
+	fs   *memFS
+	path string
+	buf  bytes.Buffer
+}
+
+func (w *memWriter) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+func (w *memWriter) Close() error {
+	return w.fs.WriteFile(w.path, w.buf.Bytes(), createdFileMode)
+}
+
+type memFileInfo struct {
+	name string
+	file *memFile
+}
+
+func (i memFileInfo) Name() string       { return i.name }
+func (i memFileInfo) Size() int64        { return i.file.size }
+func (i memFileInfo) Mode() os.FileMode  { return i.file.mode }
+func (i memFileInfo) ModTime() time.Time { return i.file.modTime }
+func (i memFileInfo) IsDir() bool        { return false }
+func (i memFileInfo) Sys() any           { return nil }
@@ -0,0 +1,415 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/biliqiqi/baklab-setup/internal/model"
+	"github.com/biliqiqi/baklab-setup/internal/utils"
+)
+
+// PreviewConfigFiles renders a generation of the selected artifacts, or all
+// of them when only is empty, into memory and compares it with the output
+// directory, without writing anything.
+func (g *GeneratorService) PreviewConfigFiles(cfg *model.SetupConfig, only []string) (*model.GenerationPreview, error) {
+	mem := newMemFS()
+	renderer := *g
+	renderer.out = mem
+
+	renderCfg := *cfg
+	if err := renderer.WriteArtifacts(&renderCfg, only); err != nil {
+		return nil, err
+	}
+
+	absOutputDir, err := g.GetAbsoluteOutputDir()
+	if err != nil {
+		return nil, err
+	}
+
+	secrets := configSecretValues(cfg)
+	preview := &model.GenerationPreview{
+		OutputDir: absOutputDir,
+		Files:     []model.PreviewFile{},
+	}
+
+	rendered := map[string]bool{}
+	for _, path := range mem.paths() {
+		relPath, err := filepath.Rel(g.outputDir, path)
+		if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+			continue
+		}
+		rendered[relPath] = true
+
+		file, err := previewFile(relPath, mem.file(path), filepath.Join(g.outputDir, relPath), secrets)
+		if err != nil {
+			return nil, err
+		}
+		preview.Files = append(preview.Files, file)
+	}
+
+	// A partial generation leaves the other files alone.
+	if len(only) == 0 {
+		removed, err := g.removedPreviewFiles(rendered)
+		if err != nil {
+			return nil, err
+		}
+		preview.Files = append(preview.Files, removed...)
+	}
+
+	sort.Slice(preview.Files, func(i, j int) bool {
+		return preview.Files[i].Path < preview.Files[j].Path
+	})
+
+	return preview, nil
+}
+
+func previewFile(relPath string, file *memFile, diskPath string, secrets []string) (model.PreviewFile, error) {
+	preview := model.PreviewFile{
+		Path: filepath.ToSlash(relPath),
+		Size: file.size,
+		Mode: fmt.Sprintf("%04o", file.mode.Perm()),
+	}
+
+	newText, isText := previewText(file.data)
+	if isSecretOnlyPath(relPath) {
+		// Nothing of these files can be shown: masking only knows the new
+		// values, so a diff would reveal the replaced secret.
+		isText = false
+	}
+	if isText {
+		preview.Content = maskSecrets(newText, secrets)
+	} else {
+		preview.ContentOmitted = true
+	}
+
+	info, err := os.Stat(diskPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			preview.Status = model.PreviewAdded
+			return preview, nil
+		}
+		return preview, fmt.Errorf("failed to stat %s: %w", diskPath, err)
+	}
+
+	same, err := sameContent(file, diskPath, info.Size())
+	if err != nil {
+		return preview, err
+	}
+	if same {
+		preview.Status = model.PreviewUnchanged
+		return preview, nil
+	}
+	preview.Status = model.PreviewModified
+
+	if !isText || info.Size() > memPreviewLimit {
+		return preview, nil
+	}
+	current, err := os.ReadFile(diskPath)
+	if err != nil {
+		return preview, fmt.Errorf("failed to read %s: %w", diskPath, err)
+	}
+	if oldText, ok := previewText(current); ok {
+		preview.Diff = UnifiedDiff(preview.Path, maskSecrets(oldText, secrets), preview.Content)
+	}
+
+	return preview, nil
+}
+
+// isSecretOnlyPath reports whether the output file at relPath holds nothing
+// but secrets: a Docker secret file or the age-encrypted secrets. The
+// preview only reports whether such a file changes.
+func isSecretOnlyPath(relPath string) bool {
+	relPath = filepath.ToSlash(relPath)
+	return strings.HasPrefix(relPath, secretsDirName+"/") || strings.HasSuffix(relPath, ".age")
+}
+
+// removedPreviewFiles lists the files ClearOutputDir would delete that the
+// generation does not write again.
+func (g *GeneratorService) removedPreviewFiles(rendered map[string]bool) ([]model.PreviewFile, error) {
+	paths, err := g.managedOutputPaths()
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []model.PreviewFile
+	for _, managedPath := range paths {
+		err := filepath.WalkDir(filepath.Join(g.outputDir, managedPath), func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+
+			relPath, err := filepath.Rel(g.outputDir, path)
+			if err != nil || rendered[relPath] {
+				return err
+			}
+
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			removed = append(removed, model.PreviewFile{
+				Path:           filepath.ToSlash(relPath),
+				Size:           info.Size(),
+				Mode:           fmt.Sprintf("%04o", info.Mode().Perm()),
+				Status:         model.PreviewRemoved,
+				ContentOmitted: true,
+			})
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan output directory: %w", err)
+		}
+	}
+
+	return removed, nil
+}
+
+func previewText(data []byte) (string, bool) {
+	if data == nil || bytes.IndexByte(data, 0) >= 0 || !utf8.Valid(data) {
+		return "", data != nil && len(data) == 0
+	}
+	return string(data), true
+}
+
+func sameContent(file *memFile, diskPath string, diskSize int64) (bool, error) {
+	if file.size != diskSize {
+		return false, nil
+	}
+
+	if file.data == nil && file.source != "" {
+		return sameFiles(file.source, diskPath)
+	}
+
+	current, err := os.ReadFile(diskPath)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", diskPath, err)
+	}
+	return bytes.Equal(file.data, current), nil
+}
+
+func sameFiles(pathA, pathB string) (bool, error) {
+	fileA, err := os.Open(pathA)
+	if err != nil {
+		return false, err
+	}
+	defer utils.Close(fileA, "file: "+pathA)
+
+	fileB, err := os.Open(pathB)
+	if err != nil {
+		return false, err
+	}
+	defer utils.Close(fileB, "file: "+pathB)
+
+	bufA := make([]byte, 64*1024)
+	bufB := make([]byte, 64*1024)
+	for {
+		nA, errA := io.ReadFull(fileA, bufA)
+		nB, errB := io.ReadFull(fileB, bufB)
+		if nA != nB || !bytes.Equal(bufA[:nA], bufB[:nB]) {
+			return false, nil
+		}
+		if errA == io.EOF || errA == io.ErrUnexpectedEOF {
+			return errB == errA, nil
+		}
+		if errA != nil {
+			return false, errA
+		}
+		if errB != nil {
+			return false, errB
+		}
+	}
+}
+
+// configSecretValues returns the secret values of cfg that must never appear
+// in a preview.
+func configSecretValues(cfg *model.SetupConfig) []string {
+	secrets := model.SecretValues(cfg)
+
+	// Replace longer secrets first so one containing another is fully masked.
+	sort.Slice(secrets, func(i, j int) bool {
+		return len(secrets[i]) > len(secrets[j])
+	})
+	return secrets
+}
+
+// secretEnvLinePattern matches the lines that assign one of the catalog
+// variables holding secrets, whatever the file: NAME=value in .env files and
+// shell scripts, optionally exported, and NAME: value or - NAME=value in
+// YAML.
+var secretEnvLinePattern = func() *regexp.Regexp {
+	var names []string
+	for _, v := range secretEnvVars() {
+		names = append(names, regexp.QuoteMeta(v.Name))
+	}
+	return regexp.MustCompile(`(?m)^([ \t]*(?:- *)?(?:export +)?["']?(?:` + strings.Join(names, "|") + `)["']?(?:=|: *))(.*)$`)
+}()
+
+// envReferencePattern matches a value that only refers to another variable,
+// such as ${PG_PASSWORD}, which is not itself a secret.
+var envReferencePattern = regexp.MustCompile(`^["']?\$\{?[A-Za-z_][A-Za-z0-9_]*\}?["']?$`)
+
+// maskSecrets hides secrets in file content: private keys entirely, the
+// values of secret env variables by name, and any known secret value. Masking
+// by name also covers values that are no longer configured, such as the old
+// side of a diff.
+func maskSecrets(content string, secrets []string) string {
+	if strings.Contains(content, "PRIVATE KEY-----") {
+		return maskedConfigValue
+	}
+
+	content = secretEnvLinePattern.ReplaceAllStringFunc(content, func(line string) string {
+		match := secretEnvLinePattern.FindStringSubmatch(line)
+		value := strings.TrimSpace(match[2])
+		if value == "" || value == "''" || value == `""` || envReferencePattern.MatchString(value) {
+			return line
+		}
+		return match[1] + "'" + maskedConfigValue + "'"
+	})
+
+	for _, secret := range secrets {
+		content = strings.ReplaceAll(content, secret, maskedConfigValue)
+	}
+
+	return content
+}
+
+const (
+	diffContextLines = 3
+	// maxDiffCells bounds the LCS table so huge files are not diffed.
+	maxDiffCells = 4 << 20
+)
+
+type diffOp struct {
+	kind byte
+	text string
+}
+
+// UnifiedDiff returns a unified diff of oldText and newText for path, with
+// three lines of context around each change.
+func UnifiedDiff(path, oldText, newText string) string {
+	oldLines := splitLines(oldText)
+	newLines := splitLines(newText)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- a/%s\n+++ b/%s\n", path, path)
+
+	if len(oldLines)*len(newLines) > maxDiffCells {
+		b.WriteString("@@ file too large to diff @@\n")
+		return b.String()
+	}
+
+	ops := diffLines(oldLines, newLines)
+
+	oldLineAt := make([]int, len(ops)+1)
+	newLineAt := make([]int, len(ops)+1)
+	for i, op := range ops {
+		oldLineAt[i+1], newLineAt[i+1] = oldLineAt[i], newLineAt[i]
+		if op.kind != '+' {
+			oldLineAt[i+1]++
+		}
+		if op.kind != '-' {
+			newLineAt[i+1]++
+		}
+	}
+
+	previousEnd := 0
+	for i := 0; i < len(ops); {
+		for i < len(ops) && ops[i].kind == ' ' {
+			i++
+		}
+		if i == len(ops) {
+			break
+		}
+
+		lastChange := i
+		for j := i; j < len(ops) && j-lastChange <= 2*diffContextLines+1; j++ {
+			if ops[j].kind != ' ' {
+				lastChange = j
+			}
+		}
+
+		start := max(i-diffContextLines, previousEnd)
+		end := min(lastChange+diffContextLines+1, len(ops))
+
+		oldCount := oldLineAt[end] - oldLineAt[start]
+		newCount := newLineAt[end] - newLineAt[start]
+		fmt.Fprintf(&b, "@@ -%d,%d +%d,%d @@\n",
+			hunkStart(oldLineAt[start], oldCount), oldCount,
+			hunkStart(newLineAt[start], newCount), newCount)
+		for _, op := range ops[start:end] {
+			b.WriteByte(op.kind)
+			b.WriteString(op.text)
+			b.WriteByte('\n')
+		}
+
+		previousEnd = end
+		i = end
+	}
+
+	return b.String()
+}
+
+func hunkStart(line, count int) int {
+	if count == 0 {
+		return line
+	}
+	return line + 1
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// diffLines computes a line diff from the longest common subsequence.
+func diffLines(oldLines, newLines []string) []diffOp {
+	n, m := len(oldLines), len(newLines)
+	lcs := make([][]int32, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if oldLines[i] == newLines[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	ops := make([]diffOp, 0, max(n, m))
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case oldLines[i] == newLines[j]:
+			ops = append(ops, diffOp{' ', oldLines[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', oldLines[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', newLines[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		ops = append(ops, diffOp{'-', oldLines[i]})
+	}
+	for ; j < m; j++ {
+		ops = append(ops, diffOp{'+', newLines[j]})
+	}
+
+	return ops
+}
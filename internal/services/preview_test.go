@@ -0,0 +1,176 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/biliqiqi/baklab-setup/internal/model"
+	"github.com/biliqiqi/baklab-setup/internal/storage"
+)
+
+func TestPreviewConfigFiles(t *testing.T) {
+	outputDir := t.TempDir()
+	writeTestFile(t, filepath.Join(outputDir, ".env.production"), "APP_DB_PASSWORD='OldDbPass1!'\n")
+	writeTestFile(t, filepath.Join(outputDir, "redis", "stale.conf"), "left over")
+
+	templatesDir, err := filepath.Abs("../../templates")
+	if err != nil {
+		t.Fatalf("Failed to get templates directory path: %v", err)
+	}
+
+	service := NewSetupService(storage.NewMemoryStorage())
+	service.SetOutputDir(outputDir)
+	service.generator.SetTemplatesFS(os.DirFS(templatesDir))
+
+	cfg := &model.SetupConfig{
+		App:          model.AppConfig{DomainName: "example.com", BrandName: "Example", DefaultLang: "en"},
+		Database:     model.DatabaseConfig{AppPassword: "AppDbPass1!", SuperPassword: "SuperDbPass1!"},
+		Redis:        model.RedisConfig{Password: "RedisPass1!"},
+		AdminUser:    model.AdminUserConfig{Username: "admin", Password: "AdminPass1!"},
+		ReverseProxy: model.ReverseProxyConfig{Type: "caddy"},
+	}
+
+	preview, err := service.PreviewConfigFiles(cfg, nil)
+	if err != nil {
+		t.Fatalf("PreviewConfigFiles() failed: %v", err)
+	}
+
+	files := map[string]model.PreviewFile{}
+	for _, file := range preview.Files {
+		files[file.Path] = file
+		for _, secret := range []string{"OldDbPass1!", "AppDbPass1!", "SuperDbPass1!", "RedisPass1!", "AdminPass1!"} {
+			if strings.Contains(file.Content, secret) || strings.Contains(file.Diff, secret) {
+				t.Errorf("%s preview leaks secret %q", file.Path, secret)
+			}
+		}
+	}
+
+	env, ok := files[".env.production"]
+	if !ok || env.Status != model.PreviewModified || env.Mode != "0644" {
+		t.Fatalf(".env.production preview = %+v, want a modified 0644 file", env)
+	}
+	if !strings.Contains(env.Diff, "+PG_PASSWORD='******'") || !strings.Contains(env.Diff, "+DEFAULT_LANG=en") {
+		t.Errorf(".env.production diff = %q, want masked passwords", env.Diff)
+	}
+
+	if file := files["docker-compose.production.yml"]; file.Status != model.PreviewAdded || file.Size == 0 {
+		t.Errorf("docker-compose.production.yml preview = %+v, want an added file", file)
+	}
+	if file := files["keys/jwt-private.pem"]; file.Content != maskedConfigValue {
+		t.Errorf("keys/jwt-private.pem content = %q, want the private key masked", file.Content)
+	}
+	if file := files["redis/stale.conf"]; file.Status != model.PreviewRemoved {
+		t.Errorf("redis/stale.conf preview = %+v, want a removed file", file)
+	}
+
+	if got := readTestFile(t, filepath.Join(outputDir, ".env.production")); got != "APP_DB_PASSWORD='OldDbPass1!'\n" {
+		t.Errorf(".env.production = %q, preview should not write files", got)
+	}
+	for _, path := range []string{"docker-compose.production.yml", filepath.Join("keys", "jwt-private.pem")} {
+		if _, err := os.Stat(filepath.Join(outputDir, path)); !os.IsNotExist(err) {
+			t.Errorf("preview should not create %s", path)
+		}
+	}
+}
+
+func TestPreviewHidesChangedDockerSecrets(t *testing.T) {
+	outputDir := t.TempDir()
+	templatesDir, err := filepath.Abs("../../templates")
+	if err != nil {
+		t.Fatalf("Failed to get templates directory path: %v", err)
+	}
+
+	g := NewGeneratorService()
+	g.SetOutputDir(outputDir)
+	g.SetTemplatesFS(os.DirFS(templatesDir))
+
+	cfg := dockerSecretsConfig()
+	cfg.Database.AppPassword = "OldDbSecret9!"
+	if err := g.WriteArtifacts(cfg, nil); err != nil {
+		t.Fatalf("WriteArtifacts() failed: %v", err)
+	}
+
+	cfg.Database.AppPassword = "NewDbSecret9!"
+	preview, err := g.PreviewConfigFiles(cfg, nil)
+	if err != nil {
+		t.Fatalf("PreviewConfigFiles() failed: %v", err)
+	}
+
+	files := map[string]model.PreviewFile{}
+	for _, file := range preview.Files {
+		files[file.Path] = file
+		for _, secret := range []string{"OldDbSecret9!", "NewDbSecret9!"} {
+			if strings.Contains(file.Content, secret) || strings.Contains(file.Diff, secret) {
+				t.Errorf("%s preview leaks secret %q", file.Path, secret)
+			}
+		}
+	}
+
+	changed := files["secrets/app_db_password"]
+	if changed.Status != model.PreviewModified || !changed.ContentOmitted || changed.Content != "" || changed.Diff != "" {
+		t.Errorf("secrets/app_db_password preview = %+v, want modified without content or diff", changed)
+	}
+	if unchanged := files["secrets/pg_password"]; unchanged.Status != model.PreviewUnchanged || unchanged.Content != "" {
+		t.Errorf("secrets/pg_password preview = %+v, want unchanged without content", unchanged)
+	}
+}
+
+func TestPreviewOmitsAgeSecrets(t *testing.T) {
+	cfg, _ := ageSecretsConfig(t)
+	outputDir := writeAgeDeployment(t, cfg)
+
+	templatesDir, err := filepath.Abs("../../templates")
+	if err != nil {
+		t.Fatalf("Failed to get templates directory path: %v", err)
+	}
+	g := NewGeneratorService()
+	g.SetOutputDir(outputDir)
+	g.SetTemplatesFS(os.DirFS(templatesDir))
+
+	preview, err := g.PreviewConfigFiles(cfg, []string{"secrets"})
+	if err != nil {
+		t.Fatalf("PreviewConfigFiles() failed: %v", err)
+	}
+	if len(preview.Files) != 1 {
+		t.Fatalf("PreviewConfigFiles() = %+v, want only the encrypted secrets", preview.Files)
+	}
+	if file := preview.Files[0]; file.Path != ".env.production.age" || !file.ContentOmitted || file.Content != "" || file.Diff != "" {
+		t.Errorf("encrypted secrets preview = %+v, want no content or diff", file)
+	}
+}
+
+func TestMaskSecretsByVariableName(t *testing.T) {
+	content := strings.Join([]string{
+		"APP_DB_PASSWORD='OldDbPass1!'",
+		"export PG_PASSWORD=OldSuperPass1!",
+		"    SMTP_PASSWORD: OldMailPass1!",
+		"      - REDIS_PASSWORD=OldRedisPass1!",
+		`  "SUPER_PASSWORD": "OldAdminPass1!"`,
+		"  REDISCLI_AUTH: ${REDISCLI_AUTH}",
+		"SMTP_PASSWORD_FILE=/run/secrets/smtp_password",
+		"EMPTY_PASSWORD=",
+		"PG_PASSWORD=",
+	}, "\n")
+
+	masked := maskSecrets(content, nil)
+	for _, secret := range []string{"OldDbPass1!", "OldSuperPass1!", "OldMailPass1!", "OldRedisPass1!", "OldAdminPass1!"} {
+		if strings.Contains(masked, secret) {
+			t.Errorf("maskSecrets() leaks %q:\n%s", secret, masked)
+		}
+	}
+	for _, kept := range []string{"REDISCLI_AUTH: ${REDISCLI_AUTH}", "SMTP_PASSWORD_FILE=/run/secrets/smtp_password", "\nPG_PASSWORD="} {
+		if !strings.Contains(masked, kept) {
+			t.Errorf("maskSecrets() changed %q:\n%s", kept, masked)
+		}
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	got := UnifiedDiff("a.txt", "one\ntwo\nthree\n", "one\n2\nthree\nfour\n")
+	want := "--- a/a.txt\n+++ b/a.txt\n@@ -1,3 +1,4 @@\n one\n-two\n+2\n three\n+four\n"
+	if got != want {
+		t.Errorf("UnifiedDiff() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/biliqiqi/baklab-setup/internal/model"
+)
+
+// secretNameHints are name fragments that mark a field as holding a secret.
+var secretNameHints = []string{"password", "secret", "auth", "token", "private_key"}
+
+// notSecretFields match a hint but hold no secret.
+var notSecretFields = []string{"Output.SecretsMode"}
+
+// TestSecretFieldsAreTagged fails when a config field that looks like a
+// secret is missing its secret:"true" tag, since untagged fields end up in
+// config.json and API responses.
+func TestSecretFieldsAreTagged(t *testing.T) {
+	var check func(typ reflect.Type, path string)
+	check = func(typ reflect.Type, path string) {
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			fieldPath := strings.TrimPrefix(path+"."+field.Name, ".")
+
+			if field.Type.Kind() == reflect.Struct && field.Type.PkgPath() == typ.PkgPath() {
+				check(field.Type, fieldPath)
+				continue
+			}
+			if field.Type.Kind() != reflect.String || slices.Contains(notSecretFields, fieldPath) {
+				continue
+			}
+
+			jsonName, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			names := strings.ToLower(field.Name + " " + jsonName)
+			for _, hint := range secretNameHints {
+				if strings.Contains(names, hint) && field.Tag.Get("secret") != "true" {
+					t.Errorf("%s looks like a secret but is not tagged secret:\"true\"", fieldPath)
+				}
+			}
+		}
+	}
+	check(reflect.TypeOf(model.SetupConfig{}), "")
+
+	if !model.IsSecretPath("SMS.APISecret") || !model.IsSecretPath("sms.api_secret") {
+		t.Errorf("SMS.APISecret should be a secret field")
+	}
+}
+
+func fillSecrets(cfg *model.SetupConfig) []string {
+	var values []string
+	for _, field := range model.SecretFields() {
+		value := "secret-value-of-" + field.JSONPath
+		field.Value(cfg).SetString(value)
+		values = append(values, value)
+	}
+	return values
+}
+
+func TestSanitizeConfigForSavingClearsSecrets(t *testing.T) {
+	cfg := model.SetupConfig{SMS: model.SMSConfig{APIKey: "sms-key"}}
+	values := fillSecrets(&cfg)
+
+	sanitized := NewGeneratorService().sanitizeConfigForSaving(cfg)
+	data, err := json.Marshal(sanitized)
+	if err != nil {
+		t.Fatalf("json.Marshal() failed: %v", err)
+	}
+
+	for _, value := range values {
+		if strings.Contains(string(data), value) {
+			t.Errorf("sanitized config still contains %s", value)
+		}
+	}
+	if sanitized.SMS.APIKey != "sms-key" {
+		t.Errorf("non-secret fields should be kept")
+	}
+	if cfg.SMS.APISecret == "" {
+		t.Errorf("sanitizeConfigForSaving() should not modify its argument")
+	}
+}
+
+func TestEnvCatalogRestoresEverySecret(t *testing.T) {
+	cfg := &model.SetupConfig{}
+	fillSecrets(cfg)
+
+	envVars := map[string]string{}
+	for _, section := range renderEnvCatalog(cfg, envContext{}) {
+		for _, v := range section.Vars {
+			envVars[v.Name] = v.Value
+		}
+	}
+
+	restored := &model.SetupConfig{}
+	applyEnvVars(restored, envVars, true)
+
+	for _, field := range model.SecretFields() {
+		if got, want := field.Value(restored).String(), field.Value(cfg).String(); got != want {
+			t.Errorf("%s = %q after import, want %q", field.Path, got, want)
+		}
+	}
+}
@@ -4,32 +4,41 @@ import (
 	"crypto/rand"
 	"embed"
 	"encoding/hex"
-	"encoding/json"
 	"fmt"
 	"io/fs"
 	"log"
+	"maps"
+	"net/netip"
 	"os"
-	"strconv"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/biliqiqi/baklab-setup/internal/age"
+	"github.com/biliqiqi/baklab-setup/internal/dirlock"
 	"github.com/biliqiqi/baklab-setup/internal/model"
 	"github.com/biliqiqi/baklab-setup/internal/storage"
 	"github.com/biliqiqi/baklab-setup/internal/utils"
 )
 
 type SetupService struct {
-	storage         *storage.JSONStorage
+	storage         storage.Storage
 	validator       *ValidatorService
 	generator       *GeneratorService
 	developmentMode bool
+	ageIdentities   []*age.Identity
+	ipv6BindPrefix  int
+	tokenMu         sync.Mutex
+	tokenLockDir    string
 }
 
-func NewSetupService(storage *storage.JSONStorage) *SetupService {
+func NewSetupService(store storage.Storage) *SetupService {
 	return &SetupService{
-		storage:   storage,
-		validator: NewValidatorService(),
-		generator: NewGeneratorService(),
+		storage:        store,
+		validator:      NewValidatorService(),
+		generator:      NewGeneratorService(),
+		ipv6BindPrefix: 128,
 	}
 }
 
@@ -41,6 +50,11 @@ func (s *SetupService) SetTemplatesFS(templatesFS embed.FS) {
 	s.generator.SetTemplatesFS(templatesSubFS)
 }
 
+// SetTemplatesDir overlays user templates from dir on the embedded ones.
+func (s *SetupService) SetTemplatesDir(dir string) error {
+	return s.generator.SetTemplatesDir(dir)
+}
+
 func (s *SetupService) SetOutputDir(dir string) {
 	s.generator.SetOutputDir(dir)
 }
@@ -49,6 +63,19 @@ func (s *SetupService) SetDevelopmentMode(enabled bool) {
 	s.developmentMode = enabled
 }
 
+// SetAgeIdentities sets the identities ImportFromOutputDir decrypts
+// age-encrypted secrets with.
+func (s *SetupService) SetAgeIdentities(identities []*age.Identity) {
+	s.ageIdentities = identities
+}
+
+// SetIPv6BindPrefix binds setup tokens used from IPv6 addresses to the
+// network of the given prefix length instead of the single address, so that
+// clients with temporary addresses keep their session.
+func (s *SetupService) SetIPv6BindPrefix(bits int) {
+	s.ipv6BindPrefix = bits
+}
+
 func (s *SetupService) PrepareConfiguration(cfg *model.SetupConfig) {
 	if s.developmentMode {
 		cfg.Development = true
@@ -83,10 +110,20 @@ func (s *SetupService) InitializeSetup(ipAddress string) (*model.SetupToken, err
 		return nil, fmt.Errorf("failed to generate setup token: %w", err)
 	}
 
-	if err := s.storage.SaveSetupToken(token); err != nil {
+	if err := s.replaceConsoleToken(token); err != nil {
 		return nil, fmt.Errorf("failed to save setup token: %w", err)
 	}
 
+	if _, err := s.RestartSetup(); err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// RestartSetup puts the setup progress back to the initialization step. The
+// setup tokens are left alone, so the caller stays signed in.
+func (s *SetupService) RestartSetup() (*model.SetupState, error) {
 	state := &model.SetupState{
 		Status:      model.StatusPending,
 		CurrentStep: "initialization",
@@ -100,7 +137,7 @@ func (s *SetupService) InitializeSetup(ipAddress string) (*model.SetupToken, err
 		return nil, fmt.Errorf("failed to save setup state: %w", err)
 	}
 
-	return token, nil
+	return state, nil
 }
 
 func (s *SetupService) GetSetupStatus() (*model.SetupState, error) {
@@ -108,45 +145,169 @@ func (s *SetupService) GetSetupStatus() (*model.SetupState, error) {
 }
 
 func (s *SetupService) ValidateSetupToken(tokenStr string, ipAddress string) error {
-	token, err := s.storage.GetSetupToken()
+	_, err := s.AuthenticateSetupToken(tokenStr, ipAddress)
+	return err
+}
+
+// AuthenticateSetupToken validates a setup token presented from ipAddress
+// and returns it, without its plaintext.
+func (s *SetupService) AuthenticateSetupToken(tokenStr string, ipAddress string) (*model.SetupToken, error) {
+	unlock, err := s.lockTokens()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	_, token, err := s.authenticate(tokenStr, ipAddress)
+	return token, err
+}
+
+// authenticate finds the token matching tokenStr among the stored tokens,
+// checks that ipAddress may use it and binds it on first use. It returns the
+// stored tokens along with the match.
+func (s *SetupService) authenticate(tokenStr string, ipAddress string) ([]*model.SetupToken, *model.SetupToken, error) {
+	tokens, err := s.storage.GetSetupTokens()
 	if err != nil {
-		return fmt.Errorf("failed to get setup token: %w", err)
+		return nil, nil, fmt.Errorf("failed to get setup tokens: %w", err)
 	}
 
-	if token.Token != tokenStr {
-		return fmt.Errorf("invalid setup token")
+	i := slices.IndexFunc(tokens, func(token *model.SetupToken) bool {
+		return tokenMatches(token, tokenStr)
+	})
+	if i < 0 {
+		return nil, nil, fmt.Errorf("invalid setup token")
 	}
+	token := tokens[i]
 
 	if time.Now().After(token.ExpiresAt) {
-		return fmt.Errorf("setup token has expired")
+		return nil, nil, fmt.Errorf("setup token has expired")
 	}
 
-	if token.IPAddress == "0.0.0.0" {
+	if token.Used {
+		return nil, nil, fmt.Errorf("setup token has already been used")
+	}
+
+	switch token.IPAddress {
+	case "":
+	case "0.0.0.0":
 		token.IPAddress = ipAddress
-		if err := s.storage.SaveSetupToken(token); err != nil {
-			return fmt.Errorf("failed to bind token to IP: %w", err)
+		if err := s.saveSetupTokens(tokens); err != nil {
+			return nil, nil, fmt.Errorf("failed to bind token to IP: %w", err)
+		}
+	default:
+		if !s.sameClient(token.IPAddress, ipAddress) {
+			return nil, nil, fmt.Errorf("setup token can only be used from IP: %s", token.IPAddress)
 		}
-	} else if token.IPAddress != ipAddress {
-		return fmt.Errorf("setup token can only be used from IP: %s", token.IPAddress)
 	}
 
-	return nil
+	return tokens, token, nil
 }
 
-func (s *SetupService) MarkTokenAsUsed(tokenStr string) error {
-	token, err := s.storage.GetSetupToken()
+// sameClient reports whether ipAddress may use a token bound to boundIP.
+// IPv6 addresses match when they share the bind prefix.
+func (s *SetupService) sameClient(boundIP, ipAddress string) bool {
+	bound, err := netip.ParseAddr(boundIP)
+	if err != nil {
+		return boundIP == ipAddress
+	}
+	addr, err := netip.ParseAddr(ipAddress)
 	if err != nil {
-		return fmt.Errorf("failed to get setup token: %w", err)
+		return false
 	}
+	bound, addr = bound.Unmap(), addr.Unmap()
 
-	if token.Token == tokenStr {
-		token.Used = true
-		return s.storage.SaveSetupToken(token)
+	if !bound.Is6() || !addr.Is6() || s.ipv6BindPrefix >= 128 {
+		return bound == addr
+	}
+
+	prefix, err := bound.Prefix(s.ipv6BindPrefix)
+	if err != nil {
+		return false
+	}
+	return prefix.Contains(addr)
+}
+
+// markTokenAsUsed marks a stored token as used. The caller must hold the
+// token lock.
+func (s *SetupService) markTokenAsUsed(tokenStr string) error {
+	tokens, err := s.storage.GetSetupTokens()
+	if err != nil {
+		return fmt.Errorf("failed to get setup tokens: %w", err)
+	}
+
+	for _, token := range tokens {
+		if tokenMatches(token, tokenStr) {
+			token.Used = true
+			return s.saveSetupTokens(tokens)
+		}
 	}
 
 	return fmt.Errorf("token not found")
 }
 
+// ConsumeSetupToken validates a setup token and marks it as used, so the
+// access URL it came with cannot be opened again. It returns the consumed
+// token.
+func (s *SetupService) ConsumeSetupToken(tokenStr string, ipAddress string) (*model.SetupToken, error) {
+	unlock, err := s.lockTokens()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	_, token, err := s.authenticate(tokenStr, ipAddress)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.markTokenAsUsed(tokenStr); err != nil {
+		return nil, fmt.Errorf("failed to mark setup token as used: %w", err)
+	}
+
+	token.Used = true
+	return token, nil
+}
+
+// RotateSetupToken replaces the console token with a new, unbound one that
+// keeps the expiry of the old token, so every URL printed so far stops
+// working. A console token that has already been exchanged for a session is
+// kept, so the session stays valid; it cannot be used to sign in again.
+// Named tokens are left alone.
+func (s *SetupService) RotateSetupToken() (*model.SetupToken, error) {
+	unlock, err := s.lockTokens()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	tokens, err := s.storage.GetSetupTokens()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get setup tokens: %w", err)
+	}
+
+	i := slices.IndexFunc(tokens, isConsoleToken)
+	if i < 0 {
+		return nil, fmt.Errorf("console token not found")
+	}
+
+	token, err := s.generateSetupToken("0.0.0.0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate setup token: %w", err)
+	}
+	token.ExpiresAt = tokens[i].ExpiresAt
+
+	if pending := slices.IndexFunc(tokens, isPendingConsoleToken); pending >= 0 {
+		tokens[pending] = token
+	} else {
+		tokens = append(tokens, token)
+	}
+
+	if err := s.saveSetupTokens(tokens); err != nil {
+		return nil, fmt.Errorf("failed to save setup token: %w", err)
+	}
+
+	return token, nil
+}
+
 func (s *SetupService) SaveConfiguration(cfg *model.SetupConfig) error {
 	s.PrepareConfiguration(cfg)
 
@@ -158,7 +319,15 @@ func (s *SetupService) SaveConfiguration(cfg *model.SetupConfig) error {
 		return err
 	}
 
-	return s.storage.SaveSetupConfig(cfg)
+	if err := s.storage.SaveSetupConfig(cfg); err != nil {
+		return err
+	}
+
+	if err := s.recordConfigSnapshot(cfg, 0); err != nil {
+		log.Printf("Warning: failed to record config snapshot: %v", err)
+	}
+
+	return nil
 }
 
 func (s *SetupService) TestConnections(cfg *model.SetupConfig) ([]model.ConnectionTestResult, error) {
@@ -192,33 +361,116 @@ func (s *SetupService) TestConnections(cfg *model.SetupConfig) ([]model.Connecti
 }
 
 func (s *SetupService) GenerateConfigFiles(cfg *model.SetupConfig) error {
+	return s.GenerateArtifacts(cfg, nil)
+}
+
+// GenerateArtifacts regenerates only the named artifacts in place, leaving the
+// rest of the output directory alone. An empty only regenerates everything.
+func (s *SetupService) GenerateArtifacts(cfg *model.SetupConfig, only []string) error {
 	s.PrepareConfiguration(cfg)
 
-	if err := s.generator.ClearOutputDir(); err != nil {
-		return fmt.Errorf("failed to clear output directory: %w", err)
+	if err := ValidateArtifactSelection(cfg, only); err != nil {
+		return err
+	}
+
+	outputLock, err := dirlock.Acquire(s.generator.outputDir)
+	if err != nil {
+		return fmt.Errorf("failed to lock output directory: %w", err)
+	}
+	defer utils.Close(outputLock, "output directory lock")
+
+	backupName, err := s.generator.BackupOutputDir()
+	if err != nil {
+		return fmt.Errorf("failed to back up output directory: %w", err)
+	}
+
+	if err := s.generateConfigFiles(cfg, only); err != nil {
+		if backupName == "" {
+			return err
+		}
+		if restoreErr := s.generator.RestoreOutputBackup(backupName); restoreErr != nil {
+			return fmt.Errorf("%w (restoring backup %s also failed: %v)", err, backupName, restoreErr)
+		}
+		log.Printf("Generation failed, output directory restored from backup %s", backupName)
+		return err
+	}
+
+	if err := s.generator.PruneOutputBackups(); err != nil {
+		log.Printf("Warning: failed to prune output backups: %v", err)
+	}
+
+	return nil
+}
+
+// PreviewConfigFiles renders cfg in memory and reports what GenerateArtifacts
+// would write, without touching the output directory.
+func (s *SetupService) PreviewConfigFiles(cfg *model.SetupConfig, only []string) (*model.GenerationPreview, error) {
+	previewCfg := *cfg
+	s.PrepareConfiguration(&previewCfg)
+
+	return s.generator.PreviewConfigFiles(&previewCfg, only)
+}
+
+func (s *SetupService) generateConfigFiles(cfg *model.SetupConfig, only []string) error {
+	if len(only) == 0 {
+		if err := s.generator.ClearOutputDir(); err != nil {
+			return fmt.Errorf("failed to clear output directory: %w", err)
+		}
 	}
 
 	if err := s.updateSetupProgress("generation", 90, "Generating configuration files..."); err != nil {
 		return err
 	}
 
-	if err := s.generator.GenerateEnvFile(cfg); err != nil {
-		return fmt.Errorf("failed to generate .env file: %w", err)
+	return s.generator.WriteArtifacts(cfg, only)
+}
+
+func (s *SetupService) SetBackupRetention(keep int) {
+	s.generator.SetBackupRetention(keep)
+}
+
+func (s *SetupService) ListOutputBackups() ([]OutputBackup, error) {
+	return s.generator.ListOutputBackups()
+}
+
+// RollbackOutputDir restores the named output backup, or the newest one when
+// name is empty. The current files are backed up first, so a rollback can be
+// undone by rolling back again.
+func (s *SetupService) RollbackOutputDir(name string) (string, error) {
+	outputLock, err := dirlock.Acquire(s.generator.outputDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to lock output directory: %w", err)
 	}
+	defer utils.Close(outputLock, "output directory lock")
 
-	if err := s.generator.HandleJWTKeyFile(cfg); err != nil {
-		return fmt.Errorf("failed to handle JWT key file: %w", err)
+	if name == "" {
+		backups, err := s.generator.ListOutputBackups()
+		if err != nil {
+			return "", err
+		}
+		if len(backups) == 0 {
+			return "", fmt.Errorf("no output backups found")
+		}
+		name = backups[0].Name
 	}
 
-	if err := s.generator.GenerateDockerConfig(cfg); err != nil {
-		return fmt.Errorf("failed to generate docker config: %w", err)
+	if _, err := s.generator.backupPath(name); err != nil {
+		return "", err
 	}
 
-	if err := s.generator.SaveSetupConfiguration(cfg); err != nil {
-		return fmt.Errorf("failed to save setup configuration: %w", err)
+	if _, err := s.generator.BackupOutputDir(); err != nil {
+		return "", fmt.Errorf("failed to back up output directory: %w", err)
 	}
 
-	return nil
+	if err := s.generator.RestoreOutputBackup(name); err != nil {
+		return "", err
+	}
+
+	if err := s.generator.PruneOutputBackups(); err != nil {
+		log.Printf("Warning: failed to prune output backups: %v", err)
+	}
+
+	return name, nil
 }
 
 func (s *SetupService) GetOutputDirPath() (string, error) {
@@ -282,7 +534,15 @@ func (s *SetupService) generateSetupToken(ipAddress string) (*model.SetupToken,
 		return nil, fmt.Errorf("failed to generate random token: %w", err)
 	}
 
+	id, err := newTokenID()
+	if err != nil {
+		return nil, err
+	}
+
 	token := &model.SetupToken{
+		ID:        id,
+		Label:     ConsoleTokenLabel,
+		Role:      model.TokenRoleAdmin,
 		Token:     hex.EncodeToString(bytes),
 		ExpiresAt: time.Now().Add(8 * time.Hour),
 		IPAddress: ipAddress,
@@ -290,6 +550,10 @@ func (s *SetupService) generateSetupToken(ipAddress string) (*model.SetupToken,
 		CreatedAt: time.Now(),
 	}
 
+	if err := hashSetupToken(token); err != nil {
+		return nil, err
+	}
+
 	return token, nil
 }
 
@@ -308,15 +572,23 @@ func (s *SetupService) updateSetupProgress(step string, progress int, message st
 }
 
 func (s *SetupService) invalidateAllTokens() error {
-	token, err := s.storage.GetSetupToken()
+	unlock, err := s.lockTokens()
 	if err != nil {
-		return nil
+		return err
 	}
+	defer unlock()
 
-	token.Used = true
-	token.ExpiresAt = time.Now().Add(-1 * time.Hour)
+	tokens, err := s.storage.GetSetupTokens()
+	if err != nil {
+		return fmt.Errorf("failed to get setup tokens: %w", err)
+	}
 
-	return s.storage.SaveSetupToken(token)
+	for _, token := range tokens {
+		token.Used = true
+		token.ExpiresAt = time.Now().Add(-1 * time.Hour)
+	}
+
+	return s.saveSetupTokens(tokens)
 }
 
 func (s *SetupService) GetSetupConfig() (*model.SetupConfig, error) {
@@ -332,31 +604,41 @@ func (s *SetupService) ResetSetup() error {
 }
 
 func (s *SetupService) ImportConfiguration(configData []byte) (*model.SetupConfig, error) {
-	var cfg model.SetupConfig
-	if err := json.Unmarshal(configData, &cfg); err != nil {
-		return nil, fmt.Errorf("failed to parse configuration: %w", err)
+	cfg, err := MigrateConfig(configData)
+	if err != nil {
+		return nil, err
 	}
 
-	sanitizedImport := s.isSanitizedConfig(&cfg)
+	sanitizedImport := s.isSanitizedConfig(cfg)
 
 	cfg.RevisionMode.Enabled = true
 	cfg.RevisionMode.ImportedAt = time.Now()
 
+	if migrations := cfg.RevisionMode.AppliedMigrations; len(migrations) > 0 {
+		log.Printf("Migrated configuration from schema version %d to %d", cfg.RevisionMode.SourceSchemaVersion, model.ConfigSchemaVersion)
+		cfg.RevisionMode.ModifiedSteps = append(cfg.RevisionMode.ModifiedSteps,
+			fmt.Sprintf("SCHEMA_MIGRATED: v%d -> v%d", cfg.RevisionMode.SourceSchemaVersion, model.ConfigSchemaVersion))
+	}
+
 	if sanitizedImport {
 		cfg.RevisionMode.ModifiedSteps = append(cfg.RevisionMode.ModifiedSteps,
 			"NOTICE: Passwords and secrets need to be re-entered")
 	}
 
-	validationErrors := s.validator.ValidateConfig(&cfg)
+	validationErrors := s.validator.ValidateConfig(cfg)
 	if len(validationErrors) > 0 {
 		cfg.RevisionMode.ModifiedSteps = append(cfg.RevisionMode.ModifiedSteps,
 			fmt.Sprintf("VALIDATION_WARNINGS: %d fields need attention", len(validationErrors)))
 	}
 
-	if err := s.storage.SaveSetupConfig(&cfg); err != nil {
+	if err := s.storage.SaveSetupConfig(cfg); err != nil {
 		return nil, fmt.Errorf("failed to save imported configuration: %w", err)
 	}
 
+	if err := s.recordConfigSnapshot(cfg, 0); err != nil {
+		log.Printf("Warning: failed to record config snapshot: %v", err)
+	}
+
 	statusMsg := "Configuration imported successfully"
 	if sanitizedImport {
 		statusMsg = "Sanitized configuration imported - passwords required"
@@ -365,7 +647,7 @@ func (s *SetupService) ImportConfiguration(configData []byte) (*model.SetupConfi
 		log.Printf("Warning: failed to update setup progress: %v", err)
 	}
 
-	return &cfg, nil
+	return cfg, nil
 }
 
 // isSanitizedConfig checks if the configuration has been sanitized (passwords removed)
@@ -406,49 +688,13 @@ func (s *SetupService) ImportFromOutputDir(outputDir string) (*model.SetupConfig
 
 	log.Printf("Parsed %d environment variables", len(envVars))
 
-	cfg.Database.SuperPassword = envVars["PG_PASSWORD"]
-	cfg.Database.AppPassword = envVars["APP_DB_PASSWORD"]
-	cfg.Redis.Password = envVars["REDIS_PASSWORD"]
-	cfg.Redis.AdminPassword = envVars["REDISCLI_AUTH"]
-	cfg.SMTP.Password = envVars["SMTP_PASSWORD"]
-	cfg.AdminUser.Password = envVars["SUPER_PASSWORD"]
-	cfg.OAuth.GoogleSecret = envVars["GOOGLE_CLIENT_SECRET"]
-	cfg.OAuth.GithubSecret = envVars["GITHUB_CLIENT_SECRET"]
-	cfg.App.OAuth.GoogleSecret = envVars["GOOGLE_CLIENT_SECRET"]
-	cfg.App.OAuth.GithubSecret = envVars["GITHUB_CLIENT_SECRET"]
-	cfg.App.CloudflareSecret = envVars["CLOUDFLARE_SECRET"]
-	cfg.App.CORSAllowOrigins = strings.Split(envVars["CORS_ALLOW_ORIGINS"], ",")
-
-	if rankingHost := envVars["RANKING_HOST_NAME"]; rankingHost != "" {
-		cfg.App.RankingHostName = rankingHost
-	}
-
-	if userGuideHost := envVars["USER_GUIDE_HOST_NAME"]; userGuideHost != "" {
-		cfg.App.UserGuideHostName = userGuideHost
-	}
-
-	if dizkazDomain := envVars["DIZKAZ_DOMAIN_NAME"]; dizkazDomain != "" {
-		cfg.App.DizkazDomainName = dizkazDomain
-	}
-
-	if dizkazPath := envVars["DIZKAZ_SITE_PATH"]; dizkazPath != "" {
-		cfg.App.DizkazSitePath = dizkazPath
-	}
+	applyEnvVars(cfg, envVars, false)
 
-	if rateLimitStr := envVars["RATE_LIMIT_REQ_PER_MIN"]; rateLimitStr != "" {
-		if rateLimit, err := strconv.Atoi(rateLimitStr); err == nil {
-			cfg.App.RateLimitReqPerMin = rateLimit
-		}
+	secretVars, err := s.readSeparatedSecrets(outputDir, cfg, envVars)
+	if err != nil {
+		return nil, err
 	}
-
-	cfg.SMS.Provider = envVars["SMS_PROVIDER"]
-	cfg.SMS.Endpoint = envVars["SMS_ENDPOINT"]
-	cfg.SMS.APIKey = envVars["SMS_API_KEY"]
-	cfg.SMS.APISecret = envVars["SMS_API_SECRET"]
-	cfg.SMS.SignName = envVars["SMS_SIGN_NAME"]
-	cfg.SMS.TemplateRegister = envVars["SMS_TEMPLATE_REGISTER"]
-	cfg.SMS.TemplateReset = envVars["SMS_TEMPLATE_RESET"]
-	cfg.SMS.From = envVars["SMS_FROM"]
+	applyEnvVars(cfg, secretVars, true)
 
 	log.Printf("Populated passwords: DB_App=%v, Redis=%v, Admin=%v",
 		cfg.Database.AppPassword != "",
@@ -561,6 +807,10 @@ func (s *SetupService) ImportFromOutputDir(outputDir string) (*model.SetupConfig
 		return nil, fmt.Errorf("failed to save imported configuration: %w", err)
 	}
 
+	if err := s.recordConfigSnapshot(cfg, 0); err != nil {
+		log.Printf("Warning: failed to record config snapshot: %v", err)
+	}
+
 	if err := s.updateSetupProgress("import", 25, "Configuration imported from output directory"); err != nil {
 		log.Printf("Warning: failed to update setup progress: %v", err)
 	}
@@ -569,34 +819,55 @@ func (s *SetupService) ImportFromOutputDir(outputDir string) (*model.SetupConfig
 	return cfg, nil
 }
 
-func parseEnvFile(envPath string) (map[string]string, error) {
-	content, err := os.ReadFile(envPath)
+// readSeparatedSecrets reads the secrets a deployment keeps out of its .env
+// file, from the Docker secrets files or the age-encrypted file. Without an
+// age identity, an age mode deployment is only readable once decrypt-env has
+// put the secrets back into envVars.
+func (s *SetupService) readSeparatedSecrets(outputDir string, cfg *model.SetupConfig, envVars map[string]string) (map[string]string, error) {
+	secretVars, err := readDockerSecrets(outputDir)
 	if err != nil {
 		return nil, err
 	}
+	if secretVars != nil {
+		log.Printf("Read %d Docker secrets from: %s/%s", len(secretVars), outputDir, secretsDirName)
+	}
 
-	envVars := make(map[string]string)
-	lines := strings.Split(string(content), "\n")
-
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
+	agePath := fmt.Sprintf("%s/%s", outputDir, ageEnvFileName(cfg))
+	if !fileExists(agePath) {
+		return secretVars, nil
+	}
 
-		parts := strings.SplitN(line, "=", 2)
-		if len(parts) != 2 {
-			continue
+	if len(s.ageIdentities) == 0 {
+		if hasSecretEnvVars(envVars) {
+			log.Printf("Warning: no age identity given; taking secrets from the decrypted %s", envFileName(cfg))
+			return secretVars, nil
 		}
+		return nil, fmt.Errorf("secrets are encrypted in %s; an age identity is required to import them", agePath)
+	}
 
-		key := strings.TrimSpace(parts[0])
-		value := strings.TrimSpace(parts[1])
-		value = strings.Trim(value, "'\"")
+	log.Printf("Decrypting secrets from: %s", agePath)
+	ageVars, err := readAgeSecrets(agePath, s.ageIdentities)
+	if err != nil {
+		return nil, err
+	}
+	if secretVars == nil {
+		return ageVars, nil
+	}
+	maps.Copy(secretVars, ageVars)
+	return secretVars, nil
+}
 
-		envVars[key] = value
+// LoadSecretsFile fills the secret fields of cfg from an env-style file that
+// uses the same variable names as the generated .env file. Variables missing
+// from the file leave the corresponding fields untouched.
+func (s *SetupService) LoadSecretsFile(cfg *model.SetupConfig, secretsPath string) error {
+	envVars, err := parseEnvFile(secretsPath)
+	if err != nil {
+		return fmt.Errorf("failed to parse secrets file: %w", err)
 	}
 
-	return envVars, nil
+	applyEnvVars(cfg, envVars, true)
+	return nil
 }
 
 func copyFile(src, dst string) error {
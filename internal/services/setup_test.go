@@ -0,0 +1,65 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/biliqiqi/baklab-setup/internal/dirlock"
+	"github.com/biliqiqi/baklab-setup/internal/model"
+	"github.com/biliqiqi/baklab-setup/internal/storage"
+)
+
+func TestGenerateConfigFilesRefusesLockedOutputDir(t *testing.T) {
+	outputDir := t.TempDir()
+
+	lock, err := dirlock.Acquire(outputDir)
+	if err != nil {
+		t.Fatalf("Acquire() failed: %v", err)
+	}
+	defer lock.Close()
+
+	service := NewSetupService(storage.NewMemoryStorage())
+	service.SetOutputDir(outputDir)
+
+	err = service.GenerateConfigFiles(&model.SetupConfig{})
+	if !errors.Is(err, dirlock.ErrLocked) {
+		t.Fatalf("GenerateConfigFiles() error = %v, want ErrLocked", err)
+	}
+}
+
+func TestValidateSetupTokenBindsIPv6Prefix(t *testing.T) {
+	tests := []struct {
+		name      string
+		prefix    int
+		firstIP   string
+		laterIP   string
+		wantValid bool
+	}{
+		{"same IPv4 address", 128, "203.0.113.7", "203.0.113.7", true},
+		{"other IPv4 address", 64, "203.0.113.7", "203.0.113.8", false},
+		{"same IPv6 address in another notation", 128, "2001:db8::7", "2001:0db8:0:0::7", true},
+		{"other IPv6 address without prefix binding", 128, "2001:db8::7", "2001:db8::8", false},
+		{"IPv6 address in the bound /64", 64, "2001:db8:0:1::7", "2001:db8:0:1:abcd::9", true},
+		{"IPv6 address outside the bound /64", 64, "2001:db8:0:1::7", "2001:db8:0:2::7", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := NewSetupService(storage.NewMemoryStorage())
+			service.SetIPv6BindPrefix(tt.prefix)
+
+			token, err := service.InitializeSetup("0.0.0.0")
+			if err != nil {
+				t.Fatalf("InitializeSetup() failed: %v", err)
+			}
+			if err := service.ValidateSetupToken(token.Token, tt.firstIP); err != nil {
+				t.Fatalf("ValidateSetupToken() from %s failed: %v", tt.firstIP, err)
+			}
+
+			err = service.ValidateSetupToken(token.Token, tt.laterIP)
+			if gotValid := err == nil; gotValid != tt.wantValid {
+				t.Errorf("ValidateSetupToken() from %s error = %v, want valid %v", tt.laterIP, err, tt.wantValid)
+			}
+		})
+	}
+}
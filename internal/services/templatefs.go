@@ -0,0 +1,121 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// overlayFS serves a file from upper when it exists there and from lower
+// otherwise, so a templates directory only needs the files it changes.
+type overlayFS struct {
+	upper fs.FS
+	lower fs.FS
+}
+
+func newOverlayFS(upper, lower fs.FS) fs.FS {
+	return overlayFS{upper: upper, lower: lower}
+}
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	file, err := o.upper.Open(name)
+	if err == nil {
+		return file, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return o.lower.Open(name)
+}
+
+// ReadDir merges the entries of both layers, preferring upper.
+func (o overlayFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	upperEntries, upperErr := fs.ReadDir(o.upper, name)
+	if upperErr != nil && !errors.Is(upperErr, fs.ErrNotExist) {
+		return nil, upperErr
+	}
+
+	lowerEntries, lowerErr := fs.ReadDir(o.lower, name)
+	if lowerErr != nil && !errors.Is(lowerErr, fs.ErrNotExist) {
+		return nil, lowerErr
+	}
+
+	if upperErr != nil && lowerErr != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	merged := map[string]fs.DirEntry{}
+	for _, entry := range lowerEntries {
+		merged[entry.Name()] = entry
+	}
+	for _, entry := range upperEntries {
+		merged[entry.Name()] = entry
+	}
+
+	entries := make([]fs.DirEntry, 0, len(merged))
+	for _, entry := range merged {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	return entries, nil
+}
+
+// SetTemplatesDir overlays the files of dir on the current templates, so a
+// deployment can customize any template without rebuilding. It must be called
+// after SetTemplatesFS.
+func (g *GeneratorService) SetTemplatesDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open templates directory: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("templates directory %s is not a directory", dir)
+	}
+
+	overrides, err := TemplateFiles(os.DirFS(dir))
+	if err != nil {
+		return err
+	}
+	for _, file := range overrides {
+		if IsComposeTemplate(file) {
+			log.Printf("Warning: ignoring %s in %s: the compose file is built from the configuration and cannot be overridden", file, dir)
+		}
+	}
+
+	g.templatesFS = newOverlayFS(os.DirFS(dir), g.templatesFS)
+	return nil
+}
+
+// IsComposeTemplate reports whether path names a Docker Compose template,
+// such as docker-compose.yml.template. The compose file is built from typed
+// YAML rather than a template, so overrides of it have no effect.
+func IsComposeTemplate(name string) bool {
+	return strings.HasPrefix(path.Base(name), "docker-compose")
+}
+
+// TemplateFiles returns the paths of all files in a templates filesystem.
+func TemplateFiles(templates fs.FS) ([]string, error) {
+	var files []string
+	err := fs.WalkDir(templates, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list templates: %w", err)
+	}
+
+	return files, nil
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/biliqiqi/baklab-setup/internal/model"
+)
+
+func TestOverlayFS(t *testing.T) {
+	lower := fstest.MapFS{
+		"db/initdb/01-init.sh": {Data: []byte("built-in init")},
+		"db/postgresql.conf":   {Data: []byte("built-in conf")},
+	}
+	upper := fstest.MapFS{
+		"db/postgresql.conf":     {Data: []byte("custom conf")},
+		"db/initdb/03-extra.sql": {Data: []byte("custom sql")},
+	}
+	overlay := newOverlayFS(upper, lower)
+
+	if content, err := fs.ReadFile(overlay, "db/postgresql.conf"); err != nil || string(content) != "custom conf" {
+		t.Errorf("postgresql.conf = %q, %v, want the override", content, err)
+	}
+	if content, err := fs.ReadFile(overlay, "db/initdb/01-init.sh"); err != nil || string(content) != "built-in init" {
+		t.Errorf("01-init.sh = %q, %v, want the built-in file", content, err)
+	}
+
+	files, err := TemplateFiles(overlay)
+	if err != nil {
+		t.Fatalf("TemplateFiles() failed: %v", err)
+	}
+	want := "db/initdb/01-init.sh,db/initdb/03-extra.sql,db/postgresql.conf"
+	if got := strings.Join(files, ","); got != want {
+		t.Errorf("TemplateFiles() = %s, want %s", got, want)
+	}
+
+	if _, err := fs.ReadFile(overlay, "missing"); err == nil {
+		t.Errorf("reading a file in neither layer should fail")
+	}
+}
+
+func TestGenerateCaddyConfigWithTemplatesDir(t *testing.T) {
+	outputDir := t.TempDir()
+	overrideDir := t.TempDir()
+	writeTestFile(t, filepath.Join(overrideDir, "caddy", "Caddyfile.template"), "{{ .App.DomainName }} {\n  respond \"custom\"\n}\n")
+
+	templatesDir, err := filepath.Abs("../../templates")
+	if err != nil {
+		t.Fatalf("Failed to get templates directory path: %v", err)
+	}
+
+	g := NewGeneratorService()
+	g.SetOutputDir(outputDir)
+	g.SetTemplatesFS(os.DirFS(templatesDir))
+	if err := g.SetTemplatesDir(overrideDir); err != nil {
+		t.Fatalf("SetTemplatesDir() failed: %v", err)
+	}
+
+	cfg := &model.SetupConfig{App: model.AppConfig{DomainName: "example.com"}}
+	if err := g.GenerateCaddyConfig(cfg); err != nil {
+		t.Fatalf("GenerateCaddyConfig() failed: %v", err)
+	}
+
+	if got := readTestFile(t, filepath.Join(outputDir, "caddy", "Caddyfile")); got != "example.com {\n  respond \"custom\"\n}\n" {
+		t.Errorf("Caddyfile = %q, want the overridden template", got)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "caddy", "optional", "dizkaz.caddy.template")); err != nil {
+		t.Errorf("templates without an override should still come from the built-in set: %v", err)
+	}
+
+	if err := g.SetTemplatesDir(filepath.Join(overrideDir, "missing")); err == nil {
+		t.Errorf("SetTemplatesDir() should fail for a missing directory")
+	}
+}
+
+func TestIsComposeTemplate(t *testing.T) {
+	tests := map[string]bool{
+		"docker-compose.yml.template":            true,
+		"docker-compose.production.yml":          true,
+		"compose/docker-compose.override.yml":    true,
+		"caddy/Caddyfile.template":               false,
+		"env.template":                           false,
+		"nginx/conf.d/docker-compose-notes.conf": true,
+	}
+	for name, want := range tests {
+		if got := IsComposeTemplate(name); got != want {
+			t.Errorf("IsComposeTemplate(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/biliqiqi/baklab-setup/internal/model"
+)
+
+// Setup tokens are stored as a salted SHA-256 hash. A token carries 256 bits
+// of randomness, so a fast hash is enough; the salt keeps equal tokens from
+// producing equal hashes. The first tokenPrefixLength characters are kept in
+// the clear to correlate log lines with a token.
+const (
+	tokenSaltSize     = 16
+	tokenPrefixLength = 8
+)
+
+// hashSetupToken fills in the hash, salt and prefix of token from its
+// plaintext.
+func hashSetupToken(token *model.SetupToken) error {
+	salt := make([]byte, tokenSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return fmt.Errorf("failed to generate token salt: %w", err)
+	}
+
+	token.TokenSalt = hex.EncodeToString(salt)
+	token.TokenHash = tokenHash(salt, token.Token)
+	token.TokenPrefix = tokenPrefix(token.Token)
+	return nil
+}
+
+func tokenHash(salt []byte, tokenStr string) string {
+	h := sha256.New()
+	h.Write(salt)
+	h.Write([]byte(tokenStr))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func tokenPrefix(tokenStr string) string {
+	if len(tokenStr) > tokenPrefixLength {
+		return tokenStr[:tokenPrefixLength]
+	}
+	return tokenStr
+}
+
+// tokenMatches reports in constant time whether tokenStr is the token.
+// Tokens saved before hashing was introduced never match; MigrateSetupToken
+// hashes them when the server starts.
+func tokenMatches(token *model.SetupToken, tokenStr string) bool {
+	if token.TokenHash == "" {
+		return false
+	}
+
+	salt, err := hex.DecodeString(token.TokenSalt)
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(tokenHash(salt, tokenStr)), []byte(token.TokenHash)) == 1
+}
+
+// saveSetupTokens stores tokens without their plaintext.
+func (s *SetupService) saveSetupTokens(tokens []*model.SetupToken) error {
+	stored := make([]*model.SetupToken, 0, len(tokens))
+	for _, token := range tokens {
+		copied := *token
+		copied.Token = ""
+		stored = append(stored, &copied)
+	}
+	return s.storage.SaveSetupTokens(stored)
+}
+
+// MigrateSetupToken converts a setup token stored by an older version: a
+// plaintext token is replaced by its hash, and a token without an ID or
+// label becomes the console token. It does nothing when every stored token
+// is up to date.
+func (s *SetupService) MigrateSetupToken() error {
+	unlock, err := s.lockTokens()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	tokens, err := s.storage.GetSetupTokens()
+	if err != nil {
+		return fmt.Errorf("failed to get setup tokens: %w", err)
+	}
+
+	migrated := false
+	for _, token := range tokens {
+		if token.ID == "" {
+			id, err := newTokenID()
+			if err != nil {
+				return err
+			}
+			token.ID = id
+			migrated = true
+		}
+		if token.Label == "" {
+			token.Label = ConsoleTokenLabel
+			migrated = true
+		}
+		if token.Token != "" && token.TokenHash == "" {
+			if err := hashSetupToken(token); err != nil {
+				return err
+			}
+			migrated = true
+		}
+	}
+	if !migrated {
+		return nil
+	}
+
+	if err := s.saveSetupTokens(tokens); err != nil {
+		return fmt.Errorf("failed to save hashed setup token: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/biliqiqi/baklab-setup/internal/model"
+	"github.com/biliqiqi/baklab-setup/internal/storage"
+)
+
+func TestSetupTokenIsStoredHashed(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	service := NewSetupService(store)
+
+	token, err := service.InitializeSetup("0.0.0.0")
+	if err != nil {
+		t.Fatalf("InitializeSetup() failed: %v", err)
+	}
+	if token.Token == "" {
+		t.Fatal("InitializeSetup() returned no plaintext token")
+	}
+
+	stored := onlySetupToken(t, store)
+	if stored.Token != "" || stored.TokenHash == "" || strings.Contains(stored.TokenHash, token.Token) {
+		t.Fatalf("stored token = %+v, want only a hash", stored)
+	}
+	if !strings.HasPrefix(token.Token, stored.TokenPrefix) || len(stored.TokenPrefix) != tokenPrefixLength {
+		t.Errorf("stored prefix = %q, want the first %d characters of the token", stored.TokenPrefix, tokenPrefixLength)
+	}
+
+	if err := service.ValidateSetupToken(token.Token, "203.0.113.7"); err != nil {
+		t.Errorf("ValidateSetupToken() failed: %v", err)
+	}
+	if err := service.ValidateSetupToken(stored.TokenHash, "203.0.113.7"); err == nil {
+		t.Error("ValidateSetupToken() accepted the stored hash")
+	}
+
+	if _, err := service.ConsumeSetupToken(token.Token, "203.0.113.7"); err != nil {
+		t.Fatalf("ConsumeSetupToken() failed: %v", err)
+	}
+	if stored := onlySetupToken(t, store); !stored.Used || stored.Token != "" {
+		t.Errorf("stored token after ConsumeSetupToken() = %+v, want used and hashed", stored)
+	}
+}
+
+func TestMigrateSetupTokenHashesPlaintextToken(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	const plaintext = "0123456789abcdef0123456789abcdef"
+	if err := store.SaveSetupTokens([]*model.SetupToken{{
+		Token:     plaintext,
+		ExpiresAt: time.Now().Add(time.Hour),
+		IPAddress: "0.0.0.0",
+	}}); err != nil {
+		t.Fatalf("SaveSetupTokens() failed: %v", err)
+	}
+
+	service := NewSetupService(store)
+	if err := service.MigrateSetupToken(); err != nil {
+		t.Fatalf("MigrateSetupToken() failed: %v", err)
+	}
+
+	stored := onlySetupToken(t, store)
+	if stored.ID == "" || stored.Label != ConsoleTokenLabel {
+		t.Errorf("migrated token ID, label = %q, %q, want an ID and %q", stored.ID, stored.Label, ConsoleTokenLabel)
+	}
+	if stored.Token != "" || stored.TokenHash == "" || stored.TokenPrefix != plaintext[:tokenPrefixLength] {
+		t.Fatalf("migrated token = %+v, want hash and prefix only", stored)
+	}
+	if err := service.ValidateSetupToken(plaintext, "203.0.113.7"); err != nil {
+		t.Errorf("ValidateSetupToken() after migration failed: %v", err)
+	}
+
+	if err := NewSetupService(storage.NewMemoryStorage()).MigrateSetupToken(); err != nil {
+		t.Errorf("MigrateSetupToken() without a token failed: %v", err)
+	}
+}
+
+func TestUnhashedSetupTokenDoesNotAuthenticate(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	const plaintext = "0123456789abcdef0123456789abcdef"
+	if err := store.SaveSetupTokens([]*model.SetupToken{{
+		ID:        "0badc0de",
+		Label:     ConsoleTokenLabel,
+		Token:     plaintext,
+		ExpiresAt: time.Now().Add(time.Hour),
+	}}); err != nil {
+		t.Fatalf("SaveSetupTokens() failed: %v", err)
+	}
+
+	service := NewSetupService(store)
+	if err := service.ValidateSetupToken(plaintext, "203.0.113.7"); err == nil {
+		t.Error("ValidateSetupToken() accepted a token stored in plaintext")
+	}
+	if _, err := service.ConsumeSetupToken(plaintext, "203.0.113.7"); err == nil {
+		t.Error("ConsumeSetupToken() accepted a token stored in plaintext")
+	}
+}
+
+// failingTokenStorage fails to read the setup tokens.
+type failingTokenStorage struct {
+	storage.Storage
+}
+
+var errTokenStorage = errors.New("token storage unavailable")
+
+func (failingTokenStorage) GetSetupTokens() ([]*model.SetupToken, error) {
+	return nil, errTokenStorage
+}
+
+func TestTokenStorageErrorsArePropagated(t *testing.T) {
+	service := NewSetupService(failingTokenStorage{storage.NewMemoryStorage()})
+
+	if err := service.MigrateSetupToken(); !errors.Is(err, errTokenStorage) {
+		t.Errorf("MigrateSetupToken() error = %v, want %v", err, errTokenStorage)
+	}
+	if err := service.CompleteSetup(); !errors.Is(err, errTokenStorage) {
+		t.Errorf("CompleteSetup() error = %v, want %v", err, errTokenStorage)
+	}
+}
+
+func onlySetupToken(t *testing.T, store storage.Storage) *model.SetupToken {
+	t.Helper()
+	tokens, err := store.GetSetupTokens()
+	if err != nil {
+		t.Fatalf("GetSetupTokens() failed: %v", err)
+	}
+	if len(tokens) != 1 {
+		t.Fatalf("GetSetupTokens() returned %d tokens, want 1", len(tokens))
+	}
+	return tokens[0]
+}
@@ -0,0 +1,276 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/netip"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/biliqiqi/baklab-setup/internal/dirlock"
+	"github.com/biliqiqi/baklab-setup/internal/model"
+	"github.com/biliqiqi/baklab-setup/internal/utils"
+)
+
+// Besides the console token, whose access URL the server prints when it
+// starts, the setup tokens can include named tokens created with the token
+// command, for example to let a DBA fill in only the database section.
+
+// ConsoleTokenLabel is the label of the token printed by the server.
+const ConsoleTokenLabel = "console"
+
+// TokenLockFileName is the lock file in the data directory that is held
+// while the setup tokens are changed, so that the token command can change
+// them while the server runs. The server re-reads the tokens on every
+// request.
+const TokenLockFileName = ".baklab-setup-tokens.lock"
+
+const tokenLockTimeout = 5 * time.Second
+
+const tokenIDSize = 4
+
+// TokenOptions describes a named setup token to create.
+type TokenOptions struct {
+	Label    string
+	Role     model.TokenRole
+	Sections []string
+	TTL      time.Duration
+	// IPAddress is empty for a token usable from any address, "0.0.0.0"
+	// to bind it on first use, or the address it is bound to.
+	IPAddress string
+}
+
+func newTokenID() (string, error) {
+	id := make([]byte, tokenIDSize)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to generate token ID: %w", err)
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// SetTokenLockDir makes changes to the setup tokens hold TokenLockFileName
+// in dir, the data directory, besides the in-process mutex.
+func (s *SetupService) SetTokenLockDir(dir string) {
+	s.tokenLockDir = dir
+}
+
+// lockTokens locks the setup tokens for a read-modify-write and returns the
+// function that unlocks them.
+func (s *SetupService) lockTokens() (func(), error) {
+	s.tokenMu.Lock()
+	if s.tokenLockDir == "" {
+		return s.tokenMu.Unlock, nil
+	}
+
+	lock, err := dirlock.AcquireNamed(s.tokenLockDir, TokenLockFileName, tokenLockTimeout)
+	if err != nil {
+		s.tokenMu.Unlock()
+		return nil, fmt.Errorf("failed to lock setup tokens: %w", err)
+	}
+	return func() {
+		utils.Close(lock, "setup token lock")
+		s.tokenMu.Unlock()
+	}, nil
+}
+
+func isConsoleToken(token *model.SetupToken) bool {
+	return token.Label == ConsoleTokenLabel
+}
+
+// isPendingConsoleToken reports whether token is a console token that has
+// not been exchanged for a session yet. Consumed console tokens stay stored
+// until they expire, since sessions started with them refer to them.
+func isPendingConsoleToken(token *model.SetupToken) bool {
+	return isConsoleToken(token) && !token.Used
+}
+
+// replaceConsoleToken stores token as the console token and drops expired
+// named tokens.
+func (s *SetupService) replaceConsoleToken(token *model.SetupToken) error {
+	unlock, err := s.lockTokens()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	tokens, err := s.storage.GetSetupTokens()
+	if err != nil {
+		return fmt.Errorf("failed to get setup tokens: %w", err)
+	}
+
+	now := time.Now()
+	tokens = slices.DeleteFunc(tokens, func(existing *model.SetupToken) bool {
+		return isConsoleToken(existing) || now.After(existing.ExpiresAt)
+	})
+	tokens = append(tokens, token)
+
+	return s.saveSetupTokens(tokens)
+}
+
+// CreateSetupToken creates a named setup token and returns it with its
+// plaintext, which is not stored.
+func (s *SetupService) CreateSetupToken(opts TokenOptions) (*model.SetupToken, error) {
+	if err := validateTokenOptions(opts); err != nil {
+		return nil, err
+	}
+
+	unlock, err := s.lockTokens()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	tokens, err := s.storage.GetSetupTokens()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get setup tokens: %w", err)
+	}
+	if slices.ContainsFunc(tokens, func(existing *model.SetupToken) bool { return existing.Label == opts.Label }) {
+		return nil, fmt.Errorf("a setup token labeled %q already exists", opts.Label)
+	}
+
+	token, err := s.generateSetupToken(opts.IPAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate setup token: %w", err)
+	}
+	token.Label = opts.Label
+	token.Role = opts.Role
+	token.Sections = opts.Sections
+	token.ExpiresAt = token.CreatedAt.Add(opts.TTL)
+
+	if err := s.saveSetupTokens(append(tokens, token)); err != nil {
+		return nil, fmt.Errorf("failed to save setup token: %w", err)
+	}
+
+	return token, nil
+}
+
+func validateTokenOptions(opts TokenOptions) error {
+	if opts.Label == "" {
+		return fmt.Errorf("token label is required")
+	}
+	if opts.Label == ConsoleTokenLabel {
+		return fmt.Errorf("token label %q is reserved for the token printed by the server", ConsoleTokenLabel)
+	}
+	if opts.TTL <= 0 {
+		return fmt.Errorf("token lifetime must be positive")
+	}
+
+	switch opts.Role {
+	case model.TokenRoleViewer, model.TokenRoleAdmin:
+		if len(opts.Sections) > 0 {
+			return fmt.Errorf("sections only apply to the %s role", model.TokenRoleSectionEditor)
+		}
+	case model.TokenRoleSectionEditor:
+		if len(opts.Sections) == 0 {
+			return fmt.Errorf("the %s role needs at least one section", model.TokenRoleSectionEditor)
+		}
+		sections := ConfigSections()
+		for _, section := range opts.Sections {
+			if !slices.Contains(sections, section) {
+				return fmt.Errorf("unknown section %q (must be one of %s)", section, strings.Join(sections, ", "))
+			}
+		}
+	default:
+		return fmt.Errorf("unknown role %q (must be %s, %s or %s)", opts.Role,
+			model.TokenRoleViewer, model.TokenRoleSectionEditor, model.TokenRoleAdmin)
+	}
+
+	if opts.IPAddress != "" && opts.IPAddress != "0.0.0.0" {
+		if _, err := netip.ParseAddr(opts.IPAddress); err != nil {
+			return fmt.Errorf("invalid IP address %q", opts.IPAddress)
+		}
+	}
+
+	return nil
+}
+
+// ListSetupTokens returns the stored setup tokens without their plaintext.
+func (s *SetupService) ListSetupTokens() ([]*model.SetupToken, error) {
+	tokens, err := s.storage.GetSetupTokens()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get setup tokens: %w", err)
+	}
+	return tokens, nil
+}
+
+// RevokeSetupToken deletes the setup token with the given ID or label and
+// returns it. Sessions started with the token end with it.
+func (s *SetupService) RevokeSetupToken(idOrLabel string) (*model.SetupToken, error) {
+	unlock, err := s.lockTokens()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	tokens, err := s.storage.GetSetupTokens()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get setup tokens: %w", err)
+	}
+
+	i := slices.IndexFunc(tokens, func(token *model.SetupToken) bool {
+		return token.ID == idOrLabel || token.Label == idOrLabel
+	})
+	if i < 0 {
+		return nil, fmt.Errorf("setup token not found: %s", idOrLabel)
+	}
+	revoked := tokens[i]
+
+	if err := s.saveSetupTokens(slices.Delete(tokens, i, i+1)); err != nil {
+		return nil, fmt.Errorf("failed to save setup tokens: %w", err)
+	}
+
+	return revoked, nil
+}
+
+// LookupSetupToken returns the setup token with the given ID, which a
+// session was started with, unless it has been revoked or has expired.
+func (s *SetupService) LookupSetupToken(id string) (*model.SetupToken, error) {
+	tokens, err := s.storage.GetSetupTokens()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get setup tokens: %w", err)
+	}
+
+	i := slices.IndexFunc(tokens, func(token *model.SetupToken) bool { return token.ID == id })
+	if i < 0 {
+		return nil, fmt.Errorf("setup token has been revoked")
+	}
+	if time.Now().After(tokens[i].ExpiresAt) {
+		return nil, fmt.Errorf("setup token has expired")
+	}
+
+	return tokens[i], nil
+}
+
+// ConfigSections returns the configuration sections a section editor can be
+// given: the top-level keys of the configuration that describe the
+// deployment.
+func ConfigSections() []string {
+	var sections []string
+	configType := reflect.TypeFor[model.SetupConfig]()
+	for i := range configType.NumField() {
+		name, _, _ := strings.Cut(configType.Field(i).Tag.Get("json"), ",")
+		if name == "" || name == "development" || historyIgnoredKeys[name] {
+			continue
+		}
+		sections = append(sections, name)
+	}
+	return sections
+}
+
+// ChangedConfigSections returns the sections cfg changes compared to the
+// saved configuration draft.
+func (s *SetupService) ChangedConfigSections(cfg *model.SetupConfig) ([]string, error) {
+	saved, err := s.storage.GetSetupConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get saved configuration: %w", err)
+	}
+
+	changes, err := diffConfigs(saved, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return changedSections(changes), nil
+}
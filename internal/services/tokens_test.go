@@ -0,0 +1,133 @@
+package services
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/biliqiqi/baklab-setup/internal/model"
+	"github.com/biliqiqi/baklab-setup/internal/storage"
+)
+
+func TestCreateSetupTokenValidatesOptions(t *testing.T) {
+	service := NewSetupService(storage.NewMemoryStorage())
+
+	tests := []struct {
+		name string
+		opts TokenOptions
+	}{
+		{"missing label", TokenOptions{Role: model.TokenRoleViewer, TTL: time.Hour}},
+		{"console label", TokenOptions{Label: ConsoleTokenLabel, Role: model.TokenRoleAdmin, TTL: time.Hour}},
+		{"unknown role", TokenOptions{Label: "ops", Role: "owner", TTL: time.Hour}},
+		{"no lifetime", TokenOptions{Label: "ops", Role: model.TokenRoleViewer}},
+		{"editor without sections", TokenOptions{Label: "dba", Role: model.TokenRoleSectionEditor, TTL: time.Hour}},
+		{"unknown section", TokenOptions{Label: "dba", Role: model.TokenRoleSectionEditor, Sections: []string{"dns"}, TTL: time.Hour}},
+		{"viewer with sections", TokenOptions{Label: "ops", Role: model.TokenRoleViewer, Sections: []string{"database"}, TTL: time.Hour}},
+		{"invalid IP", TokenOptions{Label: "ops", Role: model.TokenRoleViewer, TTL: time.Hour, IPAddress: "not-an-ip"}},
+	}
+	for _, tt := range tests {
+		if _, err := service.CreateSetupToken(tt.opts); err == nil {
+			t.Errorf("CreateSetupToken() with %s succeeded, want an error", tt.name)
+		}
+	}
+
+	opts := TokenOptions{Label: "dba", Role: model.TokenRoleSectionEditor, Sections: []string{"database"}, TTL: time.Hour}
+	if _, err := service.CreateSetupToken(opts); err != nil {
+		t.Fatalf("CreateSetupToken() failed: %v", err)
+	}
+	if _, err := service.CreateSetupToken(opts); err == nil {
+		t.Error("CreateSetupToken() with a duplicate label succeeded")
+	}
+}
+
+func TestNamedSetupTokensSurviveConsoleTokenRotation(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	service := NewSetupService(store)
+
+	console, err := service.InitializeSetup("0.0.0.0")
+	if err != nil {
+		t.Fatalf("InitializeSetup() failed: %v", err)
+	}
+	named, err := service.CreateSetupToken(TokenOptions{Label: "auditor", Role: model.TokenRoleViewer, TTL: time.Hour})
+	if err != nil {
+		t.Fatalf("CreateSetupToken() failed: %v", err)
+	}
+
+	if _, err := service.InitializeSetup("0.0.0.0"); err != nil {
+		t.Fatalf("InitializeSetup() again failed: %v", err)
+	}
+	if _, err := service.RotateSetupToken(); err != nil {
+		t.Fatalf("RotateSetupToken() failed: %v", err)
+	}
+
+	tokens, err := service.ListSetupTokens()
+	if err != nil {
+		t.Fatalf("ListSetupTokens() failed: %v", err)
+	}
+	if len(tokens) != 2 {
+		t.Fatalf("ListSetupTokens() returned %d tokens, want the console token and auditor", len(tokens))
+	}
+	if err := service.ValidateSetupToken(console.Token, "203.0.113.7"); err == nil {
+		t.Error("ValidateSetupToken() accepted the replaced console token")
+	}
+
+	authenticated, err := service.AuthenticateSetupToken(named.Token, "203.0.113.7")
+	if err != nil {
+		t.Fatalf("AuthenticateSetupToken() with the named token failed: %v", err)
+	}
+	if authenticated.ID != named.ID || authenticated.EffectiveRole() != model.TokenRoleViewer {
+		t.Errorf("AuthenticateSetupToken() = %+v, want the auditor viewer token", authenticated)
+	}
+}
+
+func TestRevokeSetupToken(t *testing.T) {
+	service := NewSetupService(storage.NewMemoryStorage())
+
+	token, err := service.CreateSetupToken(TokenOptions{Label: "auditor", Role: model.TokenRoleViewer, TTL: time.Hour})
+	if err != nil {
+		t.Fatalf("CreateSetupToken() failed: %v", err)
+	}
+	if _, err := service.LookupSetupToken(token.ID); err != nil {
+		t.Fatalf("LookupSetupToken() failed: %v", err)
+	}
+
+	if _, err := service.RevokeSetupToken("auditor"); err != nil {
+		t.Fatalf("RevokeSetupToken() failed: %v", err)
+	}
+	if _, err := service.LookupSetupToken(token.ID); err == nil {
+		t.Error("LookupSetupToken() found a revoked token")
+	}
+	if err := service.ValidateSetupToken(token.Token, "203.0.113.7"); err == nil {
+		t.Error("ValidateSetupToken() accepted a revoked token")
+	}
+	if _, err := service.RevokeSetupToken(token.ID); err == nil {
+		t.Error("RevokeSetupToken() of a revoked token succeeded")
+	}
+}
+
+func TestChangedConfigSections(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	service := NewSetupService(store)
+
+	saved := &model.SetupConfig{App: model.AppConfig{DomainName: "example.com"}}
+	if err := store.SaveSetupConfig(saved); err != nil {
+		t.Fatalf("SaveSetupConfig() failed: %v", err)
+	}
+
+	cfg := &model.SetupConfig{
+		App:         model.AppConfig{DomainName: "example.com"},
+		Database:    model.DatabaseConfig{Host: "db"},
+		CurrentStep: "database",
+	}
+	sections, err := service.ChangedConfigSections(cfg)
+	if err != nil {
+		t.Fatalf("ChangedConfigSections() failed: %v", err)
+	}
+	if !slices.Equal(sections, []string{"database"}) {
+		t.Errorf("ChangedConfigSections() = %v, want [database]", sections)
+	}
+
+	if !slices.Contains(ConfigSections(), "database") || slices.Contains(ConfigSections(), "current_step") {
+		t.Errorf("ConfigSections() = %v, want deployment sections only", ConfigSections())
+	}
+}
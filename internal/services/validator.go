@@ -16,6 +16,7 @@ import (
 	"time"
 	"unicode/utf8"
 
+	"github.com/biliqiqi/baklab-setup/internal/age"
 	"github.com/biliqiqi/baklab-setup/internal/model"
 	"github.com/biliqiqi/baklab-setup/internal/utils"
 	_ "github.com/lib/pq"
@@ -293,13 +294,12 @@ func (v *ValidatorService) TestSMTPConnection(cfg model.SMTPConfig) model.Connec
 	return result
 }
 
-func (v *ValidatorService) ValidateConfig(cfg *model.SetupConfig) []model.ValidationError {
-	var errors []model.ValidationError
+var validationStepOrder = []string{"welcome", "database", "redis", "smtp", "app", "ssl", "admin", "oauth", "goaccess", "review", "config_complete"}
 
-	stepOrder := []string{"welcome", "database", "redis", "smtp", "app", "ssl", "admin", "oauth", "goaccess", "review", "config_complete"}
+func (v *ValidatorService) ValidateConfig(cfg *model.SetupConfig) []model.ValidationError {
 	currentStepIndex := -1
 
-	for i, step := range stepOrder {
+	for i, step := range validationStepOrder {
 		if step == cfg.CurrentStep {
 			currentStepIndex = i
 			break
@@ -307,9 +307,20 @@ func (v *ValidatorService) ValidateConfig(cfg *model.SetupConfig) []model.Valida
 	}
 
 	if currentStepIndex == -1 {
-		currentStepIndex = len(stepOrder) - 1
+		currentStepIndex = len(validationStepOrder) - 1
 	}
 
+	return v.validateThroughStep(cfg, currentStepIndex)
+}
+
+// ValidateAll runs every section check, ignoring the wizard step recorded in cfg.CurrentStep.
+func (v *ValidatorService) ValidateAll(cfg *model.SetupConfig) []model.ValidationError {
+	return v.validateThroughStep(cfg, len(validationStepOrder)-1)
+}
+
+func (v *ValidatorService) validateThroughStep(cfg *model.SetupConfig, currentStepIndex int) []model.ValidationError {
+	var errors []model.ValidationError
+
 	if currentStepIndex >= 1 { // database
 		errors = append(errors, v.validateDatabaseConfig(cfg.Database)...)
 	}
@@ -342,6 +353,40 @@ func (v *ValidatorService) ValidateConfig(cfg *model.SetupConfig) []model.Valida
 		errors = append(errors, v.validateFrontendConfig(cfg.App)...)
 	}
 
+	errors = append(errors, v.validateOutputConfig(cfg.Output)...)
+
+	return errors
+}
+
+func (v *ValidatorService) validateOutputConfig(cfg model.OutputConfig) []model.ValidationError {
+	switch cfg.SecretsMode {
+	case "", model.SecretsModeEnv, model.SecretsModeDocker:
+		return nil
+	case model.SecretsModeAge:
+	default:
+		return []model.ValidationError{{
+			Field:   "output.secrets_mode",
+			Message: "key:validation.output.secrets_mode_error",
+		}}
+	}
+
+	if len(cfg.AgeRecipients) == 0 {
+		return []model.ValidationError{{
+			Field:   "output.age_recipients",
+			Message: "key:validation.output.age_recipients_required",
+		}}
+	}
+
+	var errors []model.ValidationError
+	for _, recipient := range cfg.AgeRecipients {
+		if _, err := age.ParseRecipient(recipient); err != nil {
+			errors = append(errors, model.ValidationError{
+				Field:   "output.age_recipients",
+				Message: "key:validation.output.age_recipient_invalid",
+			})
+			break
+		}
+	}
 	return errors
 }
 
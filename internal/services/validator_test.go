@@ -543,3 +543,36 @@ func TestValidatorService_ValidateRedisConfig_Password(t *testing.T) {
 		})
 	}
 }
+
+func TestValidatorService_ValidateAll_IgnoresCurrentStep(t *testing.T) {
+	validator := NewValidatorService()
+
+	cfg := &model.SetupConfig{
+		CurrentStep: "database",
+		Database: model.DatabaseConfig{
+			ServiceType:   "docker",
+			Host:          "localhost",
+			Port:          5432,
+			Name:          "testdb",
+			SuperUser:     "postgres",
+			SuperPassword: "PostgresSuper123!",
+			AppUser:       "testuser",
+			AppPassword:   "DatabasePass1!",
+		},
+	}
+
+	if errors := validator.ValidateConfig(cfg); len(errors) != 0 {
+		t.Fatalf("ValidateConfig() at database step returned %d errors, want 0", len(errors))
+	}
+
+	hasAdminError := false
+	for _, err := range validator.ValidateAll(cfg) {
+		if err.Field == "admin_user.password" {
+			hasAdminError = true
+		}
+	}
+
+	if !hasAdminError {
+		t.Errorf("ValidateAll() should report admin user errors regardless of the current step")
+	}
+}
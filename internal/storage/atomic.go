@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/biliqiqi/baklab-setup/internal/utils"
+)
+
+const backupSuffix = ".bak"
+
+// writeFileAtomic replaces path with data so that readers only ever see the
+// old or the new content: the data goes to a temp file in the same
+// directory, is fsynced, and is then renamed over the target.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+
+	tmpFile, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpPath := tmpFile.Name()
+
+	committed := false
+	defer func() {
+		if !committed {
+			utils.Close(tmpFile, "temp file: "+tmpPath)
+			_ = os.Remove(tmpPath)
+		}
+	}()
+
+	if _, err := tmpFile.Write(data); err != nil {
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+	if err := tmpFile.Chmod(perm); err != nil {
+		return fmt.Errorf("failed to set temp file permissions: %w", err)
+	}
+	if err := tmpFile.Sync(); err != nil {
+		return fmt.Errorf("failed to sync temp file: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("failed to close temp file: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		committed = true
+		return fmt.Errorf("failed to rename temp file: %w", err)
+	}
+	committed = true
+
+	return syncDir(dir)
+}
+
+// writeFileWithBackup keeps the current generation of path as path.bak
+// before atomically writing the new data. A current file that is not valid
+// JSON is never promoted to the backup.
+func writeFileWithBackup(path string, data []byte, perm os.FileMode) error {
+	if current, err := os.ReadFile(path); err == nil && json.Valid(current) {
+		if err := writeFileAtomic(path+backupSuffix, current, perm); err != nil {
+			return fmt.Errorf("failed to back up %s: %w", filepath.Base(path), err)
+		}
+	}
+
+	return writeFileAtomic(path, data, perm)
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open directory for sync: %w", err)
+	}
+	defer utils.Close(d, "directory: "+dir)
+
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("failed to sync directory: %w", err)
+	}
+	return nil
+}
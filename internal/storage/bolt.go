@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const boltFileName = "setup.db"
+
+var boltBucket = []byte("setup")
+
+type boltBackend struct {
+	db *bolt.DB
+}
+
+// NewBoltStorage creates a Storage backed by a single bbolt database file in
+// dataDir. The file is locked while open, so only one process can use it.
+func NewBoltStorage(dataDir string) (Storage, error) {
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create data directory %s: %w", dataDir, err)
+	}
+
+	dbPath := filepath.Join(dataDir, boltFileName)
+	db, err := bolt.Open(dbPath, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bolt database %s: %w", dbPath, err)
+	}
+
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltBucket)
+		return err
+	}); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to create bolt bucket: %w", err)
+	}
+
+	return &kvStorage{backend: &boltBackend{db: db}}, nil
+}
+
+func (b *boltBackend) get(key string) ([]byte, error) {
+	var data []byte
+	err := b.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(boltBucket).Get([]byte(key))
+		if value == nil {
+			return errKeyNotFound
+		}
+		data = append([]byte(nil), value...)
+		return nil
+	})
+	return data, err
+}
+
+func (b *boltBackend) put(key string, value []byte) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).Put([]byte(key), value)
+	})
+}
+
+func (b *boltBackend) delete(keys ...string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltBucket)
+		for _, key := range keys {
+			if err := bucket.Delete([]byte(key)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (b *boltBackend) close() error {
+	return b.db.Close()
+}
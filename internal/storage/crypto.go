@@ -0,0 +1,212 @@
+package storage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	encryptionFileName = "encryption.json"
+	encryptionVersion  = 1
+	encryptionAlg      = "AES-256-GCM"
+
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// keyCheckPlaintext is sealed into encryption.json so that a wrong
+// passphrase is rejected before any data file is touched.
+var keyCheckPlaintext = []byte("baklab-setup storage key check")
+
+// Cipher encrypts storage records with AES-256-GCM using a key derived from
+// a passphrase with scrypt.
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+// encryptedRecord is the on-disk envelope of an encrypted file. It is itself
+// valid JSON, so crash recovery can tell complete files from truncated ones.
+type encryptedRecord struct {
+	Version    int    `json:"baklab_encrypted"`
+	Algorithm  string `json:"algorithm"`
+	Nonce      string `json:"nonce"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+type encryptionParams struct {
+	KDF   string          `json:"kdf"`
+	Salt  string          `json:"salt"`
+	N     int             `json:"n"`
+	R     int             `json:"r"`
+	P     int             `json:"p"`
+	Check encryptedRecord `json:"check"`
+}
+
+// OpenCipher derives the storage key for dataDir from secret. The scrypt salt
+// is created in dataDir on first use and reused afterwards.
+func OpenCipher(dataDir string, secret []byte) (*Cipher, error) {
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("storage encryption key is empty")
+	}
+
+	paramsPath := filepath.Join(dataDir, encryptionFileName)
+	data, err := os.ReadFile(paramsPath)
+	if os.IsNotExist(err) {
+		return createCipher(paramsPath, secret)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", encryptionFileName, err)
+	}
+
+	var params encryptionParams
+	if err := json.Unmarshal(data, &params); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", encryptionFileName, err)
+	}
+
+	salt, err := base64.StdEncoding.DecodeString(params.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid salt in %s: %w", encryptionFileName, err)
+	}
+
+	c, err := deriveCipher(secret, salt, params.N, params.R, params.P)
+	if err != nil {
+		return nil, err
+	}
+
+	check, err := c.openRecord(encryptionFileName, params.Check)
+	if err != nil || string(check) != string(keyCheckPlaintext) {
+		return nil, fmt.Errorf("wrong storage encryption key for %s", dataDir)
+	}
+
+	return c, nil
+}
+
+func createCipher(paramsPath string, secret []byte) (*Cipher, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	c, err := deriveCipher(secret, salt, scryptN, scryptR, scryptP)
+	if err != nil {
+		return nil, err
+	}
+
+	check, err := c.sealRecord(encryptionFileName, keyCheckPlaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(encryptionParams{
+		KDF:   "scrypt",
+		Salt:  base64.StdEncoding.EncodeToString(salt),
+		N:     scryptN,
+		R:     scryptR,
+		P:     scryptP,
+		Check: check,
+	}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal encryption parameters: %w", err)
+	}
+
+	if err := writeFileAtomic(paramsPath, data, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", encryptionFileName, err)
+	}
+
+	return c, nil
+}
+
+func deriveCipher(secret, salt []byte, n, r, p int) (*Cipher, error) {
+	key, err := scrypt.Key(secret, salt, n, r, p, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive storage key: %w", err)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+
+	return &Cipher{aead: aead}, nil
+}
+
+// seal encrypts plaintext for the file called name. The name is bound as
+// additional data, so records cannot be swapped between files.
+func (c *Cipher) seal(name string, plaintext []byte) ([]byte, error) {
+	record, err := c.sealRecord(name, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(record, "", "  ")
+}
+
+func (c *Cipher) open(name string, data []byte) ([]byte, error) {
+	var record encryptedRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("failed to parse encrypted %s: %w", name, err)
+	}
+	return c.openRecord(name, record)
+}
+
+func (c *Cipher) sealRecord(name string, plaintext []byte) (encryptedRecord, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return encryptedRecord{}, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	return encryptedRecord{
+		Version:    encryptionVersion,
+		Algorithm:  encryptionAlg,
+		Nonce:      base64.StdEncoding.EncodeToString(nonce),
+		Ciphertext: base64.StdEncoding.EncodeToString(c.aead.Seal(nil, nonce, plaintext, []byte(name))),
+	}, nil
+}
+
+func (c *Cipher) openRecord(name string, record encryptedRecord) ([]byte, error) {
+	if record.Version != encryptionVersion || record.Algorithm != encryptionAlg {
+		return nil, fmt.Errorf("unsupported encryption format in %s", name)
+	}
+
+	nonce, err := base64.StdEncoding.DecodeString(record.Nonce)
+	if err != nil || len(nonce) != c.aead.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce in %s", name)
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(record.Ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ciphertext in %s: %w", name, err)
+	}
+
+	plaintext, err := c.aead.Open(nil, nonce, ciphertext, []byte(name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s: %w", name, err)
+	}
+
+	return plaintext, nil
+}
+
+var errEncryptedWithoutKey = errors.New("file is encrypted but no storage encryption key was provided")
+
+// isEncryptedRecord reports whether data is an encryption envelope rather
+// than a plaintext record.
+func isEncryptedRecord(data []byte) bool {
+	var probe struct {
+		Version int `json:"baklab_encrypted"`
+	}
+	return json.Unmarshal(data, &probe) == nil && probe.Version > 0
+}
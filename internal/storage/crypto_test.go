@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/biliqiqi/baklab-setup/internal/model"
+)
+
+func TestJSONStorageEncryptsSecretsAtRest(t *testing.T) {
+	dataDir := t.TempDir()
+
+	c, err := OpenCipher(dataDir, []byte("correct horse battery staple"))
+	if err != nil {
+		t.Fatalf("OpenCipher() failed: %v", err)
+	}
+
+	s := NewJSONStorage(dataDir)
+	if err := s.SetCipher(c); err != nil {
+		t.Fatalf("SetCipher() failed: %v", err)
+	}
+
+	cfg := &model.SetupConfig{Database: model.DatabaseConfig{AppPassword: "DatabasePass1!"}}
+	if err := s.SaveSetupConfig(cfg); err != nil {
+		t.Fatalf("SaveSetupConfig() failed: %v", err)
+	}
+	if err := s.SaveSetupTokens([]*model.SetupToken{{TokenHash: "plaintext-token"}}); err != nil {
+		t.Fatalf("SaveSetupTokens() failed: %v", err)
+	}
+
+	for _, filename := range []string{configFileName, tokenFileName} {
+		data, err := os.ReadFile(filepath.Join(dataDir, filename))
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", filename, err)
+		}
+		if strings.Contains(string(data), "DatabasePass1!") || strings.Contains(string(data), "plaintext-token") {
+			t.Errorf("%s contains plaintext secrets:\n%s", filename, data)
+		}
+	}
+
+	reopened, err := OpenCipher(dataDir, []byte("correct horse battery staple"))
+	if err != nil {
+		t.Fatalf("OpenCipher() with the same passphrase failed: %v", err)
+	}
+	s2 := NewJSONStorage(dataDir)
+	if err := s2.SetCipher(reopened); err != nil {
+		t.Fatalf("SetCipher() failed: %v", err)
+	}
+
+	got, err := s2.GetSetupConfig()
+	if err != nil {
+		t.Fatalf("GetSetupConfig() failed: %v", err)
+	}
+	if got.Database.AppPassword != "DatabasePass1!" {
+		t.Errorf("decrypted password = %q, want %q", got.Database.AppPassword, "DatabasePass1!")
+	}
+
+	if _, err := NewJSONStorage(dataDir).GetSetupTokens(); err == nil {
+		t.Errorf("GetSetupTokens() without a cipher should fail on an encrypted file")
+	}
+}
+
+func TestOpenCipherRejectsWrongPassphrase(t *testing.T) {
+	dataDir := t.TempDir()
+
+	if _, err := OpenCipher(dataDir, []byte("first passphrase")); err != nil {
+		t.Fatalf("OpenCipher() failed: %v", err)
+	}
+
+	if _, err := OpenCipher(dataDir, []byte("second passphrase")); err == nil {
+		t.Errorf("OpenCipher() with a different passphrase should fail")
+	}
+}
+
+func TestSetCipherEncryptsExistingPlaintext(t *testing.T) {
+	dataDir := t.TempDir()
+
+	s := NewJSONStorage(dataDir)
+	for _, password := range []string{"OldPassword1!", "NewPassword1!"} {
+		if err := s.SaveSetupConfig(&model.SetupConfig{SMTP: model.SMTPConfig{Password: password}}); err != nil {
+			t.Fatalf("SaveSetupConfig() failed: %v", err)
+		}
+	}
+
+	c, err := OpenCipher(dataDir, []byte("passphrase"))
+	if err != nil {
+		t.Fatalf("OpenCipher() failed: %v", err)
+	}
+	if err := s.SetCipher(c); err != nil {
+		t.Fatalf("SetCipher() failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dataDir, configFileName))
+	if err != nil {
+		t.Fatalf("Failed to read config: %v", err)
+	}
+	if !isEncryptedRecord(data) {
+		t.Errorf("existing plaintext config should be encrypted by SetCipher()")
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, configFileName+backupSuffix)); !os.IsNotExist(err) {
+		t.Errorf("plaintext backup should be removed once encryption is enabled")
+	}
+
+	got, err := s.GetSetupConfig()
+	if err != nil {
+		t.Fatalf("GetSetupConfig() failed: %v", err)
+	}
+	if got.SMTP.Password != "NewPassword1!" {
+		t.Errorf("password = %q, want %q", got.SMTP.Password, "NewPassword1!")
+	}
+}
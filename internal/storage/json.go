@@ -12,8 +12,22 @@ import (
 	"github.com/biliqiqi/baklab-setup/internal/model"
 )
 
+const (
+	stateFileName   = "setup-state.json"
+	configFileName  = "config-draft.json"
+	tokenFileName   = "tokens.json"
+	historyFileName = "config-history.json"
+)
+
+var managedFileNames = []string{stateFileName, configFileName, tokenFileName, historyFileName}
+
+// secretFileNames are the managed files that may contain secrets and are
+// encrypted when a cipher is configured.
+var secretFileNames = []string{configFileName, tokenFileName, historyFileName}
+
 type JSONStorage struct {
 	dataDir string
+	cipher  *Cipher
 	mu      sync.RWMutex
 }
 
@@ -22,16 +36,82 @@ func NewJSONStorage(dataDir string) *JSONStorage {
 		log.Printf("Warning: failed to create data directory %s: %v", dataDir, err)
 	}
 
-	return &JSONStorage{
+	s := &JSONStorage{
 		dataDir: dataDir,
 	}
+	s.recover()
+
+	return s
+}
+
+// SetCipher enables at-rest encryption of the configuration draft, its
+// history and the setup tokens. Plaintext files left from an earlier run are encrypted in
+// place, and their plaintext backups are removed.
+func (s *JSONStorage) SetCipher(c *Cipher) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cipher = c
+
+	for _, filename := range secretFileNames {
+		filePath := filepath.Join(s.dataDir, filename)
+		data, err := os.ReadFile(filePath)
+		if err != nil || isEncryptedRecord(data) {
+			continue
+		}
+
+		if err := s.writeSecretFile(filePath, data); err != nil {
+			return fmt.Errorf("failed to encrypt %s: %w", filename, err)
+		}
+		log.Printf("Encrypted existing %s at rest", filename)
+	}
+
+	return nil
+}
+
+// recover removes temp files left behind by an interrupted write and restores
+// corrupt data files from their .bak generation.
+func (s *JSONStorage) recover() {
+	if leftovers, err := filepath.Glob(filepath.Join(s.dataDir, ".*.tmp-*")); err == nil {
+		for _, leftover := range leftovers {
+			if err := os.Remove(leftover); err != nil {
+				log.Printf("Warning: failed to remove leftover temp file %s: %v", leftover, err)
+			}
+		}
+	}
+
+	for _, filename := range managedFileNames {
+		filePath := filepath.Join(s.dataDir, filename)
+
+		data, err := os.ReadFile(filePath)
+		if err != nil || json.Valid(data) {
+			continue
+		}
+
+		backupPath := filePath + backupSuffix
+		backup, err := os.ReadFile(backupPath)
+		if err != nil || !json.Valid(backup) {
+			corruptPath := filePath + ".corrupt"
+			log.Printf("Warning: %s is corrupt and has no usable backup, moving it to %s", filename, corruptPath)
+			if err := os.Rename(filePath, corruptPath); err != nil {
+				log.Printf("Warning: failed to move corrupt file %s: %v", filePath, err)
+			}
+			continue
+		}
+
+		if err := writeFileAtomic(filePath, backup, 0644); err != nil {
+			log.Printf("Warning: failed to restore %s from backup: %v", filename, err)
+			continue
+		}
+		log.Printf("Restored corrupt %s from backup %s", filename, filepath.Base(backupPath))
+	}
 }
 
 func (s *JSONStorage) GetSetupState() (*model.SetupState, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	filePath := filepath.Join(s.dataDir, "setup-state.json")
+	filePath := filepath.Join(s.dataDir, stateFileName)
 
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
 		return &model.SetupState{
@@ -66,8 +146,8 @@ func (s *JSONStorage) SaveSetupState(state *model.SetupState) error {
 		return fmt.Errorf("failed to marshal setup state: %w", err)
 	}
 
-	filePath := filepath.Join(s.dataDir, "setup-state.json")
-	if err := os.WriteFile(filePath, data, 0644); err != nil {
+	filePath := filepath.Join(s.dataDir, stateFileName)
+	if err := writeFileWithBackup(filePath, data, 0644); err != nil {
 		return fmt.Errorf("failed to write setup state: %w", err)
 	}
 
@@ -78,13 +158,13 @@ func (s *JSONStorage) GetSetupConfig() (*model.SetupConfig, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	filePath := filepath.Join(s.dataDir, "config-draft.json")
+	filePath := filepath.Join(s.dataDir, configFileName)
 
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
 		return &model.SetupConfig{}, nil
 	}
 
-	data, err := os.ReadFile(filePath)
+	data, err := s.readSecretFile(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read setup config: %w", err)
 	}
@@ -106,54 +186,136 @@ func (s *JSONStorage) SaveSetupConfig(cfg *model.SetupConfig) error {
 		return fmt.Errorf("failed to marshal setup config: %w", err)
 	}
 
-	filePath := filepath.Join(s.dataDir, "config-draft.json")
-	if err := os.WriteFile(filePath, data, 0644); err != nil {
+	filePath := filepath.Join(s.dataDir, configFileName)
+	if err := s.writeSecretFile(filePath, data); err != nil {
 		return fmt.Errorf("failed to write setup config: %w", err)
 	}
 
 	return nil
 }
 
-func (s *JSONStorage) GetSetupToken() (*model.SetupToken, error) {
+func (s *JSONStorage) GetConfigHistory() ([]model.ConfigSnapshot, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	filePath := filepath.Join(s.dataDir, "tokens.json")
+	filePath := filepath.Join(s.dataDir, historyFileName)
 
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		return nil, fmt.Errorf("setup token not found")
+		return []model.ConfigSnapshot{}, nil
 	}
 
-	data, err := os.ReadFile(filePath)
+	data, err := s.readSecretFile(filePath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read setup token: %w", err)
+		return nil, fmt.Errorf("failed to read config history: %w", err)
 	}
 
-	var token model.SetupToken
-	if err := json.Unmarshal(data, &token); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal setup token: %w", err)
+	var history []model.ConfigSnapshot
+	if err := json.Unmarshal(data, &history); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal config history: %w", err)
 	}
 
-	return &token, nil
+	return history, nil
 }
 
-func (s *JSONStorage) SaveSetupToken(token *model.SetupToken) error {
+func (s *JSONStorage) SaveConfigHistory(history []model.ConfigSnapshot) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	data, err := json.MarshalIndent(token, "", "  ")
+	data, err := json.MarshalIndent(history, "", "  ")
 	if err != nil {
-		return fmt.Errorf("failed to marshal setup token: %w", err)
+		return fmt.Errorf("failed to marshal config history: %w", err)
 	}
 
-	filePath := filepath.Join(s.dataDir, "tokens.json")
-	if err := os.WriteFile(filePath, data, 0644); err != nil {
-		return fmt.Errorf("failed to write setup token: %w", err)
+	filePath := filepath.Join(s.dataDir, historyFileName)
+	if err := s.writeSecretFile(filePath, data); err != nil {
+		return fmt.Errorf("failed to write config history: %w", err)
 	}
 
 	return nil
 }
 
+func (s *JSONStorage) GetSetupTokens() ([]*model.SetupToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	filePath := filepath.Join(s.dataDir, tokenFileName)
+
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		return []*model.SetupToken{}, nil
+	}
+
+	data, err := s.readSecretFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read setup tokens: %w", err)
+	}
+
+	var tokens setupTokenList
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal setup tokens: %w", err)
+	}
+
+	return tokens, nil
+}
+
+func (s *JSONStorage) SaveSetupTokens(tokens []*model.SetupToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal setup tokens: %w", err)
+	}
+
+	filePath := filepath.Join(s.dataDir, tokenFileName)
+	if err := s.writeSecretFile(filePath, data); err != nil {
+		return fmt.Errorf("failed to write setup tokens: %w", err)
+	}
+
+	return nil
+}
+
+// readSecretFile reads a file that may hold secrets, decrypting it when it
+// carries an encryption envelope.
+func (s *JSONStorage) readSecretFile(filePath string) ([]byte, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isEncryptedRecord(data) {
+		return data, nil
+	}
+
+	if s.cipher == nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(filePath), errEncryptedWithoutKey)
+	}
+
+	return s.cipher.open(filepath.Base(filePath), data)
+}
+
+// writeSecretFile writes a file that may hold secrets, encrypting it when a
+// cipher is configured. Encrypted files are only readable by the owner.
+func (s *JSONStorage) writeSecretFile(filePath string, data []byte) error {
+	if s.cipher == nil {
+		return writeFileWithBackup(filePath, data, 0644)
+	}
+
+	sealed, err := s.cipher.seal(filepath.Base(filePath), data)
+	if err != nil {
+		return err
+	}
+
+	if current, err := os.ReadFile(filePath); err == nil && !isEncryptedRecord(current) {
+		// Never keep a plaintext generation around once encryption is on.
+		if err := os.Remove(filePath + backupSuffix); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove plaintext backup: %w", err)
+		}
+		return writeFileAtomic(filePath, sealed, 0600)
+	}
+
+	return writeFileWithBackup(filePath, sealed, 0600)
+}
+
 func (s *JSONStorage) IsSetupCompleted() (bool, error) {
 	state, err := s.GetSetupState()
 	if err != nil {
@@ -179,12 +341,11 @@ func (s *JSONStorage) MarkSetupCompleted() error {
 }
 
 func (s *JSONStorage) CleanupTempFiles() error {
-	tempFiles := []string{"config-draft.json", "tokens.json"}
-
-	for _, filename := range tempFiles {
-		filePath := filepath.Join(s.dataDir, filename)
-		if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
-			return fmt.Errorf("failed to remove %s: %w", filename, err)
+	for _, filename := range secretFileNames {
+		for _, filePath := range []string{filepath.Join(s.dataDir, filename), filepath.Join(s.dataDir, filename+backupSuffix)} {
+			if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove %s: %w", filepath.Base(filePath), err)
+			}
 		}
 	}
 
@@ -195,19 +356,18 @@ func (s *JSONStorage) ResetSetupState() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	filesToRemove := []string{
-		"setup-state.json",
-		"config-draft.json",
-		"tokens.json",
-	}
-
-	for _, filename := range filesToRemove {
-		filePath := filepath.Join(s.dataDir, filename)
-		if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
-			log.Printf("Warning: failed to remove %s: %v", filename, err)
+	for _, filename := range managedFileNames {
+		for _, filePath := range []string{filepath.Join(s.dataDir, filename), filepath.Join(s.dataDir, filename+backupSuffix)} {
+			if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+				log.Printf("Warning: failed to remove %s: %v", filepath.Base(filePath), err)
+			}
 		}
 	}
 
 	log.Printf("Setup state has been reset")
 	return nil
 }
+
+func (s *JSONStorage) Close() error {
+	return nil
+}
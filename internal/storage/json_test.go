@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/biliqiqi/baklab-setup/internal/model"
+)
+
+func TestJSONStorageKeepsBackupGeneration(t *testing.T) {
+	dataDir := t.TempDir()
+	s := NewJSONStorage(dataDir)
+
+	for _, domain := range []string{"first.example.com", "second.example.com"} {
+		if err := s.SaveSetupConfig(&model.SetupConfig{App: model.AppConfig{DomainName: domain}}); err != nil {
+			t.Fatalf("SaveSetupConfig() failed: %v", err)
+		}
+	}
+
+	backup, err := os.ReadFile(filepath.Join(dataDir, configFileName+backupSuffix))
+	if err != nil {
+		t.Fatalf("Failed to read backup file: %v", err)
+	}
+	if !strings.Contains(string(backup), "first.example.com") {
+		t.Errorf("backup should hold the previous generation, got:\n%s", backup)
+	}
+
+	leftovers, err := filepath.Glob(filepath.Join(dataDir, ".*.tmp-*"))
+	if err != nil {
+		t.Fatalf("Glob() failed: %v", err)
+	}
+	if len(leftovers) > 0 {
+		t.Errorf("atomic writes left temp files behind: %v", leftovers)
+	}
+}
+
+func TestJSONStorageRestoresCorruptFileFromBackup(t *testing.T) {
+	dataDir := t.TempDir()
+	s := NewJSONStorage(dataDir)
+
+	for _, domain := range []string{"first.example.com", "second.example.com"} {
+		if err := s.SaveSetupConfig(&model.SetupConfig{App: model.AppConfig{DomainName: domain}}); err != nil {
+			t.Fatalf("SaveSetupConfig() failed: %v", err)
+		}
+	}
+
+	configPath := filepath.Join(dataDir, configFileName)
+	if err := os.WriteFile(configPath, []byte(`{"app": {"domain_na`), 0644); err != nil {
+		t.Fatalf("Failed to truncate config file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dataDir, "."+configFileName+".tmp-123"), []byte("partial"), 0644); err != nil {
+		t.Fatalf("Failed to create leftover temp file: %v", err)
+	}
+
+	recovered := NewJSONStorage(dataDir)
+	cfg, err := recovered.GetSetupConfig()
+	if err != nil {
+		t.Fatalf("GetSetupConfig() after recovery failed: %v", err)
+	}
+	if cfg.App.DomainName != "first.example.com" {
+		t.Errorf("recovered domain = %q, want %q", cfg.App.DomainName, "first.example.com")
+	}
+
+	if _, err := os.Stat(filepath.Join(dataDir, "."+configFileName+".tmp-123")); !os.IsNotExist(err) {
+		t.Errorf("leftover temp file should be removed on startup")
+	}
+}
+
+func TestJSONStorageMovesCorruptFileWithoutBackup(t *testing.T) {
+	dataDir := t.TempDir()
+
+	tokenPath := filepath.Join(dataDir, tokenFileName)
+	if err := os.WriteFile(tokenPath, []byte("not json"), 0644); err != nil {
+		t.Fatalf("Failed to write corrupt token file: %v", err)
+	}
+
+	s := NewJSONStorage(dataDir)
+	if tokens, err := s.GetSetupTokens(); err != nil || len(tokens) != 0 {
+		t.Errorf("GetSetupTokens() after the corrupt file is moved aside = %v, %v, want no tokens", tokens, err)
+	}
+	if _, err := os.Stat(tokenPath + ".corrupt"); err != nil {
+		t.Errorf("corrupt token file should be kept as %s.corrupt: %v", tokenFileName, err)
+	}
+}
+
+func TestJSONStorageReadsSingleTokenFile(t *testing.T) {
+	dataDir := t.TempDir()
+
+	legacy := `{"token": "abc123", "ip_address": "0.0.0.0", "used": false}`
+	if err := os.WriteFile(filepath.Join(dataDir, tokenFileName), []byte(legacy), 0600); err != nil {
+		t.Fatalf("Failed to write token file: %v", err)
+	}
+
+	tokens, err := NewJSONStorage(dataDir).GetSetupTokens()
+	if err != nil {
+		t.Fatalf("GetSetupTokens() failed: %v", err)
+	}
+	if len(tokens) != 1 || tokens[0].Token != "abc123" {
+		t.Errorf("GetSetupTokens() = %+v, want the single stored token", tokens)
+	}
+}
@@ -0,0 +1,192 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/biliqiqi/baklab-setup/internal/model"
+)
+
+const (
+	stateKey   = "setup-state"
+	configKey  = "config-draft"
+	tokenKey   = "tokens"
+	historyKey = "config-history"
+)
+
+var errKeyNotFound = errors.New("key not found")
+
+// kvBackend is the raw byte store behind the memory and bolt backends.
+type kvBackend interface {
+	get(key string) ([]byte, error)
+	put(key string, value []byte) error
+	delete(keys ...string) error
+	close() error
+}
+
+// kvStorage implements Storage on top of a kvBackend, encoding every record
+// as JSON just like JSONStorage does on disk.
+type kvStorage struct {
+	backend kvBackend
+	mu      sync.RWMutex
+}
+
+func (s *kvStorage) GetSetupState() (*model.SetupState, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var state model.SetupState
+	if err := s.load(stateKey, &state); err != nil {
+		if errors.Is(err, errKeyNotFound) {
+			return &model.SetupState{
+				Status:    model.StatusPending,
+				Progress:  0,
+				CreatedAt: time.Now(),
+				UpdatedAt: time.Now(),
+			}, nil
+		}
+		return nil, fmt.Errorf("failed to read setup state: %w", err)
+	}
+
+	return &state, nil
+}
+
+func (s *kvStorage) SaveSetupState(state *model.SetupState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state.UpdatedAt = time.Now()
+
+	if err := s.store(stateKey, state); err != nil {
+		return fmt.Errorf("failed to write setup state: %w", err)
+	}
+
+	return nil
+}
+
+func (s *kvStorage) GetSetupConfig() (*model.SetupConfig, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var cfg model.SetupConfig
+	if err := s.load(configKey, &cfg); err != nil {
+		if errors.Is(err, errKeyNotFound) {
+			return &model.SetupConfig{}, nil
+		}
+		return nil, fmt.Errorf("failed to read setup config: %w", err)
+	}
+
+	return &cfg, nil
+}
+
+func (s *kvStorage) SaveSetupConfig(cfg *model.SetupConfig) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.store(configKey, cfg); err != nil {
+		return fmt.Errorf("failed to write setup config: %w", err)
+	}
+
+	return nil
+}
+
+func (s *kvStorage) GetConfigHistory() ([]model.ConfigSnapshot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var history []model.ConfigSnapshot
+	if err := s.load(historyKey, &history); err != nil {
+		if errors.Is(err, errKeyNotFound) {
+			return []model.ConfigSnapshot{}, nil
+		}
+		return nil, fmt.Errorf("failed to read config history: %w", err)
+	}
+
+	return history, nil
+}
+
+func (s *kvStorage) SaveConfigHistory(history []model.ConfigSnapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.store(historyKey, history); err != nil {
+		return fmt.Errorf("failed to write config history: %w", err)
+	}
+
+	return nil
+}
+
+func (s *kvStorage) GetSetupTokens() ([]*model.SetupToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var tokens setupTokenList
+	if err := s.load(tokenKey, &tokens); err != nil {
+		if errors.Is(err, errKeyNotFound) {
+			return []*model.SetupToken{}, nil
+		}
+		return nil, fmt.Errorf("failed to read setup tokens: %w", err)
+	}
+
+	return tokens, nil
+}
+
+func (s *kvStorage) SaveSetupTokens(tokens []*model.SetupToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.store(tokenKey, tokens); err != nil {
+		return fmt.Errorf("failed to write setup tokens: %w", err)
+	}
+
+	return nil
+}
+
+func (s *kvStorage) IsSetupCompleted() (bool, error) {
+	state, err := s.GetSetupState()
+	if err != nil {
+		return false, err
+	}
+
+	return state.Status == model.StatusCompleted, nil
+}
+
+func (s *kvStorage) ResetSetupState() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.backend.delete(stateKey, configKey, tokenKey, historyKey); err != nil {
+		return fmt.Errorf("failed to reset setup state: %w", err)
+	}
+
+	return nil
+}
+
+func (s *kvStorage) Close() error {
+	return s.backend.close()
+}
+
+func (s *kvStorage) load(key string, v interface{}) error {
+	data, err := s.backend.get(key)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to unmarshal %s: %w", key, err)
+	}
+
+	return nil
+}
+
+func (s *kvStorage) store(key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", key, err)
+	}
+
+	return s.backend.put(key, data)
+}
@@ -0,0 +1,50 @@
+package storage
+
+import "sync"
+
+type memoryBackend struct {
+	mu      sync.RWMutex
+	records map[string][]byte
+}
+
+// NewMemoryStorage creates a Storage that keeps everything in process
+// memory. Nothing is written to disk, which suits tests and embedding.
+func NewMemoryStorage() Storage {
+	return &kvStorage{
+		backend: &memoryBackend{records: make(map[string][]byte)},
+	}
+}
+
+func (b *memoryBackend) get(key string) ([]byte, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	data, ok := b.records[key]
+	if !ok {
+		return nil, errKeyNotFound
+	}
+
+	return append([]byte(nil), data...), nil
+}
+
+func (b *memoryBackend) put(key string, value []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.records[key] = append([]byte(nil), value...)
+	return nil
+}
+
+func (b *memoryBackend) delete(keys ...string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, key := range keys {
+		delete(b.records, key)
+	}
+	return nil
+}
+
+func (b *memoryBackend) close() error {
+	return nil
+}
@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/biliqiqi/baklab-setup/internal/model"
+)
+
+// Storage persists the setup tokens, the setup state, the configuration
+// draft and its snapshot history between requests.
+type Storage interface {
+	GetSetupState() (*model.SetupState, error)
+	SaveSetupState(state *model.SetupState) error
+	GetSetupConfig() (*model.SetupConfig, error)
+	SaveSetupConfig(cfg *model.SetupConfig) error
+	GetConfigHistory() ([]model.ConfigSnapshot, error)
+	SaveConfigHistory(history []model.ConfigSnapshot) error
+	GetSetupTokens() ([]*model.SetupToken, error)
+	SaveSetupTokens(tokens []*model.SetupToken) error
+	IsSetupCompleted() (bool, error)
+	ResetSetupState() error
+	Close() error
+}
+
+const (
+	BackendJSON   = "json"
+	BackendMemory = "memory"
+	BackendBolt   = "bolt"
+)
+
+// New creates the storage backend named by backend. The JSON and bolt
+// backends keep their files in dataDir; the memory backend ignores it.
+func New(backend, dataDir string) (Storage, error) {
+	switch backend {
+	case "", BackendJSON:
+		return NewJSONStorage(dataDir), nil
+	case BackendMemory:
+		return NewMemoryStorage(), nil
+	case BackendBolt:
+		return NewBoltStorage(dataDir)
+	default:
+		return nil, fmt.Errorf("unsupported storage backend: %s (must be '%s', '%s' or '%s')",
+			backend, BackendJSON, BackendMemory, BackendBolt)
+	}
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/biliqiqi/baklab-setup/internal/model"
+)
+
+func TestStorageBackends(t *testing.T) {
+	backends := []struct {
+		name string
+		open func(t *testing.T) Storage
+	}{
+		{
+			name: "json",
+			open: func(t *testing.T) Storage { return NewJSONStorage(t.TempDir()) },
+		},
+		{
+			name: "memory",
+			open: func(t *testing.T) Storage { return NewMemoryStorage() },
+		},
+		{
+			name: "bolt",
+			open: func(t *testing.T) Storage {
+				s, err := NewBoltStorage(t.TempDir())
+				if err != nil {
+					t.Fatalf("NewBoltStorage() failed: %v", err)
+				}
+				return s
+			},
+		},
+	}
+
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			s := backend.open(t)
+			defer func() {
+				if err := s.Close(); err != nil {
+					t.Errorf("Close() failed: %v", err)
+				}
+			}()
+
+			if tokens, err := s.GetSetupTokens(); err != nil || len(tokens) != 0 {
+				t.Errorf("GetSetupTokens() on empty storage = %v, %v, want no tokens", tokens, err)
+			}
+
+			state, err := s.GetSetupState()
+			if err != nil {
+				t.Fatalf("GetSetupState() failed: %v", err)
+			}
+			if state.Status != model.StatusPending {
+				t.Errorf("default state status = %s, want %s", state.Status, model.StatusPending)
+			}
+
+			tokens := []*model.SetupToken{
+				{ID: "console", TokenHash: "abc123", IPAddress: "0.0.0.0", ExpiresAt: time.Now().Add(time.Hour)},
+				{ID: "dba", TokenHash: "def456", Role: model.TokenRoleSectionEditor, Sections: []string{"database"}},
+			}
+			if err := s.SaveSetupTokens(tokens); err != nil {
+				t.Fatalf("SaveSetupTokens() failed: %v", err)
+			}
+			gotTokens, err := s.GetSetupTokens()
+			if err != nil {
+				t.Fatalf("GetSetupTokens() failed: %v", err)
+			}
+			if len(gotTokens) != 2 || gotTokens[0].TokenHash != "abc123" || gotTokens[1].Sections[0] != "database" {
+				t.Errorf("tokens = %+v, want %+v", gotTokens, tokens)
+			}
+
+			cfg := &model.SetupConfig{App: model.AppConfig{DomainName: "example.com", CORSAllowOrigins: []string{"https://example.com"}}}
+			if err := s.SaveSetupConfig(cfg); err != nil {
+				t.Fatalf("SaveSetupConfig() failed: %v", err)
+			}
+			cfg.App.CORSAllowOrigins[0] = "mutated"
+
+			gotCfg, err := s.GetSetupConfig()
+			if err != nil {
+				t.Fatalf("GetSetupConfig() failed: %v", err)
+			}
+			if gotCfg.App.DomainName != "example.com" || gotCfg.App.CORSAllowOrigins[0] != "https://example.com" {
+				t.Errorf("stored config was not isolated from the caller: %+v", gotCfg.App)
+			}
+
+			if err := s.SaveSetupState(&model.SetupState{Status: model.StatusCompleted}); err != nil {
+				t.Fatalf("SaveSetupState() failed: %v", err)
+			}
+			completed, err := s.IsSetupCompleted()
+			if err != nil {
+				t.Fatalf("IsSetupCompleted() failed: %v", err)
+			}
+			if !completed {
+				t.Errorf("IsSetupCompleted() = false, want true")
+			}
+
+			if err := s.ResetSetupState(); err != nil {
+				t.Fatalf("ResetSetupState() failed: %v", err)
+			}
+			if tokens, err := s.GetSetupTokens(); err != nil || len(tokens) != 0 {
+				t.Errorf("GetSetupTokens() after reset = %v, %v, want no tokens", tokens, err)
+			}
+			gotCfg, err = s.GetSetupConfig()
+			if err != nil {
+				t.Fatalf("GetSetupConfig() after reset failed: %v", err)
+			}
+			if gotCfg.App.DomainName != "" {
+				t.Errorf("config after reset should be empty, got domain %q", gotCfg.App.DomainName)
+			}
+		})
+	}
+}
+
+func TestNewRejectsUnknownBackend(t *testing.T) {
+	if _, err := New("redis", t.TempDir()); err == nil {
+		t.Errorf("New() with unknown backend should fail")
+	}
+}
@@ -0,0 +1,30 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/biliqiqi/baklab-setup/internal/model"
+)
+
+// setupTokenList decodes the stored setup tokens. Versions that kept a
+// single token stored it as an object rather than a list.
+type setupTokenList []*model.SetupToken
+
+func (l *setupTokenList) UnmarshalJSON(data []byte) error {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		var token model.SetupToken
+		if err := json.Unmarshal(trimmed, &token); err != nil {
+			return err
+		}
+		*l = setupTokenList{&token}
+		return nil
+	}
+
+	var tokens []*model.SetupToken
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return err
+	}
+	*l = tokens
+	return nil
+}
@@ -0,0 +1,160 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+const MiddlewareClientIPKey MiddlewareCtxKey = "client_ip"
+
+// ParseTrustedProxies parses a comma separated list of CIDRs or single IP
+// addresses of the reverse proxies allowed to report the client address.
+func ParseTrustedProxies(list string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		if strings.Contains(item, "/") {
+			prefix, err := netip.ParsePrefix(item)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", item, err)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+
+		addr, err := netip.ParseAddr(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", item, err)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// ClientIPMiddleware resolves the client address of each request and stores
+// it in the request context for getClientIP. Forwarding headers are honored
+// only when the connection comes from one of the trusted proxies.
+func ClientIPMiddleware(trustedProxies []netip.Prefix) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := resolveClientIP(r, trustedProxies)
+			ctx := context.WithValue(r.Context(), MiddlewareClientIPKey, ip)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func getClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(MiddlewareClientIPKey).(string); ok {
+		return ip
+	}
+	return remoteIP(r)
+}
+
+// resolveClientIP walks the forwarding chain from the nearest hop outwards
+// and returns the first address that is not a trusted proxy. A hop that
+// cannot be parsed ends the walk at the last trusted proxy, which is the
+// furthest address known to be genuine.
+func resolveClientIP(r *http.Request, trustedProxies []netip.Prefix) string {
+	remote := remoteIP(r)
+	addr, err := netip.ParseAddr(remote)
+	if err != nil || !isTrustedProxy(addr, trustedProxies) {
+		return remote
+	}
+
+	hops := forwardedHops(r.Header)
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(hops[i])
+		if err != nil {
+			return addr.String()
+		}
+		addr = hop.Unmap()
+		if !isTrustedProxy(addr, trustedProxies) {
+			return addr.String()
+		}
+	}
+
+	return addr.String()
+}
+
+// remoteIP returns the address of the peer that opened the connection.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = strings.Trim(r.RemoteAddr, "[]")
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return addr.Unmap().String()
+	}
+	return host
+}
+
+func isTrustedProxy(addr netip.Addr, trustedProxies []netip.Prefix) bool {
+	addr = addr.Unmap()
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedHops returns the client addresses a proxy chain reported, the
+// nearest last. The RFC 7239 Forwarded header takes precedence over
+// X-Forwarded-For, which takes precedence over X-Real-IP.
+func forwardedHops(header http.Header) []string {
+	if values := header.Values("Forwarded"); len(values) > 0 {
+		var hops []string
+		for _, value := range values {
+			for _, element := range strings.Split(value, ",") {
+				hops = append(hops, forwardedFor(element))
+			}
+		}
+		return hops
+	}
+
+	if values := header.Values("X-Forwarded-For"); len(values) > 0 {
+		var hops []string
+		for _, value := range values {
+			for _, hop := range strings.Split(value, ",") {
+				hops = append(hops, strings.TrimSpace(hop))
+			}
+		}
+		return hops
+	}
+
+	if xri := strings.TrimSpace(header.Get("X-Real-IP")); xri != "" {
+		return []string{xri}
+	}
+
+	return nil
+}
+
+// forwardedFor returns the address of the for= parameter of a Forwarded
+// element, without quotes, brackets or port, or "" when it has none.
+// Obfuscated identifiers such as "unknown" are returned as is and fail to
+// parse as an address.
+func forwardedFor(element string) string {
+	for _, pair := range strings.Split(element, ";") {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || !strings.EqualFold(name, "for") {
+			continue
+		}
+
+		value = strings.Trim(value, `"`)
+		if host, _, err := net.SplitHostPort(value); err == nil {
+			return host
+		}
+		return strings.Trim(value, "[]")
+	}
+	return ""
+}
@@ -0,0 +1,65 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResolveClientIP(t *testing.T) {
+	trusted, err := ParseTrustedProxies("10.0.0.0/8, 2001:db8:ffff::1")
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies() failed: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		header     http.Header
+		want       string
+	}{
+		{"direct IPv4", "203.0.113.7:51234", nil, "203.0.113.7"},
+		{"direct IPv6", "[2001:db8::7]:51234", nil, "2001:db8::7"},
+		{"IPv4-mapped IPv6", "[::ffff:203.0.113.7]:51234", nil, "203.0.113.7"},
+		{"spoofed header from untrusted peer", "203.0.113.7:51234",
+			http.Header{"X-Forwarded-For": {"198.51.100.1"}}, "203.0.113.7"},
+		{"X-Forwarded-For from trusted proxy", "10.0.0.2:443",
+			http.Header{"X-Forwarded-For": {"198.51.100.1"}}, "198.51.100.1"},
+		{"spoofed first X-Forwarded-For entry", "10.0.0.2:443",
+			http.Header{"X-Forwarded-For": {"192.0.2.66, 198.51.100.1, 10.0.0.3"}}, "198.51.100.1"},
+		{"repeated X-Forwarded-For headers", "10.0.0.2:443",
+			http.Header{"X-Forwarded-For": {"192.0.2.66", "198.51.100.1"}}, "198.51.100.1"},
+		{"X-Real-IP from trusted proxy", "10.0.0.2:443",
+			http.Header{"X-Real-Ip": {"198.51.100.1"}}, "198.51.100.1"},
+		{"Forwarded with IPv6 and port", "[2001:db8:ffff::1]:443",
+			http.Header{"Forwarded": {`for=192.0.2.66, for="[2001:db8::7]:4711";proto=https`}}, "2001:db8::7"},
+		{"Forwarded takes precedence", "10.0.0.2:443",
+			http.Header{"Forwarded": {"for=198.51.100.1"}, "X-Forwarded-For": {"192.0.2.66"}}, "198.51.100.1"},
+		{"obfuscated hop stops at the trusted proxy", "10.0.0.2:443",
+			http.Header{"Forwarded": {"for=192.0.2.66, for=unknown"}}, "10.0.0.2"},
+		{"only trusted hops", "10.0.0.2:443",
+			http.Header{"X-Forwarded-For": {"10.1.1.1"}}, "10.1.1.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for name, values := range tt.header {
+				r.Header[name] = values
+			}
+
+			if got := resolveClientIP(r, trusted); got != tt.want {
+				t.Errorf("resolveClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxiesRejectsInvalidEntries(t *testing.T) {
+	for _, list := range []string{"10.0.0.0/33", "proxy.example.com", "10.0.0.1:80"} {
+		if _, err := ParseTrustedProxies(list); err == nil {
+			t.Errorf("ParseTrustedProxies(%q) succeeded, want error", list)
+		}
+	}
+}
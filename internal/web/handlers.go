@@ -2,14 +2,19 @@ package web
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 
+	"github.com/go-chi/chi/v5"
+
 	"github.com/biliqiqi/baklab-setup/internal/i18n"
 	"github.com/biliqiqi/baklab-setup/internal/model"
 	"github.com/biliqiqi/baklab-setup/internal/services"
@@ -23,6 +28,7 @@ type SetupHandlers struct {
 	devMode      bool
 	certPath     string
 	keyPath      string
+	sessions     SessionManager
 }
 
 func NewSetupHandlers(setupService *services.SetupService, i18nManager *i18n.I18nManager, devMode bool, certPath, keyPath string) *SetupHandlers {
@@ -35,6 +41,12 @@ func NewSetupHandlers(setupService *services.SetupService, i18nManager *i18n.I18
 	}
 }
 
+// SetSessionManager sets the manager the index page exchanges the token of
+// the access URL with, normally the SetupMiddleware.
+func (h *SetupHandlers) SetSessionManager(sessions SessionManager) {
+	h.sessions = sessions
+}
+
 func (h *SetupHandlers) getLocalizerFromContext(r *http.Request) *i18n.I18nCustom {
 	if h.i18nManager != nil {
 		if lang, ok := r.Context().Value(MiddlewareI18nLangKey).(language.Tag); ok {
@@ -55,20 +67,16 @@ func (h *SetupHandlers) localizeMessage(r *http.Request, messageKey string, data
 }
 
 func (h *SetupHandlers) translateValidationErrors(r *http.Request, errors []model.ValidationError) {
+	localizer := h.getLocalizerFromContext(r)
 	for i := range errors {
-		if strings.HasPrefix(errors[i].Message, "key:") {
-			messageKey := strings.TrimPrefix(errors[i].Message, "key:")
-			errors[i].Message = h.localizeMessage(r, messageKey)
-		}
+		errors[i].Message = localizer.LocalizeKeyed(errors[i].Message)
 	}
 }
 
 func (h *SetupHandlers) translateConnectionResults(r *http.Request, results []model.ConnectionTestResult) {
+	localizer := h.getLocalizerFromContext(r)
 	for i := range results {
-		if strings.HasPrefix(results[i].Message, "key:") {
-			messageKey := strings.TrimPrefix(results[i].Message, "key:")
-			results[i].Message = h.localizeMessage(r, messageKey)
-		}
+		results[i].Message = localizer.LocalizeKeyed(results[i].Message)
 	}
 }
 
@@ -78,18 +86,23 @@ func (h *SetupHandlers) IndexHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token := r.Header.Get("Setup-Token")
-	if token == "" {
-		token = r.URL.Query().Get("token")
+	if h.sessions == nil {
+		h.renderUnauthorizedPage(w, r)
+		return
 	}
 
-	if token == "" {
-		h.renderUnauthorizedPage(w, r)
+	// Exchange the token for a session cookie and drop it from the URL, so it
+	// stays out of the browser history and of Referer headers.
+	if token := r.URL.Query().Get("token"); token != "" {
+		if err := h.sessions.StartSession(w, r, token); err != nil {
+			h.renderUnauthorizedPage(w, r)
+			return
+		}
+		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
 
-	clientIP := getClientIP(r)
-	if err := h.setupService.ValidateSetupToken(token, clientIP); err != nil {
+	if !h.sessions.HasSession(r) {
 		h.renderUnauthorizedPage(w, r)
 		return
 	}
@@ -123,9 +136,9 @@ func (h *SetupHandlers) InitializeHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	clientIP := getClientIP(r)
-
-	token, err := h.setupService.InitializeSetup(clientIP)
+	// The caller is already signed in with a setup token, so only the
+	// progress is reset; issuing a new console token would end the session.
+	state, err := h.setupService.RestartSetup()
 	if err != nil {
 		h.writeJSONResponse(w, model.SetupResponse{
 			Success: false,
@@ -137,10 +150,7 @@ func (h *SetupHandlers) InitializeHandler(w http.ResponseWriter, r *http.Request
 	h.writeJSONResponse(w, model.SetupResponse{
 		Success: true,
 		Message: h.localizeMessage(r, "messages.setup_initialized"),
-		Data: map[string]interface{}{
-			"token":      token.Token,
-			"expires_at": token.ExpiresAt,
-		},
+		Data:    state,
 	}, http.StatusOK)
 }
 
@@ -195,18 +205,19 @@ func (h *SetupHandlers) SaveConfigHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	var cfg model.SetupConfig
-	if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
-		h.writeJSONResponse(w, model.SetupResponse{
-			Success: false,
-			Message: h.localizeMessage(r, "messages.errors.invalid_json"),
-		}, http.StatusBadRequest)
+	cfg, ok := h.decodeConfig(w, r)
+	if !ok {
+		return
+	}
+
+	h.setupService.PrepareConfiguration(cfg)
+
+	if !h.checkTokenSections(w, r, cfg) {
 		return
 	}
 
-	h.setupService.PrepareConfiguration(&cfg)
 	validator := services.NewValidatorService()
-	errors := validator.ValidateConfig(&cfg)
+	errors := validator.ValidateConfig(cfg)
 
 	if len(errors) > 0 {
 		h.translateValidationErrors(r, errors)
@@ -218,7 +229,7 @@ func (h *SetupHandlers) SaveConfigHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	if err := h.setupService.SaveConfiguration(&cfg); err != nil {
+	if err := h.setupService.SaveConfiguration(cfg); err != nil {
 		h.writeJSONResponse(w, model.SetupResponse{
 			Success: false,
 			Message: err.Error(),
@@ -250,31 +261,176 @@ func (h *SetupHandlers) GetConfigHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	safeCfg := *cfg
+	safeCfg, err := model.RedactSecrets(cfg)
+	if err != nil {
+		log.Printf("Failed to redact configuration: %v", err)
+		h.writeJSONResponse(w, model.SetupResponse{
+			Success: false,
+			Message: h.localizeMessage(r, "messages.failed_get_configuration"),
+		}, http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSONResponse(w, model.SetupResponse{
+		Success: true,
+		Data:    safeCfg,
+	}, http.StatusOK)
+}
+
+// decodeConfig reads a SetupConfig from the request body. Secrets sent as
+// {"unchanged": true} keep the value of the stored configuration.
+func (h *SetupHandlers) decodeConfig(w http.ResponseWriter, r *http.Request) (*model.SetupConfig, bool) {
+	stored, err := h.setupService.GetSetupConfig()
+	if err != nil {
+		h.writeJSONResponse(w, model.SetupResponse{
+			Success: false,
+			Message: h.localizeMessage(r, "messages.failed_get_configuration"),
+		}, http.StatusInternalServerError)
+		return nil, false
+	}
+
+	cfg, err := model.DecodeConfig(r.Body, stored)
+	if errors.Is(err, model.ErrSecretTargetChanged) {
+		h.writeJSONResponse(w, model.SetupResponse{
+			Success: false,
+			Message: h.localizeMessage(r, "messages.errors.secret_target_changed"),
+		}, http.StatusBadRequest)
+		return nil, false
+	}
+	if err != nil {
+		h.writeJSONResponse(w, model.SetupResponse{
+			Success: false,
+			Message: h.localizeMessage(r, "messages.errors.invalid_json"),
+		}, http.StatusBadRequest)
+		return nil, false
+	}
+	return cfg, true
+}
+
+// checkTokenSections responds with 403 and returns false when the request
+// is made with a section-editor token and cfg changes a section outside the
+// token's sections.
+func (h *SetupHandlers) checkTokenSections(w http.ResponseWriter, r *http.Request, cfg *model.SetupConfig) bool {
+	token := setupTokenFromContext(r)
+	if token == nil || token.EffectiveRole() != model.TokenRoleSectionEditor {
+		return true
+	}
 
-	isFullImport := false
-	for _, step := range cfg.RevisionMode.ModifiedSteps {
-		if step == "Imported from previous output directory with full configuration" {
-			isFullImport = true
-			break
+	changed, err := h.setupService.ChangedConfigSections(cfg)
+	if err != nil {
+		h.writeJSONResponse(w, model.SetupResponse{
+			Success: false,
+			Message: err.Error(),
+		}, http.StatusInternalServerError)
+		return false
+	}
+	for _, section := range changed {
+		if !slices.Contains(token.Sections, section) {
+			h.writeJSONResponse(w, model.SetupResponse{
+				Success: false,
+				Message: h.localizeMessage(r, "messages.errors.section_not_allowed", "section", section),
+			}, http.StatusForbidden)
+			return false
 		}
 	}
+	return true
+}
+
+// ConfigHistoryHandler lists the configuration snapshots without their
+// contents, newest first.
+func (h *SetupHandlers) ConfigHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	history, err := h.setupService.GetConfigHistory()
+	if err != nil {
+		h.writeJSONResponse(w, model.SetupResponse{
+			Success: false,
+			Message: h.localizeMessage(r, "messages.failed_get_config_history"),
+		}, http.StatusInternalServerError)
+		return
+	}
 
-	if !isFullImport {
-		safeCfg.Database.SuperPassword = ""
-		safeCfg.Database.AppPassword = ""
-		safeCfg.Redis.Password = ""
-		safeCfg.Redis.AdminPassword = ""
-		safeCfg.SMTP.Password = ""
-		safeCfg.AdminUser.Password = ""
+	summaries := make([]model.ConfigSnapshot, 0, len(history))
+	for i := len(history) - 1; i >= 0; i-- {
+		summary := history[i]
+		summary.Config = nil
+		summaries = append(summaries, summary)
 	}
 
 	h.writeJSONResponse(w, model.SetupResponse{
 		Success: true,
-		Data:    safeCfg,
+		Data:    summaries,
+	}, http.StatusOK)
+}
+
+// ConfigHistoryDiffHandler compares a snapshot with the current draft.
+func (h *SetupHandlers) ConfigHistoryDiffHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.snapshotIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	changes, err := h.setupService.DiffConfigSnapshot(id)
+	if err != nil {
+		h.writeSnapshotError(w, r, err, "messages.failed_get_config_history")
+		return
+	}
+
+	h.writeJSONResponse(w, model.SetupResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"id":      id,
+			"changes": changes,
+		},
+	}, http.StatusOK)
+}
+
+// RestoreConfigHistoryHandler makes a snapshot the current draft.
+func (h *SetupHandlers) RestoreConfigHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.snapshotIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := h.setupService.RestoreConfigSnapshot(id); err != nil {
+		h.writeSnapshotError(w, r, err, "messages.failed_restore_config")
+		return
+	}
+
+	h.writeJSONResponse(w, model.SetupResponse{
+		Success: true,
+		Message: h.localizeMessage(r, "messages.config_restored"),
+		Data:    map[string]interface{}{"id": id},
 	}, http.StatusOK)
 }
 
+func (h *SetupHandlers) snapshotIDParam(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id <= 0 {
+		h.writeJSONResponse(w, model.SetupResponse{
+			Success: false,
+			Message: h.localizeMessage(r, "messages.config_history_not_found"),
+		}, http.StatusNotFound)
+		return 0, false
+	}
+
+	return id, true
+}
+
+func (h *SetupHandlers) writeSnapshotError(w http.ResponseWriter, r *http.Request, err error, messageKey string) {
+	if errors.Is(err, services.ErrConfigSnapshotNotFound) {
+		h.writeJSONResponse(w, model.SetupResponse{
+			Success: false,
+			Message: h.localizeMessage(r, "messages.config_history_not_found"),
+		}, http.StatusNotFound)
+		return
+	}
+
+	log.Printf("Config history request failed: %v", err)
+	h.writeJSONResponse(w, model.SetupResponse{
+		Success: false,
+		Message: h.localizeMessage(r, messageKey),
+	}, http.StatusInternalServerError)
+}
+
 func (h *SetupHandlers) TestConnectionsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		h.writeJSONResponse(w, model.SetupResponse{
@@ -284,16 +440,18 @@ func (h *SetupHandlers) TestConnectionsHandler(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	var cfg model.SetupConfig
-	if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
-		h.writeJSONResponse(w, model.SetupResponse{
-			Success: false,
-			Message: h.localizeMessage(r, "messages.errors.invalid_json"),
-		}, http.StatusBadRequest)
+	cfg, ok := h.decodeConfig(w, r)
+	if !ok {
+		return
+	}
+
+	h.setupService.PrepareConfiguration(cfg)
+
+	if !h.checkTokenSections(w, r, cfg) {
 		return
 	}
 
-	results, err := h.setupService.TestConnections(&cfg)
+	results, err := h.setupService.TestConnections(cfg)
 	if err != nil {
 		h.writeJSONResponse(w, model.SetupResponse{
 			Success: false,
@@ -328,11 +486,9 @@ func (h *SetupHandlers) GenerateConfigHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	if err := h.setupService.GenerateConfigFiles(cfg); err != nil {
-		h.writeJSONResponse(w, model.SetupResponse{
-			Success: false,
-			Message: err.Error(),
-		}, http.StatusInternalServerError)
+	only := services.ParseArtifactList(r.URL.Query().Get("only"))
+	if err := h.setupService.GenerateArtifacts(cfg, only); err != nil {
+		h.writeGenerationError(w, err)
 		return
 	}
 
@@ -351,6 +507,49 @@ func (h *SetupHandlers) GenerateConfigHandler(w http.ResponseWriter, r *http.Req
 	}, http.StatusOK)
 }
 
+func (h *SetupHandlers) GeneratePreviewHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.writeJSONResponse(w, model.SetupResponse{
+			Success: false,
+			Message: h.localizeMessage(r, "messages.errors.method_not_allowed"),
+		}, http.StatusMethodNotAllowed)
+		return
+	}
+
+	cfg, err := h.setupService.GetSetupConfig()
+	if err != nil {
+		h.writeJSONResponse(w, model.SetupResponse{
+			Success: false,
+			Message: h.localizeMessage(r, "messages.failed_get_configuration"),
+		}, http.StatusInternalServerError)
+		return
+	}
+
+	only := services.ParseArtifactList(r.URL.Query().Get("only"))
+	preview, err := h.setupService.PreviewConfigFiles(cfg, only)
+	if err != nil {
+		h.writeGenerationError(w, err)
+		return
+	}
+
+	h.writeJSONResponse(w, model.SetupResponse{
+		Success: true,
+		Data:    preview,
+	}, http.StatusOK)
+}
+
+func (h *SetupHandlers) writeGenerationError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, services.ErrInvalidArtifactSelection) {
+		status = http.StatusBadRequest
+	}
+
+	h.writeJSONResponse(w, model.SetupResponse{
+		Success: false,
+		Message: err.Error(),
+	}, status)
+}
+
 func (h *SetupHandlers) CompleteSetupHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		h.writeJSONResponse(w, model.SetupResponse{
@@ -400,18 +599,14 @@ func (h *SetupHandlers) ValidateConfigHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	var cfg model.SetupConfig
-	if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
-		h.writeJSONResponse(w, model.SetupResponse{
-			Success: false,
-			Message: h.localizeMessage(r, "messages.errors.invalid_json"),
-		}, http.StatusBadRequest)
+	cfg, ok := h.decodeConfig(w, r)
+	if !ok {
 		return
 	}
 
-	h.setupService.PrepareConfiguration(&cfg)
+	h.setupService.PrepareConfiguration(cfg)
 	validator := services.NewValidatorService()
-	errors := validator.ValidateConfig(&cfg)
+	errors := validator.ValidateConfig(cfg)
 
 	if len(errors) > 0 {
 		h.translateValidationErrors(r, errors)
@@ -0,0 +1,273 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"golang.org/x/text/language"
+
+	"github.com/biliqiqi/baklab-setup/internal/i18n"
+	"github.com/biliqiqi/baklab-setup/internal/model"
+	"github.com/biliqiqi/baklab-setup/internal/services"
+	"github.com/biliqiqi/baklab-setup/internal/storage"
+)
+
+func newTestHandlers(t *testing.T) (*SetupHandlers, storage.Storage) {
+	t.Helper()
+
+	handlers, _, store := newTestHandlersWithService(t)
+	return handlers, store
+}
+
+func newTestHandlersWithService(t *testing.T) (*SetupHandlers, *services.SetupService, storage.Storage) {
+	t.Helper()
+
+	store := storage.NewMemoryStorage()
+	setupService := services.NewSetupService(store)
+	return NewSetupHandlers(setupService, i18n.NewI18nManager(language.English), false, "", ""), setupService, store
+}
+
+func TestGetConfigHandlerMasksPasswords(t *testing.T) {
+	handlers, store := newTestHandlers(t)
+
+	if err := store.SaveSetupConfig(&model.SetupConfig{
+		Database:  model.DatabaseConfig{AppPassword: "DatabasePass1!"},
+		AdminUser: model.AdminUserConfig{Username: "admin", Password: "AdminPassword123!"},
+		OAuth:     model.OAuthConfig{GoogleClientID: "google-id", GoogleSecret: "google-secret"},
+		SMS:       model.SMSConfig{APIKey: "sms-key", APISecret: "sms-secret"},
+		RevisionMode: model.RevisionMode{
+			Enabled:       true,
+			ModifiedSteps: []string{"Imported from previous output directory with full configuration"},
+		},
+	}); err != nil {
+		t.Fatalf("SaveSetupConfig() failed: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	handlers.GetConfigHandler(rec, httptest.NewRequest(http.MethodGet, "/api/config", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GetConfigHandler() status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if body := rec.Body.String(); strings.Contains(body, "DatabasePass1!") || strings.Contains(body, "google-secret") || strings.Contains(body, "sms-secret") {
+		t.Fatalf("GetConfigHandler() returned a secret: %s", body)
+	}
+
+	var response struct {
+		Success bool `json:"success"`
+		Data    struct {
+			Database struct {
+				AppPassword   model.SecretPlaceholder `json:"app_password"`
+				SuperPassword model.SecretPlaceholder `json:"super_password"`
+			} `json:"database"`
+			AdminUser struct {
+				Username string                  `json:"username"`
+				Password model.SecretPlaceholder `json:"password"`
+			} `json:"admin_user"`
+			OAuth struct {
+				GoogleSecret model.SecretPlaceholder `json:"google_client_secret"`
+			} `json:"oauth"`
+			SMS struct {
+				APIKey    string                  `json:"api_key"`
+				APISecret model.SecretPlaceholder `json:"api_secret"`
+			} `json:"sms"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if response.Data.AdminUser.Username != "admin" {
+		t.Errorf("username = %q, want %q", response.Data.AdminUser.Username, "admin")
+	}
+	if !response.Data.Database.AppPassword.Set || !response.Data.AdminUser.Password.Set {
+		t.Errorf("GetConfigHandler() should report stored passwords as set")
+	}
+	if response.Data.Database.SuperPassword.Set {
+		t.Errorf("GetConfigHandler() should report an empty password as not set")
+	}
+	if !response.Data.OAuth.GoogleSecret.Set || !response.Data.SMS.APISecret.Set {
+		t.Errorf("GetConfigHandler() should report stored client and API secrets as set")
+	}
+	if response.Data.SMS.APIKey != "sms-key" {
+		t.Errorf("api key = %q, want %q", response.Data.SMS.APIKey, "sms-key")
+	}
+}
+
+func TestSaveConfigHandlerKeepsUnchangedSecrets(t *testing.T) {
+	handlers, store := newTestHandlers(t)
+
+	stored := &model.SetupConfig{
+		Database: model.DatabaseConfig{
+			ServiceType:   "docker",
+			Host:          "localhost",
+			Port:          5432,
+			Name:          "baklab",
+			SuperUser:     "postgres",
+			SuperPassword: "PostgresSuper123!",
+			AppUser:       "baklab",
+			AppPassword:   "DatabasePass1!",
+		},
+	}
+	if err := store.SaveSetupConfig(stored); err != nil {
+		t.Fatalf("SaveSetupConfig() failed: %v", err)
+	}
+
+	save := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handlers.SaveConfigHandler(rec, httptest.NewRequest(http.MethodPost, "/api/config", strings.NewReader(body)))
+		return rec
+	}
+
+	body := `{"current_step": "database", "database": {"service_type": "docker", "host": "localhost", "port": 5432,
+		"name": "baklab", "super_user": "postgres", "super_password": {"unchanged": true},
+		"app_user": "baklab", "app_password": "NewDatabasePass2!"}}`
+	if rec := save(body); rec.Code != http.StatusOK {
+		t.Fatalf("SaveConfigHandler() status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	saved, err := store.GetSetupConfig()
+	if err != nil {
+		t.Fatalf("GetSetupConfig() failed: %v", err)
+	}
+	if saved.Database.SuperPassword != stored.Database.SuperPassword {
+		t.Errorf("super password = %q, want the stored value", saved.Database.SuperPassword)
+	}
+	if saved.Database.AppPassword != "NewDatabasePass2!" {
+		t.Errorf("app password = %q, want the new value", saved.Database.AppPassword)
+	}
+
+	for _, invalid := range []string{
+		`{"database": {"super_password": {"set": true}}}`,
+		`{"database": {"super_password": {"unchanged": false}}}`,
+	} {
+		if rec := save(invalid); rec.Code != http.StatusBadRequest {
+			t.Errorf("SaveConfigHandler(%s) status = %d, want %d", invalid, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestUnchangedSecretsAreNotSentToAChangedServer(t *testing.T) {
+	handlers, store := newTestHandlers(t)
+
+	stored := &model.SetupConfig{
+		Redis: model.RedisConfig{
+			ServiceType: "external",
+			Host:        "redis.internal",
+			Port:        6379,
+			User:        "baklab",
+			Password:    "RedisPass123!",
+		},
+	}
+	if err := store.SaveSetupConfig(stored); err != nil {
+		t.Fatalf("SaveSetupConfig() failed: %v", err)
+	}
+
+	for _, redis := range []string{
+		`{"service_type": "external", "host": "203.0.113.7", "port": 6379, "user": "baklab"`,
+		`{"service_type": "external", "host": "redis.internal", "port": 6380, "user": "baklab"`,
+		`{"service_type": "external", "host": "redis.internal", "port": 6379, "user": "other"`,
+	} {
+		body := `{"redis": ` + redis + `, "password": {"unchanged": true}}}`
+		for path, handler := range map[string]http.HandlerFunc{
+			"/api/config":           handlers.SaveConfigHandler,
+			"/api/test-connections": handlers.TestConnectionsHandler,
+		} {
+			rec := httptest.NewRecorder()
+			handler(rec, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+			var response model.SetupResponse
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if rec.Code != http.StatusBadRequest || !strings.Contains(response.Message, "enter the password again") {
+				t.Errorf("POST %s %s = %d %q, want %d asking for the password", path, body, rec.Code, response.Message, http.StatusBadRequest)
+			}
+		}
+	}
+}
+
+func TestStatusHandler(t *testing.T) {
+	handlers, _ := newTestHandlers(t)
+
+	rec := httptest.NewRecorder()
+	handlers.StatusHandler(rec, httptest.NewRequest(http.MethodGet, "/api/status", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("StatusHandler() status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	var response model.SetupResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	data, ok := response.Data.(map[string]interface{})
+	if !ok || data["status"] != string(model.StatusPending) {
+		t.Errorf("StatusHandler() data = %v, want pending status", response.Data)
+	}
+}
+
+func TestConfigHistoryHandlers(t *testing.T) {
+	handlers, setupService, _ := newTestHandlersWithService(t)
+
+	for _, domain := range []string{"good.example.com", "broken.example.com"} {
+		config := `{"app": {"domain_name": "` + domain + `"}, "database": {"app_password": "DatabasePass1!"}}`
+		if _, err := setupService.ImportConfiguration([]byte(config)); err != nil {
+			t.Fatalf("ImportConfiguration() failed: %v", err)
+		}
+	}
+
+	r := chi.NewRouter()
+	r.Get("/api/config/history", handlers.ConfigHistoryHandler)
+	r.Get("/api/config/history/{id}/diff", handlers.ConfigHistoryDiffHandler)
+	r.Post("/api/config/history/{id}/restore", handlers.RestoreConfigHistoryHandler)
+
+	serve := func(method, target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		return rec
+	}
+
+	rec := serve(http.MethodGet, "/api/config/history")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("history status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if strings.Contains(rec.Body.String(), "DatabasePass1!") {
+		t.Errorf("history listing should not contain snapshot contents")
+	}
+
+	var listing struct {
+		Data []model.ConfigSnapshot `json:"data"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&listing); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(listing.Data) != 2 || listing.Data[0].ID != 2 {
+		t.Fatalf("history = %+v, want two snapshots newest first", listing.Data)
+	}
+
+	rec = serve(http.MethodGet, "/api/config/history/1/diff")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "app.domain_name") {
+		t.Errorf("diff status = %d body = %s, want app.domain_name change", rec.Code, rec.Body.String())
+	}
+
+	if rec := serve(http.MethodGet, "/api/config/history/99/diff"); rec.Code != http.StatusNotFound {
+		t.Errorf("diff of unknown snapshot status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	if rec := serve(http.MethodPost, "/api/config/history/1/restore"); rec.Code != http.StatusOK {
+		t.Fatalf("restore status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	cfg, err := setupService.GetSetupConfig()
+	if err != nil {
+		t.Fatalf("GetSetupConfig() failed: %v", err)
+	}
+	if cfg.App.DomainName != "good.example.com" {
+		t.Errorf("restored domain = %q, want %q", cfg.App.DomainName, "good.example.com")
+	}
+}
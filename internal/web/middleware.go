@@ -2,11 +2,14 @@ package web
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -16,9 +19,12 @@ import (
 )
 
 type SetupMiddleware struct {
-	setupService *services.SetupService
-	devMode      bool
-	logFile      *os.File
+	setupService   *services.SetupService
+	devMode        bool
+	logFile        *os.File
+	guard          *tokenGuard
+	sessions       *sessionStore
+	onTokenRotated func(*model.SetupToken)
 }
 
 func NewSetupMiddleware(setupService *services.SetupService, devMode bool) *SetupMiddleware {
@@ -38,6 +44,69 @@ func NewSetupMiddleware(setupService *services.SetupService, devMode bool) *Setu
 		setupService: setupService,
 		devMode:      devMode,
 		logFile:      logFile,
+		guard:        newTokenGuard(),
+		sessions:     newSessionStore(),
+	}
+}
+
+// SetTokenRotatedHandler sets the function that announces a setup token
+// rotated after too many failed attempts.
+func (m *SetupMiddleware) SetTokenRotatedHandler(handler func(*model.SetupToken)) {
+	m.onTokenRotated = handler
+}
+
+// CheckToken validates the setup token presented by the client of r. Clients
+// that keep presenting wrong tokens are slowed down and then banned, and the
+// token is rotated once too many attempts have failed overall.
+func (m *SetupMiddleware) CheckToken(r *http.Request, token string) (*model.SetupToken, error) {
+	return m.guardTokenAttempt(r, token, func(clientIP string) (*model.SetupToken, error) {
+		return m.setupService.AuthenticateSetupToken(token, clientIP)
+	})
+}
+
+// guardTokenAttempt runs validate for a token presented by the client of r,
+// unless the client is locked out, and counts its failures.
+func (m *SetupMiddleware) guardTokenAttempt(r *http.Request, token string, validate func(clientIP string) (*model.SetupToken, error)) (*model.SetupToken, error) {
+	clientIP := getClientIP(r)
+	if retryAfter := m.guard.blocked(clientIP); retryAfter > 0 {
+		return nil, &TokenThrottledError{RetryAfter: retryAfter}
+	}
+
+	setupToken, err := validate(clientIP)
+	if err != nil {
+		tokenPrefix := token
+		if len(token) > 8 {
+			tokenPrefix = token[:8] + "..."
+		}
+		m.logSecurityEvent(r, "token_validation_failed", tokenPrefix)
+
+		outcome := m.guard.recordFailure(clientIP)
+		switch {
+		case outcome.banned:
+			m.logSecurityEvent(r, "client_banned", fmt.Sprintf("%d failed attempts, banned for %s", outcome.failures, tokenBanDuration))
+		case outcome.backoff > 0:
+			m.logSecurityEvent(r, "token_backoff", fmt.Sprintf("%d failed attempts, next attempt allowed in %s", outcome.failures, outcome.backoff))
+		}
+		if outcome.rotate {
+			m.rotateToken(r)
+		}
+		return nil, err
+	}
+
+	m.guard.recordSuccess(clientIP)
+	return setupToken, nil
+}
+
+func (m *SetupMiddleware) rotateToken(r *http.Request) {
+	token, err := m.setupService.RotateSetupToken()
+	if err != nil {
+		m.logSecurityEvent(r, "token_rotation_failed", err.Error())
+		return
+	}
+
+	m.logSecurityEvent(r, "token_rotated", fmt.Sprintf("after %d failed attempts", tokenRotateFailures))
+	if m.onTokenRotated != nil {
+		m.onTokenRotated(token)
 	}
 }
 
@@ -56,13 +125,23 @@ func (m *SetupMiddleware) SetupAuth(next http.Handler) http.Handler {
 		}
 
 
-		token := r.Header.Get("Setup-Token")
-		if token == "" {
-			token = r.URL.Query().Get("token")
+		session, setupToken := m.requestSession(r)
+		if session != nil {
+			if !safeMethod(r.Method) && !validCSRF(r, session) {
+				m.logSecurityEvent(r, "csrf_validation_failed", r.Method)
+				writeJSONResponse(w, model.SetupResponse{
+					Success: false,
+					Message: "Invalid or missing CSRF token",
+				}, http.StatusForbidden)
+				return
+			}
+			m.serveAuthorized(w, r, setupToken, next)
+			return
 		}
 
+		token := r.Header.Get("Setup-Token")
 		if token == "" {
-			m.logSecurityEvent(r, "missing_token", "no_token_provided")
+			m.logSecurityEvent(r, "missing_token", "no_session_or_token_provided")
 			writeJSONResponse(w, model.SetupResponse{
 				Success: false,
 				Message: "Setup token is required",
@@ -70,14 +149,17 @@ func (m *SetupMiddleware) SetupAuth(next http.Handler) http.Handler {
 			return
 		}
 
-		clientIP := getClientIP(r)
-
-		if err := m.setupService.ValidateSetupToken(token, clientIP); err != nil {
-			tokenPrefix := token
-			if len(token) > 8 {
-				tokenPrefix = token[:8] + "..."
+		setupToken, err := m.CheckToken(r, token)
+		if err != nil {
+			var throttled *TokenThrottledError
+			if errors.As(err, &throttled) {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+				writeJSONResponse(w, model.SetupResponse{
+					Success: false,
+					Message: "Too many failed attempts, try again later",
+				}, http.StatusTooManyRequests)
+				return
 			}
-			m.logSecurityEvent(r, "token_validation_failed", tokenPrefix)
 			writeJSONResponse(w, model.SetupResponse{
 				Success: false,
 				Message: "Invalid or expired setup token",
@@ -86,10 +168,26 @@ func (m *SetupMiddleware) SetupAuth(next http.Handler) http.Handler {
 		}
 
 
-		next.ServeHTTP(w, r)
+		m.serveAuthorized(w, r, setupToken, next)
 	})
 }
 
+// serveAuthorized passes r on to next if the role of setupToken allows its
+// route.
+func (m *SetupMiddleware) serveAuthorized(w http.ResponseWriter, r *http.Request, setupToken *model.SetupToken, next http.Handler) {
+	role := setupToken.EffectiveRole()
+	if !roleAllows(role, routeAccessOf(r)) {
+		m.logSecurityEvent(r, "access_denied", fmt.Sprintf("%s token %q (%s)", role, setupToken.Label, setupToken.TokenPrefix))
+		writeJSONResponse(w, model.SetupResponse{
+			Success: false,
+			Message: "This setup token is not allowed to do that",
+		}, http.StatusForbidden)
+		return
+	}
+
+	next.ServeHTTP(w, withSetupToken(r, setupToken))
+}
+
 func writeJSONResponse(w http.ResponseWriter, response model.SetupResponse, statusCode int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
@@ -199,21 +297,3 @@ func (m *SetupMiddleware) writeToLogFile(message string) {
 		}
 	}
 }
-
-func getClientIP(r *http.Request) string {
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		ips := strings.Split(xff, ",")
-		return strings.TrimSpace(ips[0])
-	}
-
-	if xri := r.Header.Get("X-Real-IP"); xri != "" {
-		return strings.TrimSpace(xri)
-	}
-
-	ip := r.RemoteAddr
-	if colon := strings.LastIndex(ip, ":"); colon != -1 {
-		ip = ip[:colon]
-	}
-
-	return ip
-}
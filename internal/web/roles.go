@@ -0,0 +1,79 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"path"
+
+	"github.com/biliqiqi/baklab-setup/internal/model"
+)
+
+const MiddlewareTokenKey MiddlewareCtxKey = "setup_token"
+
+// routeAccess is what a route does, which decides the roles allowed on it.
+type routeAccess int
+
+const (
+	// accessRead routes only read the configuration.
+	accessRead routeAccess = iota
+	// accessEdit routes save configuration sections or test connections.
+	accessEdit
+	// accessAdmin routes generate files, complete the setup or otherwise
+	// need full control.
+	accessAdmin
+)
+
+// apiRouteAccess lists the API routes open to roles below admin, as method
+// and path.Match pattern. Any other route needs the admin role.
+var apiRouteAccess = []struct {
+	method  string
+	pattern string
+	access  routeAccess
+}{
+	{http.MethodGet, "/api/status", accessRead},
+	{http.MethodGet, "/api/config", accessRead},
+	{http.MethodGet, "/api/config/history", accessRead},
+	{http.MethodGet, "/api/config/history/*/diff", accessRead},
+	{http.MethodGet, "/api/current-cert-paths", accessRead},
+	{http.MethodGet, "/api/geo-file/status", accessRead},
+	{http.MethodPost, "/api/validate", accessRead},
+	{http.MethodPost, "/api/generate/preview", accessRead},
+	{http.MethodPost, "/api/config", accessEdit},
+	{http.MethodPost, "/api/test-connections", accessEdit},
+}
+
+func routeAccessOf(r *http.Request) routeAccess {
+	for _, route := range apiRouteAccess {
+		if route.method != r.Method {
+			continue
+		}
+		if ok, _ := path.Match(route.pattern, r.URL.Path); ok {
+			return route.access
+		}
+	}
+	return accessAdmin
+}
+
+// roleAllows reports whether role may use a route with the given access.
+func roleAllows(role model.TokenRole, access routeAccess) bool {
+	switch role {
+	case model.TokenRoleAdmin:
+		return true
+	case model.TokenRoleSectionEditor:
+		return access <= accessEdit
+	case model.TokenRoleViewer:
+		return access == accessRead
+	}
+	return false
+}
+
+func withSetupToken(r *http.Request, token *model.SetupToken) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), MiddlewareTokenKey, token))
+}
+
+// setupTokenFromContext returns the token the request was authorized with,
+// or nil in development mode.
+func setupTokenFromContext(r *http.Request) *model.SetupToken {
+	token, _ := r.Context().Value(MiddlewareTokenKey).(*model.SetupToken)
+	return token
+}
@@ -0,0 +1,139 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/text/language"
+
+	"github.com/biliqiqi/baklab-setup/internal/i18n"
+	"github.com/biliqiqi/baklab-setup/internal/model"
+	"github.com/biliqiqi/baklab-setup/internal/services"
+	"github.com/biliqiqi/baklab-setup/internal/storage"
+)
+
+func TestSetupAuthEnforcesTokenRoles(t *testing.T) {
+	setupService := services.NewSetupService(storage.NewMemoryStorage())
+	viewer, err := setupService.CreateSetupToken(services.TokenOptions{Label: "auditor", Role: model.TokenRoleViewer, TTL: time.Hour})
+	if err != nil {
+		t.Fatalf("CreateSetupToken() failed: %v", err)
+	}
+	editor, err := setupService.CreateSetupToken(services.TokenOptions{
+		Label:    "dba",
+		Role:     model.TokenRoleSectionEditor,
+		Sections: []string{"database"},
+		TTL:      time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("CreateSetupToken() failed: %v", err)
+	}
+	admin, err := setupService.InitializeSetup("0.0.0.0")
+	if err != nil {
+		t.Fatalf("InitializeSetup() failed: %v", err)
+	}
+
+	m := newTestMiddleware(setupService)
+	handler := m.SetupAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if setupTokenFromContext(r) == nil {
+			t.Errorf("%s %s reached the handler without a setup token", r.Method, r.URL.Path)
+		}
+	}))
+
+	tests := []struct {
+		token  *model.SetupToken
+		method string
+		path   string
+		want   int
+	}{
+		{viewer, http.MethodGet, "/api/config", http.StatusOK},
+		{viewer, http.MethodGet, "/api/config/history/3/diff", http.StatusOK},
+		{viewer, http.MethodPost, "/api/config", http.StatusForbidden},
+		{viewer, http.MethodPost, "/api/complete", http.StatusForbidden},
+		{editor, http.MethodPost, "/api/config", http.StatusOK},
+		{editor, http.MethodPost, "/api/test-connections", http.StatusOK},
+		{editor, http.MethodPost, "/api/generate", http.StatusForbidden},
+		{editor, http.MethodPost, "/api/config/history/3/restore", http.StatusForbidden},
+		{admin, http.MethodPost, "/api/generate", http.StatusOK},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		r.Header.Set("Setup-Token", tt.token.Token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		if rec.Code != tt.want {
+			t.Errorf("%s token: %s %s = %d, want %d", tt.token.Label, tt.method, tt.path, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestSessionEndsWhenTokenIsRevoked(t *testing.T) {
+	setupService := services.NewSetupService(storage.NewMemoryStorage())
+	token, err := setupService.CreateSetupToken(services.TokenOptions{Label: "auditor", Role: model.TokenRoleViewer, TTL: time.Hour})
+	if err != nil {
+		t.Fatalf("CreateSetupToken() failed: %v", err)
+	}
+
+	m := newTestMiddleware(setupService)
+	rec := httptest.NewRecorder()
+	if err := m.StartSession(rec, httptest.NewRequest(http.MethodGet, "/?token="+token.Token, nil), token.Token); err != nil {
+		t.Fatalf("StartSession() failed: %v", err)
+	}
+	cookies := rec.Result().Cookies()
+
+	handler := m.SetupAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	serve := func() int {
+		r := httptest.NewRequest(http.MethodGet, "/api/status", nil)
+		for _, cookie := range cookies {
+			r.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec.Code
+	}
+
+	if got := serve(); got != http.StatusOK {
+		t.Fatalf("status before revocation = %d, want %d", got, http.StatusOK)
+	}
+	if _, err := setupService.RevokeSetupToken("auditor"); err != nil {
+		t.Fatalf("RevokeSetupToken() failed: %v", err)
+	}
+	if got := serve(); got != http.StatusUnauthorized {
+		t.Errorf("status after revocation = %d, want %d", got, http.StatusUnauthorized)
+	}
+}
+
+func TestSaveConfigHandlerLimitsSectionEditors(t *testing.T) {
+	setupService := services.NewSetupService(storage.NewMemoryStorage())
+	handlers := NewSetupHandlers(setupService, i18n.NewI18nManager(language.English), false, "", "")
+	editor := &model.SetupToken{Label: "dba", Role: model.TokenRoleSectionEditor, Sections: []string{"database"}}
+
+	r := httptest.NewRequest(http.MethodPost, "/api/config", strings.NewReader(`{"redis":{"host":"redis"}}`))
+	rec := httptest.NewRecorder()
+	handlers.SaveConfigHandler(rec, withSetupToken(r, editor))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("saving the redis section as a database editor = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/api/config", strings.NewReader(`{"database":{"host":"db"}}`))
+	rec = httptest.NewRecorder()
+	handlers.SaveConfigHandler(rec, withSetupToken(r, editor))
+	if rec.Code == http.StatusForbidden {
+		t.Error("saving the database section as a database editor was forbidden")
+	}
+}
+
+func TestTestConnectionsHandlerLimitsSectionEditors(t *testing.T) {
+	setupService := services.NewSetupService(storage.NewMemoryStorage())
+	handlers := NewSetupHandlers(setupService, i18n.NewI18nManager(language.English), false, "", "")
+	editor := &model.SetupToken{Label: "dba", Role: model.TokenRoleSectionEditor, Sections: []string{"database"}}
+
+	r := httptest.NewRequest(http.MethodPost, "/api/test-connections", strings.NewReader(`{"redis":{"host":"203.0.113.7"}}`))
+	rec := httptest.NewRecorder()
+	handlers.TestConnectionsHandler(rec, withSetupToken(r, editor))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("testing a changed redis section as a database editor = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+}
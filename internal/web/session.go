@@ -0,0 +1,191 @@
+package web
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/biliqiqi/baklab-setup/internal/model"
+)
+
+// The one-time setup token from the access URL is exchanged for a session
+// cookie, which the browser sends with every API call instead of the token.
+// State-changing requests also carry the CSRF cookie value in the CSRF
+// header, which a cross-site page cannot read.
+const (
+	SessionCookieName = "baklab_setup_session"
+	CSRFCookieName    = "baklab_setup_csrf"
+	CSRFHeaderName    = "X-CSRF-Token"
+)
+
+// SessionManager exchanges setup tokens for browser sessions.
+type SessionManager interface {
+	StartSession(w http.ResponseWriter, r *http.Request, token string) error
+	HasSession(r *http.Request) bool
+}
+
+type setupSession struct {
+	tokenID   string
+	csrfToken string
+	expiresAt time.Time
+}
+
+type sessionStore struct {
+	mu       sync.Mutex
+	now      func() time.Time
+	sessions map[string]*setupSession
+}
+
+func newSessionStore() *sessionStore {
+	return &sessionStore{
+		now:      time.Now,
+		sessions: make(map[string]*setupSession),
+	}
+}
+
+// create starts a session for the token with the given ID that ends at
+// expiresAt, and returns the session ID.
+func (s *sessionStore) create(tokenID string, expiresAt time.Time) (string, *setupSession, error) {
+	id, err := randomHex(32)
+	if err != nil {
+		return "", nil, err
+	}
+	csrfToken, err := randomHex(32)
+	if err != nil {
+		return "", nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for key, session := range s.sessions {
+		if now.After(session.expiresAt) {
+			delete(s.sessions, key)
+		}
+	}
+
+	session := &setupSession{tokenID: tokenID, csrfToken: csrfToken, expiresAt: expiresAt}
+	s.sessions[id] = session
+	return id, session, nil
+}
+
+// get returns the live session with the given ID, or nil.
+func (s *sessionStore) get(id string) *setupSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return nil
+	}
+	if s.now().After(session.expiresAt) {
+		delete(s.sessions, id)
+		return nil
+	}
+	return session
+}
+
+func (s *sessionStore) delete(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, id)
+}
+
+// StartSession consumes the setup token of the access URL and sets the
+// session and CSRF cookies, which last as long as the token would have.
+func (m *SetupMiddleware) StartSession(w http.ResponseWriter, r *http.Request, token string) error {
+	consumed, err := m.guardTokenAttempt(r, token, func(clientIP string) (*model.SetupToken, error) {
+		return m.setupService.ConsumeSetupToken(token, clientIP)
+	})
+	if err != nil {
+		return err
+	}
+
+	id, session, err := m.sessions.create(consumed.ID, consumed.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    id,
+		Path:     "/",
+		Expires:  session.expiresAt,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     CSRFCookieName,
+		Value:    session.csrfToken,
+		Path:     "/",
+		Expires:  session.expiresAt,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	m.logSecurityEvent(r, "session_started", fmt.Sprintf("%s token %q (%s...) exchanged for a session", consumed.EffectiveRole(), consumed.Label, consumed.TokenPrefix))
+	return nil
+}
+
+// HasSession reports whether r carries the cookie of a live session.
+func (m *SetupMiddleware) HasSession(r *http.Request) bool {
+	session, _ := m.requestSession(r)
+	return session != nil
+}
+
+// requestSession returns the live session of r and the token it was started
+// with. A session whose token has been revoked or has expired is ended.
+func (m *SetupMiddleware) requestSession(r *http.Request) (*setupSession, *model.SetupToken) {
+	cookie, err := r.Cookie(SessionCookieName)
+	if err != nil {
+		return nil, nil
+	}
+	session := m.sessions.get(cookie.Value)
+	if session == nil {
+		return nil, nil
+	}
+
+	token, err := m.setupService.LookupSetupToken(session.tokenID)
+	if err != nil {
+		m.sessions.delete(cookie.Value)
+		m.logSecurityEvent(r, "session_ended", err.Error())
+		return nil, nil
+	}
+	return session, token
+}
+
+// validCSRF reports whether the CSRF header of r matches both the CSRF
+// cookie and the session.
+func validCSRF(r *http.Request, session *setupSession) bool {
+	header := r.Header.Get(CSRFHeaderName)
+	cookie, err := r.Cookie(CSRFCookieName)
+	if header == "" || err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(header), []byte(cookie.Value)) == 1 &&
+		subtle.ConstantTimeCompare([]byte(header), []byte(session.csrfToken)) == 1
+}
+
+// safeMethod reports whether method cannot change state.
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random value: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,280 @@
+package web
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"golang.org/x/text/language"
+
+	"github.com/biliqiqi/baklab-setup/internal/i18n"
+	"github.com/biliqiqi/baklab-setup/internal/services"
+	"github.com/biliqiqi/baklab-setup/internal/storage"
+)
+
+func newTestMiddleware(setupService *services.SetupService) *SetupMiddleware {
+	return &SetupMiddleware{
+		setupService: setupService,
+		guard:        newTokenGuard(),
+		sessions:     newSessionStore(),
+	}
+}
+
+func TestIndexHandlerExchangesTokenForSession(t *testing.T) {
+	setupService := services.NewSetupService(storage.NewMemoryStorage())
+	token, err := setupService.InitializeSetup("0.0.0.0")
+	if err != nil {
+		t.Fatalf("InitializeSetup() failed: %v", err)
+	}
+
+	m := newTestMiddleware(setupService)
+	handlers := NewSetupHandlers(setupService, i18n.NewI18nManager(language.English), false, "", "")
+	handlers.SetSessionManager(m)
+
+	rec := httptest.NewRecorder()
+	handlers.IndexHandler(rec, httptest.NewRequest(http.MethodGet, "/?token="+token.Token, nil))
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/" {
+		t.Fatalf("IndexHandler() = %d to %q, want a redirect to /", rec.Code, rec.Header().Get("Location"))
+	}
+
+	cookies := map[string]*http.Cookie{}
+	for _, cookie := range rec.Result().Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+	session, csrf := cookies[SessionCookieName], cookies[CSRFCookieName]
+	if session == nil || csrf == nil {
+		t.Fatalf("IndexHandler() set cookies %v, want session and CSRF cookies", rec.Result().Cookies())
+	}
+	if !session.HttpOnly || !session.Secure || session.SameSite != http.SameSiteStrictMode {
+		t.Errorf("session cookie = %+v, want HttpOnly, Secure and SameSite=Strict", session)
+	}
+	if csrf.HttpOnly {
+		t.Error("CSRF cookie is HttpOnly, the page cannot read it")
+	}
+
+	rec = httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(session)
+	handlers.IndexHandler(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Errorf("IndexHandler() with the session cookie = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	rec = httptest.NewRecorder()
+	handlers.IndexHandler(rec, httptest.NewRequest(http.MethodGet, "/?token="+token.Token, nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("IndexHandler() with a used token = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestSetupAuthRequiresCSRFTokenOnPost(t *testing.T) {
+	setupService := services.NewSetupService(storage.NewMemoryStorage())
+	token, err := setupService.InitializeSetup("0.0.0.0")
+	if err != nil {
+		t.Fatalf("InitializeSetup() failed: %v", err)
+	}
+
+	m := newTestMiddleware(setupService)
+	rec := httptest.NewRecorder()
+	if err := m.StartSession(rec, httptest.NewRequest(http.MethodGet, "/?token="+token.Token, nil), token.Token); err != nil {
+		t.Fatalf("StartSession() failed: %v", err)
+	}
+	cookies := rec.Result().Cookies()
+
+	handler := m.SetupAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	serve := func(method, csrfHeader string, withCookies bool) int {
+		r := httptest.NewRequest(method, "/api/config", nil)
+		if withCookies {
+			for _, cookie := range cookies {
+				r.AddCookie(cookie)
+			}
+		}
+		if csrfHeader != "" {
+			r.Header.Set(CSRFHeaderName, csrfHeader)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec.Code
+	}
+
+	var csrf string
+	for _, cookie := range cookies {
+		if cookie.Name == CSRFCookieName {
+			csrf = cookie.Value
+		}
+	}
+
+	tests := []struct {
+		name        string
+		method      string
+		csrfHeader  string
+		withCookies bool
+		want        int
+	}{
+		{"GET with session", http.MethodGet, "", true, http.StatusOK},
+		{"POST with session and CSRF token", http.MethodPost, csrf, true, http.StatusOK},
+		{"POST without CSRF token", http.MethodPost, "", true, http.StatusForbidden},
+		{"POST with wrong CSRF token", http.MethodPost, "forged", true, http.StatusForbidden},
+		{"GET without session", http.MethodGet, "", false, http.StatusUnauthorized},
+		{"POST with CSRF token but no session", http.MethodPost, csrf, false, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := serve(tt.method, tt.csrfHeader, tt.withCookies); got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSessionSurvivesTokenRotation(t *testing.T) {
+	setupService := services.NewSetupService(storage.NewMemoryStorage())
+	token, err := setupService.InitializeSetup("0.0.0.0")
+	if err != nil {
+		t.Fatalf("InitializeSetup() failed: %v", err)
+	}
+
+	m := newTestMiddleware(setupService)
+	rec := httptest.NewRecorder()
+	if err := m.StartSession(rec, httptest.NewRequest(http.MethodGet, "/?token="+token.Token, nil), token.Token); err != nil {
+		t.Fatalf("StartSession() failed: %v", err)
+	}
+	cookies := rec.Result().Cookies()
+
+	rotated, err := setupService.RotateSetupToken()
+	if err != nil {
+		t.Fatalf("RotateSetupToken() failed: %v", err)
+	}
+
+	handler := m.SetupAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	r := httptest.NewRequest(http.MethodGet, "/api/config", nil)
+	for _, cookie := range cookies {
+		r.AddCookie(cookie)
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Errorf("status with a session after rotation = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	if err := setupService.ValidateSetupToken(token.Token, "203.0.113.7"); err == nil {
+		t.Error("ValidateSetupToken() accepted the consumed console token after rotation")
+	}
+	if err := setupService.ValidateSetupToken(rotated.Token, "203.0.113.7"); err != nil {
+		t.Errorf("ValidateSetupToken() with the rotated token failed: %v", err)
+	}
+}
+
+func TestInitializeKeepsSession(t *testing.T) {
+	setupService := services.NewSetupService(storage.NewMemoryStorage())
+	token, err := setupService.InitializeSetup("0.0.0.0")
+	if err != nil {
+		t.Fatalf("InitializeSetup() failed: %v", err)
+	}
+
+	m := newTestMiddleware(setupService)
+	handlers := NewSetupHandlers(setupService, i18n.NewI18nManager(language.English), false, "", "")
+	rec := httptest.NewRecorder()
+	if err := m.StartSession(rec, httptest.NewRequest(http.MethodGet, "/?token="+token.Token, nil), token.Token); err != nil {
+		t.Fatalf("StartSession() failed: %v", err)
+	}
+	cookies := rec.Result().Cookies()
+
+	serve := func(handler http.HandlerFunc, method, path string) int {
+		r := httptest.NewRequest(method, path, nil)
+		for _, cookie := range cookies {
+			r.AddCookie(cookie)
+			if cookie.Name == CSRFCookieName {
+				r.Header.Set(CSRFHeaderName, cookie.Value)
+			}
+		}
+		rec := httptest.NewRecorder()
+		m.SetupAuth(handler).ServeHTTP(rec, r)
+		return rec.Code
+	}
+
+	if got := serve(handlers.InitializeHandler, http.MethodPost, "/api/initialize"); got != http.StatusOK {
+		t.Fatalf("POST /api/initialize = %d, want %d", got, http.StatusOK)
+	}
+	if got := serve(func(w http.ResponseWriter, r *http.Request) {}, http.MethodGet, "/api/config"); got != http.StatusOK {
+		t.Errorf("GET /api/config after initialize = %d, want %d", got, http.StatusOK)
+	}
+}
+
+// TestTokenLinkFlow follows what the browser does with the access URL: open
+// the token link, follow the redirect that drops the token, then call the
+// API with the session cookie and the CSRF header.
+func TestTokenLinkFlow(t *testing.T) {
+	setupService := services.NewSetupService(storage.NewMemoryStorage())
+	token, err := setupService.InitializeSetup("0.0.0.0")
+	if err != nil {
+		t.Fatalf("InitializeSetup() failed: %v", err)
+	}
+
+	m := newTestMiddleware(setupService)
+	handlers := NewSetupHandlers(setupService, i18n.NewI18nManager(language.English), false, "", "")
+	handlers.SetSessionManager(m)
+
+	r := chi.NewRouter()
+	r.Route("/api", func(r chi.Router) {
+		r.Use(m.SetupAuth)
+		r.Post("/initialize", handlers.InitializeHandler)
+	})
+	r.Get("/", handlers.IndexHandler)
+
+	server := httptest.NewTLSServer(r)
+	defer server.Close()
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatalf("cookiejar.New() failed: %v", err)
+	}
+	client := server.Client()
+	client.Jar = jar
+
+	resp, err := client.Get(server.URL + "/?token=" + token.Token)
+	if err != nil {
+		t.Fatalf("GET token link failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Request.URL.RawQuery != "" {
+		t.Fatalf("token link ended at %s with %d, want / with %d", resp.Request.URL, resp.StatusCode, http.StatusOK)
+	}
+
+	serverURL, _ := url.Parse(server.URL)
+	var csrf string
+	for _, cookie := range jar.Cookies(serverURL) {
+		if cookie.Name == CSRFCookieName {
+			csrf = cookie.Value
+		}
+	}
+	if csrf == "" {
+		t.Fatal("no CSRF cookie after following the token link")
+	}
+
+	post := func(csrfHeader string) int {
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/api/initialize", nil)
+		if err != nil {
+			t.Fatalf("NewRequest() failed: %v", err)
+		}
+		if csrfHeader != "" {
+			req.Header.Set(CSRFHeaderName, csrfHeader)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("POST /api/initialize failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if got := post(""); got != http.StatusForbidden {
+		t.Errorf("POST without the CSRF header = %d, want %d", got, http.StatusForbidden)
+	}
+	if got := post(csrf); got != http.StatusOK {
+		t.Errorf("POST with the CSRF header = %d, want %d", got, http.StatusOK)
+	}
+}
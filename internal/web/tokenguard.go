@@ -0,0 +1,157 @@
+package web
+
+import (
+	"fmt"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// Limits on failed setup token attempts. A client gets a few free failures,
+// then has to wait an exponentially growing delay before its next attempt,
+// and is banned once it reaches tokenBanFailures. Failures older than
+// tokenFailureMemory are forgotten. Failures from all clients together
+// rotate the setup token once they reach tokenRotateFailures.
+const (
+	freeTokenFailures   = 3
+	tokenBackoffBase    = time.Second
+	tokenBackoffMax     = 5 * time.Minute
+	tokenBanFailures    = 10
+	tokenBanDuration    = time.Hour
+	tokenFailureMemory  = time.Hour
+	tokenRotateFailures = 50
+	maxTrackedClients   = 10000
+)
+
+// TokenThrottledError is returned for a client that has to wait before it
+// may present a setup token again.
+type TokenThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *TokenThrottledError) Error() string {
+	return fmt.Sprintf("too many failed setup token attempts, retry after %s", e.RetryAfter.Round(time.Second))
+}
+
+type clientFailures struct {
+	failures     int
+	lastFailure  time.Time
+	blockedUntil time.Time
+}
+
+// failureOutcome is what a failed attempt led to.
+type failureOutcome struct {
+	failures int
+	backoff  time.Duration
+	banned   bool
+	rotate   bool
+}
+
+// tokenGuard counts failed setup token attempts per client and globally.
+type tokenGuard struct {
+	mu             sync.Mutex
+	now            func() time.Time
+	clients        map[string]*clientFailures
+	globalFailures int
+	globalSince    time.Time
+}
+
+func newTokenGuard() *tokenGuard {
+	return &tokenGuard{
+		now:     time.Now,
+		clients: make(map[string]*clientFailures),
+	}
+}
+
+// blocked returns how long the client at ip still has to wait, or 0.
+func (g *tokenGuard) blocked(ip string) time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	c, ok := g.clients[clientKey(ip)]
+	if !ok {
+		return 0
+	}
+	return max(c.blockedUntil.Sub(g.now()), 0)
+}
+
+func (g *tokenGuard) recordFailure(ip string) failureOutcome {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	key := clientKey(ip)
+	c, ok := g.clients[key]
+	if !ok || now.Sub(c.lastFailure) > tokenFailureMemory {
+		if len(g.clients) >= maxTrackedClients {
+			g.prune(now)
+		}
+		c = &clientFailures{}
+		g.clients[key] = c
+	}
+	c.failures++
+	c.lastFailure = now
+
+	outcome := failureOutcome{failures: c.failures}
+	switch {
+	case c.failures >= tokenBanFailures:
+		c.blockedUntil = now.Add(tokenBanDuration)
+		outcome.banned = true
+	case c.failures > freeTokenFailures:
+		outcome.backoff = tokenBackoff(c.failures - freeTokenFailures)
+		c.blockedUntil = now.Add(outcome.backoff)
+	}
+
+	if now.Sub(g.globalSince) > tokenFailureMemory {
+		g.globalFailures = 0
+		g.globalSince = now
+	}
+	g.globalFailures++
+	if g.globalFailures >= tokenRotateFailures {
+		g.globalFailures = 0
+		g.globalSince = now
+		outcome.rotate = true
+	}
+
+	return outcome
+}
+
+// recordSuccess forgets the failures of the client at ip.
+func (g *tokenGuard) recordSuccess(ip string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	delete(g.clients, clientKey(ip))
+}
+
+// prune drops clients that are neither blocked nor failed recently.
+func (g *tokenGuard) prune(now time.Time) {
+	for key, c := range g.clients {
+		if now.After(c.blockedUntil) && now.Sub(c.lastFailure) > tokenFailureMemory {
+			delete(g.clients, key)
+		}
+	}
+}
+
+// tokenBackoff returns the delay after the nth failure past the free ones.
+func tokenBackoff(n int) time.Duration {
+	backoff := tokenBackoffBase
+	for i := 1; i < n && backoff < tokenBackoffMax; i++ {
+		backoff *= 2
+	}
+	return min(backoff, tokenBackoffMax)
+}
+
+// clientKey groups IPv6 clients by their /64 network, which a single host
+// usually controls entirely.
+func clientKey(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || !addr.Is6() || addr.Is4In6() {
+		return ip
+	}
+	prefix, err := addr.Prefix(64)
+	if err != nil {
+		return ip
+	}
+	return prefix.String()
+}
@@ -0,0 +1,137 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/biliqiqi/baklab-setup/internal/model"
+	"github.com/biliqiqi/baklab-setup/internal/services"
+	"github.com/biliqiqi/baklab-setup/internal/storage"
+)
+
+func TestTokenGuardBacksOffAndBans(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	g := newTokenGuard()
+	g.now = func() time.Time { return now }
+
+	const ip = "203.0.113.7"
+	for i := 1; i <= freeTokenFailures; i++ {
+		if outcome := g.recordFailure(ip); outcome.backoff != 0 || outcome.banned {
+			t.Fatalf("failure %d outcome = %+v, want no back-off", i, outcome)
+		}
+	}
+	if wait := g.blocked(ip); wait != 0 {
+		t.Fatalf("blocked() after the free failures = %s, want 0", wait)
+	}
+
+	var backoffs []time.Duration
+	for i := freeTokenFailures + 1; i < tokenBanFailures; i++ {
+		outcome := g.recordFailure(ip)
+		if g.blocked(ip) != outcome.backoff {
+			t.Fatalf("blocked() = %s, want %s", g.blocked(ip), outcome.backoff)
+		}
+		backoffs = append(backoffs, outcome.backoff)
+		now = now.Add(outcome.backoff)
+	}
+	for i := 1; i < len(backoffs); i++ {
+		if backoffs[i] != 2*backoffs[i-1] {
+			t.Fatalf("back-offs = %v, want each double the last", backoffs)
+		}
+	}
+
+	if outcome := g.recordFailure(ip); !outcome.banned {
+		t.Fatalf("failure %d outcome = %+v, want banned", tokenBanFailures, outcome)
+	}
+	if wait := g.blocked(ip); wait != tokenBanDuration {
+		t.Errorf("blocked() after ban = %s, want %s", wait, tokenBanDuration)
+	}
+	if wait := g.blocked("203.0.113.8"); wait != 0 {
+		t.Errorf("blocked() of another client = %s, want 0", wait)
+	}
+
+	now = now.Add(tokenBanDuration)
+	if wait := g.blocked(ip); wait != 0 {
+		t.Errorf("blocked() after the ban ended = %s, want 0", wait)
+	}
+}
+
+func TestTokenGuardGroupsIPv6ByNetwork(t *testing.T) {
+	g := newTokenGuard()
+	for i := 0; i <= freeTokenFailures; i++ {
+		g.recordFailure(fmt.Sprintf("2001:db8:0:1::%x", i+1))
+	}
+	if g.blocked("2001:db8:0:1::ffff") == 0 {
+		t.Error("blocked() of an address in the same /64 = 0, want back-off")
+	}
+	if g.blocked("2001:db8:0:2::1") != 0 {
+		t.Error("blocked() of another /64 is non-zero")
+	}
+}
+
+func TestCheckTokenRotatesAfterGlobalFailures(t *testing.T) {
+	setupService := services.NewSetupService(storage.NewMemoryStorage())
+	token, err := setupService.InitializeSetup("0.0.0.0")
+	if err != nil {
+		t.Fatalf("InitializeSetup() failed: %v", err)
+	}
+
+	m := newTestMiddleware(setupService)
+	var rotated *model.SetupToken
+	m.SetTokenRotatedHandler(func(token *model.SetupToken) { rotated = token })
+
+	request := func(ip string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/api/status", nil)
+		r.RemoteAddr = ip + ":51234"
+		return r
+	}
+
+	for i := 0; i < tokenRotateFailures; i++ {
+		if _, err := m.CheckToken(request(fmt.Sprintf("198.51.100.%d", i)), "wrong"); err == nil {
+			t.Fatal("CheckToken() accepted a wrong token")
+		}
+	}
+
+	if rotated == nil || rotated.Token == token.Token {
+		t.Fatal("setup token was not rotated")
+	}
+	if _, err := m.CheckToken(request("203.0.113.7"), token.Token); err == nil {
+		t.Error("CheckToken() accepted the rotated-out token")
+	}
+	if _, err := m.CheckToken(request("203.0.113.7"), rotated.Token); err != nil {
+		t.Errorf("CheckToken() with the new token failed: %v", err)
+	}
+}
+
+func TestSetupAuthThrottlesFailedAttempts(t *testing.T) {
+	setupService := services.NewSetupService(storage.NewMemoryStorage())
+	if _, err := setupService.InitializeSetup("0.0.0.0"); err != nil {
+		t.Fatalf("InitializeSetup() failed: %v", err)
+	}
+	m := newTestMiddleware(setupService)
+	handler := m.SetupAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	var codes []int
+	for i := 0; i <= freeTokenFailures+1; i++ {
+		r := httptest.NewRequest(http.MethodGet, "/api/status", nil)
+		r.Header.Set("Setup-Token", "wrong")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		codes = append(codes, rec.Code)
+
+		if rec.Code == http.StatusTooManyRequests && rec.Header().Get("Retry-After") == "" {
+			t.Error("throttled response lacks Retry-After")
+		}
+	}
+
+	if last := codes[len(codes)-1]; last != http.StatusTooManyRequests {
+		t.Errorf("status codes = %v, want the last to be %d", codes, http.StatusTooManyRequests)
+	}
+	var throttled *TokenThrottledError
+	if _, err := m.CheckToken(httptest.NewRequest(http.MethodGet, "/", nil), "wrong"); !errors.As(err, &throttled) {
+		t.Errorf("CheckToken() error = %v, want TokenThrottledError", err)
+	}
+}
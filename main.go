@@ -8,6 +8,7 @@ import (
 	"encoding/pem"
 	"flag"
 	"fmt"
+	"io"
 	"io/fs"
 	"log"
 	"net/http"
@@ -17,6 +18,7 @@ import (
 	"runtime"
 	"strings"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -25,9 +27,12 @@ import (
 	"golang.org/x/crypto/acme/autocert"
 	"golang.org/x/text/language"
 
+	"github.com/biliqiqi/baklab-setup/internal/dirlock"
 	"github.com/biliqiqi/baklab-setup/internal/i18n"
+	"github.com/biliqiqi/baklab-setup/internal/model"
 	"github.com/biliqiqi/baklab-setup/internal/services"
 	"github.com/biliqiqi/baklab-setup/internal/storage"
+	"github.com/biliqiqi/baklab-setup/internal/utils"
 	"github.com/biliqiqi/baklab-setup/internal/web"
 )
 
@@ -46,34 +51,98 @@ var (
 	autoCert = flag.Bool("auto-cert", false, "Automatically obtain and renew SSL certificates from Let's Encrypt")
 	cacheDir = flag.String("cache-dir", "./cert-cache", "Directory to cache auto-generated certificates")
 
-	configFile   = flag.String("config", "", "Import sanitized config.json file (passwords removed, safe to share)")
-	inputDir     = flag.String("input", "", "Import from previous output directory (includes passwords and sensitive data)")
-	outputDir    = flag.String("output", "", "Specify output directory for generated files (optional, defaults to auto-generated path)")
-	timeout      = flag.Duration("timeout", 30*time.Minute, "Maximum setup session duration")
-	port         = flag.String("port", "8443", "Port to run the setup server on")
-	dataDir      = flag.String("data", "./data", "Directory to store setup data")
-	regen        = flag.Bool("regen", false, "Regenerate all config files in-place from existing configuration (requires -input)")
-	reverseProxy = flag.String("reverse-proxy", "", "Override reverse proxy type: 'caddy' or 'nginx' (optional, only used with -regen)")
-	withWWW      = flag.Bool("with-www", false, "Enable www to non-www redirect handling")
-	cleanOnStart = flag.Bool("clean", false, "Clean cached setup data before starting the server")
-	dev          = flag.Bool("dev", false, "Run the setup server over local HTTP and generate a development deployment")
+	configFile    = flag.String("config", "", "Import sanitized config.json file (passwords removed, safe to share)")
+	inputDir      = flag.String("input", "", "Import from previous output directory (includes passwords and sensitive data)")
+	outputDir     = flag.String("output", "", "Specify output directory for generated files (optional, defaults to auto-generated path)")
+	timeout       = flag.Duration("timeout", 30*time.Minute, "Maximum setup session duration")
+	port          = flag.String("port", "8443", "Port to run the setup server on")
+	dataDir       = flag.String("data", "./data", "Directory to store setup data")
+	regen         = flag.Bool("regen", false, "Regenerate all config files in-place from existing configuration (requires -input)")
+	onlyArtifacts = flag.String("only", "", "With -regen, regenerate only these comma separated artifacts in place, e.g. 'caddy,env'")
+	dryRun        = flag.Bool("dry-run", false, "With -regen, print the files that would be generated and their diff against -input without writing anything")
+	reverseProxy  = flag.String("reverse-proxy", "", "Override reverse proxy type: 'caddy' or 'nginx' (optional, only used with -regen)")
+	secretsMode   = flag.String("secrets-mode", "", "Override how secrets are written: 'env' for the .env file, 'docker' for Docker secrets files or 'age' for an age-encrypted file (optional, only used with -regen)")
+	ageRecipients = flag.String("age-recipients", "", "Comma-separated age1... public keys to encrypt secrets to in age mode (optional, only used with -regen)")
+	ageIdentity   = flag.String("age-identity", "", "age identity file that decrypts the secrets of an age mode deployment (only used with -regen)")
+	withWWW       = flag.Bool("with-www", false, "Enable www to non-www redirect handling")
+	cleanOnStart  = flag.Bool("clean", false, "Clean cached setup data before starting the server")
+	dev           = flag.Bool("dev", false, "Run the setup server over local HTTP and generate a development deployment")
+	storageType   = flag.String("storage", storage.BackendJSON, "Setup data storage backend: 'json', 'memory' or 'bolt'")
+	keepBackups   = flag.Int("backup-retention", services.DefaultBackupRetention, "Number of output directory backups to keep")
+
+	storageKeyFile = flag.String("storage-key-file", "", "File holding the passphrase that encrypts setup data at rest (json storage only, or set BAKLAB_STORAGE_KEY)")
+	encryptStorage = flag.Bool("encrypt-storage", false, "Prompt for a passphrase that encrypts setup data at rest (json storage only)")
+	templatesDir   = flag.String("templates-dir", "", "Directory of template overrides layered over the built-in templates (see 'templates extract')")
+	trustedProxies = flag.String("trusted-proxies", "", "Comma-separated CIDRs or IPs of reverse proxies whose X-Forwarded-For, X-Real-IP and Forwarded headers are trusted")
+	ipv6BindPrefix = flag.Int("ipv6-bind-prefix", 128, "Prefix length the setup token is bound to for IPv6 clients, e.g. 64 to allow temporary addresses")
 )
 
 func main() {
-	if len(os.Args) > 1 && os.Args[1] == "clean" {
-		if err := runCleanCommand(os.Args[2:]); err != nil {
-			log.Fatalf("Clean command failed: %v", err)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "clean":
+			if err := runCleanCommand(os.Args[2:]); err != nil {
+				log.Fatalf("Clean command failed: %v", err)
+			}
+			return
+		case "apply":
+			if err := runApplyCommand(os.Args[2:]); err != nil {
+				log.Fatalf("Apply command failed: %v", err)
+			}
+			return
+		case "rollback":
+			if err := runRollbackCommand(os.Args[2:]); err != nil {
+				log.Fatalf("Rollback command failed: %v", err)
+			}
+			return
+		case "templates":
+			if err := runTemplatesCommand(os.Args[2:]); err != nil {
+				log.Fatalf("Templates command failed: %v", err)
+			}
+			return
+		case "export-bundle":
+			if err := runExportBundleCommand(os.Args[2:]); err != nil {
+				log.Fatalf("Export-bundle command failed: %v", err)
+			}
+			return
+		case "import-bundle":
+			if err := runImportBundleCommand(os.Args[2:]); err != nil {
+				log.Fatalf("Import-bundle command failed: %v", err)
+			}
+			return
+		case "token":
+			if err := runTokenCommand(os.Args[2:]); err != nil {
+				log.Fatalf("Token command failed: %v", err)
+			}
+			return
+		case "decrypt-env":
+			if err := runDecryptEnvCommand(os.Args[2:]); err != nil {
+				log.Fatalf("Decrypt-env command failed: %v", err)
+			}
+			return
+		case "validate":
+			exitCode, err := runValidateCommand(os.Args[2:], os.Stdout)
+			if err != nil {
+				log.Fatalf("Validate command failed: %v", err)
+			}
+			os.Exit(exitCode)
 		}
-		return
 	}
 
 	flag.Parse()
 
-	devMode := *dev || os.Getenv("BAKLAB_DEV_MODE") == "true" || os.Getenv("BAKLAB_DEV") == "1"
+	devMode := resolveDevMode(*dev)
 	if devMode {
 		log.Printf("Development mode enabled")
 	}
 
+	if *dryRun && !*regen {
+		log.Fatalf("-dry-run can only be used with -regen")
+	}
+	if *onlyArtifacts != "" && !*regen {
+		log.Fatalf("-only can only be used with -regen")
+	}
+
 	if *regen {
 		if err := runRegenMode(devMode); err != nil {
 			log.Fatalf("Regeneration failed: %v", err)
@@ -81,12 +150,26 @@ func main() {
 		return
 	}
 
+	dataLock, err := dirlock.Acquire(*dataDir)
+	if err != nil {
+		log.Fatalf("Failed to lock data directory: %v", err)
+	}
+	defer utils.Close(dataLock, "data directory lock")
+
 	if *cleanOnStart {
 		if err := cleanSetupCache(*dataDir, resolveOutputDir(*outputDir)); err != nil {
 			log.Fatalf("Failed to clean cached data: %v", err)
 		}
 	}
 
+	trustedProxyPrefixes, err := web.ParseTrustedProxies(*trustedProxies)
+	if err != nil {
+		log.Fatalf("Invalid -trusted-proxies: %v", err)
+	}
+	if *ipv6BindPrefix < 1 || *ipv6BindPrefix > 128 {
+		log.Fatalf("-ipv6-bind-prefix must be between 1 and 128")
+	}
+
 	if devMode && *domain == "" {
 		*domain = "localhost"
 	}
@@ -159,11 +242,29 @@ func main() {
 		}
 	}
 
-	jsonStorage := storage.NewJSONStorage(*dataDir)
+	setupStorage, err := openSetupStorage(*storageType, *dataDir, *storageKeyFile, *encryptStorage)
+	if err != nil {
+		log.Fatalf("Failed to open setup storage: %v", err)
+	}
+	defer utils.Close(setupStorage, "setup storage")
 
-	setupService := services.NewSetupService(jsonStorage)
+	setupService := services.NewSetupService(setupStorage)
 	setupService.SetTemplatesFS(templatesFS)
 	setupService.SetDevelopmentMode(devMode)
+	setupService.SetBackupRetention(*keepBackups)
+	setupService.SetIPv6BindPrefix(*ipv6BindPrefix)
+	if *storageType == storage.BackendJSON {
+		// Lets the token command change tokens while the server runs.
+		setupService.SetTokenLockDir(*dataDir)
+	}
+	if err := setupService.MigrateSetupToken(); err != nil {
+		log.Fatalf("Failed to migrate setup token: %v", err)
+	}
+	if *templatesDir != "" {
+		if err := setupService.SetTemplatesDir(*templatesDir); err != nil {
+			log.Fatalf("Failed to load templates: %v", err)
+		}
+	}
 
 	if *configFile != "" && *inputDir != "" {
 		log.Fatal("Cannot use both -config and -input flags simultaneously. Use -config for sanitized config (no passwords) or -input for full output directory (with passwords)")
@@ -192,13 +293,14 @@ func main() {
 
 	handlers := web.NewSetupHandlers(setupService, i18nManager, devMode, finalCertPath, finalKeyPath)
 	middlewares := web.NewSetupMiddleware(setupService, devMode)
+	handlers.SetSessionManager(middlewares)
 
 	r := chi.NewRouter()
 
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
+	r.Use(web.ClientIPMiddleware(trustedProxyPrefixes))
 
 	if devMode {
 		r.Use(setupDevelopmentCORS())
@@ -230,9 +332,13 @@ func main() {
 		r.Get("/status", handlers.StatusHandler)
 		r.Post("/config", handlers.SaveConfigHandler)
 		r.Get("/config", handlers.GetConfigHandler)
+		r.Get("/config/history", handlers.ConfigHistoryHandler)
+		r.Get("/config/history/{id}/diff", handlers.ConfigHistoryDiffHandler)
+		r.Post("/config/history/{id}/restore", handlers.RestoreConfigHistoryHandler)
 		r.Post("/validate", handlers.ValidateConfigHandler)
 		r.Post("/test-connections", handlers.TestConnectionsHandler)
 		r.Post("/generate", handlers.GenerateConfigHandler)
+		r.Post("/generate/preview", handlers.GeneratePreviewHandler)
 		r.Get("/current-cert-paths", handlers.GetCurrentCertPathsHandler)
 
 		r.Post("/upload/geo-file", handlers.UploadGeoFileHandler)
@@ -255,6 +361,12 @@ func main() {
 	}
 	accessURL := fmt.Sprintf("%s://%s:%s?token=%s", scheme, *domain, *port, token.Token)
 
+	middlewares.SetTokenRotatedHandler(func(rotated *model.SetupToken) {
+		fmt.Printf("\nWARNING: The setup token was rotated after repeated failed attempts\n")
+		fmt.Printf("New one-time Access URL:\n")
+		fmt.Printf("   %s://%s:%s?token=%s\n\n", scheme, *domain, *port, rotated.Token)
+	})
+
 	fmt.Printf("BakLab Setup Service Started\n")
 	fmt.Printf("\nOne-time Access URL:\n")
 	fmt.Printf("   %s\n\n", accessURL)
@@ -310,7 +422,7 @@ func main() {
 	go func() {
 		time.Sleep(*timeout)
 		log.Printf("Setup timeout (%v) reached, shutting down...", *timeout)
-		cleanupSensitiveData(*dataDir)
+		cleanupSensitiveData(setupStorage)
 		if err := server.Shutdown(context.Background()); err != nil {
 			log.Printf("Error during server shutdown: %v", err)
 		}
@@ -405,6 +517,7 @@ func setupStrictCORS(domain, port string) func(http.Handler) http.Handler {
 			"Content-Language",
 			"Origin",
 			"Setup-Token",
+			"X-CSRF-Token",
 			"X-Language",
 			"X-Requested-With",
 			"Authorization",
@@ -466,22 +579,13 @@ func setupSecurityHeaders(domain string, development bool) func(http.Handler) ht
 	}
 }
 
-func cleanupSensitiveData(dataDir string) {
+// cleanupSensitiveData removes the stored token, state and configuration
+// draft, including any backup generations kept by the storage backend.
+func cleanupSensitiveData(setupStorage storage.Storage) {
 	log.Println("Starting security cleanup...")
 
-	sensitiveFiles := []string{
-		"setup-token.json",
-		"setup-config.json",
-		"setup-state.json",
-	}
-
-	for _, file := range sensitiveFiles {
-		filePath := filepath.Join(dataDir, file)
-		if err := os.Remove(filePath); err != nil {
-			log.Printf("Warning: failed to remove %s: %v", file, err)
-		} else {
-			log.Printf("Removed sensitive file: %s", file)
-		}
+	if err := setupStorage.ResetSetupState(); err != nil {
+		log.Printf("Warning: failed to remove sensitive setup data: %v", err)
 	}
 
 	runtime.GC()
@@ -582,14 +686,26 @@ func runRegenMode(devMode bool) error {
 	if *reverseProxy != "" && *reverseProxy != "caddy" && *reverseProxy != "nginx" {
 		return fmt.Errorf("invalid -reverse-proxy value: %s (must be 'caddy' or 'nginx')", *reverseProxy)
 	}
+	if err := validateSecretsMode(*secretsMode); err != nil {
+		return err
+	}
 
 	absInputDir, err := filepath.Abs(*inputDir)
 	if err != nil {
 		return fmt.Errorf("failed to get absolute path: %w", err)
 	}
 
+	only := services.ParseArtifactList(*onlyArtifacts)
+	if len(only) > 0 && *outputDir != "" {
+		return fmt.Errorf("-only regenerates files in place and cannot be combined with -output")
+	}
+
 	var absOutputDir string
-	if *outputDir != "" {
+	if *dryRun || len(only) > 0 {
+		// A dry run writes nothing and a partial regeneration keeps the other
+		// files, so both work on the deployment being regenerated.
+		absOutputDir = absInputDir
+	} else if *outputDir != "" {
 		absOutputDir, err = filepath.Abs(*outputDir)
 		if err != nil {
 			return fmt.Errorf("failed to get absolute path for output: %w", err)
@@ -606,11 +722,41 @@ func runRegenMode(devMode bool) error {
 	log.Printf("Input directory: %s", absInputDir)
 	log.Printf("Output directory: %s", absOutputDir)
 
-	jsonStorage := storage.NewJSONStorage(*dataDir)
-	setupService := services.NewSetupService(jsonStorage)
+	var setupStorage storage.Storage
+	if *dryRun {
+		// Keep the imported configuration out of the data directory as well.
+		setupStorage = storage.NewMemoryStorage()
+	} else {
+		dataLock, err := dirlock.Acquire(*dataDir)
+		if err != nil {
+			return fmt.Errorf("failed to lock data directory: %w", err)
+		}
+		defer utils.Close(dataLock, "data directory lock")
+
+		setupStorage, err = openSetupStorage(*storageType, *dataDir, *storageKeyFile, *encryptStorage)
+		if err != nil {
+			return fmt.Errorf("failed to open setup storage: %w", err)
+		}
+		defer utils.Close(setupStorage, "setup storage")
+	}
+
+	setupService := services.NewSetupService(setupStorage)
 	setupService.SetTemplatesFS(templatesFS)
 	setupService.SetDevelopmentMode(devMode)
+	setupService.SetBackupRetention(*keepBackups)
 	setupService.SetOutputDir(absOutputDir)
+	if *templatesDir != "" {
+		if err := setupService.SetTemplatesDir(*templatesDir); err != nil {
+			return fmt.Errorf("failed to load templates: %w", err)
+		}
+	}
+	if *ageIdentity != "" {
+		identities, err := services.ReadAgeIdentityFile(*ageIdentity)
+		if err != nil {
+			return err
+		}
+		setupService.SetAgeIdentities(identities)
+	}
 
 	cfg, err := setupService.ImportFromOutputDir(absInputDir)
 	if err != nil {
@@ -622,6 +768,16 @@ func runRegenMode(devMode bool) error {
 		cfg.ReverseProxy.Type = *reverseProxy
 	}
 
+	if *secretsMode != "" {
+		log.Printf("Overriding secrets mode: %s -> %s", cfg.Output.SecretsMode, *secretsMode)
+		cfg.Output.SecretsMode = *secretsMode
+	}
+
+	if *ageRecipients != "" {
+		log.Printf("Overriding age recipients")
+		cfg.Output.AgeRecipients = parseList(*ageRecipients)
+	}
+
 	if *withWWW {
 		log.Printf("Enabling www redirect handling")
 		cfg.App.HandleWWW = true
@@ -632,7 +788,16 @@ func runRegenMode(devMode bool) error {
 	log.Printf("SSL Enabled: %v", cfg.SSL.Enabled)
 	log.Printf("Reverse Proxy: %s", cfg.ReverseProxy.Type)
 
-	if err := setupService.GenerateConfigFiles(cfg); err != nil {
+	if *dryRun {
+		preview, err := setupService.PreviewConfigFiles(cfg, only)
+		if err != nil {
+			return fmt.Errorf("failed to preview config files: %w", err)
+		}
+		printGenerationPreview(os.Stdout, preview)
+		return nil
+	}
+
+	if err := setupService.GenerateArtifacts(cfg, only); err != nil {
 		return fmt.Errorf("failed to generate config files: %w", err)
 	}
 
@@ -648,6 +813,53 @@ func runRegenMode(devMode bool) error {
 	return nil
 }
 
+// printGenerationPreview writes the file list of a dry run followed by the
+// diff of every added or modified file.
+func printGenerationPreview(w io.Writer, preview *model.GenerationPreview) {
+	fmt.Fprintf(w, "Dry run against %s, no files were written.\n\n", preview.OutputDir)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, file := range preview.Files {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", file.Status, file.Mode, file.Size, file.Path)
+	}
+	_ = tw.Flush()
+
+	for _, file := range preview.Files {
+		diff := file.Diff
+		if file.Status == model.PreviewAdded && !file.ContentOmitted {
+			diff = services.UnifiedDiff(file.Path, "", file.Content)
+		}
+		if diff != "" {
+			fmt.Fprintf(w, "\n%s", diff)
+		}
+	}
+}
+
+// validateSecretsMode checks a -secrets-mode value; empty keeps the mode of
+// the configuration.
+func validateSecretsMode(mode string) error {
+	switch mode {
+	case "", model.SecretsModeEnv, model.SecretsModeDocker, model.SecretsModeAge:
+		return nil
+	}
+	return fmt.Errorf("invalid -secrets-mode value: %s (must be '%s', '%s' or '%s')", mode, model.SecretsModeEnv, model.SecretsModeDocker, model.SecretsModeAge)
+}
+
+// parseList splits a comma-separated flag value, dropping empty entries.
+func parseList(list string) []string {
+	var values []string
+	for _, value := range strings.Split(list, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func resolveDevMode(flagValue bool) bool {
+	return flagValue || os.Getenv("BAKLAB_DEV_MODE") == "true" || os.Getenv("BAKLAB_DEV") == "1"
+}
+
 func findAvailableOutputDir(inputDir string) string {
 	suffix := 1
 	outputDir := fmt.Sprintf("%s-%d", inputDir, suffix)
@@ -675,8 +887,19 @@ func cleanSetupCache(dataDirPath, outputPath string) error {
 	}
 
 	log.Printf("Cleaning setup data directory: %s", absDataDir)
-	if err := os.RemoveAll(absDataDir); err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("failed to remove data directory: %w", err)
+	entries, err := os.ReadDir(absDataDir)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read data directory: %w", err)
+	}
+	for _, entry := range entries {
+		// The lock files stay, they are held by the process doing the
+		// cleaning or by a token command.
+		if entry.Name() == dirlock.FileName || entry.Name() == services.TokenLockFileName {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(absDataDir, entry.Name())); err != nil {
+			return fmt.Errorf("failed to remove data directory entry %s: %w", entry.Name(), err)
+		}
 	}
 	if err := os.MkdirAll(absDataDir, 0755); err != nil {
 		return fmt.Errorf("failed to recreate data directory: %w", err)
@@ -721,6 +944,20 @@ func runCleanCommand(args []string) error {
 		return err
 	}
 
+	dataLock, err := dirlock.Acquire(*dataPath)
+	if err != nil {
+		return fmt.Errorf("failed to lock data directory: %w", err)
+	}
+	defer utils.Close(dataLock, "data directory lock")
+
+	if _, err := os.Stat(*outputPath); err == nil {
+		outputLock, err := dirlock.Acquire(*outputPath)
+		if err != nil {
+			return fmt.Errorf("failed to lock output directory: %w", err)
+		}
+		defer utils.Close(outputLock, "output directory lock")
+	}
+
 	if err := cleanSetupCache(*dataPath, *outputPath); err != nil {
 		return err
 	}
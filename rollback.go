@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/biliqiqi/baklab-setup/internal/services"
+	"github.com/biliqiqi/baklab-setup/internal/storage"
+)
+
+func runRollbackCommand(args []string) error {
+	rollbackFlags := flag.NewFlagSet("rollback", flag.ExitOnError)
+	outputPath := rollbackFlags.String("output", defaultOutputDir, "Output directory to roll back")
+	backupName := rollbackFlags.String("backup", "", "Backup to restore (defaults to the newest one)")
+	listOnly := rollbackFlags.Bool("list", false, "List the kept backups and exit")
+	keep := rollbackFlags.Int("keep", services.DefaultBackupRetention, "Number of output directory backups to keep")
+
+	if err := rollbackFlags.Parse(args); err != nil {
+		return err
+	}
+
+	absOutputDir, err := filepath.Abs(*outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path for output: %w", err)
+	}
+	if _, err := os.Stat(absOutputDir); err != nil {
+		return fmt.Errorf("output directory not found: %s", absOutputDir)
+	}
+
+	setupService := services.NewSetupService(storage.NewMemoryStorage())
+	setupService.SetOutputDir(absOutputDir)
+	setupService.SetBackupRetention(*keep)
+
+	if *listOnly {
+		backups, err := setupService.ListOutputBackups()
+		if err != nil {
+			return err
+		}
+		if len(backups) == 0 {
+			fmt.Println("No output backups found")
+			return nil
+		}
+		for _, backup := range backups {
+			fmt.Printf("%s\t%s\n", backup.Name, backup.CreatedAt.Format("2006-01-02 15:04:05"))
+		}
+		return nil
+	}
+
+	restored, err := setupService.RollbackOutputDir(*backupName)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Output directory %s rolled back to backup %s", absOutputDir, restored)
+	return nil
+}
@@ -1,6 +1,6 @@
-var F=class{constructor(e=null){this.token=null,this.i18n=e,this.requestLocks={initialize:!1,complete:!1,generateConfig:!1,testDatabase:!1,testRedis:!1,testSMTP:!1,saveConfig:!1,geoFileUpload:!1}}setI18n(e){this.i18n=e}setToken(e){this.token=e}async api(e,t,s=null){let a={method:e,headers:{"Content-Type":"application/json"}};this.token&&(a.headers["Setup-Token"]=this.token),this.i18n&&this.i18n.getCurrentLanguage&&(a.headers["X-Language"]=this.i18n.getCurrentLanguage()),s&&(a.body=JSON.stringify(s));let r=await fetch(t,a),o=await r.json();if(!r.ok){if(o.errors&&o.errors.length>0){let i=this.i18n?this.i18n.t("messages.errors.validation_failed"):"Validation failed",l=new Error(o.message||i);throw l.validationErrors=o.errors,l}let d=this.i18n?this.i18n.t("messages.errors.request_failed"):"Request failed";throw new Error(o.message||d)}return o}acquireLock(e){return this.requestLocks[e]?!1:(this.requestLocks[e]=!0,!0)}releaseLock(e){this.requestLocks[e]=!1}async protectedApiCall(e,t,s){if(!this.acquireLock(e))return null;try{return await t()}catch(a){throw s&&s(a),a}finally{this.releaseLock(e)}}async initialize(){return this.api("POST","/api/initialize")}async getStatus(){return this.api("GET","/api/status")}async getConfig(){return this.api("GET","/api/config")}async saveConfig(e,t=null){let s=t!==null?{...e,current_step:t}:e;return this.api("POST","/api/config",s)}async getGeoFileStatus(){return this.api("GET","/api/geo-file/status")}async uploadGeoFile(e,t,s){let a=new FormData;return a.append("geo_file",e),new Promise((r,o)=>{let d=new XMLHttpRequest;d.upload.addEventListener("progress",i=>{if(i.lengthComputable&&t){let l=i.loaded/i.total*100;t(l,i.loaded,i.total)}}),d.addEventListener("load",()=>{if(d.status===200)try{let i=JSON.parse(d.responseText);r(i)}catch{let l=this.i18n?this.i18n.t("messages.errors.invalid_response"):"Invalid response format";o(new Error(l))}else try{let i=JSON.parse(d.responseText),l=this.i18n?this.i18n.t("messages.errors.upload_failed"):"Upload failed";o(new Error(i.message||l))}catch{let l=this.i18n?this.i18n.t("messages.errors.upload_failed"):"Upload failed";o(new Error(l))}}),d.addEventListener("error",()=>{let i=this.i18n?this.i18n.t("messages.errors.network_error_upload"):"Network error during upload",l=new Error(i);s&&s(l),o(l)}),d.addEventListener("abort",()=>{let i=this.i18n?this.i18n.t("messages.errors.upload_cancelled"):"Upload cancelled",l=new Error(i);s&&s(l),o(l)}),d.open("POST","/api/upload/geo-file"),this.token&&d.setRequestHeader("Setup-Token",this.token),d.send(a)})}async getCurrentCertPaths(){return(await fetch("/api/current-cert-paths",{headers:{"Setup-Token":this.token}})).json()}async testConnections(e,t){return this.api("POST","/api/test-connections",{type:e,...t})}async generateConfig(e){return this.api("POST","/api/generate",e)}async completeSetup(){return this.api("POST","/api/complete")}};function N(n,e=null){if(n===0)return"0 "+(e?e.t("common.file_size_units.bytes"):"Bytes");let t=1024,s=["bytes","kb","mb","gb"],a=Math.floor(Math.log(n)/Math.log(t)),r=e?e.t(`common.file_size_units.${s[a]}`):s[a].toUpperCase();return Math.round(n/Math.pow(t,a)*100)/100+" "+r}var H="baklab_setup_config";function W(n){try{localStorage.setItem(H,JSON.stringify(n))}catch(e){console.warn("Failed to save to localStorage:",e)}}function J(n={}){try{let e=localStorage.getItem(H);return e?{...n,...JSON.parse(e)}:n}catch(e){return console.warn("Failed to load from localStorage:",e),n}}function Y(){try{localStorage.removeItem(H)}catch(n){console.warn("Failed to clear localStorage:",n)}}async function X(n,e,t,s={}){let{onSuccess:a,onValidationError:r,onError:o}=s;try{return await t.protectedApiCall("saveConfig",async()=>{let i={...n,current_step:e},l=await t.saveConfig(i);return l.success&&a&&a(l),l},i=>{i.validationErrors&&i.validationErrors.length>0?r&&r(i.validationErrors):o&&o(i)})}catch(d){throw console.error("Configuration validation failed:",d),d}}async function Q(n,e,t,s={}){let{onValidationError:a,onError:r}=s;try{return await t.protectedApiCall("saveConfig",async()=>{let d={...n,current_step:e};return await t.saveConfig(d)},d=>{d.validationErrors&&d.validationErrors.length>0?a&&a(d.validationErrors):r&&r(d)})}catch(o){throw r&&r(o),o}}var V=class{constructor(e={}){this._config=e,this._listeners=[]}get(e){if(!e)return this._config;let t=e.split("."),s=this._config;for(let a of t)s=s?.[a];return s}set(e,t){let s=e.split("."),a=s.pop(),r=this._config;for(let o of s)r[o]||(r[o]={}),r=r[o];r[a]=t,this._notify()}update(e){this._config={...this._config,...e},this._notify()}getAll(){return this._config}setAll(e){this._config=e,this._notify()}saveToLocalCache(){W(this._config)}loadFromLocalCache(){this._config=J(this._config),this._notify()}clearLocalCache(){Y()}async saveWithValidation(e,t,s={}){return await X(this._config,e,t,s)}async save(e,t,s={}){return await Q(this._config,e,t,s)}subscribe(e){return this._listeners.push(e),()=>{this._listeners=this._listeners.filter(t=>t!==e)}}_notify(){this._listeners.forEach(e=>e(this._config))}};var z=class{constructor(e,t,s){this._steps=e,this._getCurrentStep=t,this._setCurrentStep=s}getCurrentStepKey(){let e=this._getCurrentStep();return this._steps[e].key}nextStep(){let e=this._getCurrentStep();e<this._steps.length-1&&this._setCurrentStep(e+1)}previousStep(){let e=this._getCurrentStep();e>0&&this._setCurrentStep(e-1)}goToStep(e){e>=0&&e<this._steps.length&&this._setCurrentStep(e)}};function O(n){let e=/^[A-Za-z\d!@#$%^&*]{12,64}$/,t=/[a-z]/,s=/[A-Z]/,a=/\d/,r=/[!@#$%^&*]/;return e.test(n)&&t.test(n)&&s.test(n)&&a.test(n)&&r.test(n)}function C(n){let e=/^[A-Za-z\d!@#$%^&*]{12,64}$/,t=/[a-z]/,s=/[A-Z]/,a=/\d/,r=/[!@#$%^&*]/;if(!e.test(n))return!1;let o=0;return t.test(n)&&o++,s.test(n)&&o++,a.test(n)&&o++,r.test(n)&&o++,o>=3}function L(n){if(!n||n.length===0||n.length>128)return!1;for(let e=0;e<n.length;e++){let t=n.charCodeAt(e);if(t<32||t===127)return!1}return!0}function k(n){let e=n.querySelectorAll(":invalid");e.forEach(s=>{let a=s.closest(".form-group");if(a){a.classList.add("error");let r=a.querySelector(".invalid-feedback");r&&(r.style.display="block")}}),n.querySelectorAll(":valid").forEach(s=>{let a=s.closest(".form-group");if(a){a.classList.remove("error");let r=a.querySelector(".invalid-feedback");r&&(r.style.display="none")}}),e.length>0&&(e[0].focus(),e[0].scrollIntoView({behavior:"smooth",block:"center"}))}function B(n){n.querySelectorAll(".form-group.error").forEach(t=>{t.classList.remove("error");let s=t.querySelector(".invalid-feedback");s&&(s.style.display="none",s.textContent="")})}function E(n){n.querySelectorAll("input, select, textarea").forEach(t=>{let s=()=>{let a=t.closest(".form-group");a&&a.classList.add("touched")};t.addEventListener("input",s),t.addEventListener("change",s),t.addEventListener("blur",s)})}function q(n,e){let t=n.closest(".form-group");if(t){t.classList.add("error");let s=t.querySelector(".invalid-feedback");s&&setTimeout(()=>{s.textContent=e,s.style.display="block"},0)}}function S(n,e){let t=n.closest(".form-group");if(t){t.classList.add("error");let s=t.querySelector(".invalid-feedback");s&&(s.textContent=e,s.style.display="block"),n.style.borderColor="#dc2626"}}function b(n){let e=n.closest(".form-group");if(e){e.classList.remove("error");let t=e.querySelector(".invalid-feedback");t&&(t.style.display="none"),n.style.borderColor=""}}function x(n,e=null){document.querySelectorAll(".alert").forEach(o=>o.remove());let s=document.createElement("div");s.className="alert alert-error validation-errors";let a=document.createElement("div");a.className="validation-error-title",a.textContent=e?e.t("messages.fix_errors"):"Please fix the validation errors below and try again.",s.appendChild(a);let r=document.createElement("ul");r.className="validation-error-list",n.forEach(o=>{let d=document.createElement("li");d.className="validation-error-item";let i=e?e.t("messages.errors.validation_error_generic"):"Validation error",l=o.message||i;d.textContent=l,r.appendChild(d)}),s.appendChild(r),document.querySelector(".setup-card").insertBefore(s,document.getElementById("step-content")),setTimeout(()=>{s.parentNode&&s.parentNode.removeChild(s)},1e4)}function ee(n,e,t,s={}){let{i18n:a=null,showCustomErrorFn:r=null,hideCustomErrorFn:o=null,errorMessages:d={}}=s;if(!e)return n.setCustomValidity(""),o&&o(n),!0;let i=!1,l="";switch(t){case"admin":i=O(e),l=d.admin||(a?a.t("setup.admin.password_error"):"Password must contain lowercase, uppercase, numbers, and special characters (!@#$%^&*)");break;case"database":i=C(e),l=d.database||(a?a.t("setup.database.password_error"):"Password must be 12-64 characters with at least 3 types: lowercase, uppercase, numbers, special characters (!@#$%^&*)");break;case"external":i=L(e),l=d.external||(a?a.t("setup.password_external_error"):"Password must be 1-128 characters and cannot contain control characters");break;default:throw new Error(`Unknown validation mode: ${t}`)}return i?(n.setCustomValidity(""),o&&o(n)):(n.setCustomValidity(l),r&&r(n,l)),i}var P=class{constructor(e){this.i18n=e}updateRadioStyles(e){document.querySelectorAll(`input[name="${e}"]`).forEach(s=>{let a=s.closest(".radio-option");s.checked?a.classList.add("selected"):a.classList.remove("selected")})}showAlert(e,t){let s=document.createElement("div");s.className=`alert alert-${e}`;let a=document.createElement("button");a.type="button",a.className="alert-close",a.innerHTML="&times;",a.setAttribute("aria-label","Close"),a.addEventListener("click",()=>{s.parentNode&&s.parentNode.removeChild(s)});let r=document.createElement("div");r.className="alert-message",r.textContent=this.i18n&&t.includes(".")?this.i18n.t(t):t,s.appendChild(a),s.appendChild(r);let o=document.querySelector(".setup-card");o&&o.insertBefore(s,document.getElementById("step-content"))}showValidationErrors(e){x(e,this.i18n)}};var M=class{constructor(e,t,s,a){this._store=e,this._navigation=t,this._apiClient=s,this._ui=a}get(e){return this._store.get(e)}set(e,t){this._store.set(e,t)}update(e){this._store.update(e)}getAll(){return this._store.getAll()}saveToLocalCache(){this._store.saveToLocalCache()}async saveWithValidation(){return await this._store.saveWithValidation(this._navigation.getCurrentStepKey(),this._apiClient,{onSuccess:()=>this._navigation.nextStep(),onValidationError:e=>this._ui.showValidationErrors(e),onError:e=>this._ui.showAlert("error",e.message)})}async save(){return await this._store.save(this._navigation.getCurrentStepKey(),this._apiClient,{onValidationError:e=>this._ui.showValidationErrors(e),onError:e=>this._ui.showAlert("error",e.message)})}};var j=class{constructor(e,t,s,a,r){this.apiClient=e,this.navigation=t,this.ui=s,this.config=a,this.i18n=r,this.token=null,this.outputPath=null}async initialize(){try{if(!await this.apiClient.protectedApiCall("initialize",async()=>{let t=await this.apiClient.initialize();return this.token=t.data.token,this.apiClient.setToken(this.token),window.app&&(window.app.token=this.token),this.navigation.nextStep(),t},t=>{t.validationErrors&&t.validationErrors.length>0?x(t.validationErrors,this.i18n):this.ui.showAlert("error",t.message)}))return}catch(e){console.error("Initialize error:",e)}}async generateConfig(e,t){let s=document.querySelector('button[onclick*="generateConfig"]')||document.getElementById("generate-config-btn");if(!s)return;let a=s.innerHTML;try{s.disabled=!0;let r=this.i18n?this.i18n.t("setup.review.generating"):"Generating...";return s.innerHTML=r,await this.apiClient.protectedApiCall("generateConfig",async()=>{await this.config.save();let o=await this.apiClient.generateConfig(this.config.getAll());return o.data&&o.data.output_path&&(this.outputPath=o.data.output_path),e&&e(),t&&t(),this.navigation.nextStep(),o},o=>{o.validationErrors&&o.validationErrors.length>0?this.ui.showValidationErrors(o.validationErrors):this.ui.showAlert("error",o.message)}),this.outputPath}catch(r){if(s.disabled=!1,s.innerHTML=a,this.i18n&&this.i18n.applyTranslations(),r.message&&r.message.includes("validation"))try{let o=JSON.parse(r.message.split("validation failed: ")[1]),d=this.i18n?this.i18n.t("setup.review.generation_failed"):"Configuration validation failed. Please check all fields and try again.";this.ui.showAlert("error",d)}catch{let d=this.i18n?this.i18n.t("setup.review.generation_failed"):"Configuration validation failed. Please check all fields and try again.";this.ui.showAlert("error",d)}else{let o=this.i18n?this.i18n.t("setup.review.generation_error"):"Configuration generation failed. Please try again.";this.ui.showAlert("error",o)}}}async completeSetup(e,t){try{await this.apiClient.protectedApiCall("complete",async()=>{await this.apiClient.completeSetup(),e&&e(),this.ui.showAlert("success",this.i18n?this.i18n.t("messages.setup_completed"):"Setup completed successfully! Your BakLab application is ready to use."),setTimeout(()=>{t&&t()},3e3)},s=>{s.validationErrors&&s.validationErrors.length>0?x(s.validationErrors,this.i18n):this.ui.showAlert("error",s.message)})}catch(s){console.error("Complete setup error:",s)}}};var T=class{constructor(){this.currentLanguage="en",this.fallbackLanguage="en",this.translations={},this.supportedLanguages=["en","zh-Hans"],this.pluralRules={en:e=>e===0?"zero":e===1?"one":"other","zh-Hans":e=>e===0?"zero":"other"}}async init(){await this.detectLanguage(),await this.loadTranslations(),this.applyTranslations(),document.addEventListener("languageChanged",()=>{this.applyTranslations()})}async detectLanguage(){let e=localStorage.getItem("baklab_setup_lang");if(e&&this.supportedLanguages.includes(e)){this.currentLanguage=e;return}let t=navigator.language||navigator.userLanguage,a={"zh-CN":"zh-Hans","zh-SG":"zh-Hans"}[t]||t.split("-")[0];this.supportedLanguages.includes(a)&&(this.currentLanguage=a)}async loadTranslations(){let e=!1;try{let t=await fetch(`/static/i18n/${this.currentLanguage}.json`);if(t.ok){let s=await t.json();this.translations[this.currentLanguage]=s,e=!0}else console.warn("Failed to fetch translations for",this.currentLanguage,"status:",t.status);if(this.currentLanguage!==this.fallbackLanguage){let s=await fetch(`/static/i18n/${this.fallbackLanguage}.json`);if(s.ok){let a=await s.json();this.translations[this.fallbackLanguage]=a}else console.warn("Failed to fetch fallback translations for",this.fallbackLanguage,"status:",s.status)}e||this.loadBuiltinTranslations()}catch(t){console.warn("Failed to load translations:",t),this.loadBuiltinTranslations()}}loadBuiltinTranslations(){this.translations={en:{common:{next:"Next",previous:"Previous",save:"Save",cancel:"Cancel",loading:"Loading..."},setup:{title:"BakLab Setup",page_title:"BakLab Setup",welcome:"Welcome to BakLab Setup"}},"zh-Hans":{common:{next:"\u4E0B\u4E00\u6B65",previous:"\u4E0A\u4E00\u6B65",save:"\u4FDD\u5B58",cancel:"\u53D6\u6D88",loading:"\u52A0\u8F7D\u4E2D..."},setup:{title:"BakLab \u8BBE\u7F6E",page_title:"BakLab \u8BBE\u7F6E",welcome:"\u6B22\u8FCE\u4F7F\u7528 BakLab \u8BBE\u7F6E\u5411\u5BFC"}}}}t(e,t={}){let s=this.getTranslationValue(e);return s?typeof s=="string"?this.interpolateVariables(s,t):typeof s=="object"&&s!==null?this.handlePluralObject(s,t):e:e}getTranslationValue(e){let t=e.split("."),s=this.translations[this.currentLanguage];for(let a of t)if(s&&typeof s=="object"&&a in s)s=s[a];else{s=null;break}if(s===null&&this.currentLanguage!==this.fallbackLanguage){s=this.translations[this.fallbackLanguage];for(let a of t)if(s&&typeof s=="object"&&a in s)s=s[a];else{s=null;break}}return s}handlePluralObject(e,t){let s=null,a=0;for(let[i,l]of Object.entries(t))if(typeof l=="number"){s=i,a=l;break}if(s===null){let i=["count","num","number","length"];for(let l of i)if(l in t&&typeof t[l]=="number"){s=l,a=t[l];break}}let o=(this.pluralRules[this.currentLanguage]||this.pluralRules.en)(a),d=e[o]||e.other||e.one||e.zero;if(!d){for(let i of Object.values(e))if(typeof i=="string"){d=i;break}}return s&&d&&(t={...t,count:a}),d?this.interpolateVariables(d,t):""}interpolateVariables(e,t){return e.replace(/\{\{(\w+)\}\}/g,(s,a)=>t[a]!==void 0?String(t[a]):s)}setLanguageChangeCallback(e){this.languageChangeCallback=e}async setLanguage(e){if(!this.supportedLanguages.includes(e)){console.warn(`Unsupported language: ${e}`);return}this.currentLanguage=e,localStorage.setItem("baklab_setup_lang",e),await this.loadTranslations(),document.dispatchEvent(new CustomEvent("languageChanged",{detail:{language:e}})),this.languageChangeCallback&&typeof this.languageChangeCallback=="function"?this.languageChangeCallback():this.applyTranslations()}applyTranslations(){document.title=this.t("setup.page_title"),document.querySelectorAll("[data-i18n]").forEach(e=>{let t=e.getAttribute("data-i18n"),s=e.getAttribute("data-i18n-params"),a=s?JSON.parse(s):{};e.textContent=this.t(t,a)}),document.querySelectorAll("[data-i18n-html]").forEach(e=>{let t=e.getAttribute("data-i18n-html"),s=e.getAttribute("data-i18n-params"),a=s?JSON.parse(s):{};e.innerHTML=this.t(t,a)}),document.querySelectorAll("[data-i18n-placeholder]").forEach(e=>{let t=e.getAttribute("data-i18n-placeholder"),s=e.getAttribute("data-i18n-params"),a=s?JSON.parse(s):{};e.placeholder=this.t(t,a)}),document.querySelectorAll("[data-i18n-title]").forEach(e=>{let t=e.getAttribute("data-i18n-title"),s=e.getAttribute("data-i18n-params"),a=s?JSON.parse(s):{};e.title=this.t(t,a)}),document.querySelectorAll("[data-i18n-value]").forEach(e=>{let t=e.getAttribute("data-i18n-value"),s=e.getAttribute("data-i18n-params"),a=s?JSON.parse(s):{};e.value=this.t(t,a)})}getCurrentLanguage(){return this.currentLanguage}getSupportedLanguages(){return this.supportedLanguages.map(e=>({code:e,name:this.getLanguageName(e)}))}getLanguageName(e){return{en:"English","zh-Hans":"\u4E2D\u6587 (\u7B80\u4F53)"}[e]||e}generateLanguageSelector(e,t={}){let s=document.getElementById(e);if(!s){console.warn(`Language selector container not found: ${e}`);return}let{showLabel:a=!0,labelKey:r="common.language",className:o="language-selector",style:d="dropdown"}=t,i="";a&&(i+=`<label class="language-label">${this.t(r)}</label>`),d==="dropdown"?(i+=`<select class="${o}" data-i18n-selector>`,this.supportedLanguages.forEach(p=>{let m=p===this.currentLanguage?"selected":"";i+=`<option value="${p}" ${m}>${this.getLanguageName(p)}</option>`}),i+="</select>"):d==="buttons"&&(i+=`<div class="${o}">`,this.supportedLanguages.forEach(p=>{let m=p===this.currentLanguage?"active":"";i+=`<button class="lang-btn ${m}" data-i18n-btn data-lang="${p}">
+var _e={"database.super_password":["db-super-password"],"database.app_password":["db-app-password"],"redis.password":["redis-password"],"redis.admin_password":["redis-admin-password"],"smtp.password":["smtp-password"],"oauth.google_client_secret":["google-client-secret"],"oauth.github_client_secret":["github-client-secret"],"admin_user.password":["admin-password","admin-password-confirm"]};function we(n){return n!==null&&typeof n=="object"&&!Array.isArray(n)&&Object.keys(n).length===1&&typeof n.set=="boolean"}function N(n,e="",t=new Set){if(n===null||typeof n!="object")return t;for(let[s,a]of Object.entries(n)){let r=e?`${e}.${s}`:s;we(a)?(a.set&&t.add(r),n[s]=""):N(a,r,t)}return t}function O(n,e){if(!e||e.size===0)return n;let t=JSON.parse(JSON.stringify(n));for(let s of e){let a=s.split("."),r=a.pop(),o=t;for(let d of a)o=o?.[d];o&&typeof o=="object"&&o[r]===""&&(o[r]={unchanged:!0})}return t}function Y(n){if(n)for(let e of n)for(let t of _e[e]||[]){let s=document.getElementById(t);s&&s.value===""&&(s.required=!1,s.setAttribute("data-i18n-placeholder","common.secret_unchanged_placeholder"))}}function X(){let n=document.cookie.match(/(?:^|;\s*)baklab_setup_csrf=([^;]*)/);return n?decodeURIComponent(n[1]):""}var F=class{constructor(e=null){this.i18n=e,this.storedSecrets=new Set,this.requestLocks={initialize:!1,complete:!1,generateConfig:!1,testDatabase:!1,testRedis:!1,testSMTP:!1,saveConfig:!1,geoFileUpload:!1}}setI18n(e){this.i18n=e}async api(e,t,s=null){let a={method:e,headers:{"Content-Type":"application/json"}};e!=="GET"&&(a.headers["X-CSRF-Token"]=X()),this.i18n&&this.i18n.getCurrentLanguage&&(a.headers["X-Language"]=this.i18n.getCurrentLanguage()),s&&(a.body=JSON.stringify(s));let r=await fetch(t,a),o=await r.json();if(!r.ok){if(o.errors&&o.errors.length>0){let i=this.i18n?this.i18n.t("messages.errors.validation_failed"):"Validation failed",l=new Error(o.message||i);throw l.validationErrors=o.errors,l}let d=this.i18n?this.i18n.t("messages.errors.request_failed"):"Request failed";throw new Error(o.message||d)}return o}acquireLock(e){return this.requestLocks[e]?!1:(this.requestLocks[e]=!0,!0)}releaseLock(e){this.requestLocks[e]=!1}async protectedApiCall(e,t,s){if(!this.acquireLock(e))return null;try{return await t()}catch(a){throw s&&s(a),a}finally{this.releaseLock(e)}}async initialize(){return this.api("POST","/api/initialize")}async getStatus(){return this.api("GET","/api/status")}async getConfig(){let e=await this.api("GET","/api/config");return e.data&&(this.storedSecrets=N(e.data)),e}async saveConfig(e,t=null){let s=t!==null?{...e,current_step:t}:e;return this.api("POST","/api/config",O(s,this.storedSecrets))}async getGeoFileStatus(){return this.api("GET","/api/geo-file/status")}async uploadGeoFile(e,t,s){let a=new FormData;return a.append("geo_file",e),new Promise((r,o)=>{let d=new XMLHttpRequest;d.upload.addEventListener("progress",i=>{if(i.lengthComputable&&t){let l=i.loaded/i.total*100;t(l,i.loaded,i.total)}}),d.addEventListener("load",()=>{if(d.status===200)try{let i=JSON.parse(d.responseText);r(i)}catch{let l=this.i18n?this.i18n.t("messages.errors.invalid_response"):"Invalid response format";o(new Error(l))}else try{let i=JSON.parse(d.responseText),l=this.i18n?this.i18n.t("messages.errors.upload_failed"):"Upload failed";o(new Error(i.message||l))}catch{let l=this.i18n?this.i18n.t("messages.errors.upload_failed"):"Upload failed";o(new Error(l))}}),d.addEventListener("error",()=>{let i=this.i18n?this.i18n.t("messages.errors.network_error_upload"):"Network error during upload",l=new Error(i);s&&s(l),o(l)}),d.addEventListener("abort",()=>{let i=this.i18n?this.i18n.t("messages.errors.upload_cancelled"):"Upload cancelled",l=new Error(i);s&&s(l),o(l)}),d.open("POST","/api/upload/geo-file"),d.setRequestHeader("X-CSRF-Token",X()),d.send(a)})}async getCurrentCertPaths(){return(await fetch("/api/current-cert-paths")).json()}async testConnections(e,t){return this.api("POST","/api/test-connections",O({type:e,...t},this.storedSecrets))}async generateConfig(e){return this.api("POST","/api/generate",e)}async completeSetup(){return this.api("POST","/api/complete")}};function H(n,e=null){if(n===0)return"0 "+(e?e.t("common.file_size_units.bytes"):"Bytes");let t=1024,s=["bytes","kb","mb","gb"],a=Math.floor(Math.log(n)/Math.log(t)),r=e?e.t(`common.file_size_units.${s[a]}`):s[a].toUpperCase();return Math.round(n/Math.pow(t,a)*100)/100+" "+r}var U="baklab_setup_config";function Q(n){try{localStorage.setItem(U,JSON.stringify(n))}catch(e){console.warn("Failed to save to localStorage:",e)}}function ee(n={}){try{let e=localStorage.getItem(U);return e?{...n,...JSON.parse(e)}:n}catch(e){return console.warn("Failed to load from localStorage:",e),n}}function te(){try{localStorage.removeItem(U)}catch(n){console.warn("Failed to clear localStorage:",n)}}async function se(n,e,t,s={}){let{onSuccess:a,onValidationError:r,onError:o}=s;try{return await t.protectedApiCall("saveConfig",async()=>{let i={...n,current_step:e},l=await t.saveConfig(i);return l.success&&a&&a(l),l},i=>{i.validationErrors&&i.validationErrors.length>0?r&&r(i.validationErrors):o&&o(i)})}catch(d){throw console.error("Configuration validation failed:",d),d}}async function ae(n,e,t,s={}){let{onValidationError:a,onError:r}=s;try{return await t.protectedApiCall("saveConfig",async()=>{let d={...n,current_step:e};return await t.saveConfig(d)},d=>{d.validationErrors&&d.validationErrors.length>0?a&&a(d.validationErrors):r&&r(d)})}catch(o){throw r&&r(o),o}}var V=class{constructor(e={}){this._config=e,this._listeners=[]}get(e){if(!e)return this._config;let t=e.split("."),s=this._config;for(let a of t)s=s?.[a];return s}set(e,t){let s=e.split("."),a=s.pop(),r=this._config;for(let o of s)r[o]||(r[o]={}),r=r[o];r[a]=t,this._notify()}update(e){this._config={...this._config,...e},this._notify()}getAll(){return this._config}setAll(e){this._config=e,this._notify()}saveToLocalCache(){Q(this._config)}loadFromLocalCache(){this._config=ee(this._config),this._notify()}clearLocalCache(){te()}async saveWithValidation(e,t,s={}){return await se(this._config,e,t,s)}async save(e,t,s={}){return await ae(this._config,e,t,s)}subscribe(e){return this._listeners.push(e),()=>{this._listeners=this._listeners.filter(t=>t!==e)}}_notify(){this._listeners.forEach(e=>e(this._config))}};var z=class{constructor(e,t,s){this._steps=e,this._getCurrentStep=t,this._setCurrentStep=s}getCurrentStepKey(){let e=this._getCurrentStep();return this._steps[e].key}nextStep(){let e=this._getCurrentStep();e<this._steps.length-1&&this._setCurrentStep(e+1)}previousStep(){let e=this._getCurrentStep();e>0&&this._setCurrentStep(e-1)}goToStep(e){e>=0&&e<this._steps.length&&this._setCurrentStep(e)}};function Z(n){let e=/^[A-Za-z\d!@#$%^&*]{12,64}$/,t=/[a-z]/,s=/[A-Z]/,a=/\d/,r=/[!@#$%^&*]/;return e.test(n)&&t.test(n)&&s.test(n)&&a.test(n)&&r.test(n)}function C(n){let e=/^[A-Za-z\d!@#$%^&*]{12,64}$/,t=/[a-z]/,s=/[A-Z]/,a=/\d/,r=/[!@#$%^&*]/;if(!e.test(n))return!1;let o=0;return t.test(n)&&o++,s.test(n)&&o++,a.test(n)&&o++,r.test(n)&&o++,o>=3}function L(n){if(!n||n.length===0||n.length>128)return!1;for(let e=0;e<n.length;e++){let t=n.charCodeAt(e);if(t<32||t===127)return!1}return!0}function E(n){let e=n.querySelectorAll(":invalid");e.forEach(s=>{let a=s.closest(".form-group");if(a){a.classList.add("error");let r=a.querySelector(".invalid-feedback");r&&(r.style.display="block")}}),n.querySelectorAll(":valid").forEach(s=>{let a=s.closest(".form-group");if(a){a.classList.remove("error");let r=a.querySelector(".invalid-feedback");r&&(r.style.display="none")}}),e.length>0&&(e[0].focus(),e[0].scrollIntoView({behavior:"smooth",block:"center"}))}function B(n){n.querySelectorAll(".form-group.error").forEach(t=>{t.classList.remove("error");let s=t.querySelector(".invalid-feedback");s&&(s.style.display="none",s.textContent="")})}function k(n){n.querySelectorAll("input, select, textarea").forEach(t=>{let s=()=>{let a=t.closest(".form-group");a&&a.classList.add("touched")};t.addEventListener("input",s),t.addEventListener("change",s),t.addEventListener("blur",s)})}function $(n,e){let t=n.closest(".form-group");if(t){t.classList.add("error");let s=t.querySelector(".invalid-feedback");s&&setTimeout(()=>{s.textContent=e,s.style.display="block"},0)}}function S(n,e){let t=n.closest(".form-group");if(t){t.classList.add("error");let s=t.querySelector(".invalid-feedback");s&&(s.textContent=e,s.style.display="block"),n.style.borderColor="#dc2626"}}function b(n){let e=n.closest(".form-group");if(e){e.classList.remove("error");let t=e.querySelector(".invalid-feedback");t&&(t.style.display="none"),n.style.borderColor=""}}function x(n,e=null){document.querySelectorAll(".alert").forEach(o=>o.remove());let s=document.createElement("div");s.className="alert alert-error validation-errors";let a=document.createElement("div");a.className="validation-error-title",a.textContent=e?e.t("messages.fix_errors"):"Please fix the validation errors below and try again.",s.appendChild(a);let r=document.createElement("ul");r.className="validation-error-list",n.forEach(o=>{let d=document.createElement("li");d.className="validation-error-item";let i=e?e.t("messages.errors.validation_error_generic"):"Validation error",l=o.message||i;d.textContent=l,r.appendChild(d)}),s.appendChild(r),document.querySelector(".setup-card").insertBefore(s,document.getElementById("step-content")),setTimeout(()=>{s.parentNode&&s.parentNode.removeChild(s)},1e4)}function re(n,e,t,s={}){let{i18n:a=null,showCustomErrorFn:r=null,hideCustomErrorFn:o=null,errorMessages:d={}}=s;if(!e)return n.setCustomValidity(""),o&&o(n),!0;let i=!1,l="";switch(t){case"admin":i=Z(e),l=d.admin||(a?a.t("setup.admin.password_error"):"Password must contain lowercase, uppercase, numbers, and special characters (!@#$%^&*)");break;case"database":i=C(e),l=d.database||(a?a.t("setup.database.password_error"):"Password must be 12-64 characters with at least 3 types: lowercase, uppercase, numbers, special characters (!@#$%^&*)");break;case"external":i=L(e),l=d.external||(a?a.t("setup.password_external_error"):"Password must be 1-128 characters and cannot contain control characters");break;default:throw new Error(`Unknown validation mode: ${t}`)}return i?(n.setCustomValidity(""),o&&o(n)):(n.setCustomValidity(l),r&&r(n,l)),i}var P=class{constructor(e){this.i18n=e}updateRadioStyles(e){document.querySelectorAll(`input[name="${e}"]`).forEach(s=>{let a=s.closest(".radio-option");s.checked?a.classList.add("selected"):a.classList.remove("selected")})}showAlert(e,t){let s=document.createElement("div");s.className=`alert alert-${e}`;let a=document.createElement("button");a.type="button",a.className="alert-close",a.innerHTML="&times;",a.setAttribute("aria-label","Close"),a.addEventListener("click",()=>{s.parentNode&&s.parentNode.removeChild(s)});let r=document.createElement("div");r.className="alert-message",r.textContent=this.i18n&&t.includes(".")?this.i18n.t(t):t,s.appendChild(a),s.appendChild(r);let o=document.querySelector(".setup-card");o&&o.insertBefore(s,document.getElementById("step-content"))}showValidationErrors(e){x(e,this.i18n)}};var M=class{constructor(e,t,s,a){this._store=e,this._navigation=t,this._apiClient=s,this._ui=a}get(e){return this._store.get(e)}set(e,t){this._store.set(e,t)}update(e){this._store.update(e)}getAll(){return this._store.getAll()}saveToLocalCache(){this._store.saveToLocalCache()}async saveWithValidation(){return await this._store.saveWithValidation(this._navigation.getCurrentStepKey(),this._apiClient,{onSuccess:()=>this._navigation.nextStep(),onValidationError:e=>this._ui.showValidationErrors(e),onError:e=>this._ui.showAlert("error",e.message)})}async save(){return await this._store.save(this._navigation.getCurrentStepKey(),this._apiClient,{onValidationError:e=>this._ui.showValidationErrors(e),onError:e=>this._ui.showAlert("error",e.message)})}};var j=class{constructor(e,t,s,a,r){this.apiClient=e,this.navigation=t,this.ui=s,this.config=a,this.i18n=r,this.outputPath=null}async initialize(){try{if(!await this.apiClient.protectedApiCall("initialize",async()=>{let t=await this.apiClient.initialize();return this.navigation.nextStep(),t},t=>{t.validationErrors&&t.validationErrors.length>0?x(t.validationErrors,this.i18n):this.ui.showAlert("error",t.message)}))return}catch(e){console.error("Initialize error:",e)}}async generateConfig(e,t){let s=document.querySelector('button[onclick*="generateConfig"]')||document.getElementById("generate-config-btn");if(!s)return;let a=s.innerHTML;try{s.disabled=!0;let r=this.i18n?this.i18n.t("setup.review.generating"):"Generating...";return s.innerHTML=r,await this.apiClient.protectedApiCall("generateConfig",async()=>{await this.config.save();let o=await this.apiClient.generateConfig(this.config.getAll());return o.data&&o.data.output_path&&(this.outputPath=o.data.output_path),e&&e(),t&&t(),this.navigation.nextStep(),o},o=>{o.validationErrors&&o.validationErrors.length>0?this.ui.showValidationErrors(o.validationErrors):this.ui.showAlert("error",o.message)}),this.outputPath}catch(r){if(s.disabled=!1,s.innerHTML=a,this.i18n&&this.i18n.applyTranslations(),r.message&&r.message.includes("validation"))try{let o=JSON.parse(r.message.split("validation failed: ")[1]),d=this.i18n?this.i18n.t("setup.review.generation_failed"):"Configuration validation failed. Please check all fields and try again.";this.ui.showAlert("error",d)}catch{let d=this.i18n?this.i18n.t("setup.review.generation_failed"):"Configuration validation failed. Please check all fields and try again.";this.ui.showAlert("error",d)}else{let o=this.i18n?this.i18n.t("setup.review.generation_error"):"Configuration generation failed. Please try again.";this.ui.showAlert("error",o)}}}async completeSetup(e,t){try{await this.apiClient.protectedApiCall("complete",async()=>{await this.apiClient.completeSetup(),e&&e(),this.ui.showAlert("success",this.i18n?this.i18n.t("messages.setup_completed"):"Setup completed successfully! Your BakLab application is ready to use."),setTimeout(()=>{t&&t()},3e3)},s=>{s.validationErrors&&s.validationErrors.length>0?x(s.validationErrors,this.i18n):this.ui.showAlert("error",s.message)})}catch(s){console.error("Complete setup error:",s)}}};var T=class{constructor(){this.currentLanguage="en",this.fallbackLanguage="en",this.translations={},this.supportedLanguages=["en","zh-Hans"],this.pluralRules={en:e=>e===0?"zero":e===1?"one":"other","zh-Hans":e=>e===0?"zero":"other"}}async init(){await this.detectLanguage(),await this.loadTranslations(),this.applyTranslations(),document.addEventListener("languageChanged",()=>{this.applyTranslations()})}async detectLanguage(){let e=localStorage.getItem("baklab_setup_lang");if(e&&this.supportedLanguages.includes(e)){this.currentLanguage=e;return}let t=navigator.language||navigator.userLanguage,a={"zh-CN":"zh-Hans","zh-SG":"zh-Hans"}[t]||t.split("-")[0];this.supportedLanguages.includes(a)&&(this.currentLanguage=a)}async loadTranslations(){let e=!1;try{let t=await fetch(`/static/i18n/${this.currentLanguage}.json`);if(t.ok){let s=await t.json();this.translations[this.currentLanguage]=s,e=!0}else console.warn("Failed to fetch translations for",this.currentLanguage,"status:",t.status);if(this.currentLanguage!==this.fallbackLanguage){let s=await fetch(`/static/i18n/${this.fallbackLanguage}.json`);if(s.ok){let a=await s.json();this.translations[this.fallbackLanguage]=a}else console.warn("Failed to fetch fallback translations for",this.fallbackLanguage,"status:",s.status)}e||this.loadBuiltinTranslations()}catch(t){console.warn("Failed to load translations:",t),this.loadBuiltinTranslations()}}loadBuiltinTranslations(){this.translations={en:{common:{next:"Next",previous:"Previous",save:"Save",cancel:"Cancel",loading:"Loading..."},setup:{title:"BakLab Setup",page_title:"BakLab Setup",welcome:"Welcome to BakLab Setup"}},"zh-Hans":{common:{next:"\u4E0B\u4E00\u6B65",previous:"\u4E0A\u4E00\u6B65",save:"\u4FDD\u5B58",cancel:"\u53D6\u6D88",loading:"\u52A0\u8F7D\u4E2D..."},setup:{title:"BakLab \u8BBE\u7F6E",page_title:"BakLab \u8BBE\u7F6E",welcome:"\u6B22\u8FCE\u4F7F\u7528 BakLab \u8BBE\u7F6E\u5411\u5BFC"}}}}t(e,t={}){let s=this.getTranslationValue(e);return s?typeof s=="string"?this.interpolateVariables(s,t):typeof s=="object"&&s!==null?this.handlePluralObject(s,t):e:e}getTranslationValue(e){let t=e.split("."),s=this.translations[this.currentLanguage];for(let a of t)if(s&&typeof s=="object"&&a in s)s=s[a];else{s=null;break}if(s===null&&this.currentLanguage!==this.fallbackLanguage){s=this.translations[this.fallbackLanguage];for(let a of t)if(s&&typeof s=="object"&&a in s)s=s[a];else{s=null;break}}return s}handlePluralObject(e,t){let s=null,a=0;for(let[i,l]of Object.entries(t))if(typeof l=="number"){s=i,a=l;break}if(s===null){let i=["count","num","number","length"];for(let l of i)if(l in t&&typeof t[l]=="number"){s=l,a=t[l];break}}let o=(this.pluralRules[this.currentLanguage]||this.pluralRules.en)(a),d=e[o]||e.other||e.one||e.zero;if(!d){for(let i of Object.values(e))if(typeof i=="string"){d=i;break}}return s&&d&&(t={...t,count:a}),d?this.interpolateVariables(d,t):""}interpolateVariables(e,t){return e.replace(/\{\{(\w+)\}\}/g,(s,a)=>t[a]!==void 0?String(t[a]):s)}setLanguageChangeCallback(e){this.languageChangeCallback=e}async setLanguage(e){if(!this.supportedLanguages.includes(e)){console.warn(`Unsupported language: ${e}`);return}this.currentLanguage=e,localStorage.setItem("baklab_setup_lang",e),await this.loadTranslations(),document.dispatchEvent(new CustomEvent("languageChanged",{detail:{language:e}})),this.languageChangeCallback&&typeof this.languageChangeCallback=="function"?this.languageChangeCallback():this.applyTranslations()}applyTranslations(){document.title=this.t("setup.page_title"),document.querySelectorAll("[data-i18n]").forEach(e=>{let t=e.getAttribute("data-i18n"),s=e.getAttribute("data-i18n-params"),a=s?JSON.parse(s):{};e.textContent=this.t(t,a)}),document.querySelectorAll("[data-i18n-html]").forEach(e=>{let t=e.getAttribute("data-i18n-html"),s=e.getAttribute("data-i18n-params"),a=s?JSON.parse(s):{};e.innerHTML=this.t(t,a)}),document.querySelectorAll("[data-i18n-placeholder]").forEach(e=>{let t=e.getAttribute("data-i18n-placeholder"),s=e.getAttribute("data-i18n-params"),a=s?JSON.parse(s):{};e.placeholder=this.t(t,a)}),document.querySelectorAll("[data-i18n-title]").forEach(e=>{let t=e.getAttribute("data-i18n-title"),s=e.getAttribute("data-i18n-params"),a=s?JSON.parse(s):{};e.title=this.t(t,a)}),document.querySelectorAll("[data-i18n-value]").forEach(e=>{let t=e.getAttribute("data-i18n-value"),s=e.getAttribute("data-i18n-params"),a=s?JSON.parse(s):{};e.value=this.t(t,a)})}getCurrentLanguage(){return this.currentLanguage}getSupportedLanguages(){return this.supportedLanguages.map(e=>({code:e,name:this.getLanguageName(e)}))}getLanguageName(e){return{en:"English","zh-Hans":"\u4E2D\u6587 (\u7B80\u4F53)"}[e]||e}generateLanguageSelector(e,t={}){let s=document.getElementById(e);if(!s){console.warn(`Language selector container not found: ${e}`);return}let{showLabel:a=!0,labelKey:r="common.language",className:o="language-selector",style:d="dropdown"}=t,i="";a&&(i+=`<label class="language-label">${this.t(r)}</label>`),d==="dropdown"?(i+=`<select class="${o}" data-i18n-selector>`,this.supportedLanguages.forEach(p=>{let m=p===this.currentLanguage?"selected":"";i+=`<option value="${p}" ${m}>${this.getLanguageName(p)}</option>`}),i+="</select>"):d==="buttons"&&(i+=`<div class="${o}">`,this.supportedLanguages.forEach(p=>{let m=p===this.currentLanguage?"active":"";i+=`<button class="lang-btn ${m}" data-i18n-btn data-lang="${p}">
                     ${this.getLanguageName(p)}
-                </button>`}),i+="</div>"),s.innerHTML=i;let l=s.querySelector("[data-i18n-selector]");l&&l.addEventListener("change",p=>this.setLanguage(p.target.value)),s.querySelectorAll("[data-i18n-btn]").forEach(p=>{p.addEventListener("click",m=>{let v=m.target.getAttribute("data-lang");this.setLanguage(v)})})}formatDate(e,t={}){let s=this.currentLanguage==="zh-Hans"?"zh-CN":"en-US";return new Intl.DateTimeFormat(s,t).format(new Date(e))}formatNumber(e,t={}){let s=this.currentLanguage==="zh-Hans"?"zh-CN":"en-US";return new Intl.NumberFormat(s,t).format(e)}};function ve(){let n={en:{welcome:"Welcome {{name}}!",items:{zero:"No items",one:"{{count}} item",other:"{{count}} items"},nested:{deep:{value:"Deep value: {{value}}"}}},"zh-Hans":{welcome:"\u6B22\u8FCE {{name}}\uFF01",items:{zero:"\u6CA1\u6709\u9879\u76EE",other:"{{count}} \u4E2A\u9879\u76EE"},nested:{deep:{value:"\u6DF1\u5C42\u503C\uFF1A{{value}}"}}}},e=new T;e.translations=n;let t=[{lang:"en",key:"welcome",params:{name:"Alice"},expected:"Welcome Alice!"},{lang:"en",key:"items",params:{count:0},expected:"No items"},{lang:"en",key:"items",params:{count:1},expected:"1 item"},{lang:"en",key:"items",params:{count:5},expected:"5 items"},{lang:"en",key:"nested.deep.value",params:{value:"test"},expected:"Deep value: test"},{lang:"zh-Hans",key:"welcome",params:{name:"\u5F20\u4E09"},expected:"\u6B22\u8FCE \u5F20\u4E09\uFF01"},{lang:"zh-Hans",key:"items",params:{count:0},expected:"\u6CA1\u6709\u9879\u76EE"},{lang:"zh-Hans",key:"items",params:{count:5},expected:"5 \u4E2A\u9879\u76EE"},{lang:"zh-Hans",key:"nested.deep.value",params:{value:"\u6D4B\u8BD5"},expected:"\u6DF1\u5C42\u503C\uFF1A\u6D4B\u8BD5"}],s=0,a=t.length;return t.forEach((r,o)=>{e.currentLanguage=r.lang,e.t(r.key,r.params)===r.expected&&s++}),s===a}window.location.search.includes("test=true")&&document.addEventListener("DOMContentLoaded",()=>{setTimeout(ve,1e3)});function te(n,{setupService:e}){n.innerHTML=`
+                </button>`}),i+="</div>"),s.innerHTML=i;let l=s.querySelector("[data-i18n-selector]");l&&l.addEventListener("change",p=>this.setLanguage(p.target.value)),s.querySelectorAll("[data-i18n-btn]").forEach(p=>{p.addEventListener("click",m=>{let v=m.target.getAttribute("data-lang");this.setLanguage(v)})})}formatDate(e,t={}){let s=this.currentLanguage==="zh-Hans"?"zh-CN":"en-US";return new Intl.DateTimeFormat(s,t).format(new Date(e))}formatNumber(e,t={}){let s=this.currentLanguage==="zh-Hans"?"zh-CN":"en-US";return new Intl.NumberFormat(s,t).format(e)}};function ke(){let n={en:{welcome:"Welcome {{name}}!",items:{zero:"No items",one:"{{count}} item",other:"{{count}} items"},nested:{deep:{value:"Deep value: {{value}}"}}},"zh-Hans":{welcome:"\u6B22\u8FCE {{name}}\uFF01",items:{zero:"\u6CA1\u6709\u9879\u76EE",other:"{{count}} \u4E2A\u9879\u76EE"},nested:{deep:{value:"\u6DF1\u5C42\u503C\uFF1A{{value}}"}}}},e=new T;e.translations=n;let t=[{lang:"en",key:"welcome",params:{name:"Alice"},expected:"Welcome Alice!"},{lang:"en",key:"items",params:{count:0},expected:"No items"},{lang:"en",key:"items",params:{count:1},expected:"1 item"},{lang:"en",key:"items",params:{count:5},expected:"5 items"},{lang:"en",key:"nested.deep.value",params:{value:"test"},expected:"Deep value: test"},{lang:"zh-Hans",key:"welcome",params:{name:"\u5F20\u4E09"},expected:"\u6B22\u8FCE \u5F20\u4E09\uFF01"},{lang:"zh-Hans",key:"items",params:{count:0},expected:"\u6CA1\u6709\u9879\u76EE"},{lang:"zh-Hans",key:"items",params:{count:5},expected:"5 \u4E2A\u9879\u76EE"},{lang:"zh-Hans",key:"nested.deep.value",params:{value:"\u6D4B\u8BD5"},expected:"\u6DF1\u5C42\u503C\uFF1A\u6D4B\u8BD5"}],s=0,a=t.length;return t.forEach((r,o)=>{e.currentLanguage=r.lang,e.t(r.key,r.params)===r.expected&&s++}),s===a}window.location.search.includes("test=true")&&document.addEventListener("DOMContentLoaded",()=>{setTimeout(ke,1e3)});function oe(n,{setupService:e}){n.innerHTML=`
         <div class="form-section">
             <h3 data-i18n="setup.init.welcome_title"></h3>
             <div style="margin-bottom: 2rem; color: var(--gray-600); line-height: 1.6;">
@@ -33,7 +33,7 @@ var F=class{constructor(e=null){this.token=null,this.i18n=e,this.requestLocks={i
                 </button>
             </div>
         </div>
-    `,document.getElementById("init-btn").addEventListener("click",async()=>{await e.initialize()})}async function ye(n,e,t,s){await n.protectedApiCall("testDatabase",async()=>{let a={...e.getAll()},r=document.querySelector('input[name="db-service-type"]:checked').value;a.database={service_type:r,host:document.getElementById("db-host").value,port:parseInt(document.getElementById("db-port").value),name:document.getElementById("db-name").value,app_user:document.getElementById("db-app-user").value,app_password:document.getElementById("db-app-password").value},r==="docker"?(a.database.super_user=document.getElementById("db-super-user").value,a.database.super_password=document.getElementById("db-super-password").value):(a.database.super_user="",a.database.super_password="");let o=document.getElementById("db-test-btn"),d=o.textContent;o.disabled=!0,o.textContent=s?s.t("common.testing"):"Testing...";try{let i=await n.testConnections("database",a);_e(i.data,"database")}catch(i){t.showAlert("error",s?s.t("messages.errors.failed_test_connections",{error:i.message}):"Connection test failed: "+i.message)}finally{o.disabled=!1,o.textContent=d}},a=>{a.validationErrors&&a.validationErrors.length>0?x(a.validationErrors,s):t.showAlert("error",a.message)})}function _e(n,e){let s=document.getElementById("db-connection-results");if(s){let a=n.filter(r=>r.service===e);s.innerHTML=a.length>0?`
+    `,document.getElementById("init-btn").addEventListener("click",async()=>{await e.initialize()})}async function Se(n,e,t,s){await n.protectedApiCall("testDatabase",async()=>{let a={...e.getAll()},r=document.querySelector('input[name="db-service-type"]:checked').value;a.database={service_type:r,host:document.getElementById("db-host").value,port:parseInt(document.getElementById("db-port").value),name:document.getElementById("db-name").value,app_user:document.getElementById("db-app-user").value,app_password:document.getElementById("db-app-password").value},r==="docker"?(a.database.super_user=document.getElementById("db-super-user").value,a.database.super_password=document.getElementById("db-super-password").value):(a.database.super_user="",a.database.super_password="");let o=document.getElementById("db-test-btn"),d=o.textContent;o.disabled=!0,o.textContent=s?s.t("common.testing"):"Testing...";try{let i=await n.testConnections("database",a);xe(i.data,"database")}catch(i){t.showAlert("error",s?s.t("messages.errors.failed_test_connections",{error:i.message}):"Connection test failed: "+i.message)}finally{o.disabled=!1,o.textContent=d}},a=>{a.validationErrors&&a.validationErrors.length>0?x(a.validationErrors,s):t.showAlert("error",a.message)})}function xe(n,e){let s=document.getElementById("db-connection-results");if(s){let a=n.filter(r=>r.service===e);s.innerHTML=a.length>0?`
             <div class="connection-results">
                 ${a.map(r=>`
                     <div class="connection-result ${r.success?"success":"error"}">
@@ -46,7 +46,7 @@ var F=class{constructor(e=null){this.token=null,this.i18n=e,this.requestLocks={i
                     </div>
                 `).join("")}
             </div>
-        `:""}}function D(n,e){let t=document.getElementById(n);if(t){let s=t.closest(".form-group");if(s){let a=s.querySelector(".form-help");a&&(a.style.display=e?"block":"none")}}}function U(n){let e=document.getElementById("db-host"),t=document.getElementById("db-test-connection-container"),s=document.getElementById("db-super-user-config"),a=document.getElementById("db-super-user"),r=document.getElementById("db-super-password"),o=document.getElementById("db-app-user"),d=document.getElementById("db-app-password"),i=document.getElementById("database-form");n==="docker"?(e.value="localhost",e.readOnly=!0,e.style.backgroundColor="var(--gray-100)",t&&(t.style.display="none"),s&&(s.style.display="block"),a&&(a.required=!0,a.disabled=!1),r&&(r.required=!0,r.disabled=!1),o&&(o.minLength=1,o.maxLength=63,o.pattern="^[a-zA-Z][a-zA-Z0-9_]*$"),d&&(d.minLength=12,d.maxLength=64,d.pattern="^[A-Za-z\\d!@#$%^&*]{12,64}$"),D("db-app-user",!0),D("db-app-password",!0),o&&(o.setCustomValidity(""),b(o)),d&&(d.setCustomValidity(""),b(d)),a&&(a.setCustomValidity(""),b(a)),r&&(r.setCustomValidity(""),b(r))):(e.readOnly=!1,e.style.backgroundColor="",t&&(t.style.display="block"),s&&(s.style.display="none"),a&&(a.required=!1,a.disabled=!0),r&&(r.required=!1,r.disabled=!0),o&&(o.minLength=1,o.maxLength=128,o.pattern="",o.removeAttribute("pattern")),d&&(d.minLength=1,d.maxLength=128,d.pattern="",d.removeAttribute("pattern")),D("db-app-user",!1),D("db-app-password",!1),o&&(o.setCustomValidity(""),b(o)),d&&(d.setCustomValidity(""),b(d)),a&&(a.setCustomValidity(""),b(a)),r&&(r.setCustomValidity(""),b(r))),i&&(i.querySelectorAll("input, select, textarea").forEach(p=>{p.style.display!=="none"&&!p.closest('[style*="display: none"]')&&p.setCustomValidity("")}),i.noValidate=!0,setTimeout(()=>{i.noValidate=!1},10))}function se(n,{config:e,navigation:t,ui:s,apiClient:a,i18n:r}){let o=e.get("database");n.innerHTML=`
+        `:""}}function D(n,e){let t=document.getElementById(n);if(t){let s=t.closest(".form-group");if(s){let a=s.querySelector(".form-help");a&&(a.style.display=e?"block":"none")}}}function K(n){let e=document.getElementById("db-host"),t=document.getElementById("db-test-connection-container"),s=document.getElementById("db-super-user-config"),a=document.getElementById("db-super-user"),r=document.getElementById("db-super-password"),o=document.getElementById("db-app-user"),d=document.getElementById("db-app-password"),i=document.getElementById("database-form");n==="docker"?(e.value="localhost",e.readOnly=!0,e.style.backgroundColor="var(--gray-100)",t&&(t.style.display="none"),s&&(s.style.display="block"),a&&(a.required=!0,a.disabled=!1),r&&(r.required=!0,r.disabled=!1),o&&(o.minLength=1,o.maxLength=63,o.pattern="^[a-zA-Z][a-zA-Z0-9_]*$"),d&&(d.minLength=12,d.maxLength=64,d.pattern="^[A-Za-z\\d!@#$%^&*]{12,64}$"),D("db-app-user",!0),D("db-app-password",!0),o&&(o.setCustomValidity(""),b(o)),d&&(d.setCustomValidity(""),b(d)),a&&(a.setCustomValidity(""),b(a)),r&&(r.setCustomValidity(""),b(r))):(e.readOnly=!1,e.style.backgroundColor="",t&&(t.style.display="block"),s&&(s.style.display="none"),a&&(a.required=!1,a.disabled=!0),r&&(r.required=!1,r.disabled=!0),o&&(o.minLength=1,o.maxLength=128,o.pattern="",o.removeAttribute("pattern")),d&&(d.minLength=1,d.maxLength=128,d.pattern="",d.removeAttribute("pattern")),D("db-app-user",!1),D("db-app-password",!1),o&&(o.setCustomValidity(""),b(o)),d&&(d.setCustomValidity(""),b(d)),a&&(a.setCustomValidity(""),b(a)),r&&(r.setCustomValidity(""),b(r))),i&&(i.querySelectorAll("input, select, textarea").forEach(p=>{p.style.display!=="none"&&!p.closest('[style*="display: none"]')&&p.setCustomValidity("")}),i.noValidate=!0,setTimeout(()=>{i.noValidate=!1},10))}function ne(n,{config:e,navigation:t,ui:s,apiClient:a,i18n:r}){let o=e.get("database");n.innerHTML=`
         <form id="database-form" class="form-section" novalidate>
             <h3 data-i18n="setup.database.title"></h3>
             <p style="margin-bottom: 1.5rem; color: var(--gray-600);" data-i18n="setup.database.description"></p>
@@ -205,7 +205,7 @@ var F=class{constructor(e=null){this.token=null,this.i18n=e,this.requestLocks={i
                 <button type="submit" class="btn btn-primary" data-i18n="common.next"></button>
             </div>
         </form>
-    `,document.getElementById("db-prev-btn").addEventListener("click",()=>{t.previousStep()}),document.querySelectorAll('input[name="db-service-type"]').forEach(v=>{v.addEventListener("change",u=>{U(u.target.value),s.updateRadioStyles("db-service-type"),setTimeout(()=>i(),10)})}),U(o.service_type),s.updateRadioStyles("db-service-type"),setTimeout(()=>{U(o.service_type)},100);let i=()=>{let v=document.querySelector('input[name="db-service-type"]:checked').value,u=document.getElementById("db-app-user"),c=document.getElementById("db-app-password");if(v==="docker"){let h=document.getElementById("db-super-user").value,f=document.getElementById("db-app-user").value,w=document.getElementById("db-super-password").value,I=document.getElementById("db-app-password").value;if(h===f&&h!==""&&f!==""){let $=r?r.t("setup.database.username_duplicate_error"):"Application username must be different from super user username";u.setCustomValidity($),S(u,$)}else u.setCustomValidity(""),b(u)}else u.setCustomValidity(""),b(u);if(v==="docker"){let h=document.getElementById("db-super-password").value,f=document.getElementById("db-app-password").value;if(h===f&&h!==""&&f!==""){let w=r?r.t("setup.database.password_duplicate_error"):"Application password must be different from super user password";c.setCustomValidity(w),S(c,w);return}}let g=document.getElementById("db-super-password"),y=document.getElementById("db-super-password").value;if(v==="docker"&&y){let h=C(y),f=r?r.t("setup.database.super_password_error"):"Super password must be 12-64 characters with at least 3 types: lowercase, uppercase, numbers, special characters (!@#$%^&*)";h?(g.setCustomValidity(""),b(g)):(g.setCustomValidity(f),S(g,f))}else(y===""||v!=="docker")&&(g.setCustomValidity(""),b(g));let _=document.getElementById("db-app-password").value;if(_){let h=!0,f="";v==="docker"?(h=C(_),f=r?r.t("setup.database.app_password_error"):"App password must be 12-64 characters with at least 3 types: lowercase, uppercase, numbers, special characters (!@#$%^&*)"):(h=L(_),f=r?r.t("setup.database.app_password_external_error"):"App password must be 1-128 characters and cannot contain control characters"),h?(c.setCustomValidity(""),b(c)):(c.setCustomValidity(f),S(c,f))}else _===""&&(c.setCustomValidity(""),b(c))},l=document.getElementById("db-super-password");l&&o.super_password&&(l.value=o.super_password);let p=document.getElementById("db-app-password");p&&o.app_password&&(p.value=o.app_password),["db-super-user","db-app-user","db-super-password","db-app-password"].forEach(v=>{let u=document.getElementById(v);u&&u.addEventListener("input",i)}),document.getElementById("database-form").addEventListener("submit",async v=>{v.preventDefault();let u=document.querySelector('input[name="db-service-type"]:checked').value,c=document.getElementById("db-super-password").value,g=document.getElementById("db-app-password").value,y=document.getElementById("db-super-password"),_=document.getElementById("db-app-password");if(u==="docker")if(c&&!C(c)){let h=r?r.t("setup.database.super_password_error"):"Super password must be 12-64 characters with at least 3 types: lowercase, uppercase, numbers, special characters (!@#$%^&*)";y.setCustomValidity(h)}else y.setCustomValidity("");else y&&y.setCustomValidity("");if(g){let h=!0,f="";u==="docker"?(h=C(g),f=r?r.t("setup.database.app_password_error"):"App password must be 12-64 characters with at least 3 types: lowercase, uppercase, numbers, special characters (!@#$%^&*)"):(h=L(g),f=r?r.t("setup.database.app_password_external_error"):"App password must be 1-128 characters and cannot contain control characters"),h?_.setCustomValidity(""):_.setCustomValidity(f)}else _.setCustomValidity("");if(u==="docker"){let h=document.getElementById("db-super-user").value,f=document.getElementById("db-app-user").value,w=document.getElementById("db-app-user");if(h===f&&h!==""){let I=r?r.t("setup.database.username_duplicate_error"):"Application username must be different from super user username";w.setCustomValidity(I)}else w.setCustomValidity("");if(c===g&&c!==""){let I=r?r.t("setup.database.password_duplicate_error"):"Application password must be different from super user password";_.setCustomValidity(I)}else if(g){let I=!0,$="";u==="docker"?(I=C(g),$=r?r.t("setup.database.app_password_error"):"App password must be 12-64 characters with at least 3 types: lowercase, uppercase, numbers, special characters (!@#$%^&*)"):(I=L(g),$=r?r.t("setup.database.app_password_external_error"):"App password must be 1-128 characters and cannot contain control characters"),I||_.setCustomValidity($)}}else{let h=document.getElementById("db-app-user");h&&h.setCustomValidity("")}if(v.target.checkValidity()){let h=document.querySelector('input[name="db-service-type"]:checked').value;e.set("database",{service_type:h,host:h==="docker"?"localhost":document.getElementById("db-host").value,port:parseInt(document.getElementById("db-port").value),name:document.getElementById("db-name").value,app_user:document.getElementById("db-app-user").value,app_password:document.getElementById("db-app-password").value,super_user:h==="docker"?document.getElementById("db-super-user").value:"",super_password:h==="docker"?document.getElementById("db-super-password").value:""}),e.saveToLocalCache(),await e.saveWithValidation()}else k(v.target)});let m=document.getElementById("db-test-btn");m&&m.addEventListener("click",()=>ye(a,e,s,r)),E(n)}function ae(n,{config:e,navigation:t,ui:s,i18n:a}){let r=e.get("admin_user");n.innerHTML=`
+    `,document.getElementById("db-prev-btn").addEventListener("click",()=>{t.previousStep()}),document.querySelectorAll('input[name="db-service-type"]').forEach(v=>{v.addEventListener("change",u=>{K(u.target.value),s.updateRadioStyles("db-service-type"),setTimeout(()=>i(),10)})}),K(o.service_type),s.updateRadioStyles("db-service-type"),setTimeout(()=>{K(o.service_type)},100);let i=()=>{let v=document.querySelector('input[name="db-service-type"]:checked').value,u=document.getElementById("db-app-user"),c=document.getElementById("db-app-password");if(v==="docker"){let h=document.getElementById("db-super-user").value,f=document.getElementById("db-app-user").value,w=document.getElementById("db-super-password").value,I=document.getElementById("db-app-password").value;if(h===f&&h!==""&&f!==""){let q=r?r.t("setup.database.username_duplicate_error"):"Application username must be different from super user username";u.setCustomValidity(q),S(u,q)}else u.setCustomValidity(""),b(u)}else u.setCustomValidity(""),b(u);if(v==="docker"){let h=document.getElementById("db-super-password").value,f=document.getElementById("db-app-password").value;if(h===f&&h!==""&&f!==""){let w=r?r.t("setup.database.password_duplicate_error"):"Application password must be different from super user password";c.setCustomValidity(w),S(c,w);return}}let g=document.getElementById("db-super-password"),y=document.getElementById("db-super-password").value;if(v==="docker"&&y){let h=C(y),f=r?r.t("setup.database.super_password_error"):"Super password must be 12-64 characters with at least 3 types: lowercase, uppercase, numbers, special characters (!@#$%^&*)";h?(g.setCustomValidity(""),b(g)):(g.setCustomValidity(f),S(g,f))}else(y===""||v!=="docker")&&(g.setCustomValidity(""),b(g));let _=document.getElementById("db-app-password").value;if(_){let h=!0,f="";v==="docker"?(h=C(_),f=r?r.t("setup.database.app_password_error"):"App password must be 12-64 characters with at least 3 types: lowercase, uppercase, numbers, special characters (!@#$%^&*)"):(h=L(_),f=r?r.t("setup.database.app_password_external_error"):"App password must be 1-128 characters and cannot contain control characters"),h?(c.setCustomValidity(""),b(c)):(c.setCustomValidity(f),S(c,f))}else _===""&&(c.setCustomValidity(""),b(c))},l=document.getElementById("db-super-password");l&&o.super_password&&(l.value=o.super_password);let p=document.getElementById("db-app-password");p&&o.app_password&&(p.value=o.app_password),["db-super-user","db-app-user","db-super-password","db-app-password"].forEach(v=>{let u=document.getElementById(v);u&&u.addEventListener("input",i)}),document.getElementById("database-form").addEventListener("submit",async v=>{v.preventDefault();let u=document.querySelector('input[name="db-service-type"]:checked').value,c=document.getElementById("db-super-password").value,g=document.getElementById("db-app-password").value,y=document.getElementById("db-super-password"),_=document.getElementById("db-app-password");if(u==="docker")if(c&&!C(c)){let h=r?r.t("setup.database.super_password_error"):"Super password must be 12-64 characters with at least 3 types: lowercase, uppercase, numbers, special characters (!@#$%^&*)";y.setCustomValidity(h)}else y.setCustomValidity("");else y&&y.setCustomValidity("");if(g){let h=!0,f="";u==="docker"?(h=C(g),f=r?r.t("setup.database.app_password_error"):"App password must be 12-64 characters with at least 3 types: lowercase, uppercase, numbers, special characters (!@#$%^&*)"):(h=L(g),f=r?r.t("setup.database.app_password_external_error"):"App password must be 1-128 characters and cannot contain control characters"),h?_.setCustomValidity(""):_.setCustomValidity(f)}else _.setCustomValidity("");if(u==="docker"){let h=document.getElementById("db-super-user").value,f=document.getElementById("db-app-user").value,w=document.getElementById("db-app-user");if(h===f&&h!==""){let I=r?r.t("setup.database.username_duplicate_error"):"Application username must be different from super user username";w.setCustomValidity(I)}else w.setCustomValidity("");if(c===g&&c!==""){let I=r?r.t("setup.database.password_duplicate_error"):"Application password must be different from super user password";_.setCustomValidity(I)}else if(g){let I=!0,q="";u==="docker"?(I=C(g),q=r?r.t("setup.database.app_password_error"):"App password must be 12-64 characters with at least 3 types: lowercase, uppercase, numbers, special characters (!@#$%^&*)"):(I=L(g),q=r?r.t("setup.database.app_password_external_error"):"App password must be 1-128 characters and cannot contain control characters"),I||_.setCustomValidity(q)}}else{let h=document.getElementById("db-app-user");h&&h.setCustomValidity("")}if(v.target.checkValidity()){let h=document.querySelector('input[name="db-service-type"]:checked').value;e.set("database",{service_type:h,host:h==="docker"?"localhost":document.getElementById("db-host").value,port:parseInt(document.getElementById("db-port").value),name:document.getElementById("db-name").value,app_user:document.getElementById("db-app-user").value,app_password:document.getElementById("db-app-password").value,super_user:h==="docker"?document.getElementById("db-super-user").value:"",super_password:h==="docker"?document.getElementById("db-super-password").value:""}),e.saveToLocalCache(),await e.saveWithValidation()}else E(v.target)});let m=document.getElementById("db-test-btn");m&&m.addEventListener("click",()=>Se(a,e,s,r)),k(n)}function ie(n,{config:e,navigation:t,ui:s,i18n:a}){let r=e.get("admin_user");n.innerHTML=`
             <form id="admin-form" class="form-section" novalidate>
                 <h3 data-i18n="setup.admin.title"></h3>
                 <p style="margin-bottom: 1.5rem; color: var(--gray-600);" data-i18n="setup.admin.description"></p>
@@ -278,7 +278,7 @@ var F=class{constructor(e=null){this.token=null,this.i18n=e,this.requestLocks={i
                     <button type="submit" class="btn btn-primary" data-i18n="common.next"></button>
                 </div>
             </form>
-        `,document.getElementById("admin-prev-btn").addEventListener("click",()=>{t.previousStep()}),document.getElementById("admin-form").addEventListener("submit",async i=>{i.preventDefault();let l=document.getElementById("admin-password").value,p=document.getElementById("admin-password-confirm").value,m=document.getElementById("admin-password-confirm"),v=document.getElementById("admin-password");if(l&&!O(l)){let u=a?a.t("setup.admin.password_error"):"Password must contain lowercase, uppercase, numbers, and special characters (!@#$%^&*)";v.setCustomValidity(u)}else v.setCustomValidity("");if(l!==p){let u=a?a.t("setup.admin.password_confirm_error"):"Passwords must match";m.setCustomValidity(u)}else m.setCustomValidity("");i.target.checkValidity()?(e.set("admin_user",{username:document.getElementById("admin-username").value,email:document.getElementById("admin-email").value,password:document.getElementById("admin-password").value}),e.saveToLocalCache(),await e.saveWithValidation()):k(i.target)});let o=document.getElementById("admin-password"),d=document.getElementById("admin-password-confirm");o&&r.password&&(o.value=r.password),d&&r.password&&(d.value=r.password),o.addEventListener("input",()=>{if(ee(o,o.value,"admin",{i18n:a,showCustomErrorFn:(i,l)=>S(i,l),hideCustomErrorFn:i=>b(i)}),d.value&&o.value!==d.value){let i=a?a.t("setup.admin.password_confirm_error"):"Passwords must match";d.setCustomValidity(i),S(d,i)}else d.setCustomValidity(""),b(d)}),d.addEventListener("input",()=>{let i=o.value,l=d.value;if(l&&i!==l){let p=a?a.t("setup.admin.password_confirm_error"):"Passwords must match";d.setCustomValidity(p),S(d,p)}else d.setCustomValidity(""),b(d)}),E(n)}function re(n,e){let t=document.getElementById("ssl-use-setup-cert"),s=document.getElementById("ssl-enabled");if(!t||!s)return;let a=n.get("app"),r=n.get("ssl");if(a.use_setup_domain&&r.enabled){t.checked=!0,t.readOnly=!0,t.disabled=!0,t.dataset.autoSelected="true";let o=new Event("change");t.dispatchEvent(o),r.use_setup_cert=!0,n.set("ssl",r);let d=t.closest(".checkbox-label");if(d){d.style.opacity="0.7",d.title=e?e.t("setup.ssl.auto_selected_due_to_domain"):"Automatically selected because you are using the setup program domain";let i=d.querySelector(".auto-selection-note");if(!i){i=document.createElement("span"),i.className="auto-selection-note",i.style.cssText="font-size: 0.85em; color: var(--gray-600); margin-left: 0.5rem; font-style: italic; display: inline;";let p=d.querySelector("span");p?p.parentNode.insertBefore(i,p.nextSibling):d.appendChild(i)}let l=e?e.t("setup.ssl.auto_selected_due_to_domain"):"Automatically selected because you are using the setup program domain";i.textContent=` (${l})`}}else!a.use_setup_domain&&t.dataset.autoSelected==="true"&&G(n)}function G(n){let e=document.getElementById("ssl-use-setup-cert");if(e){e.checked=!1,e.readOnly=!1,e.disabled=!1,delete e.dataset.autoSelected;let t=document.getElementById("ssl-cert-path"),s=document.getElementById("ssl-key-path");t&&(t.value="",t.readOnly=!1,t.style.backgroundColor=""),s&&(s.value="",s.readOnly=!1,s.style.backgroundColor="");let a=e.closest(".checkbox-label");if(a){a.style.opacity="",a.title="";let o=a.querySelector(".auto-selection-note");o&&o.remove()}let r=n.get("ssl");r.use_setup_cert=!1,n.set("ssl",r)}}function oe(n,{config:e,navigation:t,apiClient:s,i18n:a}){let r=e.get("ssl"),o=e.get("app");n.innerHTML=`
+        `,document.getElementById("admin-prev-btn").addEventListener("click",()=>{t.previousStep()}),document.getElementById("admin-form").addEventListener("submit",async i=>{i.preventDefault();let l=document.getElementById("admin-password").value,p=document.getElementById("admin-password-confirm").value,m=document.getElementById("admin-password-confirm"),v=document.getElementById("admin-password");if(l&&!Z(l)){let u=a?a.t("setup.admin.password_error"):"Password must contain lowercase, uppercase, numbers, and special characters (!@#$%^&*)";v.setCustomValidity(u)}else v.setCustomValidity("");if(l!==p){let u=a?a.t("setup.admin.password_confirm_error"):"Passwords must match";m.setCustomValidity(u)}else m.setCustomValidity("");i.target.checkValidity()?(e.set("admin_user",{username:document.getElementById("admin-username").value,email:document.getElementById("admin-email").value,password:document.getElementById("admin-password").value}),e.saveToLocalCache(),await e.saveWithValidation()):E(i.target)});let o=document.getElementById("admin-password"),d=document.getElementById("admin-password-confirm");o&&r.password&&(o.value=r.password),d&&r.password&&(d.value=r.password),o.addEventListener("input",()=>{if(re(o,o.value,"admin",{i18n:a,showCustomErrorFn:(i,l)=>S(i,l),hideCustomErrorFn:i=>b(i)}),d.value&&o.value!==d.value){let i=a?a.t("setup.admin.password_confirm_error"):"Passwords must match";d.setCustomValidity(i),S(d,i)}else d.setCustomValidity(""),b(d)}),d.addEventListener("input",()=>{let i=o.value,l=d.value;if(l&&i!==l){let p=a?a.t("setup.admin.password_confirm_error"):"Passwords must match";d.setCustomValidity(p),S(d,p)}else d.setCustomValidity(""),b(d)}),k(n)}function de(n,e){let t=document.getElementById("ssl-use-setup-cert"),s=document.getElementById("ssl-enabled");if(!t||!s)return;let a=n.get("app"),r=n.get("ssl");if(a.use_setup_domain&&r.enabled){t.checked=!0,t.readOnly=!0,t.disabled=!0,t.dataset.autoSelected="true";let o=new Event("change");t.dispatchEvent(o),r.use_setup_cert=!0,n.set("ssl",r);let d=t.closest(".checkbox-label");if(d){d.style.opacity="0.7",d.title=e?e.t("setup.ssl.auto_selected_due_to_domain"):"Automatically selected because you are using the setup program domain";let i=d.querySelector(".auto-selection-note");if(!i){i=document.createElement("span"),i.className="auto-selection-note",i.style.cssText="font-size: 0.85em; color: var(--gray-600); margin-left: 0.5rem; font-style: italic; display: inline;";let p=d.querySelector("span");p?p.parentNode.insertBefore(i,p.nextSibling):d.appendChild(i)}let l=e?e.t("setup.ssl.auto_selected_due_to_domain"):"Automatically selected because you are using the setup program domain";i.textContent=` (${l})`}}else!a.use_setup_domain&&t.dataset.autoSelected==="true"&&G(n)}function G(n){let e=document.getElementById("ssl-use-setup-cert");if(e){e.checked=!1,e.readOnly=!1,e.disabled=!1,delete e.dataset.autoSelected;let t=document.getElementById("ssl-cert-path"),s=document.getElementById("ssl-key-path");t&&(t.value="",t.readOnly=!1,t.style.backgroundColor=""),s&&(s.value="",s.readOnly=!1,s.style.backgroundColor="");let a=e.closest(".checkbox-label");if(a){a.style.opacity="",a.title="";let o=a.querySelector(".auto-selection-note");o&&o.remove()}let r=n.get("ssl");r.use_setup_cert=!1,n.set("ssl",r)}}function le(n,{config:e,navigation:t,apiClient:s,i18n:a}){let r=e.get("ssl"),o=e.get("app");n.innerHTML=`
             <form id="ssl-form" class="form-section" novalidate>
                 <h3 data-i18n="setup.ssl.title"></h3>
                 <p style="margin-bottom: 1.5rem; color: var(--gray-600);" data-i18n="setup.ssl.description"></p>
@@ -325,7 +325,7 @@ var F=class{constructor(e=null){this.token=null,this.i18n=e,this.requestLocks={i
                     <button type="submit" class="btn btn-primary" data-i18n="common.next"></button>
                 </div>
             </form>
-        `,document.getElementById("ssl-prev-btn").addEventListener("click",()=>{t.previousStep()}),document.getElementById("ssl-enabled").addEventListener("change",d=>{let i=document.getElementById("ssl-config"),l=document.getElementById("ssl-cert-path"),p=document.getElementById("ssl-key-path");if(d.target.checked){i.style.display="block",l.required=!0,p.required=!0;let m=e.get("ssl");m.enabled=!0,e.set("ssl",m),setTimeout(()=>re(e,a),0)}else{i.style.display="none",l.required=!1,p.required=!1,B(document.getElementById("ssl-form"));let m=e.get("ssl");m.enabled=!1,e.set("ssl",m),G(e)}}),document.getElementById("ssl-use-setup-cert").addEventListener("change",async d=>{let i=document.getElementById("ssl-cert-path"),l=document.getElementById("ssl-key-path");if(d.target.checked)try{let p=await s.getCurrentCertPaths();p.data&&(i.value=p.data.cert_path,l.value=p.data.key_path,i.readOnly=!0,l.readOnly=!0)}catch(p){console.error("Failed to get current cert paths:",p),d.target.checked=!1}else i.readOnly=!1,l.readOnly=!1}),re(e,a),document.getElementById("ssl-form").addEventListener("submit",async d=>{d.preventDefault();let i=new FormData(d.target),l={enabled:i.get("enabled")==="on",cert_path:i.get("cert_path")||"",key_path:i.get("key_path")||"",use_setup_cert:i.get("use_setup_cert")==="on"},p=!0;if(B(document.getElementById("ssl-form")),l.enabled){if(l.cert_path.trim()){if(!l.cert_path.startsWith("/")){let m=a?a.t("setup.ssl.cert_path_must_be_absolute"):"Certificate path must be an absolute path (starting with /)";q(document.getElementById("ssl-cert-path"),m),p=!1}}else{let m=a?a.t("setup.ssl.cert_path_required"):"Certificate path is required when SSL is enabled";q(document.getElementById("ssl-cert-path"),m),p=!1}if(l.key_path.trim()){if(!l.key_path.startsWith("/")){let m=a?a.t("setup.ssl.key_path_must_be_absolute"):"Private key path must be an absolute path (starting with /)";q(document.getElementById("ssl-key-path"),m),p=!1}}else{let m=a?a.t("setup.ssl.key_path_required"):"Private key path is required when SSL is enabled";q(document.getElementById("ssl-key-path"),m),p=!1}}p&&(e.set("ssl",l),await e.save(),t.nextStep())}),E(n)}function Ce(){let n=document.querySelector('input[name="jwt_method"]:checked')?.value,e=document.getElementById("jwt-auto-config"),t=document.getElementById("jwt-path-config"),s=document.getElementById("jwt-key-path");s&&s.setCustomValidity(""),n==="auto"?(e&&(e.style.display="block"),t&&(t.style.display="none"),s&&(s.required=!1)):n==="path"&&(e&&(e.style.display="none"),t&&(t.style.display="block"),s&&(s.required=!0))}function ne(n,{config:e,navigation:t,ui:s,apiClient:a,i18n:r}){let o=e.get("app");n.innerHTML=`
+        `,document.getElementById("ssl-prev-btn").addEventListener("click",()=>{t.previousStep()}),document.getElementById("ssl-enabled").addEventListener("change",d=>{let i=document.getElementById("ssl-config"),l=document.getElementById("ssl-cert-path"),p=document.getElementById("ssl-key-path");if(d.target.checked){i.style.display="block",l.required=!0,p.required=!0;let m=e.get("ssl");m.enabled=!0,e.set("ssl",m),setTimeout(()=>de(e,a),0)}else{i.style.display="none",l.required=!1,p.required=!1,B(document.getElementById("ssl-form"));let m=e.get("ssl");m.enabled=!1,e.set("ssl",m),G(e)}}),document.getElementById("ssl-use-setup-cert").addEventListener("change",async d=>{let i=document.getElementById("ssl-cert-path"),l=document.getElementById("ssl-key-path");if(d.target.checked)try{let p=await s.getCurrentCertPaths();p.data&&(i.value=p.data.cert_path,l.value=p.data.key_path,i.readOnly=!0,l.readOnly=!0)}catch(p){console.error("Failed to get current cert paths:",p),d.target.checked=!1}else i.readOnly=!1,l.readOnly=!1}),de(e,a),document.getElementById("ssl-form").addEventListener("submit",async d=>{d.preventDefault();let i=new FormData(d.target),l={enabled:i.get("enabled")==="on",cert_path:i.get("cert_path")||"",key_path:i.get("key_path")||"",use_setup_cert:i.get("use_setup_cert")==="on"},p=!0;if(B(document.getElementById("ssl-form")),l.enabled){if(l.cert_path.trim()){if(!l.cert_path.startsWith("/")){let m=a?a.t("setup.ssl.cert_path_must_be_absolute"):"Certificate path must be an absolute path (starting with /)";$(document.getElementById("ssl-cert-path"),m),p=!1}}else{let m=a?a.t("setup.ssl.cert_path_required"):"Certificate path is required when SSL is enabled";$(document.getElementById("ssl-cert-path"),m),p=!1}if(l.key_path.trim()){if(!l.key_path.startsWith("/")){let m=a?a.t("setup.ssl.key_path_must_be_absolute"):"Private key path must be an absolute path (starting with /)";$(document.getElementById("ssl-key-path"),m),p=!1}}else{let m=a?a.t("setup.ssl.key_path_required"):"Private key path is required when SSL is enabled";$(document.getElementById("ssl-key-path"),m),p=!1}}p&&(e.set("ssl",l),await e.save(),t.nextStep())}),k(n)}function $e(){let n=document.querySelector('input[name="jwt_method"]:checked')?.value,e=document.getElementById("jwt-auto-config"),t=document.getElementById("jwt-path-config"),s=document.getElementById("jwt-key-path");s&&s.setCustomValidity(""),n==="auto"?(e&&(e.style.display="block"),t&&(t.style.display="none"),s&&(s.required=!1)):n==="path"&&(e&&(e.style.display="none"),t&&(t.style.display="block"),s&&(s.required=!0))}function pe(n,{config:e,navigation:t,ui:s,apiClient:a,i18n:r}){let o=e.get("app");n.innerHTML=`
             <form id="app-form" class="form-section" novalidate>
                 <h3 data-i18n="setup.app.title"></h3>
                 <p style="margin-bottom: 1.5rem; color: var(--gray-600);" data-i18n="setup.app.description"></p>
@@ -530,7 +530,7 @@ var F=class{constructor(e=null){this.token=null,this.i18n=e,this.requestLocks={i
                     <button type="submit" class="btn btn-primary" data-i18n="common.next"></button>
                 </div>
             </form>
-        `,document.getElementById("app-prev-btn").addEventListener("click",()=>{t.previousStep()}),document.getElementById("app-form").addEventListener("submit",async i=>{if(i.preventDefault(),i.target.checkValidity()){let l=document.getElementById("app-cors").value.trim(),p=l?l.split("\\n").map(c=>c.trim()).filter(c=>c):[],m=document.querySelector('input[name="jwt_method"]:checked')?.value||"auto",v=!1,u="";if(m==="path"&&(v=!0,u=document.getElementById("jwt-key-path").value.trim(),!u)){let c=document.getElementById("jwt-key-path");c.setCustomValidity(r?r.t("setup.app.jwt_path_required"):"JWT key file path is required"),c.reportValidity();return}e.update({app:{...o,domain_name:document.getElementById("app-domain").value,static_host_name:document.getElementById("app-static-host").value,user_guide_host_name:document.getElementById("app-user-guide-host").value.trim(),brand_name:document.getElementById("app-brand").value,version:document.getElementById("app-version").value,cors_allow_origins:p,default_lang:document.getElementById("app-lang").value,debug:document.getElementById("app-debug").checked,jwt_key_from_file:v,jwt_key_file_path:u,use_setup_domain:document.getElementById("use-setup-domain").checked,frontend_decoupled:document.getElementById("frontend-decoupled").checked},reverse_proxy:{type:document.getElementById("reverse-proxy-type").value}}),e.saveToLocalCache(),await e.saveWithValidation()}else k(i.target)}),Ce(),s.updateRadioStyles("jwt_method"),document.getElementById("jwt-key-path").addEventListener("input",i=>{i.target.setCustomValidity("")}),document.getElementById("use-setup-domain").addEventListener("change",i=>{let l=document.getElementById("app-domain");if(i.target.checked){let m=window.location.hostname;l.value=m,l.readOnly=!0,l.style.backgroundColor="#f8f9fa";let v=e.get("ssl");v&&v.enabled&&(v.use_setup_cert=!0,e.set("ssl",v))}else{l.readOnly=!1,l.style.backgroundColor="";let m=e.get("ssl");m&&(m.use_setup_cert=!1,e.set("ssl",m)),G(e)}let p=e.get("app");p.use_setup_domain=i.target.checked,e.set("app",p),e.saveToLocalCache()});let d=document.getElementById("use-setup-domain");if(o.use_setup_domain){let i=document.getElementById("app-domain"),l=window.location.hostname;i.value=l,i.readOnly=!0,i.style.backgroundColor="#f8f9fa"}E(n)}function ie(){let n=document.getElementById("google-enabled").checked,e=document.getElementById("github-enabled").checked,t=document.getElementById("frontend-origin-section");t&&(t.style.display=n||e?"block":"none")}function de(n,{config:e,navigation:t}){let s=e.get("oauth"),a=e.get("app"),r=e.get("ssl");n.innerHTML=`
+        `,document.getElementById("app-prev-btn").addEventListener("click",()=>{t.previousStep()}),document.getElementById("app-form").addEventListener("submit",async i=>{if(i.preventDefault(),i.target.checkValidity()){let l=document.getElementById("app-cors").value.trim(),p=l?l.split("\\n").map(c=>c.trim()).filter(c=>c):[],m=document.querySelector('input[name="jwt_method"]:checked')?.value||"auto",v=!1,u="";if(m==="path"&&(v=!0,u=document.getElementById("jwt-key-path").value.trim(),!u)){let c=document.getElementById("jwt-key-path");c.setCustomValidity(r?r.t("setup.app.jwt_path_required"):"JWT key file path is required"),c.reportValidity();return}e.update({app:{...o,domain_name:document.getElementById("app-domain").value,static_host_name:document.getElementById("app-static-host").value,user_guide_host_name:document.getElementById("app-user-guide-host").value.trim(),brand_name:document.getElementById("app-brand").value,version:document.getElementById("app-version").value,cors_allow_origins:p,default_lang:document.getElementById("app-lang").value,debug:document.getElementById("app-debug").checked,jwt_key_from_file:v,jwt_key_file_path:u,use_setup_domain:document.getElementById("use-setup-domain").checked,frontend_decoupled:document.getElementById("frontend-decoupled").checked},reverse_proxy:{type:document.getElementById("reverse-proxy-type").value}}),e.saveToLocalCache(),await e.saveWithValidation()}else E(i.target)}),$e(),s.updateRadioStyles("jwt_method"),document.getElementById("jwt-key-path").addEventListener("input",i=>{i.target.setCustomValidity("")}),document.getElementById("use-setup-domain").addEventListener("change",i=>{let l=document.getElementById("app-domain");if(i.target.checked){let m=window.location.hostname;l.value=m,l.readOnly=!0,l.style.backgroundColor="#f8f9fa";let v=e.get("ssl");v&&v.enabled&&(v.use_setup_cert=!0,e.set("ssl",v))}else{l.readOnly=!1,l.style.backgroundColor="";let m=e.get("ssl");m&&(m.use_setup_cert=!1,e.set("ssl",m)),G(e)}let p=e.get("app");p.use_setup_domain=i.target.checked,e.set("app",p),e.saveToLocalCache()});let d=document.getElementById("use-setup-domain");if(o.use_setup_domain){let i=document.getElementById("app-domain"),l=window.location.hostname;i.value=l,i.readOnly=!0,i.style.backgroundColor="#f8f9fa"}k(n)}function ce(){let n=document.getElementById("google-enabled").checked,e=document.getElementById("github-enabled").checked,t=document.getElementById("frontend-origin-section");t&&(t.style.display=n||e?"block":"none")}function ue(n,{config:e,navigation:t}){let s=e.get("oauth"),a=e.get("app"),r=e.get("ssl");n.innerHTML=`
             <form id="oauth-form" class="form-section" novalidate>
                 <h3 data-i18n="setup.oauth.title"></h3>
                 <p style="margin-bottom: 1.5rem; color: var(--gray-600);" data-i18n="setup.oauth.description"></p>
@@ -647,7 +647,7 @@ var F=class{constructor(e=null){this.token=null,this.i18n=e,this.requestLocks={i
                     <button type="submit" class="btn btn-primary" data-i18n="common.next"></button>
                 </div>
             </form>
-        `,document.getElementById("google-enabled").addEventListener("change",i=>{let l=document.getElementById("google-config"),p=document.getElementById("google-client-id"),m=document.getElementById("google-client-secret");i.target.checked?(l.style.display="block",p.required=!0,m.required=!0):(l.style.display="none",p.required=!1,m.required=!1,B(document.getElementById("oauth-form"))),ie()}),document.getElementById("github-enabled").addEventListener("change",i=>{let l=document.getElementById("github-config"),p=document.getElementById("github-client-id"),m=document.getElementById("github-client-secret");i.target.checked?(l.style.display="block",p.required=!0,m.required=!0):(l.style.display="none",p.required=!1,m.required=!1,B(document.getElementById("oauth-form"))),ie()}),document.getElementById("oauth-prev-btn").addEventListener("click",()=>{t.previousStep()});let o=document.getElementById("google-client-secret");o&&s.google_client_secret&&(o.value=s.google_client_secret);let d=document.getElementById("github-client-secret");d&&s.github_client_secret&&(d.value=s.github_client_secret),document.getElementById("oauth-form").addEventListener("submit",async i=>{i.preventDefault(),i.target.checkValidity()?(e.set("oauth",{google_enabled:document.getElementById("google-enabled").checked,google_client_id:document.getElementById("google-client-id").value.trim(),google_client_secret:document.getElementById("google-client-secret").value.trim(),github_enabled:document.getElementById("github-enabled").checked,github_client_id:document.getElementById("github-client-id").value.trim(),github_client_secret:document.getElementById("github-client-secret").value.trim(),frontend_origin:document.getElementById("frontend-origin").value.trim()}),e.saveToLocalCache(),await e.saveWithValidation()):k(i.target)}),E(n)}async function Ie(n,e,t,s){await n.protectedApiCall("testRedis",async()=>{let a={...e.getAll()};a.redis={service_type:document.querySelector('input[name="redis-service-type"]:checked').value,host:document.getElementById("redis-host").value,port:parseInt(document.getElementById("redis-port").value),user:document.getElementById("redis-user")?document.getElementById("redis-user").value:"",password:document.getElementById("redis-password").value};let r=document.getElementById("redis-test-btn"),o=r.textContent;r.disabled=!0,r.textContent=s?s.t("common.testing"):"Testing...";try{let d=await n.testConnections("redis",a);Le(d.data,"redis")}catch(d){t.showAlert("error",s?s.t("messages.errors.failed_test_connections",{error:d.message}):"Connection test failed: "+d.message)}finally{r.disabled=!1,r.textContent=o}},a=>{a.validationErrors&&a.validationErrors.length>0?x(a.validationErrors,s):t.showAlert("error",a.message)})}function Le(n,e){let s=document.getElementById("redis-connection-results");if(s){let a=n.filter(r=>r.service===e);s.innerHTML=a.length>0?`
+        `,document.getElementById("google-enabled").addEventListener("change",i=>{let l=document.getElementById("google-config"),p=document.getElementById("google-client-id"),m=document.getElementById("google-client-secret");i.target.checked?(l.style.display="block",p.required=!0,m.required=!0):(l.style.display="none",p.required=!1,m.required=!1,B(document.getElementById("oauth-form"))),ce()}),document.getElementById("github-enabled").addEventListener("change",i=>{let l=document.getElementById("github-config"),p=document.getElementById("github-client-id"),m=document.getElementById("github-client-secret");i.target.checked?(l.style.display="block",p.required=!0,m.required=!0):(l.style.display="none",p.required=!1,m.required=!1,B(document.getElementById("oauth-form"))),ce()}),document.getElementById("oauth-prev-btn").addEventListener("click",()=>{t.previousStep()});let o=document.getElementById("google-client-secret");o&&s.google_client_secret&&(o.value=s.google_client_secret);let d=document.getElementById("github-client-secret");d&&s.github_client_secret&&(d.value=s.github_client_secret),document.getElementById("oauth-form").addEventListener("submit",async i=>{i.preventDefault(),i.target.checkValidity()?(e.set("oauth",{google_enabled:document.getElementById("google-enabled").checked,google_client_id:document.getElementById("google-client-id").value.trim(),google_client_secret:document.getElementById("google-client-secret").value.trim(),github_enabled:document.getElementById("github-enabled").checked,github_client_id:document.getElementById("github-client-id").value.trim(),github_client_secret:document.getElementById("github-client-secret").value.trim(),frontend_origin:document.getElementById("frontend-origin").value.trim()}),e.saveToLocalCache(),await e.saveWithValidation()):E(i.target)}),k(n)}async function Te(n,e,t,s){await n.protectedApiCall("testRedis",async()=>{let a={...e.getAll()};a.redis={service_type:document.querySelector('input[name="redis-service-type"]:checked').value,host:document.getElementById("redis-host").value,port:parseInt(document.getElementById("redis-port").value),user:document.getElementById("redis-user")?document.getElementById("redis-user").value:"",password:document.getElementById("redis-password").value};let r=document.getElementById("redis-test-btn"),o=r.textContent;r.disabled=!0,r.textContent=s?s.t("common.testing"):"Testing...";try{let d=await n.testConnections("redis",a);Fe(d.data,"redis")}catch(d){t.showAlert("error",s?s.t("messages.errors.failed_test_connections",{error:d.message}):"Connection test failed: "+d.message)}finally{r.disabled=!1,r.textContent=o}},a=>{a.validationErrors&&a.validationErrors.length>0?x(a.validationErrors,s):t.showAlert("error",a.message)})}function Fe(n,e){let s=document.getElementById("redis-connection-results");if(s){let a=n.filter(r=>r.service===e);s.innerHTML=a.length>0?`
             <div class="connection-results">
                 ${a.map(r=>`
                     <div class="connection-result ${r.success?"success":"error"}">
@@ -660,7 +660,7 @@ var F=class{constructor(e=null){this.token=null,this.i18n=e,this.requestLocks={i
                     </div>
                 `).join("")}
             </div>
-        `:""}}function A(n,e){let t=document.getElementById(n);if(t){let s=t.closest(".form-group");if(s){let a=s.querySelector(".form-help");a&&(a.style.display=e?"block":"none")}}}function Z(n){let e=document.getElementById("redis-host"),t=document.getElementById("redis-test-connection-container"),s=document.getElementById("redis-password"),a=document.getElementById("redis-user"),r=document.getElementById("redis-admin-config"),o=document.getElementById("redis-admin-password"),d=document.getElementById("redis-form");if(n==="docker"){if(e.value="localhost",e.readOnly=!0,e.style.backgroundColor="var(--gray-100)",t&&(t.style.display="none"),r&&(r.style.display="block"),o&&(o.required=!0,o.disabled=!1),a){a.required=!0;let i=document.getElementById("redis-user-required-indicator");i&&(i.textContent="*",i.setAttribute("data-i18n","common.required"))}s&&(s.minLength=12,s.maxLength=64,s.pattern="^[A-Za-z\\d!@#$%^&*]{12,64}$"),A("redis-password",!0),A("redis-user",!0),A("redis-admin-password",!0),s&&(s.setCustomValidity(""),b(s)),a&&(a.setCustomValidity(""),b(a)),o&&(o.setCustomValidity(""),b(o))}else e.readOnly=!1,e.style.backgroundColor="",t&&(t.style.display="block"),r&&(r.style.display="none"),o&&(o.required=!1,o.disabled=!0),a&&(a.required=!1,a.placeholder=""),s&&(s.minLength=1,s.maxLength=128,s.pattern="",s.removeAttribute("pattern")),A("redis-password",!1),A("redis-user",!1),A("redis-admin-password",!1),s&&(s.setCustomValidity(""),b(s)),a&&(a.setCustomValidity(""),b(a)),o&&(o.setCustomValidity(""),b(o));d&&(d.noValidate=!0,setTimeout(()=>{d.noValidate=!1},10))}function le(n,{config:e,navigation:t,ui:s,apiClient:a,i18n:r}){let o=e.get("redis");n.innerHTML=`
+        `:""}}function A(n,e){let t=document.getElementById(n);if(t){let s=t.closest(".form-group");if(s){let a=s.querySelector(".form-help");a&&(a.style.display=e?"block":"none")}}}function W(n){let e=document.getElementById("redis-host"),t=document.getElementById("redis-test-connection-container"),s=document.getElementById("redis-password"),a=document.getElementById("redis-user"),r=document.getElementById("redis-admin-config"),o=document.getElementById("redis-admin-password"),d=document.getElementById("redis-form");if(n==="docker"){if(e.value="localhost",e.readOnly=!0,e.style.backgroundColor="var(--gray-100)",t&&(t.style.display="none"),r&&(r.style.display="block"),o&&(o.required=!0,o.disabled=!1),a){a.required=!0;let i=document.getElementById("redis-user-required-indicator");i&&(i.textContent="*",i.setAttribute("data-i18n","common.required"))}s&&(s.minLength=12,s.maxLength=64,s.pattern="^[A-Za-z\\d!@#$%^&*]{12,64}$"),A("redis-password",!0),A("redis-user",!0),A("redis-admin-password",!0),s&&(s.setCustomValidity(""),b(s)),a&&(a.setCustomValidity(""),b(a)),o&&(o.setCustomValidity(""),b(o))}else e.readOnly=!1,e.style.backgroundColor="",t&&(t.style.display="block"),r&&(r.style.display="none"),o&&(o.required=!1,o.disabled=!0),a&&(a.required=!1,a.placeholder=""),s&&(s.minLength=1,s.maxLength=128,s.pattern="",s.removeAttribute("pattern")),A("redis-password",!1),A("redis-user",!1),A("redis-admin-password",!1),s&&(s.setCustomValidity(""),b(s)),a&&(a.setCustomValidity(""),b(a)),o&&(o.setCustomValidity(""),b(o));d&&(d.noValidate=!0,setTimeout(()=>{d.noValidate=!1},10))}function me(n,{config:e,navigation:t,ui:s,apiClient:a,i18n:r}){let o=e.get("redis");n.innerHTML=`
             <form id="redis-form" class="form-section" novalidate>
                 <h3 data-i18n="setup.redis.title"></h3>
                 <p style="margin-bottom: 1.5rem; color: var(--gray-600);" data-i18n="setup.redis.description"></p>
@@ -779,7 +779,7 @@ var F=class{constructor(e=null){this.token=null,this.i18n=e,this.requestLocks={i
                     <button type="submit" class="btn btn-primary" data-i18n="common.next"></button>
                 </div>
             </form>
-        `,document.getElementById("redis-prev-btn").addEventListener("click",()=>{t.previousStep()});let d=document.querySelectorAll('input[name="redis-service-type"]');d.forEach(c=>{c.addEventListener("change",g=>{Z(g.target.value),s.updateRadioStyles("redis-service-type")})}),Z(o.service_type),s.updateRadioStyles("redis-service-type");let i=document.getElementById("redis-password");i&&o.password&&(i.value=o.password);let l=document.getElementById("redis-admin-password");l&&o.admin_password&&(l.value=o.admin_password),setTimeout(()=>{Z(o.service_type)},100);let p=()=>{let c=document.querySelector('input[name="redis-service-type"]:checked').value,g=document.getElementById("redis-password"),y=document.getElementById("redis-admin-password"),_=g.value;if(_){let h=!0,f="";c==="docker"?(h=C(_),f=r?r.t("setup.redis.password_error"):"Password must be 12-64 characters with at least 3 types: lowercase, uppercase, numbers, special characters (!@#$%^&*)"):(h=L(_),f=r?r.t("setup.redis.password_external_error"):"Password must be 1-128 characters and cannot contain control characters"),h?(g.setCustomValidity(""),b(g)):(g.setCustomValidity(f),S(g,f))}else g.setCustomValidity(""),b(g);if(c==="docker"&&y){let h=y.value;if(h){let f=C(h),w=r?r.t("setup.redis.admin_password_error"):"CLI password must be 12-64 characters with at least 3 types: lowercase, uppercase, numbers, special characters (!@#$%^&*)";f?(y.setCustomValidity(""),b(y)):(y.setCustomValidity(w),S(y,w))}else y.setCustomValidity(""),b(y)}else y&&(y.setCustomValidity(""),b(y))},m=document.getElementById("redis-password"),v=document.getElementById("redis-admin-password");m&&m.addEventListener("input",p.bind(this)),v&&v.addEventListener("input",p.bind(this)),d.forEach(c=>{c.addEventListener("change",()=>{setTimeout(()=>p.bind(this)(),10)})}),document.getElementById("redis-form").addEventListener("submit",async c=>{c.preventDefault();let g=document.querySelector('input[name="redis-service-type"]:checked').value,y=document.getElementById("redis-password").value,_=document.getElementById("redis-password");if(y){let f=!0,w="";g==="docker"?(f=C(y),w=r?r.t("setup.redis.password_error"):"Password must be 12-64 characters with at least 3 types: lowercase, uppercase, numbers, special characters (!@#$%^&*)"):(f=L(y),w=r?r.t("setup.redis.password_external_error"):"Password must be 1-128 characters and cannot contain control characters"),f?_.setCustomValidity(""):_.setCustomValidity(w)}else _.setCustomValidity("");let h=document.getElementById("redis-admin-password");if(g==="docker"){let f=h?h.value:"";if(f)if(C(f))h.setCustomValidity("");else{let I=r?r.t("setup.redis.admin_password_error"):"CLI password must be 12-64 characters with at least 3 types: lowercase, uppercase, numbers, special characters (!@#$%^&*)";h.setCustomValidity(I)}else h&&h.setCustomValidity("")}else h&&h.setCustomValidity("");if(c.target.checkValidity()){let f=document.querySelector('input[name="redis-service-type"]:checked').value,w={service_type:f,host:f==="docker"?"localhost":document.getElementById("redis-host").value,port:parseInt(document.getElementById("redis-port").value),user:document.getElementById("redis-user")?document.getElementById("redis-user").value:"",password:document.getElementById("redis-password").value};f==="docker"?w.admin_password=document.getElementById("redis-admin-password").value:w.admin_password="",e.set("redis",w),e.saveToLocalCache(),await e.saveWithValidation()}else k(c.target)});let u=document.getElementById("redis-test-btn");u&&u.addEventListener("click",()=>Ie(a,e,s,r)),E(n)}async function qe(n,e,t,s){await n.protectedApiCall("testSMTP",async()=>{let a={...e.getAll()};a.smtp={server:document.getElementById("smtp-server").value,port:parseInt(document.getElementById("smtp-port").value),user:document.getElementById("smtp-user").value,password:document.getElementById("smtp-password").value,sender:document.getElementById("smtp-sender").value};let r=document.getElementById("smtp-test-btn"),o=r.textContent;r.disabled=!0,r.textContent=s?s.t("common.testing"):"Testing...";try{let d=await n.testConnections("smtp",a);$e(d.data,"smtp")}catch(d){t.showAlert("error",s?s.t("messages.errors.failed_test_connections",{error:d.message}):"Connection test failed: "+d.message)}finally{r.disabled=!1,r.textContent=o}},a=>{a.validationErrors&&a.validationErrors.length>0?x(a.validationErrors,s):t.showAlert("error",a.message)})}function $e(n,e){let s=document.getElementById("smtp-connection-results");if(s){let a=n.filter(r=>r.service===e);s.innerHTML=a.length>0?`
+        `,document.getElementById("redis-prev-btn").addEventListener("click",()=>{t.previousStep()});let d=document.querySelectorAll('input[name="redis-service-type"]');d.forEach(c=>{c.addEventListener("change",g=>{W(g.target.value),s.updateRadioStyles("redis-service-type")})}),W(o.service_type),s.updateRadioStyles("redis-service-type");let i=document.getElementById("redis-password");i&&o.password&&(i.value=o.password);let l=document.getElementById("redis-admin-password");l&&o.admin_password&&(l.value=o.admin_password),setTimeout(()=>{W(o.service_type)},100);let p=()=>{let c=document.querySelector('input[name="redis-service-type"]:checked').value,g=document.getElementById("redis-password"),y=document.getElementById("redis-admin-password"),_=g.value;if(_){let h=!0,f="";c==="docker"?(h=C(_),f=r?r.t("setup.redis.password_error"):"Password must be 12-64 characters with at least 3 types: lowercase, uppercase, numbers, special characters (!@#$%^&*)"):(h=L(_),f=r?r.t("setup.redis.password_external_error"):"Password must be 1-128 characters and cannot contain control characters"),h?(g.setCustomValidity(""),b(g)):(g.setCustomValidity(f),S(g,f))}else g.setCustomValidity(""),b(g);if(c==="docker"&&y){let h=y.value;if(h){let f=C(h),w=r?r.t("setup.redis.admin_password_error"):"CLI password must be 12-64 characters with at least 3 types: lowercase, uppercase, numbers, special characters (!@#$%^&*)";f?(y.setCustomValidity(""),b(y)):(y.setCustomValidity(w),S(y,w))}else y.setCustomValidity(""),b(y)}else y&&(y.setCustomValidity(""),b(y))},m=document.getElementById("redis-password"),v=document.getElementById("redis-admin-password");m&&m.addEventListener("input",p.bind(this)),v&&v.addEventListener("input",p.bind(this)),d.forEach(c=>{c.addEventListener("change",()=>{setTimeout(()=>p.bind(this)(),10)})}),document.getElementById("redis-form").addEventListener("submit",async c=>{c.preventDefault();let g=document.querySelector('input[name="redis-service-type"]:checked').value,y=document.getElementById("redis-password").value,_=document.getElementById("redis-password");if(y){let f=!0,w="";g==="docker"?(f=C(y),w=r?r.t("setup.redis.password_error"):"Password must be 12-64 characters with at least 3 types: lowercase, uppercase, numbers, special characters (!@#$%^&*)"):(f=L(y),w=r?r.t("setup.redis.password_external_error"):"Password must be 1-128 characters and cannot contain control characters"),f?_.setCustomValidity(""):_.setCustomValidity(w)}else _.setCustomValidity("");let h=document.getElementById("redis-admin-password");if(g==="docker"){let f=h?h.value:"";if(f)if(C(f))h.setCustomValidity("");else{let I=r?r.t("setup.redis.admin_password_error"):"CLI password must be 12-64 characters with at least 3 types: lowercase, uppercase, numbers, special characters (!@#$%^&*)";h.setCustomValidity(I)}else h&&h.setCustomValidity("")}else h&&h.setCustomValidity("");if(c.target.checkValidity()){let f=document.querySelector('input[name="redis-service-type"]:checked').value,w={service_type:f,host:f==="docker"?"localhost":document.getElementById("redis-host").value,port:parseInt(document.getElementById("redis-port").value),user:document.getElementById("redis-user")?document.getElementById("redis-user").value:"",password:document.getElementById("redis-password").value};f==="docker"?w.admin_password=document.getElementById("redis-admin-password").value:w.admin_password="",e.set("redis",w),e.saveToLocalCache(),await e.saveWithValidation()}else E(c.target)});let u=document.getElementById("redis-test-btn");u&&u.addEventListener("click",()=>Te(a,e,s,r)),k(n)}async function ze(n,e,t,s){await n.protectedApiCall("testSMTP",async()=>{let a={...e.getAll()};a.smtp={server:document.getElementById("smtp-server").value,port:parseInt(document.getElementById("smtp-port").value),user:document.getElementById("smtp-user").value,password:document.getElementById("smtp-password").value,sender:document.getElementById("smtp-sender").value};let r=document.getElementById("smtp-test-btn"),o=r.textContent;r.disabled=!0,r.textContent=s?s.t("common.testing"):"Testing...";try{let d=await n.testConnections("smtp",a);Pe(d.data,"smtp")}catch(d){t.showAlert("error",s?s.t("messages.errors.failed_test_connections",{error:d.message}):"Connection test failed: "+d.message)}finally{r.disabled=!1,r.textContent=o}},a=>{a.validationErrors&&a.validationErrors.length>0?x(a.validationErrors,s):t.showAlert("error",a.message)})}function Pe(n,e){let s=document.getElementById("smtp-connection-results");if(s){let a=n.filter(r=>r.service===e);s.innerHTML=a.length>0?`
             <div class="connection-results">
                 ${a.map(r=>`
                     <div class="connection-result ${r.success?"success":"error"}">
@@ -792,7 +792,7 @@ var F=class{constructor(e=null){this.token=null,this.i18n=e,this.requestLocks={i
                     </div>
                 `).join("")}
             </div>
-        `:""}}function Ae(){let n=["smtp-server","smtp-port","smtp-user","smtp-password","smtp-sender"],e=document.getElementById("smtp-test-btn"),t=()=>{let s=n.every(a=>{let r=document.getElementById(a);return r&&r.value.trim()!==""});e&&(e.disabled=!s)};n.forEach(s=>{let a=document.getElementById(s);a&&(a.addEventListener("input",t),a.addEventListener("blur",t))}),t()}function pe(n,{config:e,navigation:t,ui:s,apiClient:a,i18n:r}){let o=e.get("smtp");n.innerHTML=`
+        `:""}}function Me(){let n=["smtp-server","smtp-port","smtp-user","smtp-password","smtp-sender"],e=document.getElementById("smtp-test-btn"),t=()=>{let s=n.every(a=>{let r=document.getElementById(a);return r&&r.value.trim()!==""});e&&(e.disabled=!s)};n.forEach(s=>{let a=document.getElementById(s);a&&(a.addEventListener("input",t),a.addEventListener("blur",t))}),t()}function ge(n,{config:e,navigation:t,ui:s,apiClient:a,i18n:r}){let o=e.get("smtp");n.innerHTML=`
             <form id="smtp-form" class="form-section" novalidate>
                 <h3 data-i18n="setup.smtp.title"></h3>
                 <p style="margin-bottom: 1.5rem; color: var(--gray-600);" data-i18n="setup.smtp.description"></p>
@@ -888,7 +888,7 @@ var F=class{constructor(e=null){this.token=null,this.i18n=e,this.requestLocks={i
                     <button type="submit" class="btn btn-primary" data-i18n="common.next"></button>
                 </div>
             </form>
-        `,document.getElementById("smtp-prev-btn").addEventListener("click",()=>{t.previousStep()});let d=document.getElementById("smtp-password");d&&o.password&&(d.value=o.password),Ae(),document.getElementById("smtp-form").addEventListener("submit",async l=>{l.preventDefault(),l.target.checkValidity()?(e.set("smtp",{server:document.getElementById("smtp-server").value,port:parseInt(document.getElementById("smtp-port").value),user:document.getElementById("smtp-user").value,password:document.getElementById("smtp-password").value,sender:document.getElementById("smtp-sender").value}),e.saveToLocalCache(),await e.saveWithValidation()):k(l.target)});let i=document.getElementById("smtp-test-btn");i&&i.addEventListener("click",()=>qe(a,e,s,r)),E(n)}function R(n,e){let t=document.getElementById("geo-file-info"),s=document.querySelector("#geo-upload-area .file-upload-content");if(!t||!s)return;let a=n.get("goaccess");if(a.has_geo_file&&a.geo_file_temp_path){s.style.display="none",t.style.display="block";let r=a.original_file_name||a.geo_file_temp_path.split("/").pop(),o=a.file_size,d=t.querySelector("#geo-file-name"),i=t.querySelector("#geo-file-size");if(d&&(d.textContent=r),i){let p=e?e.t("common.unknown"):"Unknown";i.textContent=typeof o=="number"&&o>0?N(o,e):p}let l=t.querySelector("#geo-upload-progress");if(l&&l.remove(),!t.querySelector("#geo-upload-progress")){let p=e?e.t("setup.app.jwt_upload_success"):"Upload successful!",m=document.createElement("p");m.id="geo-upload-progress",m.textContent=p,m.style.color="var(--success-color)",t.appendChild(m)}}else s.style.display="block",t.style.display="none"}async function Fe(n,e,t){try{let s=await n.getGeoFileStatus();if(s.success&&s.data){let{exists:a,file_name:r,file_size:o,temp_path:d}=s.data,i=e.get("goaccess");i.has_geo_file&&!a?(console.log("GeoIP file cache inconsistent with actual file status, resetting..."),i.has_geo_file=!1,i.geo_file_temp_path="",i.original_file_name="",i.file_size=0,e.set("goaccess",i),e.saveToLocalCache(),R(e,t)):!i.has_geo_file&&a&&(console.log("Found GeoIP file but cache shows no file, updating cache..."),i.has_geo_file=!0,i.geo_file_temp_path=d,i.original_file_name=r,i.file_size=o,e.set("goaccess",i),e.saveToLocalCache(),R(e,t))}}catch(s){console.warn("Failed to check GeoIP file status:",s)}}async function ce(n,e,t,s,a){let r=s||document.getElementById("geo-file-info"),o=document.getElementById("geo-upload-area");try{if(!await n.protectedApiCall("geoFileUpload",async()=>{if(!r){console.error("fileInfoDiv is null in handleGeoFileSelect");return}if(!t.name.endsWith(".mmdb")){let c=a?a.t("setup.goaccess.invalid_file_type"):"Please select a valid .mmdb file";alert(c);return}let i=100*1024*1024;if(t.size>i){let c=a?a.t("setup.goaccess.file_too_large"):"File size too large. Maximum allowed size is 100MB";alert(c);return}if(o){let c=o.closest(".form-group");if(c){c.classList.remove("error");let g=c.querySelector(".invalid-feedback");g&&(g.style.display="none",g.textContent="")}}let l=document.querySelector("#geo-upload-area .file-upload-content");l&&(l.style.display="none"),o&&(o.style.pointerEvents="none",o.style.opacity="0.6"),r.style.display="block",r.querySelector("#geo-file-name").textContent=t.name,r.querySelector("#geo-file-size").textContent=N(t.size,a);let p=r.querySelector("#geo-upload-progress");p&&p.remove();let m=a?a.t("setup.app.jwt_uploading"):"Uploading...",v=document.createElement("p");v.id="geo-upload-progress",v.textContent=m,r.appendChild(v);let u=await n.uploadGeoFile(t);if(u.success){let c=r.querySelector("#geo-upload-progress");if(c){let y=a?a.t("setup.app.jwt_upload_success"):"Upload successful!";c.textContent=y,c.style.color="var(--success-color)"}let g=e.get("goaccess");return g.has_geo_file=!0,g.geo_file_temp_path=u.data.temp_path,g.original_file_name=t.name,g.file_size=t.size,e.set("goaccess",g),o&&(o.style.pointerEvents="",o.style.opacity=""),u}else{let c=a?a.t("messages.errors.upload_failed"):"Upload failed";throw new Error(u.message||c)}}))return}catch(d){if(console.error("File upload error:",d),r){let l=r.querySelector("#geo-upload-progress");if(l){let p=a?a.t("setup.app.jwt_upload_failed"):"Upload failed";l.textContent=`${p}: ${d.message}`,l.style.color="var(--error-color)"}}o&&(o.style.pointerEvents="",o.style.opacity="");let i=e.get("goaccess");i.has_geo_file=!1,e.set("goaccess",i),setTimeout(()=>{ue()},2e3)}}function ue(){let n=document.getElementById("geo-file-info"),e=document.querySelector("#geo-upload-area .file-upload-content");if(n&&e){n.style.display="none",e.style.display="block";let t=document.getElementById("goaccess-geo-file");t&&(t.value="")}}function Ve(n,e,t){let s=!0;B(e);let a=e.querySelector("#goaccess-enabled").checked,r=n.get("goaccess");if(a&&(!r.has_geo_file||r.has_geo_file&&!r.geo_file_temp_path)){s=!1;let o=e.querySelector("#geo-upload-area"),d;r.has_geo_file?d=t?t.t("setup.goaccess.geo_file_missing"):"GeoIP database file is no longer available. Please re-upload your GeoIP database file.":d=t?t.t("setup.goaccess.geo_file_required"):"GeoIP database file is required when GoAccess is enabled",q(o,d)}return s}function me(n,{config:e,navigation:t,apiClient:s,i18n:a}){let r=e.get("goaccess");n.innerHTML=`
+        `,document.getElementById("smtp-prev-btn").addEventListener("click",()=>{t.previousStep()});let d=document.getElementById("smtp-password");d&&o.password&&(d.value=o.password),Me(),document.getElementById("smtp-form").addEventListener("submit",async l=>{l.preventDefault(),l.target.checkValidity()?(e.set("smtp",{server:document.getElementById("smtp-server").value,port:parseInt(document.getElementById("smtp-port").value),user:document.getElementById("smtp-user").value,password:document.getElementById("smtp-password").value,sender:document.getElementById("smtp-sender").value}),e.saveToLocalCache(),await e.saveWithValidation()):E(l.target)});let i=document.getElementById("smtp-test-btn");i&&i.addEventListener("click",()=>ze(a,e,s,r)),k(n)}function R(n,e){let t=document.getElementById("geo-file-info"),s=document.querySelector("#geo-upload-area .file-upload-content");if(!t||!s)return;let a=n.get("goaccess");if(a.has_geo_file&&a.geo_file_temp_path){s.style.display="none",t.style.display="block";let r=a.original_file_name||a.geo_file_temp_path.split("/").pop(),o=a.file_size,d=t.querySelector("#geo-file-name"),i=t.querySelector("#geo-file-size");if(d&&(d.textContent=r),i){let p=e?e.t("common.unknown"):"Unknown";i.textContent=typeof o=="number"&&o>0?H(o,e):p}let l=t.querySelector("#geo-upload-progress");if(l&&l.remove(),!t.querySelector("#geo-upload-progress")){let p=e?e.t("setup.app.jwt_upload_success"):"Upload successful!",m=document.createElement("p");m.id="geo-upload-progress",m.textContent=p,m.style.color="var(--success-color)",t.appendChild(m)}}else s.style.display="block",t.style.display="none"}async function De(n,e,t){try{let s=await n.getGeoFileStatus();if(s.success&&s.data){let{exists:a,file_name:r,file_size:o,temp_path:d}=s.data,i=e.get("goaccess");i.has_geo_file&&!a?(console.log("GeoIP file cache inconsistent with actual file status, resetting..."),i.has_geo_file=!1,i.geo_file_temp_path="",i.original_file_name="",i.file_size=0,e.set("goaccess",i),e.saveToLocalCache(),R(e,t)):!i.has_geo_file&&a&&(console.log("Found GeoIP file but cache shows no file, updating cache..."),i.has_geo_file=!0,i.geo_file_temp_path=d,i.original_file_name=r,i.file_size=o,e.set("goaccess",i),e.saveToLocalCache(),R(e,t))}}catch(s){console.warn("Failed to check GeoIP file status:",s)}}async function he(n,e,t,s,a){let r=s||document.getElementById("geo-file-info"),o=document.getElementById("geo-upload-area");try{if(!await n.protectedApiCall("geoFileUpload",async()=>{if(!r){console.error("fileInfoDiv is null in handleGeoFileSelect");return}if(!t.name.endsWith(".mmdb")){let c=a?a.t("setup.goaccess.invalid_file_type"):"Please select a valid .mmdb file";alert(c);return}let i=100*1024*1024;if(t.size>i){let c=a?a.t("setup.goaccess.file_too_large"):"File size too large. Maximum allowed size is 100MB";alert(c);return}if(o){let c=o.closest(".form-group");if(c){c.classList.remove("error");let g=c.querySelector(".invalid-feedback");g&&(g.style.display="none",g.textContent="")}}let l=document.querySelector("#geo-upload-area .file-upload-content");l&&(l.style.display="none"),o&&(o.style.pointerEvents="none",o.style.opacity="0.6"),r.style.display="block",r.querySelector("#geo-file-name").textContent=t.name,r.querySelector("#geo-file-size").textContent=H(t.size,a);let p=r.querySelector("#geo-upload-progress");p&&p.remove();let m=a?a.t("setup.app.jwt_uploading"):"Uploading...",v=document.createElement("p");v.id="geo-upload-progress",v.textContent=m,r.appendChild(v);let u=await n.uploadGeoFile(t);if(u.success){let c=r.querySelector("#geo-upload-progress");if(c){let y=a?a.t("setup.app.jwt_upload_success"):"Upload successful!";c.textContent=y,c.style.color="var(--success-color)"}let g=e.get("goaccess");return g.has_geo_file=!0,g.geo_file_temp_path=u.data.temp_path,g.original_file_name=t.name,g.file_size=t.size,e.set("goaccess",g),o&&(o.style.pointerEvents="",o.style.opacity=""),u}else{let c=a?a.t("messages.errors.upload_failed"):"Upload failed";throw new Error(u.message||c)}}))return}catch(d){if(console.error("File upload error:",d),r){let l=r.querySelector("#geo-upload-progress");if(l){let p=a?a.t("setup.app.jwt_upload_failed"):"Upload failed";l.textContent=`${p}: ${d.message}`,l.style.color="var(--error-color)"}}o&&(o.style.pointerEvents="",o.style.opacity="");let i=e.get("goaccess");i.has_geo_file=!1,e.set("goaccess",i),setTimeout(()=>{fe()},2e3)}}function fe(){let n=document.getElementById("geo-file-info"),e=document.querySelector("#geo-upload-area .file-upload-content");if(n&&e){n.style.display="none",e.style.display="block";let t=document.getElementById("goaccess-geo-file");t&&(t.value="")}}function Ge(n,e,t){let s=!0;B(e);let a=e.querySelector("#goaccess-enabled").checked,r=n.get("goaccess");if(a&&(!r.has_geo_file||r.has_geo_file&&!r.geo_file_temp_path)){s=!1;let o=e.querySelector("#geo-upload-area"),d;r.has_geo_file?d=t?t.t("setup.goaccess.geo_file_missing"):"GeoIP database file is no longer available. Please re-upload your GeoIP database file.":d=t?t.t("setup.goaccess.geo_file_required"):"GeoIP database file is required when GoAccess is enabled",$(o,d)}return s}function ve(n,{config:e,navigation:t,apiClient:s,i18n:a}){let r=e.get("goaccess");n.innerHTML=`
             <form id="goaccess-form" class="form-section" novalidate>
                 <h3 data-i18n="setup.goaccess.title"></h3>
                 <p style="margin-bottom: 1.5rem; color: var(--gray-600);" data-i18n="setup.goaccess.description"></p>
@@ -937,7 +937,7 @@ var F=class{constructor(e=null){this.token=null,this.i18n=e,this.requestLocks={i
                     </button>
                 </div>
             </form>
-        `,document.getElementById("goaccess-prev-btn").addEventListener("click",()=>{t.previousStep()});let o=n.querySelector("#goaccess-enabled"),d=n.querySelector("#goaccess-config"),i=n.querySelector("#goaccess-geo-file"),l=n.querySelector("#geo-upload-area"),p=n.querySelector("#file-info");o.addEventListener("change",u=>{d.style.display=u.target.checked?"block":"none";let c=e.get("goaccess");if(c.enabled=u.target.checked,e.set("goaccess",c),!u.target.checked){let g=l.closest(".form-group");if(g){g.classList.remove("error");let y=g.querySelector(".invalid-feedback");y&&(y.style.display="none",y.textContent="")}}}),l.addEventListener("dragover",u=>{u.preventDefault(),l.classList.add("drag-over")}),l.addEventListener("dragleave",u=>{u.preventDefault(),l.classList.remove("drag-over")}),l.addEventListener("drop",u=>{if(u.preventDefault(),l.classList.remove("drag-over"),s.requestLocks.geoFileUpload){let g=a?a.t("messages.upload_in_progress"):"File upload in progress...";alert(g);return}let c=u.dataTransfer.files;c.length>0&&ce(s,e,c[0],p,a)});let m=n.querySelector("#geo-file-select-btn");m&&m.addEventListener("click",()=>{if(s.requestLocks.geoFileUpload){let u=a?a.t("messages.upload_in_progress"):"File upload in progress...";alert(u);return}i.click()});let v=n.querySelector("#geo-reselect-btn");v&&v.addEventListener("click",()=>{ue()}),i.addEventListener("change",u=>{if(u.target.files.length>0){if(s.requestLocks.geoFileUpload){let c=a?a.t("messages.upload_in_progress"):"File upload in progress...";alert(c),u.target.value="";return}ce(s,e,u.target.files[0],p,a)}}),n.querySelector("#goaccess-form").addEventListener("submit",u=>{if(u.preventDefault(),Ve(e,u.target,a)){let c=u.target,g=e.get("goaccess");g.enabled=c.querySelector("#goaccess-enabled").checked,e.set("goaccess",g),e.saveToLocalCache(),t.nextStep()}else k(u.target)}),Fe(s,e,a)}function Pe(n,e){try{let t=n.getAll(),s=e?e.t("setup.review.cors_configured",{count:t.app.cors_allow_origins.length}):`${t.app.cors_allow_origins.length} configured`,r=`
+        `,document.getElementById("goaccess-prev-btn").addEventListener("click",()=>{t.previousStep()});let o=n.querySelector("#goaccess-enabled"),d=n.querySelector("#goaccess-config"),i=n.querySelector("#goaccess-geo-file"),l=n.querySelector("#geo-upload-area"),p=n.querySelector("#file-info");o.addEventListener("change",u=>{d.style.display=u.target.checked?"block":"none";let c=e.get("goaccess");if(c.enabled=u.target.checked,e.set("goaccess",c),!u.target.checked){let g=l.closest(".form-group");if(g){g.classList.remove("error");let y=g.querySelector(".invalid-feedback");y&&(y.style.display="none",y.textContent="")}}}),l.addEventListener("dragover",u=>{u.preventDefault(),l.classList.add("drag-over")}),l.addEventListener("dragleave",u=>{u.preventDefault(),l.classList.remove("drag-over")}),l.addEventListener("drop",u=>{if(u.preventDefault(),l.classList.remove("drag-over"),s.requestLocks.geoFileUpload){let g=a?a.t("messages.upload_in_progress"):"File upload in progress...";alert(g);return}let c=u.dataTransfer.files;c.length>0&&he(s,e,c[0],p,a)});let m=n.querySelector("#geo-file-select-btn");m&&m.addEventListener("click",()=>{if(s.requestLocks.geoFileUpload){let u=a?a.t("messages.upload_in_progress"):"File upload in progress...";alert(u);return}i.click()});let v=n.querySelector("#geo-reselect-btn");v&&v.addEventListener("click",()=>{fe()}),i.addEventListener("change",u=>{if(u.target.files.length>0){if(s.requestLocks.geoFileUpload){let c=a?a.t("messages.upload_in_progress"):"File upload in progress...";alert(c),u.target.value="";return}he(s,e,u.target.files[0],p,a)}}),n.querySelector("#goaccess-form").addEventListener("submit",u=>{if(u.preventDefault(),Ge(e,u.target,a)){let c=u.target,g=e.get("goaccess");g.enabled=c.querySelector("#goaccess-enabled").checked,e.set("goaccess",g),e.saveToLocalCache(),t.nextStep()}else E(u.target)}),De(s,e,a)}function Ne(n,e){try{let t=n.getAll(),s=e?e.t("setup.review.cors_configured",{count:t.app.cors_allow_origins.length}):`${t.app.cors_allow_origins.length} configured`,r=`
             <h4 data-i18n="setup.review.sections.database"></h4>
             <p><strong data-i18n="setup.review.fields.service_type"></strong>: ${e?e.t(`setup.database.service_type_${t.database.service_type}`):t.database.service_type}</p>
             <p><strong data-i18n="setup.review.fields.host"></strong>: ${t.database.host}:${t.database.port}</p>
@@ -996,7 +996,7 @@ var F=class{constructor(e=null){this.token=null,this.i18n=e,this.requestLocks={i
             </div>
         `}catch(t){document.getElementById("config-review").innerHTML=`
             <div class="alert alert-error">${e?e.t("messages.failed_get_config"):"Failed to load configuration"}: ${t.message}</div>
-        `}e&&e.applyTranslations()}function ge(n,{config:e,navigation:t,setupService:s,i18n:a}){n.innerHTML=`
+        `}e&&e.applyTranslations()}function be(n,{config:e,navigation:t,setupService:s,i18n:a}){n.innerHTML=`
             <div class="form-section">
                 <h3 data-i18n="setup.review.title"></h3>
                 <p style="margin-bottom: 1.5rem; color: var(--gray-600);" data-i18n="setup.review.description"></p>
@@ -1012,7 +1012,7 @@ var F=class{constructor(e=null){this.token=null,this.i18n=e,this.requestLocks={i
                     <button class="btn btn-success" id="generate-config-btn" data-i18n="setup.review.generate_button"></button>
                 </div>
             </div>
-        `,document.getElementById("review-prev-btn").addEventListener("click",()=>{t.previousStep()}),document.getElementById("generate-config-btn").addEventListener("click",async()=>{await s.generateConfig()}),Pe(e,a)}function he(n,{config:e,setupService:t,i18n:s}){n.innerHTML=`
+        `,document.getElementById("review-prev-btn").addEventListener("click",()=>{t.previousStep()}),document.getElementById("generate-config-btn").addEventListener("click",async()=>{await s.generateConfig()}),Ne(e,a)}function ye(n,{config:e,setupService:t,i18n:s}){n.innerHTML=`
             <div class="form-section">
                 <h3 style="text-align: center;">
                     <span style="color: var(--success-color); margin-right: 0.5rem;">\u2713</span>
@@ -1026,7 +1026,7 @@ var F=class{constructor(e=null){this.token=null,this.i18n=e,this.requestLocks={i
                 </div>
 
             </div>
-        `,setTimeout(()=>{if(s){let a=t.outputPath||"./output",r=e.get("development")===!0,o={outputPath:a,composeFile:r?"docker-compose.development.yml":"docker-compose.production.yml",envFile:r?".env.development":".env.production"},d=document.getElementById("ready-notice"),i=document.getElementById("ready-description");if(d){let l=s.t("setup.config_complete.ready_notice",o);d.innerHTML=l,d.removeAttribute("data-i18n-html")}if(i){let p=s.t("setup.config_complete.ready_description",o).replace(/<code>([^<]*cd [^<]*)<\/code>/g,'<code class="complete-step-code">$1</code>');i.innerHTML=p,i.removeAttribute("data-i18n-html")}}},50)}var K=class{constructor(){this.currentStep=0,this.token=null,this.shouldAutoScroll=!0,this.i18n=new T,this.apiClient=new F(this.i18n),this.developmentMode=window.__BAKLAB_SETUP__?.development===!0;let e={development:this.developmentMode,database:{service_type:"docker",host:"localhost",port:5433,name:"baklab",user:"baklab",password:""},redis:{service_type:"docker",host:"localhost",port:6377,user:"",password:"",admin_password:""},smtp:{server:"",port:587,user:"",password:"",sender:""},app:{domain_name:this.developmentMode?"localhost":"",static_host_name:this.developmentMode?"localhost":"",user_guide_host_name:"",brand_name:"BakLab",default_lang:"en",version:"latest",debug:this.developmentMode,cors_allow_origins:[],session_secret:"",csrf_secret:"",jwt_key_file_path:"/host/path/to/jwt.pem",jwt_key_from_file:!1,original_file_name:"",file_size:0,cloudflare_site_key:"",cloudflare_secret:"",use_setup_domain:!1,frontend_decoupled:!1},oauth:{google_enabled:!1,google_client_id:"",google_client_secret:"",github_enabled:!1,github_client_id:"",github_client_secret:"",frontend_origin:""},admin_user:{username:"admin",email:"",password:""},goaccess:{enabled:!1,geo_db_path:"./geoip/GeoLite2-City.mmdb",has_geo_file:!1},ssl:{enabled:!1,cert_path:"",key_path:"",use_setup_cert:!1}};this.configStore=new V(e),this.steps=[{key:"welcome",titleKey:"setup.steps.welcome",handler:(t,s)=>te(t,s)},{key:"database",titleKey:"setup.steps.database",handler:(t,s)=>se(t,s)},{key:"redis",titleKey:"setup.steps.redis",handler:(t,s)=>le(t,s)},{key:"smtp",titleKey:"setup.steps.smtp",handler:(t,s)=>pe(t,s)},{key:"app",titleKey:"setup.steps.application",handler:(t,s)=>ne(t,s)},{key:"ssl",titleKey:"setup.steps.ssl",handler:(t,s)=>oe(t,s)},{key:"admin",titleKey:"setup.steps.admin_user",handler:(t,s)=>ae(t,s)},{key:"oauth",titleKey:"setup.steps.oauth",handler:(t,s)=>de(t,s)},{key:"goaccess",titleKey:"setup.steps.goaccess",handler:(t,s)=>me(t,s)},{key:"review",titleKey:"setup.steps.review",handler:(t,s)=>ge(t,s)},{key:"config_complete",titleKey:"setup.steps.config_complete",handler:(t,s)=>he(t,s)}],this.developmentMode&&(this.steps=this.steps.filter(t=>t.key!=="ssl")),this.navigation=new z(this.steps,()=>this.currentStep,t=>{this.currentStep=t,this.render()}),this.ui=new P(this.i18n),this.config=new M(this.configStore,this.navigation,this.apiClient,this.ui),this.setupService=new j(this.apiClient,this.navigation,this.ui,this.config,this.i18n),this.init()}get configData(){return this.configStore.getAll()}set configData(e){this.configStore.setAll(e)}async init(){this.setFavicon(),await this.i18n.init(),this.i18n.setLanguageChangeCallback(()=>this.render());try{this.loadFromLocalCache(),this.developmentMode&&(this.configStore.set("development",!0),this.configStore.set("ssl",{enabled:!1,cert_path:"",key_path:"",use_setup_cert:!1}));let t=new URLSearchParams(window.location.search).get("token");t&&(this.token=t,this.apiClient.setToken(t),this.currentStep=0,await this.checkAndLoadImportedConfig()),this.render()}catch(e){console.error("Initialization error:",e),this.render()}}render(){this.setFavicon();let e=document.getElementById("app"),t=this.steps[this.currentStep];e.innerHTML=`
+        `,setTimeout(()=>{if(s){let a=t.outputPath||"./output",r=e.get("development")===!0,o={outputPath:a,composeFile:r?"docker-compose.development.yml":"docker-compose.production.yml",envFile:r?".env.development":".env.production"},d=document.getElementById("ready-notice"),i=document.getElementById("ready-description");if(d){let l=s.t("setup.config_complete.ready_notice",o);d.innerHTML=l,d.removeAttribute("data-i18n-html")}if(i){let p=s.t("setup.config_complete.ready_description",o).replace(/<code>([^<]*cd [^<]*)<\/code>/g,'<code class="complete-step-code">$1</code>');i.innerHTML=p,i.removeAttribute("data-i18n-html")}}},50)}var J=class{constructor(){this.currentStep=0,this.shouldAutoScroll=!0,this.i18n=new T,this.apiClient=new F(this.i18n),this.developmentMode=window.__BAKLAB_SETUP__?.development===!0;let e={development:this.developmentMode,database:{service_type:"docker",host:"localhost",port:5433,name:"baklab",user:"baklab",password:""},redis:{service_type:"docker",host:"localhost",port:6377,user:"",password:"",admin_password:""},smtp:{server:"",port:587,user:"",password:"",sender:""},app:{domain_name:this.developmentMode?"localhost":"",static_host_name:this.developmentMode?"localhost":"",user_guide_host_name:"",brand_name:"BakLab",default_lang:"en",version:"latest",debug:this.developmentMode,cors_allow_origins:[],session_secret:"",csrf_secret:"",jwt_key_file_path:"/host/path/to/jwt.pem",jwt_key_from_file:!1,original_file_name:"",file_size:0,cloudflare_site_key:"",cloudflare_secret:"",use_setup_domain:!1,frontend_decoupled:!1},oauth:{google_enabled:!1,google_client_id:"",google_client_secret:"",github_enabled:!1,github_client_id:"",github_client_secret:"",frontend_origin:""},admin_user:{username:"admin",email:"",password:""},goaccess:{enabled:!1,geo_db_path:"./geoip/GeoLite2-City.mmdb",has_geo_file:!1},ssl:{enabled:!1,cert_path:"",key_path:"",use_setup_cert:!1}};this.configStore=new V(e),this.steps=[{key:"welcome",titleKey:"setup.steps.welcome",handler:(t,s)=>oe(t,s)},{key:"database",titleKey:"setup.steps.database",handler:(t,s)=>ne(t,s)},{key:"redis",titleKey:"setup.steps.redis",handler:(t,s)=>me(t,s)},{key:"smtp",titleKey:"setup.steps.smtp",handler:(t,s)=>ge(t,s)},{key:"app",titleKey:"setup.steps.application",handler:(t,s)=>pe(t,s)},{key:"ssl",titleKey:"setup.steps.ssl",handler:(t,s)=>le(t,s)},{key:"admin",titleKey:"setup.steps.admin_user",handler:(t,s)=>ie(t,s)},{key:"oauth",titleKey:"setup.steps.oauth",handler:(t,s)=>ue(t,s)},{key:"goaccess",titleKey:"setup.steps.goaccess",handler:(t,s)=>ve(t,s)},{key:"review",titleKey:"setup.steps.review",handler:(t,s)=>be(t,s)},{key:"config_complete",titleKey:"setup.steps.config_complete",handler:(t,s)=>ye(t,s)}],this.developmentMode&&(this.steps=this.steps.filter(t=>t.key!=="ssl")),this.navigation=new z(this.steps,()=>this.currentStep,t=>{this.currentStep=t,this.render()}),this.ui=new P(this.i18n),this.config=new M(this.configStore,this.navigation,this.apiClient,this.ui),this.setupService=new j(this.apiClient,this.navigation,this.ui,this.config,this.i18n),this.init()}get configData(){return this.configStore.getAll()}set configData(e){this.configStore.setAll(e)}async init(){this.setFavicon(),await this.i18n.init(),this.i18n.setLanguageChangeCallback(()=>this.render());try{this.loadFromLocalCache(),this.developmentMode&&(this.configStore.set("development",!0),this.configStore.set("ssl",{enabled:!1,cert_path:"",key_path:"",use_setup_cert:!1})),this.developmentMode||(this.currentStep=0,await this.checkAndLoadImportedConfig()),this.render()}catch(e){console.error("Initialization error:",e),this.render()}}render(){this.setFavicon();let e=document.getElementById("app"),t=this.steps[this.currentStep];e.innerHTML=`
             <div class="container">
                 <div class="sidebar">
                     <div class="sidebar-header">
@@ -1049,7 +1049,7 @@ var F=class{constructor(e=null){this.token=null,this.i18n=e,this.requestLocks={i
                     </div>
                 </div>
             </div>
-        `;let s=document.getElementById("step-content");t.handler(s,{config:this.config,navigation:this.navigation,ui:this.ui,apiClient:this.apiClient,setupService:this.setupService,i18n:this.i18n}),this.i18n.applyTranslations(),document.getElementById("language-switcher")&&this.i18n.generateLanguageSelector("language-switcher",{showLabel:!1,className:"language-selector",style:"dropdown"}),document.querySelectorAll(".sidebar-step[data-step-index]").forEach(r=>{r.addEventListener("click",()=>{let o=parseInt(r.getAttribute("data-step-index"));this.currentStep=o,this.render()})}),this.updateUploadStates()}renderSidebarSteps(){return`
+        `;let s=document.getElementById("step-content");t.handler(s,{config:this.config,navigation:this.navigation,ui:this.ui,apiClient:this.apiClient,setupService:this.setupService,i18n:this.i18n}),Y(this.apiClient.storedSecrets),this.i18n.applyTranslations(),document.getElementById("language-switcher")&&this.i18n.generateLanguageSelector("language-switcher",{showLabel:!1,className:"language-selector",style:"dropdown"}),document.querySelectorAll(".sidebar-step[data-step-index]").forEach(r=>{r.addEventListener("click",()=>{let o=parseInt(r.getAttribute("data-step-index"));this.currentStep=o,this.render()})}),this.updateUploadStates()}renderSidebarSteps(){return`
             <div class="sidebar-steps">
                 ${this.steps.map((e,t)=>`
                     <div class="sidebar-step ${t<this.currentStep?"completed":t===this.currentStep?"active":""}"
@@ -1061,4 +1061,4 @@ var F=class{constructor(e=null){this.token=null,this.i18n=e,this.requestLocks={i
                     </div>
                 `).join("")}
             </div>
-        `}loadFromLocalCache(){this.configStore.loadFromLocalCache()}async checkAndLoadImportedConfig(){try{let e=await this.apiClient.getStatus();if(e.success&&e.data&&e.data.revision_mode&&e.data.revision_mode.enabled){console.log("Revision mode detected, loading imported configuration...");let t=await this.apiClient.getConfig();t.success&&t.data&&(this.configStore.clearLocalCache(),this.configStore.setAll(t.data),this.developmentMode&&(this.configStore.set("development",!0),this.configStore.set("ssl",{enabled:!1,cert_path:"",key_path:"",use_setup_cert:!1})),this.config.saveToLocalCache())}}catch(e){console.warn("Failed to check or load imported configuration:",e)}}updateUploadStates(){R(this.config,this.i18n)}setFavicon(){document.querySelectorAll('link[rel="icon"], link[rel="shortcut icon"]').forEach(a=>a.remove());let t=document.createElement("link");t.rel="icon",t.type="image/x-icon",t.href="/static/favicon.ico",document.head.appendChild(t);let s=document.createElement("link");s.rel="icon",s.type="image/png",s.href="/static/logo-icon.png",document.head.appendChild(s)}};document.addEventListener("DOMContentLoaded",()=>{window.app=new K});
+        `}loadFromLocalCache(){this.configStore.loadFromLocalCache()}async checkAndLoadImportedConfig(){try{let e=await this.apiClient.getStatus();if(e.success&&e.data&&e.data.revision_mode&&e.data.revision_mode.enabled){console.log("Revision mode detected, loading imported configuration...");let t=await this.apiClient.getConfig();t.success&&t.data&&(this.configStore.clearLocalCache(),this.configStore.setAll(t.data),this.developmentMode&&(this.configStore.set("development",!0),this.configStore.set("ssl",{enabled:!1,cert_path:"",key_path:"",use_setup_cert:!1})),this.config.saveToLocalCache())}}catch(e){console.warn("Failed to check or load imported configuration:",e)}}updateUploadStates(){R(this.config,this.i18n)}setFavicon(){document.querySelectorAll('link[rel="icon"], link[rel="shortcut icon"]').forEach(a=>a.remove());let t=document.createElement("link");t.rel="icon",t.type="image/x-icon",t.href="/static/favicon.ico",document.head.appendChild(t);let s=document.createElement("link");s.rel="icon",s.type="image/png",s.href="/static/logo-icon.png",document.head.appendChild(s)}};document.addEventListener("DOMContentLoaded",()=>{window.app=new J});
@@ -1,7 +1,16 @@
+import { takeSecretPlaceholders, markUnchangedSecrets } from './secrets.js';
+
+// The setup session lives in an HttpOnly cookie; state-changing requests
+// echo the CSRF cookie in the X-CSRF-Token header.
+export function getCSRFToken() {
+    const match = document.cookie.match(/(?:^|;\s*)baklab_setup_csrf=([^;]*)/);
+    return match ? decodeURIComponent(match[1]) : '';
+}
+
 export class ApiClient {
     constructor(i18n = null) {
-        this.token = null;
         this.i18n = i18n;
+        this.storedSecrets = new Set();
         this.requestLocks = {
             initialize: false,
             complete: false,
@@ -18,10 +27,6 @@ export class ApiClient {
         this.i18n = i18n;
     }
 
-    setToken(token) {
-        this.token = token;
-    }
-
     async api(method, url, data = null) {
         const options = {
             method,
@@ -30,8 +35,8 @@ export class ApiClient {
             }
         };
 
-        if (this.token) {
-            options.headers['Setup-Token'] = this.token;
+        if (method !== 'GET') {
+            options.headers['X-CSRF-Token'] = getCSRFToken();
         }
 
         if (this.i18n && this.i18n.getCurrentLanguage) {
@@ -98,12 +103,16 @@ export class ApiClient {
     }
 
     async getConfig() {
-        return this.api('GET', '/api/config');
+        const result = await this.api('GET', '/api/config');
+        if (result.data) {
+            this.storedSecrets = takeSecretPlaceholders(result.data);
+        }
+        return result;
     }
 
     async saveConfig(config, step = null) {
         const payload = step !== null ? { ...config, current_step: step } : config;
-        return this.api('POST', '/api/config', payload);
+        return this.api('POST', '/api/config', markUnchangedSecrets(payload, this.storedSecrets));
     }
 
     async getGeoFileStatus() {
@@ -160,24 +169,18 @@ export class ApiClient {
             });
 
             xhr.open('POST', '/api/upload/geo-file');
-            if (this.token) {
-                xhr.setRequestHeader('Setup-Token', this.token);
-            }
+            xhr.setRequestHeader('X-CSRF-Token', getCSRFToken());
             xhr.send(formData);
         });
     }
 
     async getCurrentCertPaths() {
-        const response = await fetch('/api/current-cert-paths', {
-            headers: {
-                'Setup-Token': this.token
-            }
-        });
+        const response = await fetch('/api/current-cert-paths');
         return response.json();
     }
 
     async testConnections(type, config) {
-        return this.api('POST', '/api/test-connections', { type, ...config });
+        return this.api('POST', '/api/test-connections', markUnchangedSecrets({ type, ...config }, this.storedSecrets));
     }
 
     async generateConfig(config) {
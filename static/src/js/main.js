@@ -5,6 +5,7 @@ import { UI } from "./ui.js";
 import { Config } from "./config.js";
 import { SetupService } from "./setup-service.js";
 import { SetupI18n } from "./i18n.js";
+import { applyStoredSecretInputs } from "./secrets.js";
 import * as InitStep from "./steps/init.js";
 import * as DatabaseStep from "./steps/database.js";
 import * as AdminStep from "./steps/admin.js";
@@ -21,7 +22,6 @@ import * as ConfigCompleteStep from "./steps/config-complete.js";
 class SetupApp {
   constructor() {
     this.currentStep = 0;
-    this.token = null;
     this.shouldAutoScroll = true;
 
     this.i18n = new SetupI18n();
@@ -219,11 +219,7 @@ class SetupApp {
         });
       }
 
-      const urlParams = new URLSearchParams(window.location.search);
-      const urlToken = urlParams.get("token");
-      if (urlToken) {
-        this.token = urlToken;
-        this.apiClient.setToken(urlToken);
+      if (!this.developmentMode) {
         this.currentStep = 0;
 
         await this.checkAndLoadImportedConfig();
@@ -276,6 +272,7 @@ class SetupApp {
       setupService: this.setupService,
       i18n: this.i18n,
     });
+    applyStoredSecretInputs(this.apiClient.storedSecrets);
 
     this.i18n.applyTranslations();
 
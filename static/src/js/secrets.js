@@ -0,0 +1,79 @@
+// Secret config fields are write-only: GET /api/config returns {"set": true}
+// in their place, and a save sends {"unchanged": true} to keep the stored
+// value instead of the browser ever holding it.
+const SECRET_INPUTS = {
+    'database.super_password': ['db-super-password'],
+    'database.app_password': ['db-app-password'],
+    'redis.password': ['redis-password'],
+    'redis.admin_password': ['redis-admin-password'],
+    'smtp.password': ['smtp-password'],
+    'oauth.google_client_secret': ['google-client-secret'],
+    'oauth.github_client_secret': ['github-client-secret'],
+    'admin_user.password': ['admin-password', 'admin-password-confirm']
+};
+
+function isPlaceholder(value) {
+    return value !== null && typeof value === 'object' && !Array.isArray(value) &&
+        Object.keys(value).length === 1 && typeof value.set === 'boolean';
+}
+
+// takeSecretPlaceholders replaces the placeholders in config with empty
+// strings and returns the paths of the secrets that are set on the server.
+export function takeSecretPlaceholders(config, path = '', stored = new Set()) {
+    if (config === null || typeof config !== 'object') {
+        return stored;
+    }
+
+    for (const [key, value] of Object.entries(config)) {
+        const fieldPath = path ? `${path}.${key}` : key;
+        if (isPlaceholder(value)) {
+            if (value.set) {
+                stored.add(fieldPath);
+            }
+            config[key] = '';
+        } else {
+            takeSecretPlaceholders(value, fieldPath, stored);
+        }
+    }
+    return stored;
+}
+
+// markUnchangedSecrets returns a copy of config where every stored secret
+// that was left empty is sent as {"unchanged": true}.
+export function markUnchangedSecrets(config, stored) {
+    if (!stored || stored.size === 0) {
+        return config;
+    }
+
+    const result = JSON.parse(JSON.stringify(config));
+    for (const path of stored) {
+        const keys = path.split('.');
+        const lastKey = keys.pop();
+        let target = result;
+        for (const key of keys) {
+            target = target?.[key];
+        }
+        if (target && typeof target === 'object' && target[lastKey] === '') {
+            target[lastKey] = { unchanged: true };
+        }
+    }
+    return result;
+}
+
+// applyStoredSecretInputs lets the inputs of stored secrets stay empty, which
+// keeps the current value on save.
+export function applyStoredSecretInputs(stored) {
+    if (!stored) {
+        return;
+    }
+
+    for (const path of stored) {
+        for (const id of SECRET_INPUTS[path] || []) {
+            const field = document.getElementById(id);
+            if (field && field.value === '') {
+                field.required = false;
+                field.setAttribute('data-i18n-placeholder', 'common.secret_unchanged_placeholder');
+            }
+        }
+    }
+}
@@ -7,7 +7,6 @@ export class SetupService {
         this.ui = ui;
         this.config = config;
         this.i18n = i18n;
-        this.token = null;
         this.outputPath = null;
     }
 
@@ -15,13 +14,6 @@ export class SetupService {
         try {
             const result = await this.apiClient.protectedApiCall('initialize', async () => {
                 const apiResult = await this.apiClient.initialize();
-                this.token = apiResult.data.token;
-                this.apiClient.setToken(this.token);
-
-                if (window.app) {
-                    window.app.token = this.token;
-                }
-
                 this.navigation.nextStep();
                 return apiResult;
             }, (error) => {
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"golang.org/x/term"
+
+	"github.com/biliqiqi/baklab-setup/internal/storage"
+)
+
+const storageKeyEnv = "BAKLAB_STORAGE_KEY"
+
+// openSetupStorage opens the storage backend and, when a storage key is
+// supplied through keyFile, the BAKLAB_STORAGE_KEY environment variable or an
+// interactive prompt, encrypts the configuration draft and token at rest.
+func openSetupStorage(backend, dataDirPath, keyFile string, prompt bool) (storage.Storage, error) {
+	secret, err := resolveStorageKey(keyFile, prompt)
+	if err != nil {
+		return nil, err
+	}
+
+	if secret == nil {
+		return storage.New(backend, dataDirPath)
+	}
+
+	if backend != "" && backend != storage.BackendJSON {
+		return nil, fmt.Errorf("at-rest encryption is only supported by the '%s' storage backend", storage.BackendJSON)
+	}
+
+	jsonStorage := storage.NewJSONStorage(dataDirPath)
+	storageCipher, err := storage.OpenCipher(dataDirPath, secret)
+	if err != nil {
+		return nil, err
+	}
+	if err := jsonStorage.SetCipher(storageCipher); err != nil {
+		return nil, err
+	}
+
+	return jsonStorage, nil
+}
+
+func resolveStorageKey(keyFile string, prompt bool) ([]byte, error) {
+	if keyFile != "" {
+		data, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read storage key file: %w", err)
+		}
+		secret := bytes.TrimSpace(data)
+		if len(secret) == 0 {
+			return nil, fmt.Errorf("storage key file is empty: %s", keyFile)
+		}
+		return secret, nil
+	}
+
+	if envKey := os.Getenv(storageKeyEnv); envKey != "" {
+		return []byte(envKey), nil
+	}
+
+	if !prompt {
+		return nil, nil
+	}
+
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return nil, fmt.Errorf("-encrypt-storage needs an interactive terminal; use -storage-key-file or %s instead", storageKeyEnv)
+	}
+
+	fmt.Fprint(os.Stderr, "Storage passphrase: ")
+	secret, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read storage passphrase: %w", err)
+	}
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("storage passphrase is empty")
+	}
+
+	return secret, nil
+}
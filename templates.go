@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/biliqiqi/baklab-setup/internal/services"
+)
+
+// runTemplatesCommand lists the built-in templates or extracts them into a
+// directory, where they can be edited and used with -templates-dir.
+func runTemplatesCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: templates list|extract [flags]")
+	}
+
+	switch args[0] {
+	case "list":
+		return runTemplatesList(args[1:])
+	case "extract":
+		return runTemplatesExtract(args[1:])
+	default:
+		return fmt.Errorf("unknown templates command: %s (expected list or extract)", args[0])
+	}
+}
+
+func builtinTemplates() (fs.FS, []string, error) {
+	builtin, err := fs.Sub(templatesFS, "templates")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get templates subdirectory: %w", err)
+	}
+
+	files, err := services.TemplateFiles(builtin)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return builtin, files, nil
+}
+
+func runTemplatesList(args []string) error {
+	listFlags := flag.NewFlagSet("templates list", flag.ExitOnError)
+	overrideDir := listFlags.String("templates-dir", "", "Show which templates this directory overrides")
+
+	if err := listFlags.Parse(args); err != nil {
+		return err
+	}
+
+	_, files, err := builtinTemplates()
+	if err != nil {
+		return err
+	}
+
+	if *overrideDir == "" {
+		for _, file := range files {
+			fmt.Println(file)
+		}
+		return nil
+	}
+
+	overrides, err := services.TemplateFiles(os.DirFS(*overrideDir))
+	if err != nil {
+		return err
+	}
+	overridden := map[string]bool{}
+	for _, file := range overrides {
+		overridden[file] = true
+	}
+
+	for _, file := range files {
+		status := "built-in"
+		if overridden[file] {
+			status = "overridden"
+			delete(overridden, file)
+		}
+		fmt.Printf("%s\t%s\n", file, status)
+	}
+
+	// Files that match no template are usually misspelled overrides, or
+	// compose templates left over from before the compose file was built
+	// from the configuration.
+	for _, file := range overrides {
+		if !overridden[file] {
+			continue
+		}
+		if services.IsComposeTemplate(file) {
+			fmt.Printf("%s\tignored (the compose file is built from the configuration)\n", file)
+		} else {
+			fmt.Printf("%s\tunused\n", file)
+		}
+	}
+
+	return nil
+}
+
+func runTemplatesExtract(args []string) error {
+	extractFlags := flag.NewFlagSet("templates extract", flag.ExitOnError)
+	destDir := extractFlags.String("dir", "./templates", "Directory to write the templates to")
+	force := extractFlags.Bool("force", false, "Overwrite templates that already exist in the directory")
+
+	if err := extractFlags.Parse(args); err != nil {
+		return err
+	}
+
+	builtin, files, err := builtinTemplates()
+	if err != nil {
+		return err
+	}
+
+	// Optional arguments select templates by path or directory, e.g. caddy.
+	selected := files
+	if patterns := extractFlags.Args(); len(patterns) > 0 {
+		selected = nil
+		for _, pattern := range patterns {
+			pattern = strings.Trim(filepath.ToSlash(pattern), "/")
+			matched := false
+			for _, file := range files {
+				if file == pattern || strings.HasPrefix(file, pattern+"/") {
+					selected = append(selected, file)
+					matched = true
+				}
+			}
+			if !matched {
+				return fmt.Errorf("no template matches %s (see 'templates list')", pattern)
+			}
+		}
+	}
+
+	if !*force {
+		var existing []string
+		for _, file := range selected {
+			if _, err := os.Stat(filepath.Join(*destDir, file)); err == nil {
+				existing = append(existing, file)
+			} else if !errors.Is(err, fs.ErrNotExist) {
+				return fmt.Errorf("failed to check %s: %w", file, err)
+			}
+		}
+		if len(existing) > 0 {
+			return fmt.Errorf("templates already exist in %s: %s (use -force to overwrite)", *destDir, strings.Join(existing, ", "))
+		}
+	}
+
+	for _, file := range selected {
+		content, err := fs.ReadFile(builtin, file)
+		if err != nil {
+			return fmt.Errorf("failed to read template %s: %w", file, err)
+		}
+
+		dest := filepath.Join(*destDir, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %w", file, err)
+		}
+		if err := os.WriteFile(dest, content, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", dest, err)
+		}
+	}
+
+	log.Printf("Extracted %d templates to %s", len(selected), *destDir)
+	return nil
+}
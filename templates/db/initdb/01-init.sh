@@ -1,6 +1,11 @@
 #!/bin/bash
 set -e
 
+# Docker secrets deployments pass the application password as a file
+if [ -n "${APP_DB_PASSWORD_FILE}" ]; then
+    APP_DB_PASSWORD="$(cat "${APP_DB_PASSWORD_FILE}")"
+fi
+
 # Temporarily disable statement logging to prevent password leakage
 export PGCLIENTENCODING=UTF8
 
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/biliqiqi/baklab-setup/internal/model"
+	"github.com/biliqiqi/baklab-setup/internal/services"
+	"github.com/biliqiqi/baklab-setup/internal/storage"
+	"github.com/biliqiqi/baklab-setup/internal/utils"
+)
+
+// runTokenCommand creates, lists or revokes named setup tokens, which let
+// other people use the setup server with a limited role. With json storage
+// it works while the server runs: both hold the token lock only while they
+// change tokens. A bolt database is locked by the server, which must be
+// stopped first.
+func runTokenCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: token create|list|revoke [flags]")
+	}
+
+	switch args[0] {
+	case "create":
+		return runTokenCreate(args[1:])
+	case "list":
+		return runTokenList(args[1:])
+	case "revoke":
+		return runTokenRevoke(args[1:])
+	default:
+		return fmt.Errorf("unknown token command: %s (expected create, list or revoke)", args[0])
+	}
+}
+
+type tokenStorageFlags struct {
+	dataPath    *string
+	storageType *string
+	keyFile     *string
+}
+
+func addTokenStorageFlags(flags *flag.FlagSet) tokenStorageFlags {
+	return tokenStorageFlags{
+		dataPath:    flags.String("data", "./data", "Directory to store setup data"),
+		storageType: flags.String("storage", storage.BackendJSON, "Setup data storage backend: 'json' or 'bolt'"),
+		keyFile:     flags.String("storage-key-file", "", "File holding the passphrase that encrypts setup data at rest (json storage only, or set BAKLAB_STORAGE_KEY)"),
+	}
+}
+
+// withTokenService runs fn with a setup service on the data directory.
+// The data directory lock is not taken, since a running server holds it;
+// token changes take the token lock instead.
+func withTokenService(f tokenStorageFlags, fn func(*services.SetupService) error) error {
+	if *f.storageType == storage.BackendMemory {
+		return fmt.Errorf("setup tokens cannot be managed with the '%s' storage backend", storage.BackendMemory)
+	}
+
+	setupStorage, err := openSetupStorage(*f.storageType, *f.dataPath, *f.keyFile, false)
+	if err != nil {
+		if *f.storageType == storage.BackendBolt {
+			return fmt.Errorf("failed to open setup storage (stop the setup server first): %w", err)
+		}
+		return fmt.Errorf("failed to open setup storage: %w", err)
+	}
+	defer utils.Close(setupStorage, "setup storage")
+
+	setupService := services.NewSetupService(setupStorage)
+	if *f.storageType == storage.BackendJSON {
+		setupService.SetTokenLockDir(*f.dataPath)
+	}
+	if err := setupService.MigrateSetupToken(); err != nil {
+		return fmt.Errorf("failed to migrate setup token: %w", err)
+	}
+	return fn(setupService)
+}
+
+func runTokenCreate(args []string) error {
+	createFlags := flag.NewFlagSet("token create", flag.ExitOnError)
+	label := createFlags.String("label", "", "Name of the token, e.g. the person it is for (required)")
+	role := createFlags.String("role", string(model.TokenRoleViewer), "Role of the token: 'viewer', 'section-editor' or 'admin'")
+	sections := createFlags.String("sections", "", "Comma-separated configuration sections a section-editor may change, e.g. 'database'")
+	expires := createFlags.Duration("expires", 8*time.Hour, "How long the token stays valid")
+	ip := createFlags.String("ip", "first-use", "Client IP the token is bound to: 'first-use' to bind it on first use, 'any' or an IP address")
+	domain := createFlags.String("domain", "", "Domain of the setup server, to print the access URL")
+	port := createFlags.String("port", "8443", "Port of the setup server, to print the access URL")
+	storageFlags := addTokenStorageFlags(createFlags)
+
+	if err := createFlags.Parse(args); err != nil {
+		return err
+	}
+
+	opts := services.TokenOptions{
+		Label:    *label,
+		Role:     model.TokenRole(*role),
+		Sections: parseList(*sections),
+		TTL:      *expires,
+	}
+	switch *ip {
+	case "first-use":
+		opts.IPAddress = "0.0.0.0"
+	case "any":
+	default:
+		addr, err := netip.ParseAddr(*ip)
+		if err != nil {
+			return fmt.Errorf("invalid -ip value: %s (must be 'first-use', 'any' or an IP address)", *ip)
+		}
+		opts.IPAddress = addr.Unmap().String()
+	}
+
+	return withTokenService(storageFlags, func(setupService *services.SetupService) error {
+		token, err := setupService.CreateSetupToken(opts)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Created %s token %q (ID %s)\n", token.EffectiveRole(), token.Label, token.ID)
+		if len(token.Sections) > 0 {
+			fmt.Printf("Sections: %s\n", strings.Join(token.Sections, ", "))
+		}
+		fmt.Printf("Token expires at: %s\n", token.ExpiresAt.Format("2006-01-02 15:04:05"))
+		if *domain != "" {
+			fmt.Printf("\nOne-time Access URL:\n   https://%s:%s?token=%s\n\n", *domain, *port, token.Token)
+		} else {
+			fmt.Printf("\nToken: %s\n\n", token.Token)
+		}
+		fmt.Printf("WARNING: The token is shown only once and can be used ONCE!\n")
+		return nil
+	})
+}
+
+func runTokenList(args []string) error {
+	listFlags := flag.NewFlagSet("token list", flag.ExitOnError)
+	storageFlags := addTokenStorageFlags(listFlags)
+
+	if err := listFlags.Parse(args); err != nil {
+		return err
+	}
+
+	return withTokenService(storageFlags, func(setupService *services.SetupService) error {
+		tokens, err := setupService.ListSetupTokens()
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tLABEL\tROLE\tSECTIONS\tIP\tEXPIRES\tSTATUS")
+		for _, token := range tokens {
+			status := "active"
+			switch {
+			case now.After(token.ExpiresAt):
+				status = "expired"
+			case token.Used:
+				status = "used"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				token.ID, token.Label, token.EffectiveRole(), orDash(strings.Join(token.Sections, ",")),
+				tokenIPLabel(token.IPAddress), token.ExpiresAt.Format("2006-01-02 15:04:05"), status)
+		}
+		return w.Flush()
+	})
+}
+
+func runTokenRevoke(args []string) error {
+	revokeFlags := flag.NewFlagSet("token revoke", flag.ExitOnError)
+	storageFlags := addTokenStorageFlags(revokeFlags)
+
+	if err := revokeFlags.Parse(args); err != nil {
+		return err
+	}
+	if revokeFlags.NArg() != 1 {
+		return fmt.Errorf("usage: token revoke [flags] <id or label>")
+	}
+
+	return withTokenService(storageFlags, func(setupService *services.SetupService) error {
+		token, err := setupService.RevokeSetupToken(revokeFlags.Arg(0))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Revoked %s token %q (ID %s)\n", token.EffectiveRole(), token.Label, token.ID)
+		return nil
+	})
+}
+
+func tokenIPLabel(ip string) string {
+	switch ip {
+	case "":
+		return "any"
+	case "0.0.0.0":
+		return "first-use"
+	}
+	return ip
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
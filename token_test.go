@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/biliqiqi/baklab-setup/internal/dirlock"
+	"github.com/biliqiqi/baklab-setup/internal/services"
+	"github.com/biliqiqi/baklab-setup/internal/storage"
+	"github.com/biliqiqi/baklab-setup/internal/utils"
+)
+
+func TestTokenCommandWorksWhileServerRuns(t *testing.T) {
+	dataDir := t.TempDir()
+
+	// The server holds the data directory lock for its whole lifetime.
+	dataLock, err := dirlock.Acquire(dataDir)
+	if err != nil {
+		t.Fatalf("Acquire() failed: %v", err)
+	}
+	defer utils.Close(dataLock, "data directory lock")
+
+	serverStorage, err := openSetupStorage(storage.BackendJSON, dataDir, "", false)
+	if err != nil {
+		t.Fatalf("openSetupStorage() failed: %v", err)
+	}
+	defer utils.Close(serverStorage, "setup storage")
+	server := services.NewSetupService(serverStorage)
+	server.SetTokenLockDir(dataDir)
+	console, err := server.InitializeSetup("0.0.0.0")
+	if err != nil {
+		t.Fatalf("InitializeSetup() failed: %v", err)
+	}
+
+	if err := runTokenCommand([]string{"create", "-label", "auditor", "-data", dataDir}); err != nil {
+		t.Fatalf("token create failed: %v", err)
+	}
+
+	tokens, err := server.ListSetupTokens()
+	if err != nil {
+		t.Fatalf("ListSetupTokens() failed: %v", err)
+	}
+	var created string
+	for _, token := range tokens {
+		if token.Label == "auditor" {
+			created = token.ID
+		}
+	}
+	if created == "" {
+		t.Fatalf("the server does not see the token created by the token command: %v", tokens)
+	}
+	if _, err := server.LookupSetupToken(console.ID); err != nil {
+		t.Errorf("the console token is gone after token create: %v", err)
+	}
+
+	if err := runTokenCommand([]string{"revoke", "-data", dataDir, "auditor"}); err != nil {
+		t.Fatalf("token revoke failed: %v", err)
+	}
+	if _, err := server.LookupSetupToken(created); err == nil {
+		t.Error("the server still accepts the revoked token")
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/text/language"
+
+	"github.com/biliqiqi/baklab-setup/internal/i18n"
+	"github.com/biliqiqi/baklab-setup/internal/model"
+	"github.com/biliqiqi/baklab-setup/internal/services"
+	"github.com/biliqiqi/baklab-setup/internal/storage"
+)
+
+// Exit codes of the validate subcommand. Exit code 1 is left to log.Fatal
+// for usage and I/O errors.
+const (
+	validateExitOK               = 0
+	validateExitInvalid          = 2
+	validateExitConnectionFailed = 3
+)
+
+// testAllConnections runs the connection tests of the validate command.
+// Tests replace it to avoid real connections.
+var testAllConnections = func(cfg *model.SetupConfig) []model.ConnectionTestResult {
+	return services.NewValidatorService().TestAllConnections(cfg)
+}
+
+// runValidateCommand checks a config.json with every validator rule, writes
+// the report to stdout and returns the process exit code.
+func runValidateCommand(args []string, stdout io.Writer) (int, error) {
+	validateFlags := flag.NewFlagSet("validate", flag.ExitOnError)
+	configPath := validateFlags.String("config", "", "Path to config.json (required)")
+	secretsPath := validateFlags.String("secrets", "", "Optional secrets or .env file using the same variable names as the generated .env")
+	format := validateFlags.String("format", "text", "Report format: 'text' or 'json'")
+	lang := validateFlags.String("lang", "en", "Language of the report messages: 'en' or 'zh-Hans'")
+	testConnections := validateFlags.Bool("test-connections", false, "Also test database, Redis and SMTP connections")
+	devFlag := validateFlags.Bool("dev", false, "Validate as a development deployment")
+
+	if err := validateFlags.Parse(args); err != nil {
+		return 0, err
+	}
+
+	if *configPath == "" {
+		return 0, fmt.Errorf("-config flag is required")
+	}
+
+	if *format != "text" && *format != "json" {
+		return 0, fmt.Errorf("invalid -format value: %s (must be 'text' or 'json')", *format)
+	}
+
+	langTag, err := language.Parse(*lang)
+	if err != nil {
+		return 0, fmt.Errorf("invalid -lang value: %s", *lang)
+	}
+
+	cfg, err := loadConfigFile(*configPath)
+	if err != nil {
+		return 0, err
+	}
+
+	setupService := services.NewSetupService(storage.NewMemoryStorage())
+	setupService.SetDevelopmentMode(resolveDevMode(*devFlag))
+
+	if *secretsPath != "" {
+		if err := setupService.LoadSecretsFile(cfg, *secretsPath); err != nil {
+			return 0, err
+		}
+	}
+
+	setupService.PrepareConfiguration(cfg)
+
+	validator := services.NewValidatorService()
+	validationErrors := validator.ValidateAll(cfg)
+
+	var results []model.ConnectionTestResult
+	if *testConnections {
+		results = testAllConnections(cfg)
+	}
+
+	localizer := i18n.NewI18nManager(language.English).GetLocalizer(langTag)
+	localizeReport(localizer, validationErrors, results)
+
+	exitCode := validateExitOK
+	if len(validationErrors) > 0 {
+		exitCode = validateExitInvalid
+	} else if hasFailedConnection(results) {
+		exitCode = validateExitConnectionFailed
+	}
+
+	if *format == "json" {
+		err = writeJSONReport(stdout, reportMessage(exitCode), validationErrors, results)
+	} else {
+		err = writeTextReport(stdout, reportMessage(exitCode), validationErrors, results)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to write report: %w", err)
+	}
+
+	return exitCode, nil
+}
+
+func loadConfigFile(configPath string) (*model.SetupConfig, error) {
+	configData, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	cfg, err := services.MigrateConfig(configData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config file: %w", err)
+	}
+
+	return cfg, nil
+}
+
+func localizeReport(localizer *i18n.I18nCustom, validationErrors []model.ValidationError, results []model.ConnectionTestResult) {
+	for i := range validationErrors {
+		validationErrors[i].Message = localizer.LocalizeKeyed(validationErrors[i].Message)
+	}
+	for i := range results {
+		results[i].Message = localizer.LocalizeKeyed(results[i].Message)
+	}
+}
+
+func hasFailedConnection(results []model.ConnectionTestResult) bool {
+	for _, result := range results {
+		if !result.Success {
+			return true
+		}
+	}
+	return false
+}
+
+func reportMessage(exitCode int) string {
+	switch exitCode {
+	case validateExitInvalid:
+		return "configuration validation failed"
+	case validateExitConnectionFailed:
+		return "connection test failed"
+	default:
+		return "configuration is valid"
+	}
+}
+
+func writeJSONReport(w io.Writer, message string, validationErrors []model.ValidationError, results []model.ConnectionTestResult) error {
+	response := model.SetupResponse{
+		Success: len(validationErrors) == 0 && !hasFailedConnection(results),
+		Message: message,
+		Errors:  validationErrors,
+	}
+	if results != nil {
+		response.Data = results
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(response)
+}
+
+func writeTextReport(w io.Writer, message string, validationErrors []model.ValidationError, results []model.ConnectionTestResult) error {
+	if _, err := fmt.Fprintf(w, "%s\n", message); err != nil {
+		return err
+	}
+
+	if len(validationErrors) > 0 {
+		if _, err := fmt.Fprintf(w, "\nValidation errors (%d):\n", len(validationErrors)); err != nil {
+			return err
+		}
+		for _, validationError := range validationErrors {
+			if _, err := fmt.Fprintf(w, "  %s: %s\n", validationError.Field, validationError.Message); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(results) > 0 {
+		if _, err := fmt.Fprintf(w, "\nConnection tests:\n"); err != nil {
+			return err
+		}
+		for _, result := range results {
+			status := "OK"
+			if !result.Success {
+				status = "FAIL"
+			}
+			if _, err := fmt.Fprintf(w, "  [%s] %s: %s\n", status, result.Service, result.Message); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/biliqiqi/baklab-setup/internal/model"
+)
+
+// validateReport is the JSON report of the validate command.
+type validateReport struct {
+	Success bool                         `json:"success"`
+	Message string                       `json:"message"`
+	Errors  []model.ValidationError      `json:"errors"`
+	Data    []model.ConnectionTestResult `json:"data"`
+}
+
+// stubConnections makes the validate command report the given connection
+// test results instead of connecting.
+func stubConnections(t *testing.T, success bool) {
+	t.Helper()
+	original := testAllConnections
+	t.Cleanup(func() { testAllConnections = original })
+
+	testAllConnections = func(cfg *model.SetupConfig) []model.ConnectionTestResult {
+		results := []model.ConnectionTestResult{
+			{Service: "database", Success: true, Message: "key:messages.database_connection_successful", TestedAt: time.Now()},
+			{Service: "redis", Success: success, TestedAt: time.Now()},
+		}
+		if !success {
+			results[1].Message = "connection refused"
+		}
+		return results
+	}
+}
+
+func runValidate(t *testing.T, config string, extraArgs ...string) (int, string) {
+	t.Helper()
+	configPath, secretsPath := writeApplyInputs(t, config, applyTestSecrets)
+
+	var stdout bytes.Buffer
+	args := append([]string{"-dev", "-config", configPath, "-secrets", secretsPath}, extraArgs...)
+	exitCode, err := runValidateCommand(args, &stdout)
+	if err != nil {
+		t.Fatalf("runValidateCommand() failed: %v", err)
+	}
+	return exitCode, stdout.String()
+}
+
+func decodeValidateReport(t *testing.T, output string) validateReport {
+	t.Helper()
+	var report validateReport
+	if err := json.Unmarshal([]byte(output), &report); err != nil {
+		t.Fatalf("report is not JSON: %v\n%s", err, output)
+	}
+	return report
+}
+
+func TestValidateCommandAcceptsValidConfig(t *testing.T) {
+	stubConnections(t, true)
+
+	exitCode, output := runValidate(t, applyTestConfig, "-test-connections", "-format", "json")
+	if exitCode != validateExitOK {
+		t.Fatalf("exit code = %d, want %d\n%s", exitCode, validateExitOK, output)
+	}
+
+	report := decodeValidateReport(t, output)
+	if !report.Success || report.Message != "configuration is valid" || len(report.Errors) != 0 {
+		t.Errorf("report = %+v, want success without errors", report)
+	}
+	if len(report.Data) != 2 || report.Data[0].Service != "database" || report.Data[0].Message == "key:messages.database_connection_successful" {
+		t.Errorf("connection results = %+v, want both services with localized messages", report.Data)
+	}
+
+	exitCode, output = runValidate(t, applyTestConfig)
+	if exitCode != validateExitOK || !strings.HasPrefix(output, "configuration is valid\n") {
+		t.Errorf("text report = %d %q, want %d and the valid message", exitCode, output, validateExitOK)
+	}
+}
+
+func TestValidateCommandRejectsInvalidConfig(t *testing.T) {
+	config := strings.Replace(applyTestConfig, `"email": "admin@example.com"`, `"email": "not-an-email"`, 1)
+
+	exitCode, output := runValidate(t, config, "-format", "json")
+	if exitCode != validateExitInvalid {
+		t.Fatalf("exit code = %d, want %d\n%s", exitCode, validateExitInvalid, output)
+	}
+
+	report := decodeValidateReport(t, output)
+	if report.Success || report.Message != "configuration validation failed" || report.Data != nil {
+		t.Errorf("report = %+v, want a failure without connection results", report)
+	}
+	found := false
+	for _, validationError := range report.Errors {
+		if validationError.Field == "admin_user.email" {
+			found = true
+		}
+		if strings.HasPrefix(validationError.Message, "key:") {
+			t.Errorf("error %s message %q is not localized", validationError.Field, validationError.Message)
+		}
+	}
+	if !found {
+		t.Errorf("errors = %+v, want one for admin_user.email", report.Errors)
+	}
+
+	exitCode, output = runValidate(t, config)
+	if exitCode != validateExitInvalid || !strings.Contains(output, "Validation errors (") || !strings.Contains(output, "admin_user.email: ") {
+		t.Errorf("text report = %d %q, want %d and the error list", exitCode, output, validateExitInvalid)
+	}
+}
+
+func TestValidateCommandReportsFailedConnection(t *testing.T) {
+	stubConnections(t, false)
+
+	exitCode, output := runValidate(t, applyTestConfig, "-test-connections", "-format", "json")
+	if exitCode != validateExitConnectionFailed {
+		t.Fatalf("exit code = %d, want %d\n%s", exitCode, validateExitConnectionFailed, output)
+	}
+
+	report := decodeValidateReport(t, output)
+	if report.Success || report.Message != "connection test failed" || len(report.Errors) != 0 {
+		t.Errorf("report = %+v, want a connection failure without validation errors", report)
+	}
+	if len(report.Data) != 2 || report.Data[1].Success || report.Data[1].Message != "connection refused" {
+		t.Errorf("connection results = %+v, want the failed redis test", report.Data)
+	}
+
+	exitCode, output = runValidate(t, applyTestConfig, "-test-connections")
+	if exitCode != validateExitConnectionFailed || !strings.Contains(output, "[FAIL] redis: connection refused") {
+		t.Errorf("text report = %d %q, want %d and the failed test", exitCode, output, validateExitConnectionFailed)
+	}
+}